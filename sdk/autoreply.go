@@ -0,0 +1,123 @@
+package wechat
+
+// 公众平台官网设置的自动回复，设置了服务器配置后官网的自动回复不再生效，可以通过 get_current_autoreply_info 读取
+//
+// 文档：https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Getting_Rules_for_Auto_Replies.html
+
+const (
+	GET_CURRENT_AUTOREPLY_INFO = "https://api.weixin.qq.com/cgi-bin/get_current_autoreply_info" // 获取公众号的自动回复规则
+
+	AUTOREPLY_MATCH_CONTAIN = "contain"    // 消息中含有该关键词
+	AUTOREPLY_MATCH_EQUAL   = "equal"      // 消息内容必须和关键词严格相同
+	AUTOREPLY_REPLY_ALL     = "reply_all"  // 全部回复
+	AUTOREPLY_REPLY_RANDOM  = "random_one" // 随机回复其中一条
+	AUTOREPLY_TYPE_TEXT     = "text"
+	AUTOREPLY_TYPE_IMG      = "img"
+	AUTOREPLY_TYPE_VOICE    = "voice"
+	AUTOREPLY_TYPE_VIDEO    = "video"
+	AUTOREPLY_TYPE_NEWS     = "news"
+)
+
+// AutoReplyNews 关键词回复中的图文
+type AutoReplyNews struct {
+	Title      string `json:"title"`
+	Author     string `json:"author"`
+	Digest     string `json:"digest"`
+	ShowCover  int    `json:"show_cover"`
+	CoverUrl   string `json:"cover_url"`
+	ContentUrl string `json:"content_url"`
+	SourceUrl  string `json:"source_url"`
+}
+
+// AutoReplyContent 回复内容，Type 为 text 时 Content 为文本，img、voice、video 时为 media_id，
+// news 时图文在 NewsInfo 中
+type AutoReplyContent struct {
+	Type     string `json:"type"`
+	Content  string `json:"content"`
+	NewsInfo *struct {
+		List []AutoReplyNews `json:"list"`
+	} `json:"news_info,omitempty"`
+}
+
+// AutoReplyKeyword 关键词，MatchMode 为 contain 或 equal
+type AutoReplyKeyword struct {
+	Type      string `json:"type"`
+	MatchMode string `json:"match_mode"`
+	Content   string `json:"content"`
+}
+
+// AutoReplyRule 关键词自动回复规则，ReplyMode 为 reply_all 或 random_one
+type AutoReplyRule struct {
+	RuleName        string             `json:"rule_name"`
+	CreateTime      int64              `json:"create_time"`
+	ReplyMode       string             `json:"reply_mode"`
+	KeywordListInfo []AutoReplyKeyword `json:"keyword_list_info"`
+	ReplyListInfo   []AutoReplyContent `json:"reply_list_info"`
+}
+
+// AutoReplyInfo 公众平台官网设置的自动回复
+type AutoReplyInfo struct {
+	IsAddFriendReplyOpen        int               `json:"is_add_friend_reply_open"`
+	IsAutoreplyOpen             int               `json:"is_autoreply_open"`
+	AddFriendAutoreplyInfo      *AutoReplyContent `json:"add_friend_autoreply_info,omitempty"`
+	MessageDefaultAutoreplyInfo *AutoReplyContent `json:"message_default_autoreply_info,omitempty"`
+	KeywordAutoreplyInfo        struct {
+		List []AutoReplyRule `json:"list"`
+	} `json:"keyword_autoreply_info"`
+}
+
+// GetCurrentAutoReplyInfo 获取公众号的自动回复规则
+//
+// 返回：
+// 成功返回 { "is_add_friend_reply_open":1, "is_autoreply_open":1, "add_friend_autoreply_info":{ "type":"text", "content":"Thanks for your attention!" },
+// "message_default_autoreply_info":{ "type":"text", "content":"Hello, this is autoreply!" },
+// "keyword_autoreply_info":{ "list":[ { "rule_name":"autoreply-news", "create_time":1423028166, "reply_mode":"reply_all",
+// "keyword_list_info":[ { "type":"text", "match_mode":"contain", "content":"news测试" } ],
+// "reply_list_info":[ { "type":"news", "news_info":{ "list":[ { "title":"it's news", "digest":"it's digest", "show_cover":1, "cover_url":COVER_URL, "content_url":CONTENT_URL, "source_url":"" } ] } } ] } ] } }
+func GetCurrentAutoReplyInfo(accessToken string) (AutoReplyInfo, error) {
+	var info AutoReplyInfo
+	resData, err := MakeGetReq(GET_CURRENT_AUTOREPLY_INFO, map[string]string{
+		"access_token": accessToken,
+	})
+	if err != nil {
+		return info, err
+	}
+
+	err = ParseResult(resData, &info)
+	return info, err
+}
+
+// CustomMessage 将官网的回复内容转换为客服消息格式，用于被动回复与客服消息
+func (c AutoReplyContent) CustomMessage() (CustomMessage, error) {
+	var msg CustomMessage
+	switch c.Type {
+	case AUTOREPLY_TYPE_TEXT:
+		msg.MsgType, msg.Text = REPLY_TYPE_TEXT, &CustomText{c.Content}
+	case AUTOREPLY_TYPE_IMG:
+		msg.MsgType, msg.Image = REPLY_TYPE_IMAGE, &CustomMedia{c.Content}
+	case AUTOREPLY_TYPE_VOICE:
+		msg.MsgType, msg.Voice = REPLY_TYPE_VOICE, &CustomMedia{c.Content}
+	case AUTOREPLY_TYPE_VIDEO:
+		msg.MsgType, msg.Video = REPLY_TYPE_VIDEO, &CustomVideo{MediaId: c.Content}
+	case AUTOREPLY_TYPE_NEWS:
+		if c.NewsInfo == nil || len(c.NewsInfo.List) == 0 {
+			return msg, ErrUnsupportedReply
+		}
+		news := &CustomNews{}
+		for _, item := range c.NewsInfo.List {
+			if len(news.Articles) == MAX_NEWS_ARTICLES {
+				break
+			}
+			news.Articles = append(news.Articles, NewsArticle{
+				Title:       item.Title,
+				Description: item.Digest,
+				PicUrl:      item.CoverUrl,
+				Url:         item.ContentUrl,
+			})
+		}
+		msg.MsgType, msg.News = REPLY_TYPE_NEWS, news
+	default:
+		return msg, ErrUnsupportedReply
+	}
+	return msg, nil
+}
@@ -0,0 +1,171 @@
+package wechat
+
+// 图文消息留言管理，msg_data_id 为群发或发布返回的 msg_data_id，index 为多图文中的第几篇，第一篇为0
+//
+// 文档：https://developers.weixin.qq.com/doc/offiaccount/Comments_management/Image_Comments_Management_Interface.html
+
+const (
+	COMMENT_OPEN         = "https://api.weixin.qq.com/cgi-bin/comment/open?access_token=ACCESS_TOKEN"         // 打开已群发文章评论
+	COMMENT_CLOSE        = "https://api.weixin.qq.com/cgi-bin/comment/close?access_token=ACCESS_TOKEN"        // 关闭已群发文章评论
+	COMMENT_LIST         = "https://api.weixin.qq.com/cgi-bin/comment/list?access_token=ACCESS_TOKEN"         // 查看指定文章的评论数据
+	COMMENT_MARKELECT    = "https://api.weixin.qq.com/cgi-bin/comment/markelect?access_token=ACCESS_TOKEN"    // 将评论标记精选
+	COMMENT_UNMARKELECT  = "https://api.weixin.qq.com/cgi-bin/comment/unmarkelect?access_token=ACCESS_TOKEN"  // 将评论取消精选
+	COMMENT_DELETE       = "https://api.weixin.qq.com/cgi-bin/comment/delete?access_token=ACCESS_TOKEN"       // 删除评论
+	COMMENT_REPLY_ADD    = "https://api.weixin.qq.com/cgi-bin/comment/reply/add?access_token=ACCESS_TOKEN"    // 回复评论
+	COMMENT_REPLY_DELETE = "https://api.weixin.qq.com/cgi-bin/comment/reply/delete?access_token=ACCESS_TOKEN" // 删除回复
+
+	COMMENT_TYPE_ALL     = 0 // 普通评论和精选评论
+	COMMENT_TYPE_NORMAL  = 1 // 普通评论
+	COMMENT_TYPE_ELECTED = 2 // 精选评论
+	MAX_COMMENT_LIST     = 50
+)
+
+// CommentReply 作者回复
+type CommentReply struct {
+	Content    string `json:"content"`
+	CreateTime int64  `json:"create_time"`
+}
+
+// Comment 用户评论，CommentType 为1时是精选评论
+type Comment struct {
+	UserCommentId int64         `json:"user_comment_id"`
+	OpenId        string        `json:"openid"`
+	CreateTime    int64         `json:"create_time"`
+	Content       string        `json:"content"`
+	CommentType   int           `json:"comment_type"`
+	Reply         *CommentReply `json:"reply,omitempty"`
+}
+
+// CommentList 评论列表
+type CommentList struct {
+	Total   int64     `json:"total"`
+	Comment []Comment `json:"comment"`
+}
+
+// OpenComment 打开已群发文章评论
+//
+//	参数：{
+//		  "msg_data_id":MSG_DATA_ID,
+//		  "index":INDEX
+//	}
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+// 失败返回 { "errcode":88000,"errmsg":"without comment privilege"}
+func OpenComment(accessToken string, msgDataId int64, index int) error {
+	return commentRequest(COMMENT_OPEN, accessToken, map[string]interface{}{
+		"msg_data_id": msgDataId,
+		"index":       index,
+	})
+}
+
+// CloseComment 关闭已群发文章评论
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func CloseComment(accessToken string, msgDataId int64, index int) error {
+	return commentRequest(COMMENT_CLOSE, accessToken, map[string]interface{}{
+		"msg_data_id": msgDataId,
+		"index":       index,
+	})
+}
+
+// GetComments 查看指定文章的评论数据
+//
+//	参数：{
+//		  "msg_data_id":MSG_DATA_ID,
+//		  "index":INDEX,
+//		  "begin":BEGIN,
+//		  "count":COUNT,
+//		  "type":TYPE
+//	}
+//
+// count 不超过50，type 为0普通评论和精选评论，1普通评论，2精选评论
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok", "total":TOTAL, "comment":[ { "user_comment_id":USER_COMMENT_ID, "openid":OPENID, "create_time":CREATE_TIME, "content":CONTENT, "comment_type":IS_ELECTED, "reply":{ "content":CONTENT, "create_time":CREATE_TIME } } ] }
+func GetComments(accessToken string, msgDataId int64, index int, begin int, count int, commentType int) (CommentList, error) {
+	var list CommentList
+	if count < 1 || count > MAX_COMMENT_LIST {
+		count = MAX_COMMENT_LIST
+	}
+
+	resData, err := MakePostReq(TokenUrl(COMMENT_LIST, accessToken), map[string]interface{}{
+		"msg_data_id": msgDataId,
+		"index":       index,
+		"begin":       begin,
+		"count":       count,
+		"type":        commentType,
+	}, "application/json")
+	if err != nil {
+		return list, err
+	}
+
+	err = ParseResult(resData, &list)
+	return list, err
+}
+
+// MarkElectComment 将评论标记精选
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func MarkElectComment(accessToken string, msgDataId int64, index int, userCommentId int64) error {
+	return commentRequest(COMMENT_MARKELECT, accessToken, commentParams(msgDataId, index, userCommentId))
+}
+
+// UnmarkElectComment 将评论取消精选
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func UnmarkElectComment(accessToken string, msgDataId int64, index int, userCommentId int64) error {
+	return commentRequest(COMMENT_UNMARKELECT, accessToken, commentParams(msgDataId, index, userCommentId))
+}
+
+// DeleteComment 删除评论
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func DeleteComment(accessToken string, msgDataId int64, index int, userCommentId int64) error {
+	return commentRequest(COMMENT_DELETE, accessToken, commentParams(msgDataId, index, userCommentId))
+}
+
+// ReplyComment 回复评论
+//
+//	参数：{
+//		  "msg_data_id":MSG_DATA_ID,
+//		  "index":INDEX,
+//		  "user_comment_id":COMMENT_ID,
+//		  "content":CONTENT
+//	}
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func ReplyComment(accessToken string, msgDataId int64, index int, userCommentId int64, content string) error {
+	params := commentParams(msgDataId, index, userCommentId)
+	params["content"] = content
+	return commentRequest(COMMENT_REPLY_ADD, accessToken, params)
+}
+
+// DeleteCommentReply 删除回复
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func DeleteCommentReply(accessToken string, msgDataId int64, index int, userCommentId int64) error {
+	return commentRequest(COMMENT_REPLY_DELETE, accessToken, commentParams(msgDataId, index, userCommentId))
+}
+
+func commentParams(msgDataId int64, index int, userCommentId int64) map[string]interface{} {
+	return map[string]interface{}{
+		"msg_data_id":     msgDataId,
+		"index":           index,
+		"user_comment_id": userCommentId,
+	}
+}
+
+func commentRequest(api string, accessToken string, params map[string]interface{}) error {
+	resData, err := MakePostReq(TokenUrl(api, accessToken), params, "application/json")
+	if err != nil {
+		return err
+	}
+	return ParseResult(resData, nil)
+}
@@ -0,0 +1,175 @@
+package wechat
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"strconv"
+)
+
+// 消息加解密(安全模式与兼容模式)，与官方 WXBizMsgCrypt 算法一致：
+//
+// msg_encrypt = Base64_Encode(AES_Encrypt[random(16B) + msg_len(4B) + msg + appid])
+// AES 采用 CBC 模式，密钥长度 32 字节，IV 为密钥前 16 字节，数据采用 PKCS#7 填充至 32 字节的倍数
+//
+// 文档：https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Message_encryption_and_decryption_instructions.html
+
+const (
+	ENCRYPT_MODE_PLAIN  = 0 // 明文模式
+	ENCRYPT_MODE_COMPAT = 1 // 兼容模式
+	ENCRYPT_MODE_SAFE   = 2 // 安全模式
+
+	pkcs7BlockSize = 32
+)
+
+var (
+	ErrInvalidAESKey       = errors.New("invalid EncodingAESKey")
+	ErrInvalidMsgSignature = errors.New("invalid msg_signature")
+	ErrInvalidCipherText   = errors.New("invalid cipher text")
+	ErrInvalidAppId        = errors.New("appid mismatch")
+)
+
+// CDATA 序列化为 <![CDATA[...]]> 的字符串
+type CDATA struct {
+	Value string `xml:",cdata"`
+}
+
+// EncryptedMessage 安全模式下推送与回复的消息体
+type EncryptedMessage struct {
+	XMLName      xml.Name `xml:"xml"`
+	ToUserName   *CDATA   `xml:"ToUserName,omitempty"`
+	Encrypt      CDATA    `xml:"Encrypt"`
+	MsgSignature *CDATA   `xml:"MsgSignature,omitempty"`
+	TimeStamp    string   `xml:"TimeStamp,omitempty"`
+	Nonce        *CDATA   `xml:"Nonce,omitempty"`
+}
+
+type MsgCrypt struct {
+	Token  string
+	AppId  string
+	aesKey []byte
+}
+
+// NewMsgCrypt
+//
+// 参数：
+// token			服务器配置中的令牌
+// encodingAESKey	服务器配置中的消息加解密密钥，43位字符
+// appId			公众号appid，解密时校验消息中的appid与之相同
+func NewMsgCrypt(token string, encodingAESKey string, appId string) (*MsgCrypt, error) {
+	if len(encodingAESKey) != 43 {
+		return nil, ErrInvalidAESKey
+	}
+	aesKey, err := base64.StdEncoding.DecodeString(encodingAESKey + "=")
+	if err != nil || len(aesKey) != 32 {
+		return nil, ErrInvalidAESKey
+	}
+	return &MsgCrypt{Token: token, AppId: appId, aesKey: aesKey}, nil
+}
+
+// Encrypt 加密明文消息，返回base64编码的密文
+func (c *MsgCrypt) Encrypt(msg []byte) (string, error) {
+	buf := make([]byte, 20, 20+len(msg)+len(c.AppId)+pkcs7BlockSize)
+	if _, err := rand.Read(buf[:16]); err != nil {
+		return "", err
+	}
+	binary.BigEndian.PutUint32(buf[16:20], uint32(len(msg)))
+	buf = append(buf, msg...)
+	buf = append(buf, c.AppId...)
+	buf = pkcs7Pad(buf, pkcs7BlockSize)
+
+	block, err := aes.NewCipher(c.aesKey)
+	if err != nil {
+		return "", err
+	}
+	cipher.NewCBCEncrypter(block, c.aesKey[:aes.BlockSize]).CryptBlocks(buf, buf)
+
+	return base64.StdEncoding.EncodeToString(buf), nil
+}
+
+// Decrypt 解密base64编码的密文，并校验其中的appid
+func (c *MsgCrypt) Decrypt(encrypt string) ([]byte, error) {
+	buf, err := base64.StdEncoding.DecodeString(encrypt)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) == 0 || len(buf)%aes.BlockSize != 0 {
+		return nil, ErrInvalidCipherText
+	}
+
+	block, err := aes.NewCipher(c.aesKey)
+	if err != nil {
+		return nil, err
+	}
+	cipher.NewCBCDecrypter(block, c.aesKey[:aes.BlockSize]).CryptBlocks(buf, buf)
+
+	buf, err = pkcs7Unpad(buf, pkcs7BlockSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < 20 {
+		return nil, ErrInvalidCipherText
+	}
+
+	msgLen := int(binary.BigEndian.Uint32(buf[16:20]))
+	if msgLen < 0 || 20+msgLen > len(buf) {
+		return nil, ErrInvalidCipherText
+	}
+	if string(buf[20+msgLen:]) != c.AppId {
+		return nil, ErrInvalidAppId
+	}
+
+	return buf[20 : 20+msgLen], nil
+}
+
+// DecryptMsg 校验 msg_signature 并解密推送的消息体，返回明文xml
+func (c *MsgCrypt) DecryptMsg(msgSignature string, timestamp string, nonce string, body []byte) ([]byte, error) {
+	var encrypted EncryptedMessage
+	if err := xml.Unmarshal(body, &encrypted); err != nil {
+		return nil, err
+	}
+	if encrypted.Encrypt.Value == "" {
+		return nil, ErrInvalidCipherText
+	}
+	if Signature(c.Token, timestamp, nonce, encrypted.Encrypt.Value) != msgSignature {
+		return nil, ErrInvalidMsgSignature
+	}
+	return c.Decrypt(encrypted.Encrypt.Value)
+}
+
+// EncryptMsg 加密被动回复的明文xml，返回带 msg_signature 的密文xml
+func (c *MsgCrypt) EncryptMsg(reply []byte, timestamp int64, nonce string) ([]byte, error) {
+	encrypt, err := c.Encrypt(reply)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := strconv.FormatInt(timestamp, 10)
+	return xml.Marshal(EncryptedMessage{
+		Encrypt:      CDATA{encrypt},
+		MsgSignature: &CDATA{Signature(c.Token, ts, nonce, encrypt)},
+		TimeStamp:    ts,
+		Nonce:        &CDATA{nonce},
+	})
+}
+
+func pkcs7Pad(data []byte, blockSize int) []byte {
+	padding := blockSize - len(data)%blockSize
+	return append(data, bytes.Repeat([]byte{byte(padding)}, padding)...)
+}
+
+func pkcs7Unpad(data []byte, blockSize int) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidCipherText
+	}
+	padding := int(data[len(data)-1])
+	if padding < 1 || padding > blockSize || padding > len(data) {
+		return nil, ErrInvalidCipherText
+	}
+	return data[:len(data)-padding], nil
+}
@@ -0,0 +1,143 @@
+package wechat
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// 官方 WXBizMsgCrypt 示例中的参数与密文，密文的16字节随机串为 aaaabbbbccccdddd
+const (
+	testCryptToken     = "pamtest"
+	testCryptAESKey    = "abcdefghijklmnopqrstuvwxyz0123456789ABCDEFG"
+	testCryptAppId     = "wxb11529c136998cb6"
+	testCryptTimestamp = "1409304348"
+	testCryptNonce     = "xxxxxx"
+
+	testCryptMsg     = "我是中文abcd123"
+	testCryptEncrypt = "jn1L23DB+6ELqJ+6bruv21Y6MD7KeIfP82D6gU39rmkgczbWwt5+3bnyg5K55bgVtVzd832WzZGMhkP72vVOfg=="
+
+	testCryptReply = "<xml><ToUserName><![CDATA[oia2Tj我是中文jewbmiOUlr6X-1crbLOvLw]]></ToUserName>" +
+		"<FromUserName><![CDATA[gh_7f083739789a]]></FromUserName><CreateTime>1407743423</CreateTime>" +
+		"<MsgType><![CDATA[video]]></MsgType><Video><MediaId><![CDATA[eYJ1MbwPRJtOvIEabaxHs7TX2D-HV71s79GUxqdUkjm6Gs2Ed1KF3ulAOA9H1xG0]]></MediaId>" +
+		"<Title><![CDATA[testCallBackReplyVideo]]></Title><Description><![CDATA[testCallBackReplyVideo]]></Description></Video></xml>"
+	testCryptReplyEncrypt = "jn1L23DB+6ELqJ+6bruv23M2GmYfkv0xBh2h+XTBOKVKcgDFHle6gqcZ1cZrk3e1qjPQ1F4RsLWzQRG9udbKWesxlkupqcEcW7ZQweImX9+wLMa0" +
+		"GaUzpkycA8+IamDBxn5loLgZpnS7fVAbExOkK5DYHBmv5tptA9tklE/fTIILHR8HLXa5nQvFb3tYPKAlHF3rtTeayNf0QuM+UW/wM9enGIDIJHF7CLHi" +
+		"DNAYxr+r+OrJCmPQyTy8cVWlu9iSvOHPT/77bZqJucQHQ04sq7KZI27OcqpQNSto2OdHCoTccjggX5Z9Mma0nMJBU+jLKJ38YB1fBIz+vBzsYjrTmFQ4" +
+		"4YfeEuZ+xRTQwr92vhA9OxchWVINGC50qE/6lmkwWTwGX9wtQpsJKhP+oS7rvTY8+VdzETdfakjkwQ5/Xka042OlUb1/slTwo4RscuQ+RdxSGvDahxAJ" +
+		"6+EAjLt9d8igHngxIbf6YyqqROxuxqIeIch3CssH/LqRs+iAcILvApYZckqmA7FNERspKA5f8GoJ9sv8xmGvZ9Yrf57cExWtnX8aCMMaBropU/1k+hKP" +
+		"5LVdzbWCG0hGwx/dQudYR/eXp3P0XxjlFiy+9DMlaFExWUZQDajPkdPrEeOwofJb"
+)
+
+// testMsgSignature 按文档计算 msg_signature：token、timestamp、nonce、密文字典序排序后拼接做sha1
+func testMsgSignature(params ...string) string {
+	sorted := append([]string{}, params...)
+	sort.Strings(sorted)
+	sum := sha1.Sum([]byte(strings.Join(sorted, "")))
+	return hex.EncodeToString(sum[:])
+}
+
+func newTestMsgCrypt(t *testing.T) *MsgCrypt {
+	c, err := NewMsgCrypt(testCryptToken, testCryptAESKey, testCryptAppId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestNewMsgCryptInvalidKey(t *testing.T) {
+	for _, key := range []string{"", testCryptAESKey[:42], testCryptAESKey + "H", "!" + testCryptAESKey[1:]} {
+		if _, err := NewMsgCrypt(testCryptToken, key, testCryptAppId); err != ErrInvalidAESKey {
+			t.Errorf("NewMsgCrypt(%q): err %v, want ErrInvalidAESKey", key, err)
+		}
+	}
+}
+
+func TestDecryptSample(t *testing.T) {
+	c := newTestMsgCrypt(t)
+	for encrypt, want := range map[string]string{testCryptEncrypt: testCryptMsg, testCryptReplyEncrypt: testCryptReply} {
+		msg, err := c.Decrypt(encrypt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(msg) != want {
+			t.Errorf("Decrypt: %q, want %q", msg, want)
+		}
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	other, err := NewMsgCrypt(testCryptToken, testCryptAESKey, "wx0000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Decrypt(testCryptEncrypt); err != ErrInvalidAppId {
+		t.Errorf("other appid: err %v, want ErrInvalidAppId", err)
+	}
+
+	c := newTestMsgCrypt(t)
+	if _, err := c.Decrypt(testCryptEncrypt[:len(testCryptEncrypt)-4]); err != ErrInvalidCipherText {
+		t.Errorf("truncated: err %v, want ErrInvalidCipherText", err)
+	}
+	if _, err := c.Decrypt("not base64"); err == nil {
+		t.Errorf("not base64: expected error")
+	}
+}
+
+func TestDecryptMsgSample(t *testing.T) {
+	c := newTestMsgCrypt(t)
+	body := []byte("<xml><ToUserName><![CDATA[toUser]]></ToUserName><Encrypt><![CDATA[" + testCryptEncrypt + "]]></Encrypt></xml>")
+	signature := testMsgSignature(testCryptToken, testCryptTimestamp, testCryptNonce, testCryptEncrypt)
+
+	msg, err := c.DecryptMsg(signature, testCryptTimestamp, testCryptNonce, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != testCryptMsg {
+		t.Errorf("DecryptMsg: %q, want %q", msg, testCryptMsg)
+	}
+
+	if _, err := c.DecryptMsg(signature, testCryptTimestamp, "yyyyyy", body); err != ErrInvalidMsgSignature {
+		t.Errorf("wrong nonce: err %v, want ErrInvalidMsgSignature", err)
+	}
+	if _, err := c.DecryptMsg(signature, testCryptTimestamp, testCryptNonce, []byte("<xml></xml>")); err != ErrInvalidCipherText {
+		t.Errorf("no Encrypt: err %v, want ErrInvalidCipherText", err)
+	}
+}
+
+func TestEncryptMsgRoundTrip(t *testing.T) {
+	c := newTestMsgCrypt(t)
+	body, err := c.EncryptMsg([]byte(testCryptReply), 1409304348, testCryptNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var encrypted EncryptedMessage
+	if err := xml.Unmarshal(body, &encrypted); err != nil {
+		t.Fatal(err)
+	}
+	if encrypted.TimeStamp != testCryptTimestamp || encrypted.Nonce == nil || encrypted.Nonce.Value != testCryptNonce {
+		t.Fatalf("unexpected reply envelope %s", body)
+	}
+	want := testMsgSignature(testCryptToken, testCryptTimestamp, testCryptNonce, encrypted.Encrypt.Value)
+	if encrypted.MsgSignature == nil || encrypted.MsgSignature.Value != want {
+		t.Fatalf("MsgSignature mismatch in %s", body)
+	}
+
+	msg, err := c.DecryptMsg(want, testCryptTimestamp, testCryptNonce, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != testCryptReply {
+		t.Errorf("round trip: %q", msg)
+	}
+
+	// 每次加密使用新的随机串
+	again, _ := c.Encrypt([]byte(testCryptReply))
+	if again == encrypted.Encrypt.Value {
+		t.Errorf("Encrypt should use a random prefix")
+	}
+}
@@ -0,0 +1,107 @@
+package wechat
+
+import "errors"
+
+// 客服消息
+//
+// 文档：https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Service_Center_messages.html
+
+const (
+	SEND_CUSTOM_MESSAGE = "https://api.weixin.qq.com/cgi-bin/message/custom/send?access_token=ACCESS_TOKEN" // 发送客服消息
+)
+
+var ErrUnsupportedReply = errors.New("reply can not be sent as custom message")
+
+type CustomText struct {
+	Content string `json:"content"`
+}
+
+type CustomMedia struct {
+	MediaId string `json:"media_id"`
+}
+
+type CustomVideo struct {
+	MediaId      string `json:"media_id"`
+	ThumbMediaId string `json:"thumb_media_id,omitempty"`
+	Title        string `json:"title,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+type CustomMusic struct {
+	Title        string `json:"title,omitempty"`
+	Description  string `json:"description,omitempty"`
+	MusicUrl     string `json:"musicurl"`
+	HQMusicUrl   string `json:"hqmusicurl"`
+	ThumbMediaId string `json:"thumb_media_id"`
+}
+
+type CustomNews struct {
+	Articles []NewsArticle `json:"articles"`
+}
+
+type CustomService struct {
+	KfAccount string `json:"kf_account"`
+}
+
+// CustomMessage 客服消息，msgtype为 text, image, voice, video, music, news
+type CustomMessage struct {
+	ToUser        string         `json:"touser"`
+	MsgType       string         `json:"msgtype"`
+	Text          *CustomText    `json:"text,omitempty"`
+	Image         *CustomMedia   `json:"image,omitempty"`
+	Voice         *CustomMedia   `json:"voice,omitempty"`
+	Video         *CustomVideo   `json:"video,omitempty"`
+	Music         *CustomMusic   `json:"music,omitempty"`
+	News          *CustomNews    `json:"news,omitempty"`
+	CustomService *CustomService `json:"customservice,omitempty"`
+}
+
+// CustomMessageFromReply 将被动回复转换为客服消息，转发客服的回复无法转换
+func CustomMessageFromReply(toUser string, reply Reply) (CustomMessage, error) {
+	msg := CustomMessage{ToUser: toUser}
+
+	switch r := reply.(type) {
+	case *TextReply:
+		msg.MsgType = REPLY_TYPE_TEXT
+		msg.Text = &CustomText{r.Content}
+	case *ImageReply:
+		msg.MsgType = REPLY_TYPE_IMAGE
+		msg.Image = &CustomMedia{r.MediaId}
+	case *VoiceReply:
+		msg.MsgType = REPLY_TYPE_VOICE
+		msg.Voice = &CustomMedia{r.MediaId}
+	case *VideoReply:
+		msg.MsgType = REPLY_TYPE_VIDEO
+		msg.Video = &CustomVideo{MediaId: r.MediaId, Title: r.Title, Description: r.Description}
+	case *MusicReply:
+		msg.MsgType = REPLY_TYPE_MUSIC
+		msg.Music = &CustomMusic{r.Title, r.Description, r.MusicUrl, r.HQMusicUrl, r.ThumbMediaId}
+	case *NewsReply:
+		msg.MsgType = REPLY_TYPE_NEWS
+		msg.News = &CustomNews{r.Articles}
+	default:
+		return msg, ErrUnsupportedReply
+	}
+
+	return msg, nil
+}
+
+// SendCustomMessage
+//
+//	参数：{
+//		  "touser":"OPENID",
+//		  "msgtype":"text",
+//		  "text":{ "content":"Hello World" }
+//	}
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+// 失败返回 { "errcode":45015,"errmsg":"response out of time limit or subscription is canceled"}
+func SendCustomMessage(accessToken string, msg CustomMessage) error {
+	resData, err := MakePostReq(TokenUrl(SEND_CUSTOM_MESSAGE, accessToken), msg, "application/json")
+	if err != nil {
+		return err
+	}
+
+	return ParseResult(resData, nil)
+}
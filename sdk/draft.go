@@ -0,0 +1,338 @@
+package wechat
+
+import (
+	"errors"
+	"strings"
+)
+
+// 草稿箱与发布能力
+//
+// 草稿箱保存待发布的图文，发布后通过 PUBLISHJOBFINISH 事件推送结果，也可以通过 freepublish/get 轮询
+//
+// 文档：https://developers.weixin.qq.com/doc/offiaccount/Draft_Box/Add_draft.html
+//      https://developers.weixin.qq.com/doc/offiaccount/Publish/Publish.html
+
+const (
+	DRAFT_ADD              = "https://api.weixin.qq.com/cgi-bin/draft/add?access_token=ACCESS_TOKEN"              // 新建草稿
+	DRAFT_GET              = "https://api.weixin.qq.com/cgi-bin/draft/get?access_token=ACCESS_TOKEN"              // 获取草稿
+	DRAFT_DELETE           = "https://api.weixin.qq.com/cgi-bin/draft/delete?access_token=ACCESS_TOKEN"           // 删除草稿
+	DRAFT_UPDATE           = "https://api.weixin.qq.com/cgi-bin/draft/update?access_token=ACCESS_TOKEN"           // 修改草稿
+	DRAFT_COUNT            = "https://api.weixin.qq.com/cgi-bin/draft/count"                                      // 获取草稿总数
+	DRAFT_BATCHGET         = "https://api.weixin.qq.com/cgi-bin/draft/batchget?access_token=ACCESS_TOKEN"         // 获取草稿列表
+	FREEPUBLISH_SUBMIT     = "https://api.weixin.qq.com/cgi-bin/freepublish/submit?access_token=ACCESS_TOKEN"     // 发布
+	FREEPUBLISH_GET        = "https://api.weixin.qq.com/cgi-bin/freepublish/get?access_token=ACCESS_TOKEN"        // 发布状态轮询
+	FREEPUBLISH_DELETE     = "https://api.weixin.qq.com/cgi-bin/freepublish/delete?access_token=ACCESS_TOKEN"     // 删除发布
+	FREEPUBLISH_GETARTICLE = "https://api.weixin.qq.com/cgi-bin/freepublish/getarticle?access_token=ACCESS_TOKEN" // 通过 article_id 获取已发布文章
+	FREEPUBLISH_BATCHGET   = "https://api.weixin.qq.com/cgi-bin/freepublish/batchget?access_token=ACCESS_TOKEN"   // 获取成功发布列表
+
+	MAX_DRAFT_ARTICLES = 8 // 一个草稿最多8篇图文
+
+	PUBLISH_STATUS_SUCCESS       = 0 // 发布成功
+	PUBLISH_STATUS_PUBLISHING    = 1 // 发布中
+	PUBLISH_STATUS_ORIGINAL_FAIL = 2 // 原创失败
+	PUBLISH_STATUS_FAIL          = 3 // 常规失败
+	PUBLISH_STATUS_AUDIT_FAIL    = 4 // 平台审核不通过
+	PUBLISH_STATUS_DELETED       = 5 // 成功后用户删除所有文章
+	PUBLISH_STATUS_BANNED        = 6 // 成功后系统封禁所有文章
+)
+
+var ErrInvalidArticles = errors.New("articles must contain 1 to 8 items")
+
+// Article 草稿与已发布的图文，Url、ThumbUrl 与 IsDeleted 只在获取时返回
+type Article struct {
+	Title              string `json:"title"`
+	Author             string `json:"author,omitempty"`
+	Digest             string `json:"digest,omitempty"`
+	Content            string `json:"content"`
+	ContentSourceUrl   string `json:"content_source_url,omitempty"`
+	ThumbMediaId       string `json:"thumb_media_id"`
+	NeedOpenComment    int    `json:"need_open_comment"`
+	OnlyFansCanComment int    `json:"only_fans_can_comment"`
+	PicCrop2351        string `json:"pic_crop_235_1,omitempty"`
+	PicCrop11          string `json:"pic_crop_1_1,omitempty"`
+	Url                string `json:"url,omitempty"`
+	ThumbUrl           string `json:"thumb_url,omitempty"`
+	IsDeleted          bool   `json:"is_deleted,omitempty"`
+}
+
+// DraftItem 草稿列表中的一项
+type DraftItem struct {
+	MediaId string `json:"media_id"`
+	Content struct {
+		NewsItem []Article `json:"news_item"`
+	} `json:"content"`
+	UpdateTime int64 `json:"update_time"`
+}
+
+// DraftList 草稿列表
+type DraftList struct {
+	TotalCount int64       `json:"total_count"`
+	ItemCount  int64       `json:"item_count"`
+	Item       []DraftItem `json:"item"`
+}
+
+// PublishId 发布任务id，接口文档中为字符串，实际可能返回数字，两种都可以解析
+type PublishId string
+
+func (id *PublishId) UnmarshalJSON(data []byte) error {
+	*id = PublishId(strings.Trim(string(data), `"`))
+	return nil
+}
+
+// PublishResult 提交发布的结果
+type PublishResult struct {
+	PublishId PublishId `json:"publish_id"`
+	MsgDataId int64     `json:"msg_data_id"`
+}
+
+// PublishArticleDetail 发布成功的文章，idx 从1开始
+type PublishArticleDetail struct {
+	Count int64 `json:"count" xml:"count"`
+	Item  []struct {
+		Idx        int64  `json:"idx" xml:"idx"`
+		ArticleUrl string `json:"article_url" xml:"article_url"`
+	} `json:"item" xml:"item"`
+}
+
+// PublishStatus 发布状态，与 PUBLISHJOBFINISH 事件中的 PublishEventInfo 字段相同
+type PublishStatus struct {
+	PublishId     PublishId            `json:"publish_id" xml:"publish_id"`
+	PublishStatus int                  `json:"publish_status" xml:"publish_status"`
+	ArticleId     string               `json:"article_id" xml:"article_id"`
+	ArticleDetail PublishArticleDetail `json:"article_detail" xml:"article_detail"`
+	FailIdx       []int64              `json:"fail_idx" xml:"fail_idx"`
+}
+
+// PublishedItem 成功发布列表中的一项
+type PublishedItem struct {
+	ArticleId string `json:"article_id"`
+	Content   struct {
+		NewsItem   []Article `json:"news_item"`
+		CreateTime int64     `json:"create_time"`
+		UpdateTime int64     `json:"update_time"`
+	} `json:"content"`
+	UpdateTime int64 `json:"update_time"`
+}
+
+// PublishedList 成功发布列表
+type PublishedList struct {
+	TotalCount int64           `json:"total_count"`
+	ItemCount  int64           `json:"item_count"`
+	Item       []PublishedItem `json:"item"`
+}
+
+// AddDraft
+//
+//	参数：{
+//		  "articles":[ { "title":TITLE, "author":AUTHOR, "digest":DIGEST, "content":CONTENT, "content_source_url":CONTENT_SOURCE_URL,
+//		                 "thumb_media_id":THUMB_MEDIA_ID, "need_open_comment":0, "only_fans_can_comment":0 } ]
+//	}
+//
+// 返回：
+// 成功返回 { "media_id":MEDIA_ID }
+// 失败返回 { "errcode":40007,"errmsg":"invalid media_id"}
+func AddDraft(accessToken string, articles []Article) (string, error) {
+	if len(articles) == 0 || len(articles) > MAX_DRAFT_ARTICLES {
+		return "", ErrInvalidArticles
+	}
+
+	resData, err := MakePostReq(TokenUrl(DRAFT_ADD, accessToken), map[string][]Article{
+		"articles": articles,
+	}, "application/json")
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		MediaId string `json:"media_id"`
+	}
+	err = ParseResult(resData, &result)
+	return result.MediaId, err
+}
+
+// GetDraft
+//
+// 返回：
+// 成功返回 { "news_item":[ { "title":TITLE, ..., "url":URL, "thumb_url":THUMB_URL } ] }
+func GetDraft(accessToken string, mediaId string) ([]Article, error) {
+	return getArticles(TokenUrl(DRAFT_GET, accessToken), map[string]string{"media_id": mediaId})
+}
+
+// DeleteDraft
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func DeleteDraft(accessToken string, mediaId string) error {
+	resData, err := MakePostReq(TokenUrl(DRAFT_DELETE, accessToken), map[string]string{
+		"media_id": mediaId,
+	}, "application/json")
+	if err != nil {
+		return err
+	}
+	return ParseResult(resData, nil)
+}
+
+// UpdateDraft 修改草稿中的一篇图文
+//
+//	参数：{
+//		  "media_id":MEDIA_ID,
+//		  "index":INDEX,
+//		  "articles":{ "title":TITLE, ... }
+//	}
+//
+// index 为要更新的文章在图文消息中的位置，第一篇为0
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func UpdateDraft(accessToken string, mediaId string, index int, article Article) error {
+	resData, err := MakePostReq(TokenUrl(DRAFT_UPDATE, accessToken), map[string]interface{}{
+		"media_id": mediaId,
+		"index":    index,
+		"articles": article,
+	}, "application/json")
+	if err != nil {
+		return err
+	}
+	return ParseResult(resData, nil)
+}
+
+// GetDraftCount
+//
+// 返回：
+// 成功返回 { "total_count":TOTAL_COUNT }
+func GetDraftCount(accessToken string) (int64, error) {
+	resData, err := MakeGetReq(DRAFT_COUNT, map[string]string{
+		"access_token": accessToken,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		TotalCount int64 `json:"total_count"`
+	}
+	err = ParseResult(resData, &result)
+	return result.TotalCount, err
+}
+
+// BatchGetDraft 获取草稿列表
+//
+//	参数：{
+//		  "offset":OFFSET,
+//		  "count":COUNT,
+//		  "no_content":NO_CONTENT
+//	}
+//
+// count 取值在1到20之间，noContent 为true时不返回 content 字段
+//
+// 返回：
+// 成功返回 { "total_count":TOTAL_COUNT, "item_count":ITEM_COUNT, "item":[ { "media_id":MEDIA_ID, "content":{ "news_item":[...] }, "update_time":UPDATE_TIME } ] }
+func BatchGetDraft(accessToken string, offset int, count int, noContent bool) (DraftList, error) {
+	var list DraftList
+	resData, err := MakePostReq(TokenUrl(DRAFT_BATCHGET, accessToken), batchGetParams(offset, count, noContent), "application/json")
+	if err != nil {
+		return list, err
+	}
+
+	err = ParseResult(resData, &list)
+	return list, err
+}
+
+// SubmitPublish 发布草稿，发布结果通过 PUBLISHJOBFINISH 事件推送
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok", "publish_id":"100000001", "msg_data_id":2247483673 }
+// 失败返回 { "errcode":53503,"errmsg":"该草稿未通过发布检查"}
+func SubmitPublish(accessToken string, mediaId string) (PublishResult, error) {
+	var result PublishResult
+	resData, err := MakePostReq(TokenUrl(FREEPUBLISH_SUBMIT, accessToken), map[string]string{
+		"media_id": mediaId,
+	}, "application/json")
+	if err != nil {
+		return result, err
+	}
+
+	err = ParseResult(resData, &result)
+	return result, err
+}
+
+// GetPublishStatus 发布状态轮询
+//
+// 返回：
+// 成功返回 { "publish_id":"100000001", "publish_status":0, "article_id":ARTICLE_ID, "article_detail":{ "count":1, "item":[ { "idx":1, "article_url":ARTICLE_URL } ] }, "fail_idx":[] }
+func GetPublishStatus(accessToken string, publishId string) (PublishStatus, error) {
+	var status PublishStatus
+	resData, err := MakePostReq(TokenUrl(FREEPUBLISH_GET, accessToken), map[string]string{
+		"publish_id": publishId,
+	}, "application/json")
+	if err != nil {
+		return status, err
+	}
+
+	err = ParseResult(resData, &status)
+	return status, err
+}
+
+// DeletePublish 删除发布的文章，index 为要删除的文章在图文消息中的位置，第一篇为1，为0时删除全部文章
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func DeletePublish(accessToken string, articleId string, index int) error {
+	resData, err := MakePostReq(TokenUrl(FREEPUBLISH_DELETE, accessToken), map[string]interface{}{
+		"article_id": articleId,
+		"index":      index,
+	}, "application/json")
+	if err != nil {
+		return err
+	}
+	return ParseResult(resData, nil)
+}
+
+// GetPublishedArticle 通过 article_id 获取已发布文章
+//
+// 返回：
+// 成功返回 { "news_item":[ { "title":TITLE, ..., "url":URL, "is_deleted":false } ] }
+func GetPublishedArticle(accessToken string, articleId string) ([]Article, error) {
+	return getArticles(TokenUrl(FREEPUBLISH_GETARTICLE, accessToken), map[string]string{"article_id": articleId})
+}
+
+// BatchGetPublished 获取成功发布列表
+//
+// 参数与 BatchGetDraft 相同
+//
+// 返回：
+// 成功返回 { "total_count":TOTAL_COUNT, "item_count":ITEM_COUNT, "item":[ { "article_id":ARTICLE_ID, "content":{ "news_item":[...], "create_time":CREATE_TIME, "update_time":UPDATE_TIME }, "update_time":UPDATE_TIME } ] }
+func BatchGetPublished(accessToken string, offset int, count int, noContent bool) (PublishedList, error) {
+	var list PublishedList
+	resData, err := MakePostReq(TokenUrl(FREEPUBLISH_BATCHGET, accessToken), batchGetParams(offset, count, noContent), "application/json")
+	if err != nil {
+		return list, err
+	}
+
+	err = ParseResult(resData, &list)
+	return list, err
+}
+
+func getArticles(url string, params map[string]string) ([]Article, error) {
+	resData, err := MakePostReq(url, params, "application/json")
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		NewsItem []Article `json:"news_item"`
+	}
+	err = ParseResult(resData, &result)
+	return result.NewsItem, err
+}
+
+func batchGetParams(offset int, count int, noContent bool) map[string]int {
+	if count < 1 || count > 20 {
+		count = 20
+	}
+	params := map[string]int{"offset": offset, "count": count, "no_content": 0}
+	if noContent {
+		params["no_content"] = 1
+	}
+	return params
+}
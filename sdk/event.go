@@ -0,0 +1,291 @@
+package wechat
+
+// 消息与事件的类型化结构，由 MixMessage.Typed 转换得到
+
+const (
+	MSG_TYPE_TEXT        = "text"
+	MSG_TYPE_IMAGE       = "image"
+	MSG_TYPE_VOICE       = "voice"
+	MSG_TYPE_VIDEO       = "video"
+	MSG_TYPE_SHORT_VIDEO = "shortvideo"
+	MSG_TYPE_LOCATION    = "location"
+	MSG_TYPE_LINK        = "link"
+	MSG_TYPE_EVENT       = "event"
+
+	EVENT_SUBSCRIBE                  = "subscribe"
+	EVENT_UNSUBSCRIBE                = "unsubscribe"
+	EVENT_SCAN                       = "SCAN"
+	EVENT_LOCATION                   = "LOCATION"
+	EVENT_CLICK                      = "CLICK"
+	EVENT_VIEW                       = "VIEW"
+	EVENT_SCANCODE_PUSH              = "scancode_push"
+	EVENT_SCANCODE_WAITMSG           = "scancode_waitmsg"
+	EVENT_PIC_SYSPHOTO               = "pic_sysphoto"
+	EVENT_PIC_PHOTO_OR_ALBUM         = "pic_photo_or_album"
+	EVENT_PIC_WEIXIN                 = "pic_weixin"
+	EVENT_LOCATION_SELECT            = "location_select"
+	EVENT_VIEW_MINIPROGRAM           = "view_miniprogram"
+	EVENT_TEMPLATE_SEND_JOB_FINISH   = "TEMPLATESENDJOBFINISH"
+	EVENT_MASS_SEND_JOB_FINISH       = "MASSSENDJOBFINISH"
+	EVENT_SUBSCRIBE_MSG_POPUP_EVENT  = "subscribe_msg_popup_event"
+	EVENT_SUBSCRIBE_MSG_CHANGE_EVENT = "subscribe_msg_change_event"
+	EVENT_SUBSCRIBE_MSG_SENT_EVENT   = "subscribe_msg_sent_event"
+	EVENT_PUBLISH_JOB_FINISH         = "PUBLISHJOBFINISH"
+)
+
+type MessageHeader struct {
+	ToUserName   string `xml:"ToUserName"`
+	FromUserName string `xml:"FromUserName"`
+	CreateTime   int64  `xml:"CreateTime"`
+	MsgType      string `xml:"MsgType"`
+}
+
+type TextMessage struct {
+	MessageHeader
+	MsgId   int64  `xml:"MsgId"`
+	Content string `xml:"Content"`
+}
+
+type ImageMessage struct {
+	MessageHeader
+	MsgId   int64  `xml:"MsgId"`
+	PicUrl  string `xml:"PicUrl"`
+	MediaId string `xml:"MediaId"`
+}
+
+type VoiceMessage struct {
+	MessageHeader
+	MsgId       int64  `xml:"MsgId"`
+	MediaId     string `xml:"MediaId"`
+	Format      string `xml:"Format"`
+	Recognition string `xml:"Recognition"`
+}
+
+// VideoMessage 视频与小视频消息，通过MsgType区分
+type VideoMessage struct {
+	MessageHeader
+	MsgId        int64  `xml:"MsgId"`
+	MediaId      string `xml:"MediaId"`
+	ThumbMediaId string `xml:"ThumbMediaId"`
+}
+
+type LocationMessage struct {
+	MessageHeader
+	MsgId     int64   `xml:"MsgId"`
+	LocationX float64 `xml:"Location_X"`
+	LocationY float64 `xml:"Location_Y"`
+	Scale     float64 `xml:"Scale"`
+	Label     string  `xml:"Label"`
+}
+
+type LinkMessage struct {
+	MessageHeader
+	MsgId       int64  `xml:"MsgId"`
+	Title       string `xml:"Title"`
+	Description string `xml:"Description"`
+	Url         string `xml:"Url"`
+}
+
+type EventHeader struct {
+	MessageHeader
+	Event string `xml:"Event"`
+}
+
+// SubscribeEvent 关注事件，扫描带参数二维码关注时EventKey为 qrscene_ 加二维码参数
+type SubscribeEvent struct {
+	EventHeader
+	EventKey string `xml:"EventKey"`
+	Ticket   string `xml:"Ticket"`
+}
+
+type UnsubscribeEvent struct {
+	EventHeader
+}
+
+// ScanEvent 已关注用户扫描带参数二维码事件
+type ScanEvent struct {
+	EventHeader
+	EventKey string `xml:"EventKey"`
+	Ticket   string `xml:"Ticket"`
+}
+
+type LocationEvent struct {
+	EventHeader
+	Latitude  float64 `xml:"Latitude"`
+	Longitude float64 `xml:"Longitude"`
+	Precision float64 `xml:"Precision"`
+}
+
+type ClickEvent struct {
+	EventHeader
+	EventKey string `xml:"EventKey"`
+}
+
+type ViewEvent struct {
+	EventHeader
+	EventKey string `xml:"EventKey"`
+	MenuId   string `xml:"MenuId"`
+}
+
+// ScanCodeEvent 扫码推事件与扫码推事件且弹出“消息接收中”提示框的事件
+type ScanCodeEvent struct {
+	EventHeader
+	EventKey     string       `xml:"EventKey"`
+	ScanCodeInfo ScanCodeInfo `xml:"ScanCodeInfo"`
+}
+
+// PicEvent 弹出系统拍照发图、拍照或者相册发图、微信相册发图器的事件
+type PicEvent struct {
+	EventHeader
+	EventKey     string       `xml:"EventKey"`
+	SendPicsInfo SendPicsInfo `xml:"SendPicsInfo"`
+}
+
+type LocationSelectEvent struct {
+	EventHeader
+	EventKey         string           `xml:"EventKey"`
+	SendLocationInfo SendLocationInfo `xml:"SendLocationInfo"`
+}
+
+type ViewMiniprogramEvent struct {
+	EventHeader
+	EventKey string `xml:"EventKey"`
+	MenuId   string `xml:"MenuId"`
+}
+
+type TemplateSendJobFinishEvent struct {
+	EventHeader
+	MsgID  int64  `xml:"MsgID"`
+	Status string `xml:"Status"`
+}
+
+type MassSendJobFinishEvent struct {
+	EventHeader
+	MsgID       int64  `xml:"MsgID"`
+	Status      string `xml:"Status"`
+	TotalCount  int64  `xml:"TotalCount"`
+	FilterCount int64  `xml:"FilterCount"`
+	SentCount   int64  `xml:"SentCount"`
+	ErrorCount  int64  `xml:"ErrorCount"`
+}
+
+// SubscribeMsgPopupEvent 用户在图文等场景内订阅通知的操作
+type SubscribeMsgPopupEvent struct {
+	EventHeader
+	List []SubscribeMsgEventItem `xml:"SubscribeMsgPopupEvent>List"`
+}
+
+// SubscribeMsgChangeEvent 用户在服务通知管理页面做通知管理时的操作
+type SubscribeMsgChangeEvent struct {
+	EventHeader
+	List []SubscribeMsgEventItem `xml:"SubscribeMsgChangeEvent>List"`
+}
+
+// SubscribeMsgSentEvent 发送订阅通知的结果
+type SubscribeMsgSentEvent struct {
+	EventHeader
+	List []SubscribeMsgEventItem `xml:"SubscribeMsgSentEvent>List"`
+}
+
+// PublishJobFinishEvent 发布任务完成的结果
+type PublishJobFinishEvent struct {
+	EventHeader
+	PublishEventInfo PublishStatus `xml:"PublishEventInfo"`
+}
+
+// Typed 将消息转换为对应的类型化结构，如 *TextMessage, *SubscribeEvent，
+// 未知的消息与事件类型返回消息本身
+func (m *MixMessage) Typed() interface{} {
+	header := MessageHeader{
+		ToUserName:   m.ToUserName,
+		FromUserName: m.FromUserName,
+		CreateTime:   m.CreateTime,
+		MsgType:      m.MsgType,
+	}
+
+	switch m.MsgType {
+	case MSG_TYPE_TEXT:
+		return &TextMessage{header, m.MsgId, m.Content}
+	case MSG_TYPE_IMAGE:
+		return &ImageMessage{header, m.MsgId, m.PicUrl, m.MediaId}
+	case MSG_TYPE_VOICE:
+		return &VoiceMessage{header, m.MsgId, m.MediaId, m.Format, m.Recognition}
+	case MSG_TYPE_VIDEO, MSG_TYPE_SHORT_VIDEO:
+		return &VideoMessage{header, m.MsgId, m.MediaId, m.ThumbMediaId}
+	case MSG_TYPE_LOCATION:
+		return &LocationMessage{header, m.MsgId, m.LocationX, m.LocationY, m.Scale, m.Label}
+	case MSG_TYPE_LINK:
+		return &LinkMessage{header, m.MsgId, m.Title, m.Description, m.Url}
+	case MSG_TYPE_EVENT:
+		return m.typedEvent(EventHeader{header, m.Event})
+	}
+
+	return m
+}
+
+func (m *MixMessage) typedEvent(header EventHeader) interface{} {
+	switch m.Event {
+	case EVENT_SUBSCRIBE:
+		return &SubscribeEvent{header, m.EventKey, m.Ticket}
+	case EVENT_UNSUBSCRIBE:
+		return &UnsubscribeEvent{header}
+	case EVENT_SCAN:
+		return &ScanEvent{header, m.EventKey, m.Ticket}
+	case EVENT_LOCATION:
+		return &LocationEvent{header, m.Latitude, m.Longitude, m.Precision}
+	case EVENT_CLICK:
+		return &ClickEvent{header, m.EventKey}
+	case EVENT_VIEW:
+		return &ViewEvent{header, m.EventKey, m.MenuId}
+	case EVENT_SCANCODE_PUSH, EVENT_SCANCODE_WAITMSG:
+		event := &ScanCodeEvent{EventHeader: header, EventKey: m.EventKey}
+		if m.ScanCodeInfo != nil {
+			event.ScanCodeInfo = *m.ScanCodeInfo
+		}
+		return event
+	case EVENT_PIC_SYSPHOTO, EVENT_PIC_PHOTO_OR_ALBUM, EVENT_PIC_WEIXIN:
+		event := &PicEvent{EventHeader: header, EventKey: m.EventKey}
+		if m.SendPicsInfo != nil {
+			event.SendPicsInfo = *m.SendPicsInfo
+		}
+		return event
+	case EVENT_LOCATION_SELECT:
+		event := &LocationSelectEvent{EventHeader: header, EventKey: m.EventKey}
+		if m.SendLocationInfo != nil {
+			event.SendLocationInfo = *m.SendLocationInfo
+		}
+		return event
+	case EVENT_VIEW_MINIPROGRAM:
+		return &ViewMiniprogramEvent{header, m.EventKey, m.MenuId}
+	case EVENT_TEMPLATE_SEND_JOB_FINISH:
+		return &TemplateSendJobFinishEvent{header, m.MsgID, m.Status}
+	case EVENT_MASS_SEND_JOB_FINISH:
+		return &MassSendJobFinishEvent{header, m.MsgID, m.Status, m.TotalCount, m.FilterCount, m.SentCount, m.ErrorCount}
+	case EVENT_SUBSCRIBE_MSG_POPUP_EVENT:
+		event := &SubscribeMsgPopupEvent{EventHeader: header}
+		if m.SubscribeMsgPopupEvent != nil {
+			event.List = m.SubscribeMsgPopupEvent.List
+		}
+		return event
+	case EVENT_SUBSCRIBE_MSG_CHANGE_EVENT:
+		event := &SubscribeMsgChangeEvent{EventHeader: header}
+		if m.SubscribeMsgChangeEvent != nil {
+			event.List = m.SubscribeMsgChangeEvent.List
+		}
+		return event
+	case EVENT_SUBSCRIBE_MSG_SENT_EVENT:
+		event := &SubscribeMsgSentEvent{EventHeader: header}
+		if m.SubscribeMsgSentEvent != nil {
+			event.List = m.SubscribeMsgSentEvent.List
+		}
+		return event
+	case EVENT_PUBLISH_JOB_FINISH:
+		event := &PublishJobFinishEvent{EventHeader: header}
+		if m.PublishEventInfo != nil {
+			event.PublishEventInfo = *m.PublishEventInfo
+		}
+		return event
+	}
+
+	return m
+}
@@ -0,0 +1,456 @@
+package wechat
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Markdown 转换为公众号图文的html
+//
+// 公众号编辑器会去掉 <style> 与 class，样式只能写在每个标签的 style 属性中，由 Theme 配置。
+// 图文中只有公众号文章的链接可以点击，其他链接转为文末的参考资料。
+// 支持标题、段落、强调、删除线、行内代码、代码块、引用、列表、表格、分割线、链接与图片，不支持内嵌html
+
+// Theme 各标签的内联样式，key 为标签名，section 为最外层容器，footnotes 为文末参考资料
+type Theme map[string]string
+
+// DefaultTheme 默认主题
+var DefaultTheme = Theme{
+	"section":    "font-size: 16px; color: #3f3f3f; line-height: 1.75; letter-spacing: 0.5px; word-break: break-word;",
+	"h1":         "font-size: 22px; font-weight: bold; margin: 1.2em 0 0.8em; text-align: center;",
+	"h2":         "font-size: 20px; font-weight: bold; margin: 1.2em 0 0.8em; padding-bottom: 4px; border-bottom: 2px solid #07c160;",
+	"h3":         "font-size: 18px; font-weight: bold; margin: 1em 0 0.6em; padding-left: 8px; border-left: 4px solid #07c160;",
+	"h4":         "font-size: 16px; font-weight: bold; margin: 1em 0 0.6em;",
+	"p":          "margin: 0 0 1em;",
+	"strong":     "font-weight: bold; color: #07c160;",
+	"em":         "font-style: italic;",
+	"del":        "text-decoration: line-through;",
+	"code":       "font-family: Menlo, Consolas, monospace; font-size: 90%; padding: 2px 4px; color: #d14; background: #f6f8fa; border-radius: 3px;",
+	"pre":        "font-family: Menlo, Consolas, monospace; font-size: 13px; line-height: 1.5; margin: 0 0 1em; padding: 12px; overflow-x: auto; background: #f6f8fa; border-radius: 4px;",
+	"blockquote": "margin: 0 0 1em; padding: 8px 12px; color: #666; background: #f7f7f7; border-left: 4px solid #d0d0d0;",
+	"ul":         "margin: 0 0 1em; padding-left: 1.5em; list-style-type: disc;",
+	"ol":         "margin: 0 0 1em; padding-left: 1.5em; list-style-type: decimal;",
+	"li":         "margin: 0.2em 0;",
+	"a":          "color: #576b95; text-decoration: none;",
+	"img":        "display: block; max-width: 100%; margin: 0.5em auto;",
+	"hr":         "border: none; border-top: 1px solid #e5e5e5; margin: 1.5em 0;",
+	"table":      "width: 100%; margin: 0 0 1em; border-collapse: collapse; font-size: 14px;",
+	"th":         "padding: 6px 8px; border: 1px solid #dfe2e5; background: #f6f8fa; font-weight: bold;",
+	"td":         "padding: 6px 8px; border: 1px solid #dfe2e5;",
+	"sup":        "color: #576b95; font-size: 12px;",
+	"footnotes":  "margin-top: 2em; font-size: 13px; color: #888;",
+}
+
+// MarkdownRenderer Image 不为空时渲染每张图片前调用，返回替换后的图片地址，如上传到微信服务器后的url
+type MarkdownRenderer struct {
+	Theme         Theme
+	Image         func(src string) (string, error)
+	FootnoteTitle string
+
+	footnotes []string
+	err       error
+}
+
+func NewMarkdownRenderer(theme Theme) *MarkdownRenderer {
+	return &MarkdownRenderer{Theme: theme, FootnoteTitle: "参考资料"}
+}
+
+// RenderMarkdown 使用主题渲染，不替换图片地址
+func RenderMarkdown(src string, theme Theme) string {
+	content, _ := NewMarkdownRenderer(theme).Render(src)
+	return content
+}
+
+// Render 渲染 Markdown，Image 返回错误时中止渲染并返回该错误
+func (r *MarkdownRenderer) Render(src string) (string, error) {
+	r.footnotes, r.err = nil, nil
+
+	lines := strings.Split(strings.Replace(strings.Replace(src, "\r\n", "\n", -1), "\t", "    ", -1), "\n")
+	var buf bytes.Buffer
+	buf.WriteString(r.open("section"))
+	r.blocks(&buf, lines, false)
+
+	if len(r.footnotes) > 0 {
+		buf.WriteString(r.openAs("section", "footnotes"))
+		buf.WriteString(r.open("p") + html.EscapeString(r.FootnoteTitle) + "</p>")
+		for i, link := range r.footnotes {
+			buf.WriteString(r.open("p") + "[" + strconv.Itoa(i+1) + "] " + link + "</p>")
+		}
+		buf.WriteString("</section>")
+	}
+	buf.WriteString("</section>")
+
+	if r.err != nil {
+		return "", r.err
+	}
+	return buf.String(), nil
+}
+
+func (r *MarkdownRenderer) open(tag string) string {
+	return r.openAs(tag, tag)
+}
+
+// openAs 使用 style 的样式输出 tag，如参考资料使用 footnotes 样式的 section
+func (r *MarkdownRenderer) openAs(tag string, style string) string {
+	if s := r.Theme[style]; s != "" {
+		return "<" + tag + ` style="` + html.EscapeString(s) + `">`
+	}
+	return "<" + tag + ">"
+}
+
+var (
+	headingRe   = regexp.MustCompile(`^ {0,3}(#{1,6})\s+(.*?)(\s+#+)?\s*$`)
+	hrRe        = regexp.MustCompile(`^ {0,3}([-*_])(\s*[-*_]){2,}\s*$`)
+	fenceRe     = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+	listItemRe  = regexp.MustCompile(`^( *)([-*+]|\d{1,9}[.)])\s+(.*)$`)
+	tableSepRe  = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+	autolinkRe  = regexp.MustCompile(`^<(https?://[^\s>]+)>`)
+	wechatUrlRe = regexp.MustCompile(`^https?://mp\.weixin\.qq\.com/`)
+)
+
+// blocks 渲染块级元素，tight 为true时段落不包 <p>，用于列表项
+func (r *MarkdownRenderer) blocks(buf *bytes.Buffer, lines []string, tight bool) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			i++
+
+		case fenceRe.MatchString(line):
+			fence := fenceRe.FindStringSubmatch(line)[1]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			i++
+			r.codeBlock(buf, code)
+
+		case headingRe.MatchString(line):
+			m := headingRe.FindStringSubmatch(line)
+			tag := "h" + strconv.Itoa(len(m[1]))
+			buf.WriteString(r.open(tag) + r.inline(m[2]) + "</" + tag + ">")
+			i++
+
+		case hrRe.MatchString(line):
+			buf.WriteString(strings.TrimSuffix(r.open("hr"), ">") + " />")
+			i++
+
+		case strings.HasPrefix(trimmed, ">"):
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				q := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quote = append(quote, strings.TrimPrefix(q, " "))
+			}
+			buf.WriteString(r.open("blockquote"))
+			r.blocks(buf, quote, false)
+			buf.WriteString("</blockquote>")
+
+		case listItemRe.MatchString(line):
+			i = r.list(buf, lines, i)
+
+		case i+1 < len(lines) && strings.Contains(line, "|") && tableSepRe.MatchString(lines[i+1]):
+			i = r.table(buf, lines, i)
+
+		default:
+			var para []string
+			for ; i < len(lines) && !r.interrupts(lines, i); i++ {
+				para = append(para, lines[i])
+			}
+			text := r.inline(strings.TrimSpace(strings.Join(para, "\n")))
+			if tight {
+				buf.WriteString(text)
+			} else {
+				buf.WriteString(r.open("p") + text + "</p>")
+			}
+		}
+	}
+}
+
+// interrupts 判断该行是否结束当前段落
+func (r *MarkdownRenderer) interrupts(lines []string, i int) bool {
+	line := lines[i]
+	return strings.TrimSpace(line) == "" || fenceRe.MatchString(line) || headingRe.MatchString(line) ||
+		hrRe.MatchString(line) || strings.HasPrefix(strings.TrimSpace(line), ">") || listItemRe.MatchString(line)
+}
+
+func (r *MarkdownRenderer) codeBlock(buf *bytes.Buffer, code []string) {
+	// 公众号会合并空白与换行，代码块中的空格与换行需要转换
+	for i, line := range code {
+		code[i] = strings.Replace(html.EscapeString(line), " ", "&nbsp;", -1)
+	}
+	buf.WriteString(r.open("pre") + "<code>" + strings.Join(code, "<br />") + "</code></pre>")
+}
+
+// list 渲染从第i行开始的列表，返回列表后的行号，缩进多于列表项的行属于该列表项
+func (r *MarkdownRenderer) list(buf *bytes.Buffer, lines []string, i int) int {
+	first := listItemRe.FindStringSubmatch(lines[i])
+	indent := len(first[1])
+	ordered := orderedMarker(first[2])
+
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+	buf.WriteString(r.open(tag))
+
+	for i < len(lines) {
+		m := listItemRe.FindStringSubmatch(lines[i])
+		if m == nil || len(m[1]) != indent || orderedMarker(m[2]) != ordered {
+			break
+		}
+		item := []string{m[3]}
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if strings.TrimSpace(line) == "" {
+				// 空行后缩进的内容仍属于该列表项
+				if i+1 < len(lines) && leadingSpaces(lines[i+1]) > indent {
+					item = append(item, "")
+					continue
+				}
+				break
+			}
+			if leadingSpaces(line) <= indent && listItemRe.MatchString(line) {
+				break
+			}
+			if leadingSpaces(line) <= indent && r.interrupts(lines, i) {
+				break
+			}
+			item = append(item, strings.TrimPrefix(line, strings.Repeat(" ", indent+2)))
+		}
+
+		buf.WriteString(r.open("li"))
+		r.blocks(buf, item, true)
+		buf.WriteString("</li>")
+
+		// 列表项之间的空行
+		if i < len(lines) && strings.TrimSpace(lines[i]) == "" && i+1 < len(lines) {
+			if m := listItemRe.FindStringSubmatch(lines[i+1]); m != nil && len(m[1]) == indent && orderedMarker(m[2]) == ordered {
+				i++
+			}
+		}
+	}
+
+	buf.WriteString("</" + tag + ">")
+	return i
+}
+
+func orderedMarker(marker string) bool {
+	return marker != "-" && marker != "*" && marker != "+"
+}
+
+func leadingSpaces(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func (r *MarkdownRenderer) table(buf *bytes.Buffer, lines []string, i int) int {
+	buf.WriteString(r.open("table") + "<thead><tr>")
+	for _, cell := range tableCells(lines[i]) {
+		buf.WriteString(r.open("th") + r.inline(cell) + "</th>")
+	}
+	buf.WriteString("</tr></thead><tbody>")
+
+	for i += 2; i < len(lines) && strings.Contains(lines[i], "|") && strings.TrimSpace(lines[i]) != ""; i++ {
+		buf.WriteString("<tr>")
+		for _, cell := range tableCells(lines[i]) {
+			buf.WriteString(r.open("td") + r.inline(cell) + "</td>")
+		}
+		buf.WriteString("</tr>")
+	}
+
+	buf.WriteString("</tbody></table>")
+	return i
+}
+
+func tableCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "|"), "|")
+	cells := strings.Split(line, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+// inline 渲染行内元素
+func (r *MarkdownRenderer) inline(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_{}[]()#+-.!|~<>", s[i+1]) >= 0:
+			buf.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+
+		case c == '`':
+			n := runLength(s, i, '`')
+			if end := strings.Index(s[i+n:], s[i:i+n]); end >= 0 {
+				code := strings.TrimSpace(s[i+n : i+n+end])
+				buf.WriteString(r.open("code") + html.EscapeString(code) + "</code>")
+				i += n + end + n
+				continue
+			}
+
+		case c == '!' && i+1 < len(s) && s[i+1] == '[':
+			if text, dest, n := parseLink(s[i+1:]); n > 0 {
+				buf.WriteString(r.image(text, dest))
+				i += 1 + n
+				continue
+			}
+
+		case c == '[':
+			if text, dest, n := parseLink(s[i:]); n > 0 {
+				buf.WriteString(r.link(r.inline(text), dest))
+				i += n
+				continue
+			}
+
+		case c == '<':
+			if m := autolinkRe.FindStringSubmatch(s[i:]); m != nil {
+				buf.WriteString(r.link(html.EscapeString(m[1]), m[1]))
+				i += len(m[0])
+				continue
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			if out, n := r.emphasis(s, i); n > 0 {
+				buf.WriteString(out)
+				i += n
+				continue
+			}
+
+		case c == '\n':
+			if strings.HasSuffix(s[:i], "  ") {
+				buf.Truncate(len(bytes.TrimRight(buf.Bytes(), " ")))
+				buf.WriteString("<br />")
+			} else {
+				buf.WriteString("\n")
+			}
+			i++
+			continue
+		}
+
+		buf.WriteString(html.EscapeString(s[i : i+1]))
+		i++
+	}
+	return strings.TrimRight(buf.String(), " ")
+}
+
+// emphasis 渲染 **强调**、*斜体* 与 ~~删除线~~，返回html与消耗的长度，不匹配时长度为0
+func (r *MarkdownRenderer) emphasis(s string, i int) (string, int) {
+	c := s[i]
+	n := runLength(s, i, c)
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		return "", 0
+	}
+
+	var tag string
+	switch {
+	case c == '~' && n >= 2:
+		tag, n = "del", 2
+	case c == '~':
+		return "", 0
+	case n >= 2:
+		tag, n = "strong", 2
+	default:
+		tag = "em"
+	}
+
+	delim := s[i : i+n]
+	rest := s[i+n:]
+	if rest == "" || rest[0] == ' ' || rest[0] == '\n' {
+		return "", 0
+	}
+	for j := 0; j < len(rest); {
+		k := strings.Index(rest[j:], delim)
+		if k < 0 {
+			return "", 0
+		}
+		k += j
+		// 单个分隔符不能是连续分隔符的一部分，如 *a **b** c* 中的 **
+		run := runLength(rest, k, c)
+		if (n == 1 && run != 1) || k == 0 || rest[k-1] == ' ' {
+			j = k + run
+			continue
+		}
+		return r.open(tag) + r.inline(rest[:k]) + "</" + tag + ">", n + k + n
+	}
+	return "", 0
+}
+
+func runLength(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+func isWordByte(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// parseLink 解析 [text](dest "title")，返回文字、地址与消耗的长度，不匹配时长度为0
+func parseLink(s string) (string, string, int) {
+	depth := 0
+	closeText := -1
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == '[' {
+			depth++
+		} else if s[i] == ']' {
+			depth--
+			if depth == 0 {
+				closeText = i
+				break
+			}
+		}
+	}
+	if closeText < 0 || closeText+1 >= len(s) || s[closeText+1] != '(' {
+		return "", "", 0
+	}
+
+	end := strings.IndexByte(s[closeText+2:], ')')
+	if end < 0 {
+		return "", "", 0
+	}
+	dest := strings.TrimSpace(s[closeText+2 : closeText+2+end])
+	if sp := strings.IndexAny(dest, " \t"); sp >= 0 {
+		dest = dest[:sp] // 忽略 title
+	}
+	dest = strings.TrimSuffix(strings.TrimPrefix(dest, "<"), ">")
+	return s[1:closeText], dest, closeText + 2 + end + 1
+}
+
+func (r *MarkdownRenderer) image(alt string, src string) string {
+	if r.Image != nil && r.err == nil {
+		url, err := r.Image(src)
+		if err != nil {
+			r.err = err
+			return ""
+		}
+		src = url
+	}
+	return strings.TrimSuffix(r.open("img"), ">") + ` src="` + html.EscapeString(src) + `" alt="` + html.EscapeString(alt) + `" />`
+}
+
+// link 公众号文章的链接保留，其他链接转为脚注
+func (r *MarkdownRenderer) link(text string, dest string) string {
+	if wechatUrlRe.MatchString(dest) {
+		return strings.TrimSuffix(r.open("a"), ">") + ` href="` + html.EscapeString(dest) + `">` + text + "</a>"
+	}
+	if dest == "" || strings.HasPrefix(dest, "#") {
+		return text
+	}
+
+	r.footnotes = append(r.footnotes, html.EscapeString(dest))
+	return r.openAs("span", "a") + text + "</span>" + r.open("sup") + "[" + strconv.Itoa(len(r.footnotes)) + "]</sup>"
+}
@@ -0,0 +1,79 @@
+package wechat
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	cases := []struct {
+		name, src, want string
+	}{
+		{"heading", "# 标题 #\n\n###### 六级", "<h1>标题</h1><h6>六级</h6>"},
+		{"paragraph", "第一行\n第二行  \n第三行", "<p>第一行\n第二行<br />第三行</p>"},
+		{"emphasis", "**粗体** *斜体* _下划线_ ~~删除~~ snake_case_name", "<p><strong>粗体</strong> <em>斜体</em> <em>下划线</em> <del>删除</del> snake_case_name</p>"},
+		{"nested emphasis", "*a **b** c*", "<p><em>a <strong>b</strong> c</em></p>"},
+		{"unclosed emphasis", "2 * 3 = 6", "<p>2 * 3 = 6</p>"},
+		{"escape", `\*不是斜体\* <b>&`, "<p>*不是斜体* &lt;b&gt;&amp;</p>"},
+		{"inline code", "使用 `` a`b `` 与 `<br>`", "<p>使用 <code>a`b</code> 与 <code>&lt;br&gt;</code></p>"},
+		{"code block", "```go\nif a < b {\n  return\n}\n```", "<pre><code>if&nbsp;a&nbsp;&lt;&nbsp;b&nbsp;{<br />&nbsp;&nbsp;return<br />}</code></pre>"},
+		{"blockquote", "> 引用\n> **强调**", "<blockquote><p>引用\n<strong>强调</strong></p></blockquote>"},
+		{"unordered list", "- 一\n- 二\n  - 二.一\n- 三", "<ul><li>一</li><li>二<ul><li>二.一</li></ul></li><li>三</li></ul>"},
+		{"ordered list", "1. 一\n\n2. 二\n\n段落", "<ol><li>一</li><li>二</li></ol><p>段落</p>"},
+		{"table", "| 名称 | 说明 |\n| --- | :-: |\n| `a` | b |", "<table><thead><tr><th>名称</th><th>说明</th></tr></thead><tbody><tr><td><code>a</code></td><td>b</td></tr></tbody></table>"},
+		{"hr", "上\n\n---\n\n下", "<p>上</p><hr /><p>下</p>"},
+		{"image", `![图 "1"](https://example.com/a.png "标题")`, `<p><img src="https://example.com/a.png" alt="图 &#34;1&#34;" /></p>`},
+		{"wechat link", "[文章](https://mp.weixin.qq.com/s/abc)", `<p><a href="https://mp.weixin.qq.com/s/abc">文章</a></p>`},
+		{"anchor link", "[目录](#toc)", "<p>目录</p>"},
+		{
+			"footnotes", "[Go](https://go.dev/?a=1&b=2) 与 <https://example.com>",
+			"<p><span>Go</span><sup>[1]</sup> 与 <span>https://example.com</span><sup>[2]</sup></p>" +
+				"<section><p>参考资料</p><p>[1] https://go.dev/?a=1&amp;b=2</p><p>[2] https://example.com</p></section>",
+		},
+	}
+
+	for _, c := range cases {
+		if got := RenderMarkdown(c.src, Theme{}); got != "<section>"+c.want+"</section>" {
+			t.Errorf("%s: RenderMarkdown(%q)\n got %s\nwant <section>%s</section>", c.name, c.src, got, c.want)
+		}
+	}
+}
+
+func TestRenderMarkdownTheme(t *testing.T) {
+	theme := Theme{"section": "color: #333;", "strong": `font-family: "a"`, "a": "color: blue;", "footnotes": "font-size: 12px;"}
+	want := `<section style="color: #333;"><p><strong style="font-family: &#34;a&#34;">粗体</strong> <span style="color: blue;">链接</span><sup>[1]</sup></p>` +
+		`<section style="font-size: 12px;"><p>参考资料</p><p>[1] https://example.com</p></section></section>`
+	if got := RenderMarkdown("**粗体** [链接](https://example.com)", theme); got != want {
+		t.Errorf("RenderMarkdown with theme\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestMarkdownRendererImage(t *testing.T) {
+	r := NewMarkdownRenderer(Theme{})
+	var opened []string
+	r.Image = func(src string) (string, error) {
+		opened = append(opened, src)
+		return "https://mmbiz.qpic.cn/" + src, nil
+	}
+	got, err := r.Render("![a](a.png)\n\n" + `![b](<b.png> "标题")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<section><p><img src="https://mmbiz.qpic.cn/a.png" alt="a" /></p><p><img src="https://mmbiz.qpic.cn/b.png" alt="b" /></p></section>`
+	if got != want || len(opened) != 2 {
+		t.Errorf("Render\n got %s\nwant %s", got, want)
+	}
+
+	uploadErr := errors.New("upload failed")
+	r.Image = func(src string) (string, error) {
+		opened = append(opened, src)
+		return "", uploadErr
+	}
+	opened = nil
+	if _, err := r.Render("![a](a.png) ![b](b.png)"); err != uploadErr {
+		t.Errorf("Render: err %v, want %v", err, uploadErr)
+	}
+	if len(opened) != 1 {
+		t.Errorf("Render should stop calling Image after an error, called %d times", len(opened))
+	}
+}
@@ -0,0 +1,235 @@
+package wechat
+
+// 群发消息
+//
+// 文档：https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Batch_Sends_and_Originality_Checks.html
+
+const (
+	MASS_SEND_ALL  = "https://api.weixin.qq.com/cgi-bin/message/mass/sendall?access_token=ACCESS_TOKEN"   // 根据标签进行群发
+	MASS_SEND      = "https://api.weixin.qq.com/cgi-bin/message/mass/send?access_token=ACCESS_TOKEN"      // 根据OpenID列表群发
+	MASS_PREVIEW   = "https://api.weixin.qq.com/cgi-bin/message/mass/preview?access_token=ACCESS_TOKEN"   // 预览接口
+	MASS_GET       = "https://api.weixin.qq.com/cgi-bin/message/mass/get?access_token=ACCESS_TOKEN"       // 查询群发消息发送状态
+	MASS_DELETE    = "https://api.weixin.qq.com/cgi-bin/message/mass/delete?access_token=ACCESS_TOKEN"    // 删除群发
+	MASS_SPEED_GET = "https://api.weixin.qq.com/cgi-bin/message/mass/speed/get?access_token=ACCESS_TOKEN" // 获取群发速度
+	MASS_SPEED_SET = "https://api.weixin.qq.com/cgi-bin/message/mass/speed/set?access_token=ACCESS_TOKEN" // 设置群发速度
+)
+
+type MassFilter struct {
+	IsToAll bool  `json:"is_to_all"`
+	TagId   int64 `json:"tag_id,omitempty"`
+}
+
+type MassText struct {
+	Content string `json:"content"`
+}
+
+type MassMedia struct {
+	MediaId string `json:"media_id"`
+}
+
+type MassCard struct {
+	CardId string `json:"card_id"`
+}
+
+// MassMessage 群发消息体，msgtype为 text, mpnews, voice, image, mpvideo, wxcard
+type MassMessage struct {
+	MsgType           string     `json:"msgtype"`
+	Text              *MassText  `json:"text,omitempty"`
+	MpNews            *MassMedia `json:"mpnews,omitempty"`
+	Voice             *MassMedia `json:"voice,omitempty"`
+	Image             *MassMedia `json:"image,omitempty"`
+	MpVideo           *MassMedia `json:"mpvideo,omitempty"`
+	WxCard            *MassCard  `json:"wxcard,omitempty"`
+	SendIgnoreReprint int        `json:"send_ignore_reprint,omitempty"`
+	ClientMsgId       string     `json:"clientmsgid,omitempty"`
+}
+
+// NewMassMessage 根据消息类型构建群发消息，text类型content为文本内容，wxcard为card_id，其余为media_id
+func NewMassMessage(msgType string, content string) MassMessage {
+	msg := MassMessage{MsgType: msgType}
+	switch msgType {
+	case "text":
+		msg.Text = &MassText{Content: content}
+	case "mpnews":
+		msg.MpNews = &MassMedia{MediaId: content}
+	case "voice":
+		msg.Voice = &MassMedia{MediaId: content}
+	case "image":
+		msg.Image = &MassMedia{MediaId: content}
+	case "mpvideo":
+		msg.MpVideo = &MassMedia{MediaId: content}
+	case "wxcard":
+		msg.WxCard = &MassCard{CardId: content}
+	}
+	return msg
+}
+
+type MassResult struct {
+	MsgId     int64 `json:"msg_id"`
+	MsgDataId int64 `json:"msg_data_id"`
+}
+
+type MassStatus struct {
+	MsgId     int64  `json:"msg_id"`
+	MsgStatus string `json:"msg_status"`
+}
+
+type MassSpeed struct {
+	Speed     int `json:"speed"`
+	RealSpeed int `json:"realspeed"`
+}
+
+// SendMassAll
+//
+// 参数：
+// filter				用于设定图文消息的接收者，is_to_all为true时发送给全部用户，否则发送给tag_id对应的标签
+// msgtype				群发的消息类型
+// send_ignore_reprint	图文消息被判定为转载时，是否继续群发
+// clientmsgid			开发者侧群发msgid，长度限制64字节，用于避免重复推送
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"send job submission success", "msg_id":34182, "msg_data_id": 206227730 }
+// 失败返回 { "errcode":40007,"errmsg":"invalid media_id"}
+func SendMassAll(accessToken string, filter MassFilter, msg MassMessage) (MassResult, error) {
+	var result MassResult
+
+	resData, err := MakePostReq(TokenUrl(MASS_SEND_ALL, accessToken), struct {
+		Filter MassFilter `json:"filter"`
+		MassMessage
+	}{filter, msg}, "application/json")
+	if err != nil {
+		return result, err
+	}
+
+	err = ParseResult(resData, &result)
+	return result, err
+}
+
+// SendMass
+//
+// 参数：
+// touser	填写图文消息的接收者，一串OpenID列表，OpenID最少2个，最多10000个
+// msgtype	群发的消息类型
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"send job submission success", "msg_id":34182, "msg_data_id": 206227730 }
+// 失败返回 { "errcode":40007,"errmsg":"invalid media_id"}
+func SendMass(accessToken string, toUser []string, msg MassMessage) (MassResult, error) {
+	var result MassResult
+
+	resData, err := MakePostReq(TokenUrl(MASS_SEND, accessToken), struct {
+		ToUser []string `json:"touser"`
+		MassMessage
+	}{toUser, msg}, "application/json")
+	if err != nil {
+		return result, err
+	}
+
+	err = ParseResult(resData, &result)
+	return result, err
+}
+
+// PreviewMass
+//
+// 参数：
+// touser	接收消息用户对应该公众号的openid，与towxname二选一
+// towxname	接收消息用户的微信号，同时传入时以towxname优先
+// msgtype	群发的消息类型
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"preview success", "msg_id":34182 }
+// 失败返回 { "errcode":40007,"errmsg":"invalid media_id"}
+func PreviewMass(accessToken string, toUser string, toWxName string, msg MassMessage) (MassResult, error) {
+	var result MassResult
+
+	resData, err := MakePostReq(TokenUrl(MASS_PREVIEW, accessToken), struct {
+		ToUser   string `json:"touser,omitempty"`
+		ToWxName string `json:"towxname,omitempty"`
+		MassMessage
+	}{toUser, toWxName, msg}, "application/json")
+	if err != nil {
+		return result, err
+	}
+
+	err = ParseResult(resData, &result)
+	return result, err
+}
+
+// GetMass
+//
+// 参数：
+// msg_id	群发消息后返回的消息id
+//
+// 返回：
+// 成功返回 { "msg_id":201053012, "msg_status":"SEND_SUCCESS" }
+// 失败返回 { "errcode":40001,"errmsg":"invalid credential"}
+func GetMass(accessToken string, msgId int64) (MassStatus, error) {
+	var status MassStatus
+
+	resData, err := MakePostReq(TokenUrl(MASS_GET, accessToken), map[string]interface{}{
+		"msg_id": msgId,
+	}, "application/json")
+	if err != nil {
+		return status, err
+	}
+
+	err = ParseResult(resData, &status)
+	return status, err
+}
+
+// DeleteMass
+//
+// 参数：
+// msg_id		发送出去的消息ID
+// article_idx	要删除的文章在图文消息中的位置，第一篇编号为1，不填或填0会删除全部文章
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+// 失败返回 { "errcode":40001,"errmsg":"invalid credential"}
+func DeleteMass(accessToken string, msgId int64, articleIdx int) error {
+	resData, err := MakePostReq(TokenUrl(MASS_DELETE, accessToken), map[string]interface{}{
+		"msg_id":      msgId,
+		"article_idx": articleIdx,
+	}, "application/json")
+	if err != nil {
+		return err
+	}
+
+	return ParseResult(resData, nil)
+}
+
+// GetMassSpeed
+//
+// 返回：
+// 成功返回 { "speed":3, "realspeed":15 }
+// 失败返回 { "errcode":40001,"errmsg":"invalid credential"}
+func GetMassSpeed(accessToken string) (MassSpeed, error) {
+	var speed MassSpeed
+
+	resData, err := MakePostReq(TokenUrl(MASS_SPEED_GET, accessToken), map[string]interface{}{}, "application/json")
+	if err != nil {
+		return speed, err
+	}
+
+	err = ParseResult(resData, &speed)
+	return speed, err
+}
+
+// SetMassSpeed
+//
+// 参数：
+// speed	群发速度的级别，0到4，0为80w/分钟，4为10w/分钟
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+// 失败返回 { "errcode":45083,"errmsg":"invalid speed"}
+func SetMassSpeed(accessToken string, speed int) error {
+	resData, err := MakePostReq(TokenUrl(MASS_SPEED_SET, accessToken), map[string]interface{}{
+		"speed": speed,
+	}, "application/json")
+	if err != nil {
+		return err
+	}
+
+	return ParseResult(resData, nil)
+}
@@ -0,0 +1,537 @@
+package wechat
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// 临时素材与永久素材
+//
+// 上传与下载都以流的方式进行，文件不会整个读入内存：上传从 io.Reader 边读边写入 multipart 请求体，
+// 下载将响应体直接交给调用方。上传前按素材类型校验扩展名、文件头与大小，超过大小时中止上传
+//
+// 文档：https://developers.weixin.qq.com/doc/offiaccount/Asset_Management/New_temporary_materials.html
+//      https://developers.weixin.qq.com/doc/offiaccount/Asset_Management/Adding_Permanent_Assets.html
+
+const (
+	MEDIA_UPLOAD      = "https://api.weixin.qq.com/cgi-bin/media/upload?access_token=ACCESS_TOKEN"               // 新增临时素材
+	MEDIA_GET         = "https://api.weixin.qq.com/cgi-bin/media/get"                                            // 获取临时素材
+	MEDIA_GET_JSSDK   = "https://api.weixin.qq.com/cgi-bin/media/get/jssdk"                                      // 获取JSSDK上传的高清语音素材
+	MEDIA_UPLOAD_IMG  = "https://api.weixin.qq.com/cgi-bin/media/uploadimg?access_token=ACCESS_TOKEN"            // 上传图文消息内的图片
+	MATERIAL_ADD      = "https://api.weixin.qq.com/cgi-bin/material/add_material?access_token=ACCESS_TOKEN"      // 新增其他类型永久素材
+	MATERIAL_GET      = "https://api.weixin.qq.com/cgi-bin/material/get_material?access_token=ACCESS_TOKEN"      // 获取永久素材
+	MATERIAL_DEL      = "https://api.weixin.qq.com/cgi-bin/material/del_material?access_token=ACCESS_TOKEN"      // 删除永久素材
+	MATERIAL_COUNT    = "https://api.weixin.qq.com/cgi-bin/material/get_materialcount"                           // 获取素材总数
+	MATERIAL_BATCHGET = "https://api.weixin.qq.com/cgi-bin/material/batchget_material?access_token=ACCESS_TOKEN" // 获取素材列表
+
+	MEDIA_TYPE_IMAGE = "image"
+	MEDIA_TYPE_VOICE = "voice"
+	MEDIA_TYPE_VIDEO = "video"
+	MEDIA_TYPE_THUMB = "thumb"
+	MEDIA_TYPE_NEWS  = "news" // 只用于获取素材列表
+
+	MAX_MEDIA_JSON_SIZE = 1 << 20 // 下载时 json 响应最多读取1M
+)
+
+// 本地校验的错误与微信接口返回的错误码相同
+var (
+	ErrInvalidMediaType   = &CommonError{ErrCode: 40004, ErrMsg: "invalid media type"}
+	ErrInvalidMediaFormat = &CommonError{ErrCode: 40005, ErrMsg: "invalid file type"}
+	ErrMediaTooLarge      = &CommonError{ErrCode: 40006, ErrMsg: "invalid media size"}
+)
+
+// MediaLimit 素材的大小与格式限制，ContentType 为按文件头识别的类型前缀，为空时只校验扩展名
+type MediaLimit struct {
+	MaxSize     int64
+	Extensions  []string
+	ContentType string
+}
+
+// MediaLimits 临时素材的限制
+var MediaLimits = map[string]MediaLimit{
+	MEDIA_TYPE_IMAGE: {10 << 20, []string{".bmp", ".png", ".jpeg", ".jpg", ".gif"}, "image/"},
+	MEDIA_TYPE_VOICE: {2 << 20, []string{".amr", ".mp3"}, ""},
+	MEDIA_TYPE_VIDEO: {10 << 20, []string{".mp4"}, "video/"},
+	MEDIA_TYPE_THUMB: {64 << 10, []string{".jpg", ".jpeg"}, "image/"},
+}
+
+// MaterialLimits 永久素材的限制
+var MaterialLimits = map[string]MediaLimit{
+	MEDIA_TYPE_IMAGE: {10 << 20, []string{".bmp", ".png", ".jpeg", ".jpg", ".gif"}, "image/"},
+	MEDIA_TYPE_VOICE: {2 << 20, []string{".mp3", ".wma", ".wav", ".amr"}, ""},
+	MEDIA_TYPE_VIDEO: {10 << 20, []string{".mp4"}, "video/"},
+	MEDIA_TYPE_THUMB: {64 << 10, []string{".jpg", ".jpeg"}, "image/"},
+}
+
+// ArticleImageLimit 图文消息内图片的限制
+var ArticleImageLimit = MediaLimit{1 << 20, []string{".jpg", ".jpeg", ".png"}, "image/"}
+
+// MediaFile 上传的文件，Size 未知时为0，上传中超过限制时返回 ErrMediaTooLarge
+type MediaFile struct {
+	Name   string
+	Reader io.Reader
+	Size   int64
+}
+
+// VideoDescription 永久视频素材的描述
+type VideoDescription struct {
+	Title        string `json:"title"`
+	Introduction string `json:"introduction"`
+}
+
+// MediaResult 上传临时素材的结果，素材在微信服务器保存3天
+type MediaResult struct {
+	Type      string `json:"type"`
+	MediaId   string `json:"media_id"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// MaterialResult 新增永久素材的结果，url 只在图片素材中返回
+type MaterialResult struct {
+	MediaId string `json:"media_id"`
+	Url     string `json:"url,omitempty"`
+}
+
+// MediaInfo 下载的素材信息，Size 未知时为-1，临时视频素材返回 VideoUrl 而没有文件内容
+type MediaInfo struct {
+	ContentType string `json:"content_type"`
+	FileName    string `json:"file_name"`
+	Size        int64  `json:"size"`
+	VideoUrl    string `json:"video_url,omitempty"`
+}
+
+// MaterialNewsItem 永久图文素材中的一篇图文
+type MaterialNewsItem struct {
+	Title            string `json:"title"`
+	ThumbMediaId     string `json:"thumb_media_id"`
+	ThumbUrl         string `json:"thumb_url,omitempty"`
+	ShowCoverPic     int    `json:"show_cover_pic"`
+	Author           string `json:"author"`
+	Digest           string `json:"digest"`
+	Content          string `json:"content"`
+	Url              string `json:"url"`
+	ContentSourceUrl string `json:"content_source_url"`
+}
+
+// MaterialInfo 获取的永久素材信息，图文素材返回 NewsItem，视频素材返回 Title、Description 与 DownUrl，其他类型为文件
+type MaterialInfo struct {
+	MediaInfo
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+	DownUrl     string             `json:"down_url,omitempty"`
+	NewsItem    []MaterialNewsItem `json:"news_item,omitempty"`
+}
+
+// MaterialCount 永久素材总数
+type MaterialCount struct {
+	VoiceCount int64 `json:"voice_count"`
+	VideoCount int64 `json:"video_count"`
+	ImageCount int64 `json:"image_count"`
+	NewsCount  int64 `json:"news_count"`
+}
+
+// MaterialItem 素材列表中的一项，图文素材的内容在 Content 中
+type MaterialItem struct {
+	MediaId    string `json:"media_id"`
+	Name       string `json:"name,omitempty"`
+	UpdateTime int64  `json:"update_time"`
+	Url        string `json:"url,omitempty"`
+	Content    *struct {
+		NewsItem []MaterialNewsItem `json:"news_item"`
+	} `json:"content,omitempty"`
+}
+
+// MaterialList 素材列表
+type MaterialList struct {
+	TotalCount int64          `json:"total_count"`
+	ItemCount  int64          `json:"item_count"`
+	Item       []MaterialItem `json:"item"`
+}
+
+// ValidateMedia 校验文件的扩展名、文件头与大小，返回读取文件的 io.Reader，
+// 文件头通过预读得到，返回的 io.Reader 从文件开头读取，读取超过大小限制时返回 ErrMediaTooLarge
+func ValidateMedia(limit MediaLimit, file MediaFile) (io.Reader, error) {
+	if file.Size > limit.MaxSize {
+		return nil, ErrMediaTooLarge
+	}
+
+	ext := strings.ToLower(path.Ext(file.Name))
+	allowed := false
+	for _, e := range limit.Extensions {
+		if e == ext {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, ErrInvalidMediaFormat
+	}
+
+	reader := bufio.NewReaderSize(file.Reader, 512)
+	if limit.ContentType != "" {
+		head, err := reader.Peek(512)
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return nil, err
+		}
+		if !strings.HasPrefix(http.DetectContentType(head), limit.ContentType) {
+			return nil, ErrInvalidMediaFormat
+		}
+	}
+
+	return &limitedReader{reader: reader, remaining: limit.MaxSize}, nil
+}
+
+// limitedReader 与 io.LimitedReader 不同，超过限制时返回错误而不是 io.EOF，避免上传被截断的文件
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n, ErrMediaTooLarge
+	}
+	return n, err
+}
+
+// postMultipart 以 multipart/form-data 流式上传文件，fields 为额外的表单字段
+func postMultipart(api string, fieldName string, fileName string, reader io.Reader, fields map[string]string) ([]byte, error) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	writeErr := make(chan error, 1)
+	go func() {
+		err := func() error {
+			for k, v := range fields {
+				if err := writer.WriteField(k, v); err != nil {
+					return err
+				}
+			}
+			part, err := writer.CreateFormFile(fieldName, path.Base(fileName))
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(part, reader); err != nil {
+				return err
+			}
+			return writer.Close()
+		}()
+		writeErr <- err
+		pw.CloseWithError(err)
+	}()
+
+	res, err := http.Post(api, writer.FormDataContentType(), pr)
+
+	// 微信提前返回响应时停止写入，读取文件出错时返回原始错误便于判断 ErrMediaTooLarge
+	pr.Close()
+	if e := <-writeErr; e != nil && e != io.ErrClosedPipe {
+		if err == nil {
+			res.Body.Close()
+		}
+		return []byte{}, e
+	}
+	if err != nil {
+		return []byte{}, err
+	}
+	defer res.Body.Close()
+
+	return ioutil.ReadAll(io.LimitReader(res.Body, MAX_MEDIA_JSON_SIZE))
+}
+
+// openMedia 打开素材下载的响应，json 响应读入内存并检查 errcode，返回的 body 为 nil；
+// 文件响应返回响应体，由调用方读取后关闭
+func openMedia(res *http.Response) (io.ReadCloser, []byte, MediaInfo, error) {
+	info := MediaInfo{ContentType: res.Header.Get("Content-Type"), Size: res.ContentLength}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, nil, info, errors.New("网络错误")
+	}
+
+	if strings.HasPrefix(info.ContentType, "application/json") || strings.HasPrefix(info.ContentType, "text/plain") {
+		defer res.Body.Close()
+		data, err := ioutil.ReadAll(io.LimitReader(res.Body, MAX_MEDIA_JSON_SIZE))
+		if err != nil {
+			return nil, nil, info, err
+		}
+		if err := ParseResult(data, nil); err != nil {
+			return nil, nil, info, err
+		}
+		return nil, data, info, nil
+	}
+
+	if _, params, err := mime.ParseMediaType(res.Header.Get("Content-Disposition")); err == nil {
+		info.FileName = params["filename"]
+	}
+	return res.Body, nil, info, nil
+}
+
+// UploadMedia 新增临时素材
+//
+// 参数：
+// type		媒体文件类型，image、voice、video、thumb
+// media	form-data中媒体文件标识，有filename、filelength、content-type等信息
+//
+// 返回：
+// 成功返回 { "type":"TYPE", "media_id":"MEDIA_ID", "created_at":123456789 }
+// 失败返回 { "errcode":40004,"errmsg":"invalid media type"}
+func UploadMedia(accessToken string, mediaType string, file MediaFile) (MediaResult, error) {
+	var result MediaResult
+	limit, ok := MediaLimits[mediaType]
+	if !ok {
+		return result, ErrInvalidMediaType
+	}
+	reader, err := ValidateMedia(limit, file)
+	if err != nil {
+		return result, err
+	}
+
+	resData, err := postMultipart(TokenUrl(MEDIA_UPLOAD, accessToken)+"&type="+mediaType, "media", file.Name, reader, nil)
+	if err != nil {
+		return result, err
+	}
+
+	err = ParseResult(resData, &result)
+	return result, err
+}
+
+// UploadArticleImage 上传图文消息内的图片，返回的url只能用于图文消息，不占用素材库的数量限制
+//
+// 返回：
+// 成功返回 { "url":"http://mmbiz.qpic.cn/mmbiz/gLO17UPS6FS2xsypf378iaNhWacZ1G1UplZYWEYfwvuU6Ont96b1roYs CNFwaRrSaKTPCUdBK9DgEHicsKwWCBRQ/0" }
+func UploadArticleImage(accessToken string, file MediaFile) (string, error) {
+	reader, err := ValidateMedia(ArticleImageLimit, file)
+	if err != nil {
+		return "", err
+	}
+
+	resData, err := postMultipart(TokenUrl(MEDIA_UPLOAD_IMG, accessToken), "media", file.Name, reader, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Url string `json:"url"`
+	}
+	err = ParseResult(resData, &result)
+	return result.Url, err
+}
+
+// AddMaterial 新增永久素材，视频素材需要 description
+//
+// 参数：
+// type			媒体文件类型，image、voice、video、thumb
+// media		form-data中媒体文件标识
+// description	视频素材的描述 { "title":VIDEO_TITLE, "introduction":INTRODUCTION }
+//
+// 返回：
+// 成功返回 { "media_id":MEDIA_ID, "url":URL }
+// 失败返回 { "errcode":40007,"errmsg":"invalid media_id"}
+func AddMaterial(accessToken string, mediaType string, file MediaFile, description *VideoDescription) (MaterialResult, error) {
+	var result MaterialResult
+	limit, ok := MaterialLimits[mediaType]
+	if !ok {
+		return result, ErrInvalidMediaType
+	}
+	if mediaType == MEDIA_TYPE_VIDEO && (description == nil || description.Title == "") {
+		return result, errors.New("video material requires title")
+	}
+	reader, err := ValidateMedia(limit, file)
+	if err != nil {
+		return result, err
+	}
+
+	var fields map[string]string
+	if mediaType == MEDIA_TYPE_VIDEO {
+		data, err := json.Marshal(description)
+		if err != nil {
+			return result, err
+		}
+		fields = map[string]string{"description": string(data)}
+	}
+
+	resData, err := postMultipart(TokenUrl(MATERIAL_ADD, accessToken)+"&type="+mediaType, "media", file.Name, reader, fields)
+	if err != nil {
+		return result, err
+	}
+
+	err = ParseResult(resData, &result)
+	return result, err
+}
+
+// OpenMedia 获取临时素材，返回的 io.ReadCloser 需要由调用方关闭，视频素材只返回 VideoUrl，io.ReadCloser 为 nil
+//
+// 返回：
+// 成功返回 文件内容，视频素材返回 { "video_url":DOWN_URL }
+// 失败返回 { "errcode":40007,"errmsg":"invalid media_id"}
+func OpenMedia(accessToken string, mediaId string) (io.ReadCloser, MediaInfo, error) {
+	return openTemporaryMedia(MEDIA_GET, accessToken, mediaId)
+}
+
+// OpenJssdkMedia 获取JSSDK上传的高清语音素材，格式为speex，16K采样率
+func OpenJssdkMedia(accessToken string, mediaId string) (io.ReadCloser, MediaInfo, error) {
+	return openTemporaryMedia(MEDIA_GET_JSSDK, accessToken, mediaId)
+}
+
+func openTemporaryMedia(api string, accessToken string, mediaId string) (io.ReadCloser, MediaInfo, error) {
+	res, err := http.Get(api + "?access_token=" + url.QueryEscape(accessToken) + "&media_id=" + url.QueryEscape(mediaId))
+	if err != nil {
+		return nil, MediaInfo{}, err
+	}
+
+	body, data, info, err := openMedia(res)
+	if err != nil || body != nil {
+		return body, info, err
+	}
+
+	var result struct {
+		VideoUrl string `json:"video_url"`
+	}
+	err = json.Unmarshal(data, &result)
+	info.VideoUrl = result.VideoUrl
+	return nil, info, err
+}
+
+// DownloadMedia 获取临时素材并写入 w
+func DownloadMedia(accessToken string, mediaId string, w io.Writer) (MediaInfo, error) {
+	body, info, err := OpenMedia(accessToken, mediaId)
+	if err != nil || body == nil {
+		return info, err
+	}
+	defer body.Close()
+
+	info.Size, err = io.Copy(w, body)
+	return info, err
+}
+
+// DownloadJssdkMedia 获取JSSDK上传的高清语音素材并写入 w
+func DownloadJssdkMedia(accessToken string, mediaId string, w io.Writer) (MediaInfo, error) {
+	body, info, err := OpenJssdkMedia(accessToken, mediaId)
+	if err != nil || body == nil {
+		return info, err
+	}
+	defer body.Close()
+
+	info.Size, err = io.Copy(w, body)
+	return info, err
+}
+
+// OpenMaterial 获取永久素材，图文与视频素材只返回 MaterialInfo，io.ReadCloser 为 nil，
+// 其他类型返回的 io.ReadCloser 需要由调用方关闭
+//
+//	参数：{
+//		  "media_id":MEDIA_ID
+//	}
+//
+// 返回：
+// 成功返回 图文素材 { "news_item":[ { "title":TITLE, "thumb_media_id":THUMB_MEDIA_ID, ... } ] }
+//
+//	视频素材 { "title":TITLE, "description":DESCRIPTION, "down_url":DOWN_URL }
+//	其他类型 文件内容
+//
+// 失败返回 { "errcode":40007,"errmsg":"invalid media_id"}
+func OpenMaterial(accessToken string, mediaId string) (io.ReadCloser, MaterialInfo, error) {
+	var info MaterialInfo
+	body, _ := json.Marshal(map[string]string{"media_id": mediaId})
+	res, err := http.Post(TokenUrl(MATERIAL_GET, accessToken), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, info, err
+	}
+
+	reader, data, mediaInfo, err := openMedia(res)
+	if err != nil || reader != nil {
+		info.MediaInfo = mediaInfo
+		return reader, info, err
+	}
+
+	err = json.Unmarshal(data, &info)
+	info.MediaInfo = mediaInfo
+	return nil, info, err
+}
+
+// DownloadMaterial 获取永久素材，文件内容写入 w
+func DownloadMaterial(accessToken string, mediaId string, w io.Writer) (MaterialInfo, error) {
+	body, info, err := OpenMaterial(accessToken, mediaId)
+	if err != nil || body == nil {
+		return info, err
+	}
+	defer body.Close()
+
+	info.Size, err = io.Copy(w, body)
+	return info, err
+}
+
+// DelMaterial
+//
+//	参数：{
+//		  "media_id":MEDIA_ID
+//	}
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func DelMaterial(accessToken string, mediaId string) error {
+	resData, err := MakePostReq(TokenUrl(MATERIAL_DEL, accessToken), map[string]string{
+		"media_id": mediaId,
+	}, "application/json")
+	if err != nil {
+		return err
+	}
+	return ParseResult(resData, nil)
+}
+
+// GetMaterialCount
+//
+// 返回：
+// 成功返回 { "voice_count":COUNT, "video_count":COUNT, "image_count":COUNT, "news_count":COUNT }
+func GetMaterialCount(accessToken string) (MaterialCount, error) {
+	var count MaterialCount
+	resData, err := MakeGetReq(MATERIAL_COUNT, map[string]string{
+		"access_token": accessToken,
+	})
+	if err != nil {
+		return count, err
+	}
+
+	err = ParseResult(resData, &count)
+	return count, err
+}
+
+// BatchGetMaterial 获取素材列表
+//
+//	参数：{
+//		  "type":TYPE,
+//		  "offset":OFFSET,
+//		  "count":COUNT
+//	}
+//
+// type为 image、video、voice、news，count 取值在1到20之间
+//
+// 返回：
+// 成功返回 { "total_count":TOTAL_COUNT, "item_count":ITEM_COUNT, "item":[ { "media_id":MEDIA_ID, "name":NAME, "update_time":UPDATE_TIME, "url":URL } ] }
+func BatchGetMaterial(accessToken string, mediaType string, offset int, count int) (MaterialList, error) {
+	var list MaterialList
+	if count < 1 || count > 20 {
+		count = 20
+	}
+	resData, err := MakePostReq(TokenUrl(MATERIAL_BATCHGET, accessToken), map[string]interface{}{
+		"type":   mediaType,
+		"offset": offset,
+		"count":  count,
+	}, "application/json")
+	if err != nil {
+		return list, err
+	}
+
+	err = ParseResult(resData, &list)
+	return list, err
+}
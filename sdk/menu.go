@@ -0,0 +1,471 @@
+package wechat
+
+import (
+	"strconv"
+	"strings"
+)
+
+// 自定义菜单与个性化菜单
+//
+// 文档：https://developers.weixin.qq.com/doc/offiaccount/Custom_Menus/Creating_Custom-Defined_Menu.html
+//      https://developers.weixin.qq.com/doc/offiaccount/Custom_Menus/Personalized_menu_interface.html
+
+const (
+	MENU_CREATE                = "https://api.weixin.qq.com/cgi-bin/menu/create?access_token=ACCESS_TOKEN"         // 创建菜单
+	MENU_GET                   = "https://api.weixin.qq.com/cgi-bin/menu/get"                                      // 查询菜单
+	MENU_DELETE                = "https://api.weixin.qq.com/cgi-bin/menu/delete"                                   // 删除菜单，同时删除所有个性化菜单
+	MENU_CURRENT_SELFMENU_INFO = "https://api.weixin.qq.com/cgi-bin/get_current_selfmenu_info"                     // 查询当前生效的菜单，包括在公众平台官网设置的菜单
+	MENU_ADD_CONDITIONAL       = "https://api.weixin.qq.com/cgi-bin/menu/addconditional?access_token=ACCESS_TOKEN" // 创建个性化菜单
+	MENU_DEL_CONDITIONAL       = "https://api.weixin.qq.com/cgi-bin/menu/delconditional?access_token=ACCESS_TOKEN" // 删除个性化菜单
+	MENU_TRY_MATCH             = "https://api.weixin.qq.com/cgi-bin/menu/trymatch?access_token=ACCESS_TOKEN"       // 测试个性化菜单匹配结果
+)
+
+const (
+	BUTTON_TYPE_CLICK                = "click"
+	BUTTON_TYPE_VIEW                 = "view"
+	BUTTON_TYPE_MINIPROGRAM          = "miniprogram"
+	BUTTON_TYPE_SCANCODE_PUSH        = "scancode_push"
+	BUTTON_TYPE_SCANCODE_WAITMSG     = "scancode_waitmsg"
+	BUTTON_TYPE_PIC_SYSPHOTO         = "pic_sysphoto"
+	BUTTON_TYPE_PIC_PHOTO_OR_ALBUM   = "pic_photo_or_album"
+	BUTTON_TYPE_PIC_WEIXIN           = "pic_weixin"
+	BUTTON_TYPE_LOCATION_SELECT      = "location_select"
+	BUTTON_TYPE_MEDIA_ID             = "media_id"
+	BUTTON_TYPE_VIEW_LIMITED         = "view_limited"
+	BUTTON_TYPE_ARTICLE_ID           = "article_id"
+	BUTTON_TYPE_ARTICLE_VIEW_LIMITED = "article_view_limited"
+
+	MAX_MENU_BUTTONS        = 3    // 一级菜单最多3个
+	MAX_MENU_SUB_BUTTONS    = 5    // 二级菜单最多5个
+	MAX_MENU_NAME_BYTES     = 16   // 一级菜单标题不超过16个字节
+	MAX_MENU_SUB_NAME_BYTES = 60   // 二级菜单标题不超过60个字节
+	MAX_MENU_KEY_BYTES      = 128  // 菜单KEY值不超过128字节
+	MAX_MENU_URL_BYTES      = 1024 // 网页链接不超过1024字节
+)
+
+// Button 菜单按钮，有子菜单的一级菜单只需要 Name 与 SubButton
+type Button struct {
+	Type      string   `json:"type,omitempty"`
+	Name      string   `json:"name"`
+	Key       string   `json:"key,omitempty"`
+	Url       string   `json:"url,omitempty"`
+	MediaId   string   `json:"media_id,omitempty"`
+	ArticleId string   `json:"article_id,omitempty"`
+	AppId     string   `json:"appid,omitempty"`
+	PagePath  string   `json:"pagepath,omitempty"`
+	SubButton []Button `json:"sub_button,omitempty"`
+}
+
+// NewClickButton 点击推事件，推送 CLICK 事件
+func NewClickButton(name string, key string) Button {
+	return Button{Type: BUTTON_TYPE_CLICK, Name: name, Key: key}
+}
+
+// NewViewButton 跳转网页
+func NewViewButton(name string, url string) Button {
+	return Button{Type: BUTTON_TYPE_VIEW, Name: name, Url: url}
+}
+
+// NewMiniprogramButton 跳转小程序，url 为不支持小程序的老版本客户端打开的网页
+func NewMiniprogramButton(name string, url string, appId string, pagePath string) Button {
+	return Button{Type: BUTTON_TYPE_MINIPROGRAM, Name: name, Url: url, AppId: appId, PagePath: pagePath}
+}
+
+// NewScanCodePushButton 扫码推事件
+func NewScanCodePushButton(name string, key string) Button {
+	return Button{Type: BUTTON_TYPE_SCANCODE_PUSH, Name: name, Key: key}
+}
+
+// NewScanCodeWaitMsgButton 扫码推事件且弹出“消息接收中”提示框
+func NewScanCodeWaitMsgButton(name string, key string) Button {
+	return Button{Type: BUTTON_TYPE_SCANCODE_WAITMSG, Name: name, Key: key}
+}
+
+// NewPicSysPhotoButton 弹出系统拍照发图
+func NewPicSysPhotoButton(name string, key string) Button {
+	return Button{Type: BUTTON_TYPE_PIC_SYSPHOTO, Name: name, Key: key}
+}
+
+// NewPicPhotoOrAlbumButton 弹出拍照或者相册发图
+func NewPicPhotoOrAlbumButton(name string, key string) Button {
+	return Button{Type: BUTTON_TYPE_PIC_PHOTO_OR_ALBUM, Name: name, Key: key}
+}
+
+// NewPicWeixinButton 弹出微信相册发图器
+func NewPicWeixinButton(name string, key string) Button {
+	return Button{Type: BUTTON_TYPE_PIC_WEIXIN, Name: name, Key: key}
+}
+
+// NewLocationSelectButton 弹出地理位置选择器
+func NewLocationSelectButton(name string, key string) Button {
+	return Button{Type: BUTTON_TYPE_LOCATION_SELECT, Name: name, Key: key}
+}
+
+// NewMediaIdButton 下发永久素材消息
+func NewMediaIdButton(name string, mediaId string) Button {
+	return Button{Type: BUTTON_TYPE_MEDIA_ID, Name: name, MediaId: mediaId}
+}
+
+// NewArticleIdButton 下发发布后的图文消息
+func NewArticleIdButton(name string, articleId string) Button {
+	return Button{Type: BUTTON_TYPE_ARTICLE_ID, Name: name, ArticleId: articleId}
+}
+
+// NewSubMenu 包含二级菜单的一级菜单
+func NewSubMenu(name string, subButtons ...Button) Button {
+	return Button{Name: name, SubButton: subButtons}
+}
+
+// MatchRule 个性化菜单的匹配规则，至少填写一项
+type MatchRule struct {
+	TagId              string `json:"tag_id,omitempty"`
+	Sex                string `json:"sex,omitempty"`     // 1 男 2 女
+	Country            string `json:"country,omitempty"` // 国家、省份、城市需按层级填写
+	Province           string `json:"province,omitempty"`
+	City               string `json:"city,omitempty"`
+	ClientPlatformType string `json:"client_platform_type,omitempty"` // 1 IOS 2 Android 3 Others
+	Language           string `json:"language,omitempty"`
+}
+
+// UnmarshalJSON menu/get 返回的 sex、client_platform_type 与 group_id 为数字，
+// group_id 为旧版的分组id，与 tag_id 相同，没有 tag_id 时作为 TagId
+func (rule *MatchRule) UnmarshalJSON(data []byte) error {
+	var v struct {
+		TagId              numberString `json:"tag_id"`
+		GroupId            numberString `json:"group_id"`
+		Sex                numberString `json:"sex"`
+		Country            string       `json:"country"`
+		Province           string       `json:"province"`
+		City               string       `json:"city"`
+		ClientPlatformType numberString `json:"client_platform_type"`
+		Language           string       `json:"language"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	*rule = MatchRule{
+		TagId:              string(v.TagId),
+		Sex:                string(v.Sex),
+		Country:            v.Country,
+		Province:           v.Province,
+		City:               v.City,
+		ClientPlatformType: string(v.ClientPlatformType),
+		Language:           v.Language,
+	}
+	if rule.TagId == "" {
+		rule.TagId = string(v.GroupId)
+	}
+	return nil
+}
+
+// numberString 接口返回中有时为数字有时为字符串的字段
+type numberString string
+
+func (s *numberString) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	*s = numberString(strings.Trim(string(data), `"`))
+	return nil
+}
+
+// MenuId 个性化菜单id，接口返回中有时为数字有时为字符串
+type MenuId string
+
+func (id *MenuId) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	*id = MenuId(strings.Trim(string(data), `"`))
+	return nil
+}
+
+// Menu 菜单，MatchRule 不为nil时为个性化菜单
+type Menu struct {
+	Button    []Button   `json:"button"`
+	MatchRule *MatchRule `json:"matchrule,omitempty"`
+	MenuId    MenuId     `json:"menuid,omitempty"`
+}
+
+type MenuInfo struct {
+	Menu            Menu   `json:"menu"`
+	ConditionalMenu []Menu `json:"conditionalmenu,omitempty"`
+}
+
+type SelfMenuNews struct {
+	Title      string `json:"title"`
+	Author     string `json:"author"`
+	Digest     string `json:"digest"`
+	ShowCover  int    `json:"show_cover"`
+	CoverUrl   string `json:"cover_url"`
+	ContentUrl string `json:"content_url"`
+	SourceUrl  string `json:"source_url"`
+}
+
+// SelfMenuButton 当前生效的菜单按钮，在公众平台官网设置的菜单类型为 text, img, voice, video, news，内容在 Value 或 NewsInfo 中
+type SelfMenuButton struct {
+	Type      string `json:"type,omitempty"`
+	Name      string `json:"name"`
+	Key       string `json:"key,omitempty"`
+	Url       string `json:"url,omitempty"`
+	Value     string `json:"value,omitempty"`
+	SubButton *struct {
+		List []SelfMenuButton `json:"list"`
+	} `json:"sub_button,omitempty"`
+	NewsInfo *struct {
+		List []SelfMenuNews `json:"list"`
+	} `json:"news_info,omitempty"`
+}
+
+type SelfMenuInfo struct {
+	IsMenuOpen   int `json:"is_menu_open"`
+	SelfMenuInfo struct {
+		Button []SelfMenuButton `json:"button"`
+	} `json:"selfmenu_info"`
+}
+
+// MenuError 菜单校验失败的原因，Path 如 button[1].sub_button[0]
+type MenuError struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+func (e *MenuError) Error() string {
+	return "invalid menu " + e.Path + ": " + e.Reason
+}
+
+// Validate 在上传前按微信的限制校验菜单
+func (menu *Menu) Validate() error {
+	if len(menu.Button) == 0 {
+		return &MenuError{"button", "at least 1 button is required"}
+	}
+	if len(menu.Button) > MAX_MENU_BUTTONS {
+		return &MenuError{"button", "at most " + strconv.Itoa(MAX_MENU_BUTTONS) + " buttons are allowed"}
+	}
+
+	for i, button := range menu.Button {
+		path := "button[" + strconv.Itoa(i) + "]"
+		if err := validateButtonName(path, button.Name, MAX_MENU_NAME_BYTES); err != nil {
+			return err
+		}
+
+		if len(button.SubButton) == 0 {
+			if err := validateButton(path, button); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if len(button.SubButton) > MAX_MENU_SUB_BUTTONS {
+			return &MenuError{path + ".sub_button", "at most " + strconv.Itoa(MAX_MENU_SUB_BUTTONS) + " sub buttons are allowed"}
+		}
+		for j, sub := range button.SubButton {
+			subPath := path + ".sub_button[" + strconv.Itoa(j) + "]"
+			if len(sub.SubButton) > 0 {
+				return &MenuError{subPath, "sub buttons can not have sub buttons"}
+			}
+			if err := validateButtonName(subPath, sub.Name, MAX_MENU_SUB_NAME_BYTES); err != nil {
+				return err
+			}
+			if err := validateButton(subPath, sub); err != nil {
+				return err
+			}
+		}
+	}
+
+	if menu.MatchRule != nil && *menu.MatchRule == (MatchRule{}) {
+		return &MenuError{"matchrule", "at least 1 rule is required"}
+	}
+	return nil
+}
+
+func validateButtonName(path string, name string, maxBytes int) error {
+	if name == "" {
+		return &MenuError{path + ".name", "name is required"}
+	}
+	if len(name) > maxBytes {
+		return &MenuError{path + ".name", "name exceeds " + strconv.Itoa(maxBytes) + " bytes"}
+	}
+	return nil
+}
+
+func validateButton(path string, button Button) error {
+	require := func(field string, value string, maxBytes int) error {
+		if value == "" {
+			return &MenuError{path + "." + field, field + " is required for " + button.Type + " button"}
+		}
+		if maxBytes > 0 && len(value) > maxBytes {
+			return &MenuError{path + "." + field, field + " exceeds " + strconv.Itoa(maxBytes) + " bytes"}
+		}
+		return nil
+	}
+
+	switch button.Type {
+	case BUTTON_TYPE_CLICK, BUTTON_TYPE_SCANCODE_PUSH, BUTTON_TYPE_SCANCODE_WAITMSG,
+		BUTTON_TYPE_PIC_SYSPHOTO, BUTTON_TYPE_PIC_PHOTO_OR_ALBUM, BUTTON_TYPE_PIC_WEIXIN, BUTTON_TYPE_LOCATION_SELECT:
+		return require("key", button.Key, MAX_MENU_KEY_BYTES)
+	case BUTTON_TYPE_VIEW:
+		return require("url", button.Url, MAX_MENU_URL_BYTES)
+	case BUTTON_TYPE_MINIPROGRAM:
+		if err := require("url", button.Url, MAX_MENU_URL_BYTES); err != nil {
+			return err
+		}
+		if err := require("appid", button.AppId, 0); err != nil {
+			return err
+		}
+		return require("pagepath", button.PagePath, 0)
+	case BUTTON_TYPE_MEDIA_ID, BUTTON_TYPE_VIEW_LIMITED:
+		return require("media_id", button.MediaId, 0)
+	case BUTTON_TYPE_ARTICLE_ID, BUTTON_TYPE_ARTICLE_VIEW_LIMITED:
+		return require("article_id", button.ArticleId, 0)
+	case "":
+		return &MenuError{path + ".type", "type is required for button without sub buttons"}
+	}
+	return &MenuError{path + ".type", "unknown button type " + button.Type}
+}
+
+// CreateMenu
+//
+//	参数：{
+//		  "button":[
+//		    { "type":"click", "name":"今日歌曲", "key":"V1001_TODAY_MUSIC" },
+//		    { "name":"菜单", "sub_button":[ { "type":"view", "name":"搜索", "url":"http://www.soso.com/" } ] }
+//		  ]
+//	}
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+// 失败返回 { "errcode":40018,"errmsg":"invalid button name size"}
+func CreateMenu(accessToken string, menu Menu) error {
+	menu.MatchRule = nil
+	menu.MenuId = ""
+	if err := menu.Validate(); err != nil {
+		return err
+	}
+
+	resData, err := MakePostReq(TokenUrl(MENU_CREATE, accessToken), menu, "application/json")
+	if err != nil {
+		return err
+	}
+	return ParseResult(resData, nil)
+}
+
+// GetMenu
+//
+// 返回：
+// 成功返回 { "menu":{ "button":[...], "menuid":208396938 }, "conditionalmenu":[ { "button":[...], "matchrule":{...}, "menuid":208396993 } ] }
+// 失败返回 { "errcode":46003,"errmsg":"menu no exist"}
+func GetMenu(accessToken string) (MenuInfo, error) {
+	var info MenuInfo
+	resData, err := MakeGetReq(MENU_GET, map[string]string{
+		"access_token": accessToken,
+	})
+	if err != nil {
+		return info, err
+	}
+
+	err = ParseResult(resData, &info)
+	return info, err
+}
+
+// DeleteMenu 删除菜单，同时删除所有个性化菜单
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func DeleteMenu(accessToken string) error {
+	resData, err := MakeGetReq(MENU_DELETE, map[string]string{
+		"access_token": accessToken,
+	})
+	if err != nil {
+		return err
+	}
+	return ParseResult(resData, nil)
+}
+
+// GetCurrentSelfMenuInfo
+//
+// 返回：
+// 成功返回 { "is_menu_open":1, "selfmenu_info":{ "button":[ { "type":"click", "name":"今日歌曲", "key":"V1001_TODAY_MUSIC" } ] } }
+func GetCurrentSelfMenuInfo(accessToken string) (SelfMenuInfo, error) {
+	var info SelfMenuInfo
+	resData, err := MakeGetReq(MENU_CURRENT_SELFMENU_INFO, map[string]string{
+		"access_token": accessToken,
+	})
+	if err != nil {
+		return info, err
+	}
+
+	err = ParseResult(resData, &info)
+	return info, err
+}
+
+// AddConditionalMenu
+//
+//	参数：{
+//		  "button":[ { "type":"click", "name":"今日歌曲", "key":"V1001_TODAY_MUSIC" } ],
+//		  "matchrule":{ "tag_id":"2", "client_platform_type":"2" }
+//	}
+//
+// 返回：
+// 成功返回 { "menuid":"208379533" }
+// 失败返回 { "errcode":65303,"errmsg":"there is no selfmenu, please create selfmenu first"}
+func AddConditionalMenu(accessToken string, menu Menu) (MenuId, error) {
+	menu.MenuId = ""
+	if menu.MatchRule == nil {
+		return "", &MenuError{"matchrule", "matchrule is required for conditional menu"}
+	}
+	if err := menu.Validate(); err != nil {
+		return "", err
+	}
+
+	resData, err := MakePostReq(TokenUrl(MENU_ADD_CONDITIONAL, accessToken), menu, "application/json")
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		MenuId MenuId `json:"menuid"`
+	}
+	err = ParseResult(resData, &result)
+	return result.MenuId, err
+}
+
+// DelConditionalMenu
+//
+// 参数：
+// menuid	个性化菜单id
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+// 失败返回 { "errcode":65301,"errmsg":"no such menu"}
+func DelConditionalMenu(accessToken string, menuId MenuId) error {
+	resData, err := MakePostReq(TokenUrl(MENU_DEL_CONDITIONAL, accessToken), map[string]MenuId{
+		"menuid": menuId,
+	}, "application/json")
+	if err != nil {
+		return err
+	}
+	return ParseResult(resData, nil)
+}
+
+// TryMatchMenu
+//
+// 参数：
+// user_id	粉丝的OpenID或微信号
+//
+// 返回：
+// 成功返回 { "button":[ { "type":"view", "name":"tx", "url":"http://www.qq.com/" } ] }
+// 失败返回 { "errcode":65304,"errmsg":"match rule empty"}
+func TryMatchMenu(accessToken string, userId string) (Menu, error) {
+	var menu Menu
+	resData, err := MakePostReq(TokenUrl(MENU_TRY_MATCH, accessToken), map[string]string{
+		"user_id": userId,
+	}, "application/json")
+	if err != nil {
+		return menu, err
+	}
+
+	err = ParseResult(resData, &menu)
+	return menu, err
+}
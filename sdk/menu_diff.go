@@ -0,0 +1,93 @@
+package wechat
+
+import (
+	"strconv"
+)
+
+// 菜单对比，按按钮位置逐项比较两份菜单，个性化菜单按匹配规则对应
+//
+// 输出的每一行以 + 新增、- 删除、~ 修改开头，如
+// ~ menu.button[0].name: "今日歌曲" -> "每日歌曲"
+// + menu.button[1].sub_button[2]: {"type":"view","name":"搜索","url":"http://www.soso.com/"}
+// - conditionalmenu{"tag_id":"2"}: {"button":[...],"matchrule":{"tag_id":"2"}}
+
+// DiffMenu 返回从 current 变为 desired 的差异，没有差异时返回空
+func DiffMenu(current MenuInfo, desired MenuInfo) []string {
+	diff := diffButtons("menu.button", current.Menu.Button, desired.Menu.Button)
+
+	// 匹配规则相同的个性化菜单按顺序对应
+	currentConditional := map[string][]Menu{}
+	for _, menu := range current.ConditionalMenu {
+		key := matchRuleKey(menu.MatchRule)
+		currentConditional[key] = append(currentConditional[key], menu)
+	}
+
+	matched := map[string]int{}
+	for _, menu := range desired.ConditionalMenu {
+		key := matchRuleKey(menu.MatchRule)
+		if matched[key] >= len(currentConditional[key]) {
+			diff = append(diff, "+ conditionalmenu"+key+": "+menuJson(Menu{Button: menu.Button, MatchRule: menu.MatchRule}))
+			continue
+		}
+		old := currentConditional[key][matched[key]]
+		matched[key]++
+		diff = append(diff, diffButtons("conditionalmenu"+key+".button", old.Button, menu.Button)...)
+	}
+
+	seen := map[string]int{}
+	for _, menu := range current.ConditionalMenu {
+		key := matchRuleKey(menu.MatchRule)
+		if seen[key]++; seen[key] > matched[key] {
+			diff = append(diff, "- conditionalmenu"+key+": "+menuJson(Menu{Button: menu.Button, MatchRule: menu.MatchRule}))
+		}
+	}
+
+	return diff
+}
+
+func diffButtons(path string, current []Button, desired []Button) []string {
+	var diff []string
+	for i := 0; i < len(current) || i < len(desired); i++ {
+		buttonPath := path + "[" + strconv.Itoa(i) + "]"
+		switch {
+		case i >= len(current):
+			diff = append(diff, "+ "+buttonPath+": "+menuJson(desired[i]))
+		case i >= len(desired):
+			diff = append(diff, "- "+buttonPath+": "+menuJson(current[i]))
+		default:
+			old, button := buttonFields(current[i]), buttonFields(desired[i])
+			for j := range old {
+				if old[j][1] != button[j][1] {
+					diff = append(diff, "~ "+buttonPath+"."+old[j][0]+": "+strconv.Quote(old[j][1])+" -> "+strconv.Quote(button[j][1]))
+				}
+			}
+			diff = append(diff, diffButtons(buttonPath+".sub_button", current[i].SubButton, desired[i].SubButton)...)
+		}
+	}
+	return diff
+}
+
+func buttonFields(button Button) [][2]string {
+	return [][2]string{
+		{"type", button.Type},
+		{"name", button.Name},
+		{"key", button.Key},
+		{"url", button.Url},
+		{"media_id", button.MediaId},
+		{"article_id", button.ArticleId},
+		{"appid", button.AppId},
+		{"pagepath", button.PagePath},
+	}
+}
+
+func matchRuleKey(rule *MatchRule) string {
+	if rule == nil {
+		return "{}"
+	}
+	return menuJson(rule)
+}
+
+func menuJson(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
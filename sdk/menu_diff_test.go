@@ -0,0 +1,88 @@
+package wechat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffMenu(t *testing.T) {
+	music := NewClickButton("今日歌曲", "V1001_TODAY_MUSIC")
+	search := NewViewButton("搜索", "http://www.soso.com/")
+	male, female := &MatchRule{TagId: "2", Sex: "1"}, &MatchRule{TagId: "2", Sex: "2"}
+	menu := func(buttons ...Button) Menu { return Menu{Button: buttons} }
+	conditional := func(rule *MatchRule, menuId MenuId, buttons ...Button) Menu {
+		return Menu{Button: buttons, MatchRule: rule, MenuId: menuId}
+	}
+
+	cases := []struct {
+		name             string
+		current, desired MenuInfo
+		want             []string
+	}{
+		{
+			name:    "no change",
+			current: MenuInfo{Menu: menu(music, NewSubMenu("菜单", search))},
+			desired: MenuInfo{Menu: menu(music, NewSubMenu("菜单", search))},
+		},
+		{
+			name:    "changed fields",
+			current: MenuInfo{Menu: menu(music)},
+			desired: MenuInfo{Menu: menu(NewViewButton("每日歌曲", "http://www.qq.com/"))},
+			want: []string{
+				`~ menu.button[0].type: "click" -> "view"`,
+				`~ menu.button[0].name: "今日歌曲" -> "每日歌曲"`,
+				`~ menu.button[0].key: "V1001_TODAY_MUSIC" -> ""`,
+				`~ menu.button[0].url: "" -> "http://www.qq.com/"`,
+			},
+		},
+		{
+			name:    "added and removed buttons",
+			current: MenuInfo{Menu: menu(music, search)},
+			desired: MenuInfo{Menu: menu(NewSubMenu("今日歌曲", music))},
+			want: []string{
+				`~ menu.button[0].type: "click" -> ""`,
+				`~ menu.button[0].key: "V1001_TODAY_MUSIC" -> ""`,
+				`+ menu.button[0].sub_button[0]: {"type":"click","name":"今日歌曲","key":"V1001_TODAY_MUSIC"}`,
+				`- menu.button[1]: {"type":"view","name":"搜索","url":"http://www.soso.com/"}`,
+			},
+		},
+		{
+			name: "conditional menus by matchrule",
+			current: MenuInfo{Menu: menu(music), ConditionalMenu: []Menu{
+				conditional(male, "1", music),
+				conditional(&MatchRule{Language: "en"}, "2", music),
+			}},
+			desired: MenuInfo{Menu: menu(music), ConditionalMenu: []Menu{
+				conditional(female, "", search),
+				conditional(male, "", search),
+			}},
+			want: []string{
+				`+ conditionalmenu{"tag_id":"2","sex":"2"}: {"button":[{"type":"view","name":"搜索","url":"http://www.soso.com/"}],"matchrule":{"tag_id":"2","sex":"2"}}`,
+				`~ conditionalmenu{"tag_id":"2","sex":"1"}.button[0].type: "click" -> "view"`,
+				`~ conditionalmenu{"tag_id":"2","sex":"1"}.button[0].name: "今日歌曲" -> "搜索"`,
+				`~ conditionalmenu{"tag_id":"2","sex":"1"}.button[0].key: "V1001_TODAY_MUSIC" -> ""`,
+				`~ conditionalmenu{"tag_id":"2","sex":"1"}.button[0].url: "" -> "http://www.soso.com/"`,
+				`- conditionalmenu{"language":"en"}: {"button":[{"type":"click","name":"今日歌曲","key":"V1001_TODAY_MUSIC"}],"matchrule":{"language":"en"}}`,
+			},
+		},
+		{
+			name: "duplicate matchrules in current menu",
+			current: MenuInfo{Menu: menu(music), ConditionalMenu: []Menu{
+				conditional(male, "1", music),
+				conditional(male, "2", search),
+			}},
+			desired: MenuInfo{Menu: menu(music), ConditionalMenu: []Menu{
+				conditional(male, "", music),
+			}},
+			want: []string{
+				`- conditionalmenu{"tag_id":"2","sex":"1"}: {"button":[{"type":"view","name":"搜索","url":"http://www.soso.com/"}],"matchrule":{"tag_id":"2","sex":"1"}}`,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		if diff := DiffMenu(c.current, c.desired); !reflect.DeepEqual(diff, c.want) {
+			t.Errorf("%s: DiffMenu\n got %q\nwant %q", c.name, diff, c.want)
+		}
+	}
+}
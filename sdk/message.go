@@ -0,0 +1,114 @@
+package wechat
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"sort"
+	"strings"
+)
+
+// 接收普通消息与事件推送
+//
+// 文档：https://developers.weixin.qq.com/doc/offiaccount/Basic_Information/Access_Overview.html
+//      https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Receiving_standard_messages.html
+//      https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Receiving_event_pushes.html
+
+// Signature 将参数按字典序排序后拼接做sha1，用于校验 signature 与 msg_signature
+func Signature(params ...string) string {
+	sort.Strings(params)
+	h := sha1.New()
+	h.Write([]byte(strings.Join(params, "")))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CheckSignature 校验服务器配置中的 signature
+func CheckSignature(token string, timestamp string, nonce string, signature string) bool {
+	return token != "" && Signature(token, timestamp, nonce) == signature
+}
+
+type ScanCodeInfo struct {
+	ScanType   string `xml:"ScanType" json:"ScanType"`
+	ScanResult string `xml:"ScanResult" json:"ScanResult"`
+}
+
+type SendPicsInfo struct {
+	Count   int          `xml:"Count" json:"Count"`
+	PicList []PicMd5Item `xml:"PicList>item" json:"PicList"`
+}
+
+type PicMd5Item struct {
+	PicMd5Sum string `xml:"PicMd5Sum" json:"PicMd5Sum"`
+}
+
+type SendLocationInfo struct {
+	LocationX float64 `xml:"Location_X" json:"Location_X"`
+	LocationY float64 `xml:"Location_Y" json:"Location_Y"`
+	Scale     float64 `xml:"Scale" json:"Scale"`
+	Label     string  `xml:"Label" json:"Label"`
+	Poiname   string  `xml:"Poiname" json:"Poiname"`
+}
+
+// MixMessage 微信推送的消息与事件，所有类型的字段都在一个结构中
+type MixMessage struct {
+	XMLName xml.Name `xml:"xml" json:"-"`
+
+	ToUserName   string `xml:"ToUserName" json:"ToUserName"`
+	FromUserName string `xml:"FromUserName" json:"FromUserName"`
+	CreateTime   int64  `xml:"CreateTime" json:"CreateTime"`
+	MsgType      string `xml:"MsgType" json:"MsgType"`
+
+	// 普通消息
+	MsgId        int64   `xml:"MsgId" json:"MsgId,omitempty"`
+	Content      string  `xml:"Content" json:"Content,omitempty"`
+	PicUrl       string  `xml:"PicUrl" json:"PicUrl,omitempty"`
+	MediaId      string  `xml:"MediaId" json:"MediaId,omitempty"`
+	Format       string  `xml:"Format" json:"Format,omitempty"`
+	Recognition  string  `xml:"Recognition" json:"Recognition,omitempty"`
+	ThumbMediaId string  `xml:"ThumbMediaId" json:"ThumbMediaId,omitempty"`
+	LocationX    float64 `xml:"Location_X" json:"Location_X,omitempty"`
+	LocationY    float64 `xml:"Location_Y" json:"Location_Y,omitempty"`
+	Scale        float64 `xml:"Scale" json:"Scale,omitempty"`
+	Label        string  `xml:"Label" json:"Label,omitempty"`
+	Title        string  `xml:"Title" json:"Title,omitempty"`
+	Description  string  `xml:"Description" json:"Description,omitempty"`
+	Url          string  `xml:"Url" json:"Url,omitempty"`
+
+	// 事件
+	Event     string  `xml:"Event" json:"Event,omitempty"`
+	EventKey  string  `xml:"EventKey" json:"EventKey,omitempty"`
+	Ticket    string  `xml:"Ticket" json:"Ticket,omitempty"`
+	Latitude  float64 `xml:"Latitude" json:"Latitude,omitempty"`
+	Longitude float64 `xml:"Longitude" json:"Longitude,omitempty"`
+	Precision float64 `xml:"Precision" json:"Precision,omitempty"`
+	MenuId    string  `xml:"MenuId" json:"MenuId,omitempty"`
+
+	ScanCodeInfo     *ScanCodeInfo     `xml:"ScanCodeInfo" json:"ScanCodeInfo,omitempty"`
+	SendPicsInfo     *SendPicsInfo     `xml:"SendPicsInfo" json:"SendPicsInfo,omitempty"`
+	SendLocationInfo *SendLocationInfo `xml:"SendLocationInfo" json:"SendLocationInfo,omitempty"`
+
+	// 群发与模板消息结果
+	MsgID       int64  `xml:"MsgID" json:"MsgID,omitempty"`
+	Status      string `xml:"Status" json:"Status,omitempty"`
+	TotalCount  int64  `xml:"TotalCount" json:"TotalCount,omitempty"`
+	FilterCount int64  `xml:"FilterCount" json:"FilterCount,omitempty"`
+	SentCount   int64  `xml:"SentCount" json:"SentCount,omitempty"`
+	ErrorCount  int64  `xml:"ErrorCount" json:"ErrorCount,omitempty"`
+
+	// 订阅通知
+	SubscribeMsgPopupEvent  *SubscribeMsgEvent `xml:"SubscribeMsgPopupEvent" json:"SubscribeMsgPopupEvent,omitempty"`
+	SubscribeMsgChangeEvent *SubscribeMsgEvent `xml:"SubscribeMsgChangeEvent" json:"SubscribeMsgChangeEvent,omitempty"`
+	SubscribeMsgSentEvent   *SubscribeMsgEvent `xml:"SubscribeMsgSentEvent" json:"SubscribeMsgSentEvent,omitempty"`
+
+	// 发布结果
+	PublishEventInfo *PublishStatus `xml:"PublishEventInfo" json:"PublishEventInfo,omitempty"`
+}
+
+// ParseMessage 解析推送的xml消息体
+func ParseMessage(data []byte) (*MixMessage, error) {
+	var msg MixMessage
+	if err := xml.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
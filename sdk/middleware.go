@@ -0,0 +1,153 @@
+package wechat
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 消息路由中间件
+
+// Logging 记录每条消息的类型、来源、耗时与错误
+func Logging(logger *log.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) (Reply, error) {
+			start := time.Now()
+			reply, err := next(ctx)
+
+			msg := ctx.Message
+			logger.Printf("account:%d | %s | %s | %s | %s | %v | %v",
+				ctx.AccountId, msg.FromUserName, msg.MsgType, msg.Event, msg.EventKey, time.Since(start), err)
+
+			return reply, err
+		}
+	}
+}
+
+// Recovery 将处理函数中的panic转换为error
+func Recovery() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) (reply Reply, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					reply = nil
+					err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+				}
+			}()
+			return next(ctx)
+		}
+	}
+}
+
+// DedupStore 消息排重的存储
+type DedupStore interface {
+	// Add 记录key并设置过期时间，key已存在时返回false
+	Add(key string, ttl time.Duration) (bool, error)
+}
+
+// Dedup 丢弃重复推送的消息，直接回复 success
+//
+// 微信服务器在五秒内收不到响应会断掉连接，并且重新发起请求，总共重试三次
+func Dedup(store DedupStore, ttl time.Duration) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) (Reply, error) {
+			ok, err := store.Add(strconv.Itoa(ctx.AccountId)+":"+DedupKey(ctx.Message), ttl)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, nil
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// DedupKey 消息排重的key，普通消息使用MsgId，事件使用FromUserName与CreateTime
+func DedupKey(msg *MixMessage) string {
+	if msg.MsgId != 0 {
+		return strconv.FormatInt(msg.MsgId, 10)
+	}
+	return msg.FromUserName + ":" + strconv.FormatInt(msg.CreateTime, 10) + ":" + msg.Event
+}
+
+// MemoryDedupStore 进程内的排重存储，多实例部署时请使用共享的存储
+type MemoryDedupStore struct {
+	mu        sync.Mutex
+	keys      map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewMemoryDedupStore() *MemoryDedupStore {
+	return &MemoryDedupStore{keys: map[string]time.Time{}, lastSweep: time.Now()}
+}
+
+func (s *MemoryDedupStore) Add(key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, expire := range s.keys {
+			if now.After(expire) {
+				delete(s.keys, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if expire, ok := s.keys[key]; ok && now.Before(expire) {
+		return false, nil
+	}
+	s.keys[key] = now.Add(ttl)
+	return true, nil
+}
+
+// LateReplyFunc 处理超时后在后台执行完成的处理函数的结果
+type LateReplyFunc func(ctx *Context, reply Reply, err error)
+
+// Timeout 处理函数超过 budget 仍未返回时先回复 success，处理函数继续在后台执行，
+// 执行完成后的回复交给 late 处理，例如通过客服消息下发
+//
+// Timeout 之后添加的中间件与处理函数运行在单独的goroutine中，需要在其后添加 Recovery
+func Timeout(budget time.Duration, late LateReplyFunc) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) (Reply, error) {
+			type result struct {
+				reply Reply
+				err   error
+			}
+
+			done := make(chan result)
+			timeout := make(chan struct{})
+			go func() {
+				reply, err := next(ctx)
+				select {
+				case done <- result{reply, err}:
+				case <-timeout:
+					late(ctx, reply, err)
+				}
+			}()
+
+			timer := time.NewTimer(budget)
+			defer timer.Stop()
+
+			select {
+			case res := <-done:
+				return res.reply, res.err
+			case <-timer.C:
+				close(timeout)
+				// 处理函数可能恰好在超时的同时完成
+				select {
+				case res := <-done:
+					return res.reply, res.err
+				default:
+					return nil, nil
+				}
+			}
+		}
+	}
+}
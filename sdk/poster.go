@@ -0,0 +1,379 @@
+package wechat
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 海报合成，在背景图上按固定布局放置二维码或小程序码、用户头像与昵称
+//
+// 布局为json文件：
+//
+// {
+// 	  "background":"bg.jpg",
+// 	  "code":{ "x":460, "y":980, "size":200 },
+// 	  "avatar":{ "x":40, "y":1000, "size":96, "circle":true },
+// 	  "nickname":{ "x":156, "y":1030, "font_size":32, "color":"#333333", "max_width":280 }
+// }
+//
+// background 相对布局文件所在目录，坐标以背景图左上角为原点，size 为0时不绘制。
+// 标准库没有字体渲染，昵称通过 TextRenderer 绘制，可以使用 LoadBDFFont 加载的点阵字体或自行接入矢量字体
+
+// PosterLayout 海报布局
+type PosterLayout struct {
+	Background string     `json:"background"`
+	Code       PosterBox  `json:"code"`
+	Avatar     PosterBox  `json:"avatar"`
+	Nickname   PosterText `json:"nickname"`
+}
+
+// PosterBox 图片的位置与边长，Circle 为true时裁剪为圆形
+type PosterBox struct {
+	X      int  `json:"x"`
+	Y      int  `json:"y"`
+	Size   int  `json:"size"`
+	Circle bool `json:"circle"`
+}
+
+// PosterText 文字的位置与样式，Y 为文字顶部，Align 为 left(默认)、center 或 right，
+// 宽度超过 MaxWidth 时截断并加省略号
+type PosterText struct {
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	FontSize int    `json:"font_size"`
+	Color    string `json:"color"`
+	Align    string `json:"align"`
+	MaxWidth int    `json:"max_width"`
+}
+
+// TextRenderer 文字渲染
+type TextRenderer interface {
+	// MeasureText 文字在 fontSize 像素高时的宽度
+	MeasureText(text string, fontSize int) int
+	// DrawText 在 (x, y) 处绘制文字，y 为文字顶部
+	DrawText(dst draw.Image, text string, x int, y int, fontSize int, c color.Color)
+}
+
+// Poster 海报模板，Text 为空时不绘制昵称
+type Poster struct {
+	Layout     PosterLayout
+	Background image.Image
+	Text       TextRenderer
+}
+
+// LoadPoster 读取布局文件与背景图
+func LoadPoster(layoutFile string) (*Poster, error) {
+	data, err := ioutil.ReadFile(layoutFile)
+	if err != nil {
+		return nil, err
+	}
+	var layout PosterLayout
+	if err := json.Unmarshal(data, &layout); err != nil {
+		return nil, errors.New("invalid poster layout: " + err.Error())
+	}
+	if layout.Background == "" {
+		return nil, errors.New("poster background required")
+	}
+
+	background := layout.Background
+	if !filepath.IsAbs(background) {
+		background = filepath.Join(filepath.Dir(layoutFile), background)
+	}
+	f, err := os.Open(background)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	return &Poster{Layout: layout, Background: img}, nil
+}
+
+// Compose 合成海报，code 与 avatar 为空时不绘制
+func (p *Poster) Compose(code image.Image, avatar image.Image, nickname string) (*image.RGBA, error) {
+	if p.Background == nil {
+		return nil, errors.New("poster background required")
+	}
+	bounds := p.Background.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), p.Background, bounds.Min, draw.Src)
+
+	drawPosterImage(dst, code, p.Layout.Code)
+	drawPosterImage(dst, avatar, p.Layout.Avatar)
+
+	text := p.Layout.Nickname
+	if p.Text != nil && nickname != "" && text.FontSize > 0 {
+		c := color.Color(color.Black)
+		if text.Color != "" {
+			rgba, err := ParseColor(text.Color)
+			if err != nil {
+				return nil, err
+			}
+			c = rgba
+		}
+
+		width := p.Text.MeasureText(nickname, text.FontSize)
+		if text.MaxWidth > 0 && width > text.MaxWidth {
+			runes := []rune(nickname)
+			for len(runes) > 0 && width > text.MaxWidth {
+				runes = runes[:len(runes)-1]
+				nickname = string(runes) + "..."
+				width = p.Text.MeasureText(nickname, text.FontSize)
+			}
+		}
+
+		x := text.X
+		switch text.Align {
+		case "center":
+			x -= width / 2
+		case "right":
+			x -= width
+		}
+		p.Text.DrawText(dst, nickname, x, text.Y, text.FontSize, c)
+	}
+	return dst, nil
+}
+
+func drawPosterImage(dst draw.Image, src image.Image, box PosterBox) {
+	if src == nil || box.Size <= 0 {
+		return
+	}
+	scaled := ResizeImage(src, box.Size, box.Size)
+	rect := image.Rect(box.X, box.Y, box.X+box.Size, box.Y+box.Size)
+	if box.Circle {
+		draw.DrawMask(dst, rect, scaled, image.ZP, circleMask{box.Size}, image.ZP, draw.Over)
+	} else {
+		draw.Draw(dst, rect, scaled, image.ZP, draw.Over)
+	}
+}
+
+// circleMask 内切圆遮罩，边缘一个像素抗锯齿
+type circleMask struct {
+	size int
+}
+
+func (c circleMask) ColorModel() color.Model {
+	return color.AlphaModel
+}
+
+func (c circleMask) Bounds() image.Rectangle {
+	return image.Rect(0, 0, c.size, c.size)
+}
+
+func (c circleMask) At(x int, y int) color.Color {
+	r := float64(c.size) / 2
+	dist := math.Hypot(float64(x)+0.5-r, float64(y)+0.5-r)
+	alpha := math.Max(0, math.Min(1, r-dist+0.5))
+	return color.Alpha{uint8(alpha * 0xff)}
+}
+
+// ResizeImage 按区域平均缩放图片，放大时为最近邻
+func ResizeImage(src image.Image, width int, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if sw == 0 || sh == 0 {
+		return dst
+	}
+	for y := 0; y < height; y++ {
+		y0 := b.Min.Y + y*sh/height
+		y1 := b.Min.Y + (y+1)*sh/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := b.Min.X + x*sw/width
+			x1 := b.Min.X + (x+1)*sw/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+cr, g+cg, bl+cb, a+ca, n+1
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n >> 8), uint8(g / n >> 8), uint8(bl / n >> 8), uint8(a / n >> 8)})
+		}
+	}
+	return dst
+}
+
+// ParseColor 解析 #rgb、#rrggbb 或 #rrggbbaa 格式的颜色
+func ParseColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 4 {
+		return color.RGBA{}, errors.New("invalid color")
+	}
+	// color.RGBA 为预乘 alpha
+	a := uint32(b[3])
+	return color.RGBA{uint8(uint32(b[0]) * a / 0xff), uint8(uint32(b[1]) * a / 0xff), uint8(uint32(b[2]) * a / 0xff), b[3]}, nil
+}
+
+// BitmapFont BDF 格式的点阵字体，绘制时按 fontSize 整数倍放大，如 GNU Unifont、文泉驿点阵宋体
+type BitmapFont struct {
+	glyphs  map[rune]bitmapGlyph
+	ascent  int
+	descent int
+	unknown rune
+}
+
+type bitmapGlyph struct {
+	advance int
+	width   int
+	height  int
+	xoff    int
+	yoff    int
+	rows    [][]byte
+}
+
+// LoadBDFFont 读取 BDF 字体文件
+func LoadBDFFont(file string) (*BitmapFont, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseBDFFont(f)
+}
+
+// ParseBDFFont 解析 BDF 字体
+func ParseBDFFont(r io.Reader) (*BitmapFont, error) {
+	font := &BitmapFont{glyphs: map[rune]bitmapGlyph{}, unknown: '?'}
+	var (
+		glyph    bitmapGlyph
+		encoding = -1
+		bitmap   bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if bitmap {
+			if fields[0] == "ENDCHAR" {
+				bitmap = false
+				if encoding >= 0 {
+					font.glyphs[rune(encoding)] = glyph
+				}
+				continue
+			}
+			row, err := hex.DecodeString(fields[0])
+			if err != nil {
+				return nil, errors.New("invalid bdf bitmap")
+			}
+			glyph.rows = append(glyph.rows, row)
+			continue
+		}
+
+		ints := make([]int, len(fields)-1)
+		for i, field := range fields[1:] {
+			ints[i], _ = strconv.Atoi(field)
+		}
+		switch {
+		case fields[0] == "FONT_ASCENT" && len(ints) > 0:
+			font.ascent = ints[0]
+		case fields[0] == "FONT_DESCENT" && len(ints) > 0:
+			font.descent = ints[0]
+		case fields[0] == "DEFAULT_CHAR" && len(ints) > 0:
+			font.unknown = rune(ints[0])
+		case fields[0] == "FONTBOUNDINGBOX" && len(ints) == 4 && font.ascent == 0:
+			font.ascent, font.descent = ints[1]+ints[3], -ints[3]
+		case fields[0] == "STARTCHAR":
+			glyph, encoding = bitmapGlyph{}, -1
+		case fields[0] == "ENCODING" && len(ints) > 0:
+			encoding = ints[0]
+		case fields[0] == "DWIDTH" && len(ints) > 0:
+			glyph.advance = ints[0]
+		case fields[0] == "BBX" && len(ints) == 4:
+			glyph.width, glyph.height, glyph.xoff, glyph.yoff = ints[0], ints[1], ints[2], ints[3]
+		case fields[0] == "BITMAP":
+			bitmap = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(font.glyphs) == 0 || font.ascent+font.descent <= 0 {
+		return nil, errors.New("invalid bdf font")
+	}
+	return font, nil
+}
+
+// scale 字号对应的放大倍数
+func (f *BitmapFont) scale(fontSize int) int {
+	scale := int(math.Floor(float64(fontSize)/float64(f.ascent+f.descent) + 0.5))
+	if scale < 1 {
+		scale = 1
+	}
+	return scale
+}
+
+func (f *BitmapFont) glyph(r rune) (bitmapGlyph, bool) {
+	glyph, ok := f.glyphs[r]
+	if !ok {
+		glyph, ok = f.glyphs[f.unknown]
+	}
+	return glyph, ok
+}
+
+// MeasureText 实现 TextRenderer
+func (f *BitmapFont) MeasureText(text string, fontSize int) int {
+	width := 0
+	for _, r := range text {
+		if glyph, ok := f.glyph(r); ok {
+			width += glyph.advance
+		}
+	}
+	return width * f.scale(fontSize)
+}
+
+// DrawText 实现 TextRenderer
+func (f *BitmapFont) DrawText(dst draw.Image, text string, x int, y int, fontSize int, c color.Color) {
+	scale := f.scale(fontSize)
+	src := image.NewUniform(c)
+	baseline := y + f.ascent*scale
+	for _, r := range text {
+		glyph, ok := f.glyph(r)
+		if !ok {
+			continue
+		}
+		top := baseline - (glyph.yoff+glyph.height)*scale
+		for gy, row := range glyph.rows {
+			for gx := 0; gx < glyph.width && gx/8 < len(row); gx++ {
+				if row[gx/8]&(0x80>>uint(gx%8)) == 0 {
+					continue
+				}
+				px, py := x+(glyph.xoff+gx)*scale, top+gy*scale
+				draw.Draw(dst, image.Rect(px, py, px+scale, py+scale), src, image.ZP, draw.Over)
+			}
+		}
+		x += glyph.advance * scale
+	}
+}
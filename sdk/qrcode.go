@@ -0,0 +1,219 @@
+package wechat
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// 公众号带参数二维码与短链接
+//
+// 用户扫描带场景值的二维码时推送 subscribe(未关注，EventKey 为 qrscene_ 加场景值)或 SCAN(已关注，EventKey 为场景值)事件
+//
+// 文档：https://developers.weixin.qq.com/doc/offiaccount/Account_Management/Generating_a_Parametric_QR_Code.html
+//      https://developers.weixin.qq.com/doc/offiaccount/Account_Management/URL_Shortener.html
+
+const (
+	QRCODE_CREATE = "https://api.weixin.qq.com/cgi-bin/qrcode/create?access_token=ACCESS_TOKEN" // 生成带参数的二维码
+	QRCODE_SHOW   = "https://mp.weixin.qq.com/cgi-bin/showqrcode"                               // 通过ticket换取二维码
+	SHORT_URL     = "https://api.weixin.qq.com/cgi-bin/shorturl?access_token=ACCESS_TOKEN"      // 长链接转短链接
+	SHORTEN_GEN   = "https://api.weixin.qq.com/cgi-bin/shorten/gen?access_token=ACCESS_TOKEN"   // 生成短key
+	SHORTEN_FETCH = "https://api.weixin.qq.com/cgi-bin/shorten/fetch?access_token=ACCESS_TOKEN" // 获取短key对应的长信息
+
+	QR_SCENE           = "QR_SCENE"           // 临时的整型参数值
+	QR_STR_SCENE       = "QR_STR_SCENE"       // 临时的字符串参数值
+	QR_LIMIT_SCENE     = "QR_LIMIT_SCENE"     // 永久的整型参数值
+	QR_LIMIT_STR_SCENE = "QR_LIMIT_STR_SCENE" // 永久的字符串参数值
+
+	QRCODE_SCENE_PREFIX       = "qrscene_" // 未关注用户扫码关注时 EventKey 的前缀
+	MAX_QRCODE_EXPIRE_SECONDS = 2592000    // 临时二维码最长30天
+	MAX_LIMIT_SCENE_ID        = 100000     // 永久二维码整型场景值为1到100000
+	MAX_SCENE_STR_LEN         = 64
+)
+
+var ErrInvalidScene = errors.New("invalid qrcode scene")
+
+// QrcodeScene 二维码场景值，SceneStr 不为空时使用字符串参数值
+type QrcodeScene struct {
+	SceneId  int64  `json:"scene_id,omitempty"`
+	SceneStr string `json:"scene_str,omitempty"`
+}
+
+// Qrcode 生成的二维码，Url 为二维码图片解析后的地址
+type Qrcode struct {
+	Ticket        string `json:"ticket"`
+	ExpireSeconds int64  `json:"expire_seconds,omitempty"`
+	Url           string `json:"url"`
+}
+
+// ShortenData shorten/fetch 返回的长信息
+type ShortenData struct {
+	LongData      string `json:"long_data"`
+	CreateTime    int64  `json:"create_time"`
+	ExpireSeconds int64  `json:"expire_seconds"`
+}
+
+// CreateQrcode 生成带参数的二维码，permanent 为false时生成临时二维码，expireSeconds 为0时默认30秒
+//
+//	参数：{
+//		  "expire_seconds":604800,
+//		  "action_name":"QR_STR_SCENE",
+//		  "action_info":{ "scene":{ "scene_str":"test" } }
+//	}
+//
+// 返回：
+// 成功返回 { "ticket":"gQH47joAAAAAAAAAASxodHRwOi8vd2VpeGluLnFxLmNvbS9xL2taZ2Z3TVRtNzJXV1Brb3ZhYmJJAAIEZ23sUwMEmm3sUw==", "expire_seconds":60, "url":"http://weixin.qq.com/q/kZgfwMTm72WWPkovabbI" }
+// 失败返回 { "errcode":40013,"errmsg":"invalid appid"}
+func CreateQrcode(accessToken string, scene QrcodeScene, permanent bool, expireSeconds int64) (Qrcode, error) {
+	var qrcode Qrcode
+	if scene.SceneStr == "" && scene.SceneId <= 0 || len(scene.SceneStr) > MAX_SCENE_STR_LEN {
+		return qrcode, ErrInvalidScene
+	}
+
+	action := QrcodeAction(scene, permanent)
+	if action == QR_LIMIT_SCENE && scene.SceneId > MAX_LIMIT_SCENE_ID {
+		return qrcode, ErrInvalidScene
+	}
+
+	params := map[string]interface{}{
+		"action_name": action,
+		"action_info": map[string]QrcodeScene{"scene": scene},
+	}
+	if !permanent && expireSeconds > 0 {
+		if expireSeconds > MAX_QRCODE_EXPIRE_SECONDS {
+			expireSeconds = MAX_QRCODE_EXPIRE_SECONDS
+		}
+		params["expire_seconds"] = expireSeconds
+	}
+
+	resData, err := MakePostReq(TokenUrl(QRCODE_CREATE, accessToken), params, "application/json")
+	if err != nil {
+		return qrcode, err
+	}
+
+	err = ParseResult(resData, &qrcode)
+	return qrcode, err
+}
+
+// QrcodeAction 二维码类型，QR_SCENE、QR_STR_SCENE、QR_LIMIT_SCENE 或 QR_LIMIT_STR_SCENE
+func QrcodeAction(scene QrcodeScene, permanent bool) string {
+	switch {
+	case permanent && scene.SceneStr != "":
+		return QR_LIMIT_STR_SCENE
+	case permanent:
+		return QR_LIMIT_SCENE
+	case scene.SceneStr != "":
+		return QR_STR_SCENE
+	default:
+		return QR_SCENE
+	}
+}
+
+// QrcodeImageUrl 通过ticket换取二维码图片的地址，不需要access_token
+func QrcodeImageUrl(ticket string) string {
+	return QRCODE_SHOW + "?ticket=" + url.QueryEscape(ticket)
+}
+
+// OpenQrcode 获取二维码图片，返回的 io.ReadCloser 需要由调用方关闭
+func OpenQrcode(ticket string) (io.ReadCloser, MediaInfo, error) {
+	res, err := http.Get(QrcodeImageUrl(ticket))
+	if err != nil {
+		return nil, MediaInfo{}, err
+	}
+
+	body, _, info, err := openMedia(res)
+	if err == nil && body == nil {
+		err = errors.New("网络错误")
+	}
+	if info.FileName == "" {
+		info.FileName = "qrcode.jpg"
+	}
+	return body, info, err
+}
+
+// DownloadQrcode 获取二维码图片并写入 w
+func DownloadQrcode(ticket string, w io.Writer) (MediaInfo, error) {
+	body, info, err := OpenQrcode(ticket)
+	if err != nil {
+		return info, err
+	}
+	defer body.Close()
+
+	info.Size, err = io.Copy(w, body)
+	return info, err
+}
+
+// QrcodeSceneFromEventKey 从 subscribe 或 SCAN 事件的 EventKey 中取出场景值
+func QrcodeSceneFromEventKey(eventKey string) string {
+	return strings.TrimPrefix(eventKey, QRCODE_SCENE_PREFIX)
+}
+
+// ShortUrl 长链接转短链接
+//
+//	参数：{
+//		  "action":"long2short",
+//		  "long_url":"http://wap.koudaitong.com/v2/showcase/goods?alias=128wi9shh"
+//	}
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok", "short_url":"http://w.url.cn/s/AvCo6Ih" }
+func ShortUrl(accessToken string, longUrl string) (string, error) {
+	resData, err := MakePostReq(TokenUrl(SHORT_URL, accessToken), map[string]string{
+		"action":   "long2short",
+		"long_url": longUrl,
+	}, "application/json")
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		ShortUrl string `json:"short_url"`
+	}
+	err = ParseResult(resData, &result)
+	return result.ShortUrl, err
+}
+
+// ShortenGen 将长信息转换为短key，expireSeconds 最长30天，为0时默认30天
+//
+//	参数：{
+//		  "long_data":"loooooong data",
+//		  "expire_seconds":86400
+//	}
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok", "short_key":"iTVEGWbNLGUdWWz" }
+func ShortenGen(accessToken string, longData string, expireSeconds int64) (string, error) {
+	params := map[string]interface{}{"long_data": longData}
+	if expireSeconds > 0 {
+		params["expire_seconds"] = expireSeconds
+	}
+	resData, err := MakePostReq(TokenUrl(SHORTEN_GEN, accessToken), params, "application/json")
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		ShortKey string `json:"short_key"`
+	}
+	err = ParseResult(resData, &result)
+	return result.ShortKey, err
+}
+
+// ShortenFetch 获取短key对应的长信息
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok", "long_data":"loooooong data", "create_time":1611047541, "expire_seconds":86300 }
+func ShortenFetch(accessToken string, shortKey string) (ShortenData, error) {
+	var data ShortenData
+	resData, err := MakePostReq(TokenUrl(SHORTEN_FETCH, accessToken), map[string]string{
+		"short_key": shortKey,
+	}, "application/json")
+	if err != nil {
+		return data, err
+	}
+
+	err = ParseResult(resData, &data)
+	return data, err
+}
@@ -0,0 +1,714 @@
+package wechat
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// 本地二维码编码，不依赖微信接口，用于支付 code_url、短链接、网页授权链接等
+//
+// 按 ISO/IEC 18004 编码，内容为纯数字或大写字母数字时使用数字、字母数字模式，其余按字节模式(UTF-8)，
+// 自动选择能容纳内容的最小版本与罚分最低的掩码
+
+type QrLevel int
+
+const (
+	QR_LEVEL_L QrLevel = iota // 约7%纠错
+	QR_LEVEL_M                // 约15%纠错
+	QR_LEVEL_Q                // 约25%纠错
+	QR_LEVEL_H                // 约30%纠错
+
+	QR_MIN_VERSION = 1
+	QR_MAX_VERSION = 40
+
+	qrModeNumeric      = 0x1
+	qrModeAlphanumeric = 0x2
+	qrModeByte         = 0x4
+
+	qrAlphanumericCharset = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+)
+
+var ErrQrTooLong = errors.New("qrcode content too long")
+
+// 每个纠错块的纠错码字数与纠错块数，按 L、M、Q、H 与版本索引
+var qrEccCodewordsPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+var qrEccBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// 格式信息中的纠错等级
+var qrLevelFormatBits = [4]int{1, 0, 3, 2}
+
+// ParseQrLevel 解析纠错等级 L、M、Q、H，为空时为 M
+func ParseQrLevel(level string) (QrLevel, error) {
+	switch strings.ToUpper(level) {
+	case "L":
+		return QR_LEVEL_L, nil
+	case "", "M":
+		return QR_LEVEL_M, nil
+	case "Q":
+		return QR_LEVEL_Q, nil
+	case "H":
+		return QR_LEVEL_H, nil
+	}
+	return QR_LEVEL_M, errors.New("invalid qrcode level")
+}
+
+// QrMatrix 编码后的二维码，Modules[y][x] 为true时是深色模块
+type QrMatrix struct {
+	Version  int
+	Level    QrLevel
+	Mask     int
+	Size     int
+	Modules  [][]bool
+	function [][]bool
+}
+
+// EncodeQr 编码二维码
+func EncodeQr(content string, level QrLevel) (*QrMatrix, error) {
+	if level < QR_LEVEL_L || level > QR_LEVEL_H {
+		return nil, errors.New("invalid qrcode level")
+	}
+	data := []byte(content)
+	mode := qrMode(data)
+
+	version := QR_MIN_VERSION
+	for ; version <= QR_MAX_VERSION; version++ {
+		if qrSegmentBits(mode, len(data), version) <= qrDataCodewords(version, level)*8 {
+			break
+		}
+	}
+	if version > QR_MAX_VERSION {
+		return nil, ErrQrTooLong
+	}
+
+	capacity := qrDataCodewords(version, level) * 8
+	bits := &qrBitBuffer{}
+	bits.append(mode, 4)
+	bits.append(len(data), qrCharCountBits(mode, version))
+	switch mode {
+	case qrModeNumeric:
+		for i := 0; i < len(data); i += 3 {
+			n := len(data) - i
+			if n > 3 {
+				n = 3
+			}
+			value := 0
+			for _, c := range data[i : i+n] {
+				value = value*10 + int(c-'0')
+			}
+			bits.append(value, n*3+1)
+		}
+	case qrModeAlphanumeric:
+		for i := 0; i < len(data); i += 2 {
+			if i+1 < len(data) {
+				bits.append(strings.IndexByte(qrAlphanumericCharset, data[i])*45+
+					strings.IndexByte(qrAlphanumericCharset, data[i+1]), 11)
+			} else {
+				bits.append(strings.IndexByte(qrAlphanumericCharset, data[i]), 6)
+			}
+		}
+	default:
+		for _, b := range data {
+			bits.append(int(b), 8)
+		}
+	}
+
+	// 终止符、补齐到字节与填充字节
+	terminator := capacity - bits.len
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-bits.len%8)%8)
+	for pad := 0xEC; bits.len < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	m := newQrMatrix(version, level)
+	m.drawFunctionPatterns()
+	m.drawCodewords(qrAddEcc(bits.bytes(), version, level))
+
+	best, minPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		m.applyMask(mask)
+		m.drawFormatBits(mask)
+		penalty := m.penalty()
+		if minPenalty < 0 || penalty < minPenalty {
+			best, minPenalty = mask, penalty
+		}
+		m.applyMask(mask)
+	}
+	m.Mask = best
+	m.applyMask(best)
+	m.drawFormatBits(best)
+	return m, nil
+}
+
+func qrMode(data []byte) int {
+	numeric, alphanumeric := true, true
+	for _, c := range data {
+		if c < '0' || c > '9' {
+			numeric = false
+		}
+		if strings.IndexByte(qrAlphanumericCharset, c) < 0 {
+			alphanumeric = false
+		}
+	}
+	switch {
+	case numeric:
+		return qrModeNumeric
+	case alphanumeric:
+		return qrModeAlphanumeric
+	}
+	return qrModeByte
+}
+
+func qrCharCountBits(mode int, version int) int {
+	i := 0
+	if version >= 27 {
+		i = 2
+	} else if version >= 10 {
+		i = 1
+	}
+	switch mode {
+	case qrModeNumeric:
+		return [3]int{10, 12, 14}[i]
+	case qrModeAlphanumeric:
+		return [3]int{9, 11, 13}[i]
+	}
+	return [3]int{8, 16, 16}[i]
+}
+
+// qrSegmentBits 模式指示符、字符计数与数据的总位数，字符数超过计数位能表示的范围时返回无穷大
+func qrSegmentBits(mode int, n int, version int) int {
+	countBits := qrCharCountBits(mode, version)
+	if n >= 1<<uint(countBits) {
+		return 1 << 30
+	}
+	bits := 4 + countBits
+	switch mode {
+	case qrModeNumeric:
+		return bits + n/3*10 + [3]int{0, 4, 7}[n%3]
+	case qrModeAlphanumeric:
+		return bits + n/2*11 + n%2*6
+	}
+	return bits + n*8
+}
+
+// qrRawDataModules 除功能图形与版本信息外可以放置数据的模块数
+func qrRawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		align := version/7 + 2
+		result -= (25*align-10)*align - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+func qrDataCodewords(version int, level QrLevel) int {
+	return qrRawDataModules(version)/8 - qrEccCodewordsPerBlock[level][version]*qrEccBlocks[level][version]
+}
+
+// qrAddEcc 将数据分块、计算每块的纠错码并交错排列
+func qrAddEcc(data []byte, version int, level QrLevel) []byte {
+	numBlocks := qrEccBlocks[level][version]
+	eccLen := qrEccCodewordsPerBlock[level][version]
+	rawCodewords := qrRawDataModules(version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := qrReedSolomonDivisor(eccLen)
+	blocks := make([][]byte, numBlocks)
+	for i, k := 0, 0; i < numBlocks; i++ {
+		n := shortBlockLen - eccLen
+		if i >= numShortBlocks {
+			n++
+		}
+		block := make([]byte, 0, shortBlockLen+1)
+		block = append(block, data[k:k+n]...)
+		k += n
+		ecc := qrReedSolomonRemainder(block, divisor)
+		if i < numShortBlocks {
+			// 短块在数据部分末尾占位，交错时跳过
+			block = append(block, 0)
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := 0; i <= shortBlockLen; i++ {
+		for j, block := range blocks {
+			if i != shortBlockLen-eccLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+func qrReedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = qrGfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = qrGfMultiply(root, 0x02)
+	}
+	return result
+}
+
+func qrReedSolomonRemainder(data []byte, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= qrGfMultiply(d, factor)
+		}
+	}
+	return result
+}
+
+// qrGfMultiply GF(2^8) 上的乘法，本原多项式为 0x11D
+func qrGfMultiply(x byte, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+type qrBitBuffer struct {
+	data []byte
+	len  int
+}
+
+func (b *qrBitBuffer) append(value int, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if b.len%8 == 0 {
+			b.data = append(b.data, 0)
+		}
+		if (value>>uint(i))&1 != 0 {
+			b.data[b.len/8] |= 0x80 >> uint(b.len%8)
+		}
+		b.len++
+	}
+}
+
+func (b *qrBitBuffer) bytes() []byte {
+	return b.data
+}
+
+func newQrMatrix(version int, level QrLevel) *QrMatrix {
+	size := version*4 + 17
+	m := &QrMatrix{Version: version, Level: level, Size: size}
+	m.Modules = make([][]bool, size)
+	m.function = make([][]bool, size)
+	for i := range m.Modules {
+		m.Modules[i] = make([]bool, size)
+		m.function[i] = make([]bool, size)
+	}
+	return m
+}
+
+func (m *QrMatrix) setFunction(x int, y int, dark bool) {
+	m.Modules[y][x] = dark
+	m.function[y][x] = true
+}
+
+func (m *QrMatrix) drawFunctionPatterns() {
+	// 定时图形
+	for i := 0; i < m.Size; i++ {
+		m.setFunction(6, i, i%2 == 0)
+		m.setFunction(i, 6, i%2 == 0)
+	}
+
+	// 位置探测图形与分隔符
+	for _, p := range [][2]int{{3, 3}, {m.Size - 4, 3}, {3, m.Size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := p[0]+dx, p[1]+dy
+				if x >= 0 && x < m.Size && y >= 0 && y < m.Size {
+					dist := qrMax(qrAbs(dx), qrAbs(dy))
+					m.setFunction(x, y, dist != 2 && dist != 4)
+				}
+			}
+		}
+	}
+
+	// 校正图形，跳过与位置探测图形重叠的三个角
+	positions := m.alignmentPositions()
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					m.setFunction(x+dx, y+dy, qrMax(qrAbs(dx), qrAbs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// 先占住格式信息的位置
+	m.drawFormatBits(0)
+	m.drawVersion()
+}
+
+func (m *QrMatrix) alignmentPositions() []int {
+	if m.Version == 1 {
+		return nil
+	}
+	align := m.Version/7 + 2
+	step := 26
+	if m.Version != 32 {
+		step = (m.Version*4 + align*2 + 1) / (align*2 - 2) * 2
+	}
+	result := make([]int, align)
+	result[0] = 6
+	for i, pos := align-1, m.Size-7; i >= 1; i, pos = i-1, pos-step {
+		result[i] = pos
+	}
+	return result
+}
+
+func (m *QrMatrix) drawFormatBits(mask int) {
+	data := qrLevelFormatBits[m.Level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>uint(i))&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		m.setFunction(8, i, bit(i))
+	}
+	m.setFunction(8, 7, bit(6))
+	m.setFunction(8, 8, bit(7))
+	m.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		m.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		m.setFunction(m.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		m.setFunction(8, m.Size-15+i, bit(i))
+	}
+	m.setFunction(8, m.Size-8, true)
+}
+
+func (m *QrMatrix) drawVersion() {
+	if m.Version < 7 {
+		return
+	}
+	rem := m.Version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := m.Version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := (bits>>uint(i))&1 != 0
+		a, b := m.Size-11+i%3, i/3
+		m.setFunction(a, b, dark)
+		m.setFunction(b, a, dark)
+	}
+}
+
+// drawCodewords 从右下角开始按两列一组的之字形放置码字
+func (m *QrMatrix) drawCodewords(data []byte) {
+	i := 0
+	for right := m.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < m.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = m.Size - 1 - vert
+				}
+				if !m.function[y][x] && i < len(data)*8 {
+					m.Modules[y][x] = (data[i>>3]>>uint(7-i&7))&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (m *QrMatrix) applyMask(mask int) {
+	for y := 0; y < m.Size; y++ {
+		for x := 0; x < m.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !m.function[y][x] {
+				m.Modules[y][x] = !m.Modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty 按标准的四条规则计算掩码罚分
+func (m *QrMatrix) penalty() int {
+	result := 0
+	dark := 0
+	finder := [2][11]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+	for a := 0; a < m.Size; a++ {
+		rowRun, colRun := 1, 1
+		for b := 0; b < m.Size; b++ {
+			if m.Modules[a][b] {
+				dark++
+			}
+			if b > 0 {
+				// 连续同色
+				if m.Modules[a][b] == m.Modules[a][b-1] {
+					rowRun++
+				} else {
+					rowRun = 1
+				}
+				if rowRun == 5 {
+					result += 3
+				} else if rowRun > 5 {
+					result++
+				}
+				if m.Modules[b][a] == m.Modules[b-1][a] {
+					colRun++
+				} else {
+					colRun = 1
+				}
+				if colRun == 5 {
+					result += 3
+				} else if colRun > 5 {
+					result++
+				}
+			}
+			// 2x2 同色块
+			if a > 0 && b > 0 {
+				c := m.Modules[a][b]
+				if c == m.Modules[a-1][b] && c == m.Modules[a][b-1] && c == m.Modules[a-1][b-1] {
+					result += 3
+				}
+			}
+			// 类似位置探测图形的 1:1:3:1:1
+			if b+11 <= m.Size {
+				for _, pattern := range finder {
+					row, col := true, true
+					for k, p := range pattern {
+						row = row && m.Modules[a][b+k] == p
+						col = col && m.Modules[b+k][a] == p
+					}
+					if row {
+						result += 40
+					}
+					if col {
+						result += 40
+					}
+				}
+			}
+		}
+	}
+
+	// 深色比例偏离50%
+	total := m.Size * m.Size
+	result += qrAbs(dark*100/total-50) / 5 * 10
+	return result
+}
+
+// Image 生成 size 像素宽的图片，margin 为四周空白的模块数
+func (m *QrMatrix) Image(size int, margin int, foreground color.Color, background color.Color) image.Image {
+	total := m.Size + margin*2
+	scale := size / total
+	if scale < 1 {
+		scale = 1
+	}
+	if size < total*scale {
+		size = total * scale
+	}
+	offset := (size-total*scale)/2 + margin*scale
+
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{background, foreground})
+	for y := 0; y < m.Size; y++ {
+		for x := 0; x < m.Size; x++ {
+			if !m.Modules[y][x] {
+				continue
+			}
+			for py := 0; py < scale; py++ {
+				row := (offset+y*scale+py)*img.Stride + offset + x*scale
+				for px := 0; px < scale; px++ {
+					img.Pix[row+px] = 1
+				}
+			}
+		}
+	}
+	return img
+}
+
+// SVG 生成 size 像素宽的 svg，每行连续的深色模块合并为一个矩形
+func (m *QrMatrix) SVG(size int, margin int, foreground color.Color, background color.Color) []byte {
+	total := m.Size + margin*2
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, total, total)
+	if fill, opacity := svgColor(background); opacity > 0 {
+		fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="%s" fill-opacity="%.3g"/>`, total, total, fill, opacity)
+	}
+
+	buf.WriteString(`<path d="`)
+	for y := 0; y < m.Size; y++ {
+		for x := 0; x < m.Size; x++ {
+			if !m.Modules[y][x] {
+				continue
+			}
+			start := x
+			for x < m.Size && m.Modules[y][x] {
+				x++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", start+margin, y+margin, x-start, x-start)
+		}
+	}
+	fill, opacity := svgColor(foreground)
+	fmt.Fprintf(&buf, `" fill="%s" fill-opacity="%.3g"/></svg>`, fill, opacity)
+	return buf.Bytes()
+}
+
+func svgColor(c color.Color) (string, float64) {
+	r, g, b, a := c.RGBA()
+	if a == 0 {
+		return "none", 0
+	}
+	// 还原预乘 alpha
+	return fmt.Sprintf("#%02x%02x%02x", r*0xff/a, g*0xff/a, b*0xff/a), float64(a) / 0xffff
+}
+
+// QrOptions 二维码图片选项，Size 为图片宽度(像素)，Margin 为四周空白的模块数，为0时使用默认值，小于0时没有空白
+type QrOptions struct {
+	Level      QrLevel
+	Size       int
+	Margin     int
+	Foreground color.Color
+	Background color.Color
+}
+
+// DefaultQrOptions 中等纠错、256像素、四个模块的空白、白底黑色
+var DefaultQrOptions = QrOptions{
+	Level:      QR_LEVEL_M,
+	Size:       256,
+	Margin:     4,
+	Foreground: color.Black,
+	Background: color.White,
+}
+
+func (o QrOptions) withDefaults() QrOptions {
+	if o.Size <= 0 {
+		o.Size = DefaultQrOptions.Size
+	}
+	if o.Margin == 0 {
+		o.Margin = DefaultQrOptions.Margin
+	} else if o.Margin < 0 {
+		o.Margin = 0
+	}
+	if o.Foreground == nil {
+		o.Foreground = DefaultQrOptions.Foreground
+	}
+	if o.Background == nil {
+		o.Background = DefaultQrOptions.Background
+	}
+	return o
+}
+
+// QrImage 编码二维码并生成图片
+func QrImage(content string, options QrOptions) (image.Image, error) {
+	options = options.withDefaults()
+	m, err := EncodeQr(content, options.Level)
+	if err != nil {
+		return nil, err
+	}
+	return m.Image(options.Size, options.Margin, options.Foreground, options.Background), nil
+}
+
+// QrPNG 编码二维码并生成 png
+func QrPNG(content string, options QrOptions) ([]byte, error) {
+	img, err := QrImage(content, options)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	return buf.Bytes(), err
+}
+
+// QrSVG 编码二维码并生成 svg
+func QrSVG(content string, options QrOptions) ([]byte, error) {
+	options = options.withDefaults()
+	m, err := EncodeQr(content, options.Level)
+	if err != nil {
+		return nil, err
+	}
+	return m.SVG(options.Size, options.Margin, options.Foreground, options.Background), nil
+}
+
+func qrAbs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func qrMax(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
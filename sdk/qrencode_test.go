@@ -0,0 +1,362 @@
+package wechat
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// 按 ISO/IEC 18004 独立读取编码结果：校验格式与版本信息，按之字形读出码字，
+// 解交错后用 Reed-Solomon 校验子检查每个块，再解析数据段还原内容
+
+// 校正图形中心坐标，附录 E，测试内容的版本不超过14
+var testQrAlignment = [][]int{
+	nil, nil,
+	{6, 18}, {6, 22}, {6, 26}, {6, 30}, {6, 34},
+	{6, 22, 38}, {6, 24, 42}, {6, 26, 46}, {6, 28, 50}, {6, 30, 54}, {6, 32, 58}, {6, 34, 62},
+	{6, 26, 46, 66},
+}
+
+var testQrExp, testQrLog = func() ([512]byte, [256]int) {
+	var exp [512]byte
+	var log [256]int
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i], exp[i+255] = byte(x), byte(x)
+		log[x] = i
+		if x <<= 1; x >= 256 {
+			x ^= 0x11D
+		}
+	}
+	return exp, log
+}()
+
+func testQrBch(value int, poly int, degree uint) int {
+	rem := value << degree
+	for bit := 30; bit >= int(degree); bit-- {
+		if rem>>uint(bit)&1 != 0 {
+			rem ^= poly << (uint(bit) - degree)
+		}
+	}
+	return value<<degree | rem
+}
+
+func testQrMasked(mask int, x int, y int) bool {
+	switch mask {
+	case 0:
+		return (y+x)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (y+x)%3 == 0
+	case 4:
+		return (y/2+x/3)%2 == 0
+	case 5:
+		return y*x%2+y*x%3 == 0
+	case 6:
+		return (y*x%2+y*x%3)%2 == 0
+	}
+	return ((y+x)%2+y*x%3)%2 == 0
+}
+
+// testQrReserved 功能图形、格式信息与版本信息占用的模块
+func testQrReserved(version int) [][]bool {
+	size := version*4 + 17
+	reserved := make([][]bool, size)
+	for y := range reserved {
+		reserved[y] = make([]bool, size)
+		for x := range reserved[y] {
+			reserved[y][x] = x == 6 || y == 6 ||
+				x < 9 && y < 9 || x >= size-8 && y < 9 || x < 9 && y >= size-8 ||
+				version >= 7 && (x >= size-11 && x < size-8 && y < 6 || y >= size-11 && y < size-8 && x < 6)
+		}
+	}
+	// 校正图形跳过与位置探测图形重叠的三个角，中心在定时图形上的照常放置
+	positions := testQrAlignment[version]
+	for _, cx := range positions {
+		for _, cy := range positions {
+			if cx < 9 && cy < 9 || cx >= size-8 && cy < 9 || cx < 9 && cy >= size-8 {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					reserved[cy+dy][cx+dx] = true
+				}
+			}
+		}
+	}
+	return reserved
+}
+
+// testQrFormat 读取两处格式信息，返回纠错等级与掩码
+func testQrFormat(m *QrMatrix) (QrLevel, int, error) {
+	dark := func(x, y int) int {
+		if m.Modules[y][x] {
+			return 1
+		}
+		return 0
+	}
+	first, second := 0, 0
+	for i := 0; i <= 5; i++ {
+		first |= dark(8, i) << uint(i)
+	}
+	first |= dark(8, 7)<<6 | dark(8, 8)<<7 | dark(7, 8)<<8
+	for i := 9; i < 15; i++ {
+		first |= dark(14-i, 8) << uint(i)
+	}
+	for i := 0; i < 8; i++ {
+		second |= dark(m.Size-1-i, 8) << uint(i)
+	}
+	for i := 8; i < 15; i++ {
+		second |= dark(8, m.Size-15+i) << uint(i)
+	}
+	if first != second {
+		return 0, 0, fmt.Errorf("format copies differ: %015b %015b", first, second)
+	}
+	if dark(8, m.Size-8) != 1 {
+		return 0, 0, fmt.Errorf("dark module is not dark")
+	}
+
+	for data := 0; data < 32; data++ {
+		if testQrBch(data, 0x537, 10)^0x5412 == first {
+			level := map[int]QrLevel{1: QR_LEVEL_L, 0: QR_LEVEL_M, 3: QR_LEVEL_Q, 2: QR_LEVEL_H}[data>>3]
+			return level, data & 7, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid format bits %015b", first)
+}
+
+// decodeQrForTest 还原二维码的内容与数据模式
+func decodeQrForTest(m *QrMatrix) (string, int, error) {
+	if m.Size != m.Version*4+17 || m.Version >= len(testQrAlignment) {
+		return "", 0, fmt.Errorf("unexpected version %d size %d", m.Version, m.Size)
+	}
+	level, mask, err := testQrFormat(m)
+	if err != nil {
+		return "", 0, err
+	}
+	if level != m.Level || mask != m.Mask {
+		return "", 0, fmt.Errorf("format says level %d mask %d, matrix says %d %d", level, mask, m.Level, m.Mask)
+	}
+	if m.Version >= 7 {
+		expected := testQrBch(m.Version, 0x1F25, 12)
+		for i := 0; i < 18; i++ {
+			bit := expected>>uint(i)&1 != 0
+			a, b := m.Size-11+i%3, i/3
+			if m.Modules[b][a] != bit || m.Modules[a][b] != bit {
+				return "", 0, fmt.Errorf("version bit %d mismatch", i)
+			}
+		}
+	}
+
+	// 从右下角开始两列一组之字形读取
+	reserved := testQrReserved(m.Version)
+	var bits []bool
+	for right := m.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (m.Size-1-right)/2%2 == 0
+		if right < 6 {
+			upward = (m.Size-2-right)/2%2 == 0
+		}
+		for vert := 0; vert < m.Size; vert++ {
+			y := vert
+			if upward {
+				y = m.Size - 1 - vert
+			}
+			for _, x := range []int{right, right - 1} {
+				if !reserved[y][x] {
+					bits = append(bits, m.Modules[y][x] != testQrMasked(mask, x, y))
+				}
+			}
+		}
+	}
+	if remainder := len(bits) % 8; remainder != 0 && remainder != 3 && remainder != 4 && remainder != 7 {
+		return "", 0, fmt.Errorf("unexpected remainder bits %d", remainder)
+	}
+	codewords := make([]byte, len(bits)/8)
+	for i := range codewords {
+		for _, bit := range bits[i*8 : i*8+8] {
+			codewords[i] <<= 1
+			if bit {
+				codewords[i] |= 1
+			}
+		}
+	}
+
+	// 解交错，短块在前
+	numBlocks, eccLen := qrEccBlocks[level][m.Version], qrEccCodewordsPerBlock[level][m.Version]
+	shortLen, numLong := len(codewords)/numBlocks, len(codewords)%numBlocks
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i < shortLen-eccLen+1; i++ {
+		for j := range blocks {
+			if i < shortLen-eccLen || j >= numBlocks-numLong {
+				blocks[j] = append(blocks[j], codewords[k])
+				k++
+			}
+		}
+	}
+	for i := 0; i < eccLen; i++ {
+		for j := range blocks {
+			blocks[j] = append(blocks[j], codewords[k])
+			k++
+		}
+	}
+
+	var data []byte
+	for j, block := range blocks {
+		for root := 0; root < eccLen; root++ {
+			syndrome := byte(0)
+			for _, c := range block {
+				if syndrome != 0 {
+					syndrome = testQrExp[testQrLog[syndrome]+root]
+				}
+				syndrome ^= c
+			}
+			if syndrome != 0 {
+				return "", 0, fmt.Errorf("block %d syndrome %d is %d", j, root, syndrome)
+			}
+		}
+		data = append(data, block[:len(block)-eccLen]...)
+	}
+
+	pos := 0
+	read := func(n int) int {
+		value := 0
+		for i := 0; i < n; i++ {
+			value = value<<1 | int(data[pos/8]>>uint(7-pos%8)&1)
+			pos++
+		}
+		return value
+	}
+	countBits := map[int][3]int{1: {10, 12, 14}, 2: {9, 11, 13}, 4: {8, 16, 16}}
+	tier := 0
+	if m.Version >= 27 {
+		tier = 2
+	} else if m.Version >= 10 {
+		tier = 1
+	}
+
+	mode := read(4)
+	if _, ok := countBits[mode]; !ok {
+		return "", 0, fmt.Errorf("unexpected mode %d", mode)
+	}
+	count := read(countBits[mode][tier])
+	var content []byte
+	switch mode {
+	case 1:
+		for ; count >= 3; count -= 3 {
+			content = append(content, fmt.Sprintf("%03d", read(10))...)
+		}
+		if count == 2 {
+			content = append(content, fmt.Sprintf("%02d", read(7))...)
+		} else if count == 1 {
+			content = append(content, fmt.Sprintf("%d", read(4))...)
+		}
+	case 2:
+		const charset = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+		for ; count >= 2; count -= 2 {
+			value := read(11)
+			content = append(content, charset[value/45], charset[value%45])
+		}
+		if count == 1 {
+			content = append(content, charset[read(6)])
+		}
+	case 4:
+		for i := 0; i < count; i++ {
+			content = append(content, byte(read(8)))
+		}
+	}
+	// 终止符与补齐位为0，其后为交替的填充字节 0xEC、0x11
+	if remaining := len(data)*8 - pos; remaining > 0 {
+		if terminator := read(testQrMin(4, remaining)); terminator != 0 {
+			return "", 0, fmt.Errorf("unexpected terminator %b", terminator)
+		}
+	}
+	if pos%8 != 0 && read(8-pos%8) != 0 {
+		return "", 0, fmt.Errorf("unexpected padding bits")
+	}
+	for i, pad := pos/8, 0xEC; i < len(data); i, pad = i+1, pad^0xEC^0x11 {
+		if int(data[i]) != pad {
+			return "", 0, fmt.Errorf("pad byte %d is %#x, want %#x", i, data[i], pad)
+		}
+	}
+	return string(content), mode, nil
+}
+
+func testQrMin(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func TestEncodeQrRoundTrip(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		mode    int
+	}{
+		{"numeric", "01234567890123456789", qrModeNumeric},
+		{"numeric remainder", "1234", qrModeNumeric},
+		{"alphanumeric", "WXP://F2F0/ABCD $%*+-.", qrModeAlphanumeric},
+		{"byte", "weixin://wxpay/bizpayurl?pr=abc123", qrModeByte},
+		{"utf8", "微信支付 ¥12.00 ✓", qrModeByte},
+		{"multi block", strings.Repeat("https://mp.weixin.qq.com/s/", 4), qrModeByte},
+		{"long numeric", strings.Repeat("0123456789", 30), qrModeNumeric},
+	}
+	levels := map[QrLevel]string{QR_LEVEL_L: "L", QR_LEVEL_M: "M", QR_LEVEL_Q: "Q", QR_LEVEL_H: "H"}
+
+	for _, c := range cases {
+		for level, name := range levels {
+			m, err := EncodeQr(c.content, level)
+			if err != nil {
+				t.Fatalf("%s/%s: %v", c.name, name, err)
+			}
+			content, mode, err := decodeQrForTest(m)
+			if err != nil {
+				t.Fatalf("%s/%s version %d: %v", c.name, name, m.Version, err)
+			}
+			if content != c.content {
+				t.Errorf("%s/%s: decoded %q, want %q", c.name, name, content, c.content)
+			}
+			if mode != c.mode {
+				t.Errorf("%s/%s: mode %d, want %d", c.name, name, mode, c.mode)
+			}
+		}
+	}
+}
+
+func TestEncodeQrVersion(t *testing.T) {
+	// 版本1的容量：数字 M 34 个，字节 L 17 个
+	if m, _ := EncodeQr(strings.Repeat("7", 34), QR_LEVEL_M); m.Version != 1 {
+		t.Errorf("34 digits at M: version %d, want 1", m.Version)
+	}
+	if m, _ := EncodeQr(strings.Repeat("7", 35), QR_LEVEL_M); m.Version != 2 {
+		t.Errorf("35 digits at M: version %d, want 2", m.Version)
+	}
+	if m, _ := EncodeQr(strings.Repeat("a", 17), QR_LEVEL_L); m.Version != 1 {
+		t.Errorf("17 bytes at L: version %d, want 1", m.Version)
+	}
+	if _, err := EncodeQr(strings.Repeat("a", 1300), QR_LEVEL_H); err != ErrQrTooLong {
+		t.Errorf("1300 bytes at H: err %v, want ErrQrTooLong", err)
+	}
+	if testQrBch(7, 0x1F25, 12) != 0x07C94 || testQrBch(0, 0x537, 10)^0x5412 != 0x5412 {
+		t.Errorf("bch reference mismatch")
+	}
+}
+
+func TestParseQrLevel(t *testing.T) {
+	for input, want := range map[string]QrLevel{"": QR_LEVEL_M, "l": QR_LEVEL_L, "M": QR_LEVEL_M, "q": QR_LEVEL_Q, "H": QR_LEVEL_H} {
+		if level, err := ParseQrLevel(input); err != nil || level != want {
+			t.Errorf("ParseQrLevel(%q) = %d, %v", input, level, err)
+		}
+	}
+	if _, err := ParseQrLevel("X"); err == nil {
+		t.Errorf("ParseQrLevel(\"X\") should fail")
+	}
+}
@@ -0,0 +1,195 @@
+package wechat
+
+import (
+	"encoding/xml"
+	"errors"
+	"strconv"
+)
+
+// 被动回复用户消息
+//
+// 文档：https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Passive_user_reply_message.html
+
+const (
+	REPLY_TYPE_TEXT                      = "text"
+	REPLY_TYPE_IMAGE                     = "image"
+	REPLY_TYPE_VOICE                     = "voice"
+	REPLY_TYPE_VIDEO                     = "video"
+	REPLY_TYPE_MUSIC                     = "music"
+	REPLY_TYPE_NEWS                      = "news"
+	REPLY_TYPE_TRANSFER_CUSTOMER_SERVICE = "transfer_customer_service"
+
+	MAX_NEWS_ARTICLES = 8 // 图文消息最多8条
+)
+
+var ErrTooManyArticles = errors.New("news reply supports at most " + strconv.Itoa(MAX_NEWS_ARTICLES) + " articles")
+
+type replyHeader struct {
+	XMLName      xml.Name `xml:"xml"`
+	ToUserName   CDATA    `xml:"ToUserName"`
+	FromUserName CDATA    `xml:"FromUserName"`
+	CreateTime   int64    `xml:"CreateTime"`
+	MsgType      CDATA    `xml:"MsgType"`
+}
+
+func newReplyHeader(toUser string, fromUser string, createTime int64, msgType string) replyHeader {
+	return replyHeader{
+		ToUserName:   CDATA{toUser},
+		FromUserName: CDATA{fromUser},
+		CreateTime:   createTime,
+		MsgType:      CDATA{msgType},
+	}
+}
+
+type replyMedia struct {
+	MediaId CDATA `xml:"MediaId"`
+}
+
+// TextReply 回复文本消息
+type TextReply struct {
+	Content string
+}
+
+func (r *TextReply) ReplyXML(toUser string, fromUser string, createTime int64) ([]byte, error) {
+	return xml.Marshal(struct {
+		replyHeader
+		Content CDATA `xml:"Content"`
+	}{newReplyHeader(toUser, fromUser, createTime, REPLY_TYPE_TEXT), CDATA{r.Content}})
+}
+
+// ImageReply 回复图片消息，MediaId 通过素材管理接口上传多媒体文件得到
+type ImageReply struct {
+	MediaId string
+}
+
+func (r *ImageReply) ReplyXML(toUser string, fromUser string, createTime int64) ([]byte, error) {
+	return xml.Marshal(struct {
+		replyHeader
+		Image replyMedia `xml:"Image"`
+	}{newReplyHeader(toUser, fromUser, createTime, REPLY_TYPE_IMAGE), replyMedia{CDATA{r.MediaId}}})
+}
+
+// VoiceReply 回复语音消息
+type VoiceReply struct {
+	MediaId string
+}
+
+func (r *VoiceReply) ReplyXML(toUser string, fromUser string, createTime int64) ([]byte, error) {
+	return xml.Marshal(struct {
+		replyHeader
+		Voice replyMedia `xml:"Voice"`
+	}{newReplyHeader(toUser, fromUser, createTime, REPLY_TYPE_VOICE), replyMedia{CDATA{r.MediaId}}})
+}
+
+// VideoReply 回复视频消息
+type VideoReply struct {
+	MediaId     string
+	Title       string
+	Description string
+}
+
+func (r *VideoReply) ReplyXML(toUser string, fromUser string, createTime int64) ([]byte, error) {
+	type video struct {
+		MediaId     CDATA  `xml:"MediaId"`
+		Title       *CDATA `xml:"Title,omitempty"`
+		Description *CDATA `xml:"Description,omitempty"`
+	}
+	v := video{MediaId: CDATA{r.MediaId}}
+	if r.Title != "" {
+		v.Title = &CDATA{r.Title}
+	}
+	if r.Description != "" {
+		v.Description = &CDATA{r.Description}
+	}
+
+	return xml.Marshal(struct {
+		replyHeader
+		Video video `xml:"Video"`
+	}{newReplyHeader(toUser, fromUser, createTime, REPLY_TYPE_VIDEO), v})
+}
+
+// MusicReply 回复音乐消息，ThumbMediaId 为缩略图的媒体id
+type MusicReply struct {
+	Title        string
+	Description  string
+	MusicUrl     string
+	HQMusicUrl   string
+	ThumbMediaId string
+}
+
+func (r *MusicReply) ReplyXML(toUser string, fromUser string, createTime int64) ([]byte, error) {
+	type music struct {
+		Title        CDATA `xml:"Title"`
+		Description  CDATA `xml:"Description"`
+		MusicUrl     CDATA `xml:"MusicUrl"`
+		HQMusicUrl   CDATA `xml:"HQMusicUrl"`
+		ThumbMediaId CDATA `xml:"ThumbMediaId"`
+	}
+
+	return xml.Marshal(struct {
+		replyHeader
+		Music music `xml:"Music"`
+	}{newReplyHeader(toUser, fromUser, createTime, REPLY_TYPE_MUSIC), music{
+		CDATA{r.Title}, CDATA{r.Description}, CDATA{r.MusicUrl}, CDATA{r.HQMusicUrl}, CDATA{r.ThumbMediaId},
+	}})
+}
+
+type NewsArticle struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	PicUrl      string `json:"picurl"`
+	Url         string `json:"url"`
+}
+
+// NewsReply 回复图文消息，最多8条
+type NewsReply struct {
+	Articles []NewsArticle
+}
+
+func (r *NewsReply) ReplyXML(toUser string, fromUser string, createTime int64) ([]byte, error) {
+	if len(r.Articles) > MAX_NEWS_ARTICLES {
+		return nil, ErrTooManyArticles
+	}
+
+	type item struct {
+		Title       CDATA `xml:"Title"`
+		Description CDATA `xml:"Description"`
+		PicUrl      CDATA `xml:"PicUrl"`
+		Url         CDATA `xml:"Url"`
+	}
+	items := make([]item, 0, len(r.Articles))
+	for _, a := range r.Articles {
+		items = append(items, item{CDATA{a.Title}, CDATA{a.Description}, CDATA{a.PicUrl}, CDATA{a.Url}})
+	}
+
+	return xml.Marshal(struct {
+		replyHeader
+		ArticleCount int    `xml:"ArticleCount"`
+		Articles     []item `xml:"Articles>item"`
+	}{newReplyHeader(toUser, fromUser, createTime, REPLY_TYPE_NEWS), len(items), items})
+}
+
+// TransferCustomerServiceReply 将消息转发到客服，KfAccount 不为空时转发到指定的客服帐号
+type TransferCustomerServiceReply struct {
+	KfAccount string
+}
+
+func (r *TransferCustomerServiceReply) ReplyXML(toUser string, fromUser string, createTime int64) ([]byte, error) {
+	type transInfo struct {
+		KfAccount CDATA `xml:"KfAccount"`
+	}
+	var info *transInfo
+	if r.KfAccount != "" {
+		info = &transInfo{CDATA{r.KfAccount}}
+	}
+
+	return xml.Marshal(struct {
+		replyHeader
+		TransInfo *transInfo `xml:"TransInfo,omitempty"`
+	}{newReplyHeader(toUser, fromUser, createTime, REPLY_TYPE_TRANSFER_CUSTOMER_SERVICE), info})
+}
+
+// Reply 以当前消息的发送者为接收方生成回复的xml
+func (ctx *Context) Reply(reply Reply, createTime int64) ([]byte, error) {
+	return reply.ReplyXML(ctx.Message.FromUserName, ctx.Message.ToUserName, createTime)
+}
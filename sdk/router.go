@@ -0,0 +1,126 @@
+package wechat
+
+import (
+	"strings"
+)
+
+// 消息路由，按 MsgType、Event 与 EventKey 前缀注册处理函数
+//
+// 同一条消息匹配到的处理函数按注册顺序全部执行，以第一个非nil的回复作为被动回复，
+// 没有匹配到任何处理函数时执行 Fallback
+
+// Context 一次消息推送的上下文
+type Context struct {
+	AccountId int
+	Message   *MixMessage
+	Raw       []byte // 明文xml消息体
+}
+
+// Typed 返回消息的类型化结构
+func (ctx *Context) Typed() interface{} {
+	return ctx.Message.Typed()
+}
+
+// Reply 被动回复消息，处理函数返回nil时回复 success
+type Reply interface {
+	// ReplyXML 生成回复的xml，toUser 为用户openid，fromUser 为开发者微信号
+	ReplyXML(toUser string, fromUser string, createTime int64) ([]byte, error)
+}
+
+type HandlerFunc func(ctx *Context) (Reply, error)
+
+type Middleware func(next HandlerFunc) HandlerFunc
+
+type eventKeyHandler struct {
+	event   string
+	prefix  string
+	handler HandlerFunc
+}
+
+type Router struct {
+	middlewares      []Middleware
+	msgHandlers      map[string][]HandlerFunc
+	eventHandlers    map[string][]HandlerFunc
+	eventKeyHandlers []eventKeyHandler
+	fallback         HandlerFunc
+}
+
+func NewRouter() *Router {
+	return &Router{
+		msgHandlers:   map[string][]HandlerFunc{},
+		eventHandlers: map[string][]HandlerFunc{},
+	}
+}
+
+// Use 添加中间件，先添加的中间件在外层
+func (r *Router) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// HandleMsg 按 MsgType 注册处理函数，如 text, image
+func (r *Router) HandleMsg(msgType string, handler HandlerFunc) {
+	r.msgHandlers[msgType] = append(r.msgHandlers[msgType], handler)
+}
+
+// HandleEvent 按 Event 注册处理函数，如 subscribe, CLICK
+func (r *Router) HandleEvent(event string, handler HandlerFunc) {
+	r.eventHandlers[event] = append(r.eventHandlers[event], handler)
+}
+
+// HandleEventKey 按 Event 与 EventKey 前缀注册处理函数，event 为空时匹配所有事件
+func (r *Router) HandleEventKey(event string, prefix string, handler HandlerFunc) {
+	r.eventKeyHandlers = append(r.eventKeyHandlers, eventKeyHandler{event, prefix, handler})
+}
+
+// Fallback 设置没有匹配到处理函数时执行的函数
+func (r *Router) Fallback(handler HandlerFunc) {
+	r.fallback = handler
+}
+
+// Dispatch 经过中间件后分发消息
+func (r *Router) Dispatch(ctx *Context) (Reply, error) {
+	handler := r.route
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		handler = r.middlewares[i](handler)
+	}
+	return handler(ctx)
+}
+
+func (r *Router) route(ctx *Context) (Reply, error) {
+	handlers := r.match(ctx.Message)
+	if len(handlers) == 0 {
+		if r.fallback == nil {
+			return nil, nil
+		}
+		return r.fallback(ctx)
+	}
+
+	var (
+		reply    Reply
+		firstErr error
+	)
+	for _, handler := range handlers {
+		res, err := handler(ctx)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if res != nil && reply == nil {
+			reply = res
+		}
+	}
+	return reply, firstErr
+}
+
+func (r *Router) match(msg *MixMessage) []HandlerFunc {
+	if msg.MsgType != MSG_TYPE_EVENT {
+		return r.msgHandlers[msg.MsgType]
+	}
+
+	handlers := append([]HandlerFunc{}, r.eventHandlers[msg.Event]...)
+	for _, h := range r.eventKeyHandlers {
+		if (h.event == "" || h.event == msg.Event) && strings.HasPrefix(msg.EventKey, h.prefix) {
+			handlers = append(handlers, h.handler)
+		}
+	}
+	return handlers
+}
@@ -0,0 +1,203 @@
+package wechat
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// 推送消息流
+//
+// go-wechat 将每条推送消息写入账号对应的 Redis Stream，key 为 go-wechat:stream:{accountId}，
+// 每条记录包含 account_id, msg_type, event 与 json 格式的 message 字段，
+// 业务服务可以通过消费组拉取消息，处理完成后 Ack
+
+const STREAM_KEY_PREFIX = "go-wechat:stream:"
+
+var ErrInvalidStreamMessage = errors.New("invalid stream message")
+
+// StreamKey 账号的消息流key
+func StreamKey(accountId int) string {
+	return STREAM_KEY_PREFIX + strconv.Itoa(accountId)
+}
+
+// StreamValues 生成写入消息流的字段
+func StreamValues(accountId int, msg *MixMessage) (map[string]interface{}, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"account_id": accountId,
+		"msg_type":   msg.MsgType,
+		"event":      msg.Event,
+		"message":    string(data),
+	}, nil
+}
+
+// StreamMessage 从消息流读取的一条消息
+type StreamMessage struct {
+	Id        string
+	AccountId int
+	Message   *MixMessage
+}
+
+// Typed 返回消息的类型化结构
+func (m *StreamMessage) Typed() interface{} {
+	return m.Message.Typed()
+}
+
+// DecodeStreamMessage 解析消息流中的记录
+func DecodeStreamMessage(entry redis.XMessage) (*StreamMessage, error) {
+	data, ok := entry.Values["message"].(string)
+	if !ok {
+		return nil, ErrInvalidStreamMessage
+	}
+
+	msg := &MixMessage{}
+	if err := json.Unmarshal([]byte(data), msg); err != nil {
+		return nil, err
+	}
+
+	accountId, _ := strconv.Atoi(stringValue(entry.Values["account_id"]))
+	return &StreamMessage{Id: entry.ID, AccountId: accountId, Message: msg}, nil
+}
+
+func stringValue(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	}
+	return ""
+}
+
+// StreamConsumer 消费组中的一个消费者
+type StreamConsumer struct {
+	Client   *redis.Client
+	Stream   string
+	Group    string
+	Consumer string
+	Count    int64         // 每次读取的最大条数
+	Block    time.Duration // 没有新消息时阻塞等待的时间
+}
+
+// NewStreamConsumer 创建账号消息流的消费者，同一消费组内的消费者分摊消息
+func NewStreamConsumer(client *redis.Client, accountId int, group string, consumer string) *StreamConsumer {
+	return &StreamConsumer{
+		Client:   client,
+		Stream:   StreamKey(accountId),
+		Group:    group,
+		Consumer: consumer,
+		Count:    100,
+		Block:    5 * time.Second,
+	}
+}
+
+// CreateGroup 创建消费组，start 为 $ 时只消费之后的消息，为 0 时从头消费，消费组已存在时忽略
+func (c *StreamConsumer) CreateGroup(start string) error {
+	err := c.Client.XGroupCreateMkStream(c.Stream, c.Group, start).Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// Read 读取新的消息，没有消息时阻塞 Block 后返回空
+func (c *StreamConsumer) Read() ([]*StreamMessage, error) {
+	messages, _, err := c.read(">")
+	return messages, err
+}
+
+// Pending 读取已分配给当前消费者但未 Ack 的消息，start 为 0 时从头读取，
+// 之后传入上一批最后一条消息的id继续读取，用于重启后继续处理
+func (c *StreamConsumer) Pending(start string) ([]*StreamMessage, string, error) {
+	return c.read(start)
+}
+
+// read 返回解析后的消息与本批最后一条记录的id
+func (c *StreamConsumer) read(id string) ([]*StreamMessage, string, error) {
+	block := c.Block
+	if id != ">" {
+		block = -1
+	}
+
+	streams, err := c.Client.XReadGroup(&redis.XReadGroupArgs{
+		Group:    c.Group,
+		Consumer: c.Consumer,
+		Streams:  []string{c.Stream, id},
+		Count:    c.Count,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	var (
+		messages []*StreamMessage
+		lastId   string
+	)
+	for _, stream := range streams {
+		for _, entry := range stream.Messages {
+			lastId = entry.ID
+			msg, err := DecodeStreamMessage(entry)
+			if err != nil {
+				// 无法解析的消息直接 Ack，避免一直留在待处理列表中
+				c.Ack(entry.ID)
+				continue
+			}
+			messages = append(messages, msg)
+		}
+	}
+	return messages, lastId, nil
+}
+
+// Ack 确认消息已处理
+func (c *StreamConsumer) Ack(ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return c.Client.XAck(c.Stream, c.Group, ids...).Err()
+}
+
+// Consume 先处理未 Ack 的消息，再持续读取新消息，handler 返回nil时 Ack，
+// 返回error的消息留在待处理列表中，下次启动时重新处理，stop 关闭时返回
+func (c *StreamConsumer) Consume(stop <-chan struct{}, handler func(msg *StreamMessage) error) error {
+	for start := "0"; start != ""; {
+		pending, lastId, err := c.Pending(start)
+		if err != nil {
+			return err
+		}
+		c.handle(pending, handler)
+		start = lastId
+	}
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+
+		messages, err := c.Read()
+		if err != nil {
+			return err
+		}
+		c.handle(messages, handler)
+	}
+}
+
+func (c *StreamConsumer) handle(messages []*StreamMessage, handler func(msg *StreamMessage) error) {
+	for _, msg := range messages {
+		if handler(msg) == nil {
+			c.Ack(msg.Id)
+		}
+	}
+}
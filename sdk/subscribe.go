@@ -0,0 +1,313 @@
+package wechat
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// 订阅通知与一次性订阅消息
+//
+// 文档：https://developers.weixin.qq.com/doc/offiaccount/Subscription_Messages/api.html
+//      https://developers.weixin.qq.com/doc/offiaccount/Message_Management/One-time_subscription_info.html
+
+const (
+	ADD_SUBSCRIBE_TEMPLATE      = "https://api.weixin.qq.com/wxaapi/newtmpl/addtemplate?access_token=ACCESS_TOKEN"         // 选用模板
+	DEL_SUBSCRIBE_TEMPLATE      = "https://api.weixin.qq.com/wxaapi/newtmpl/deltemplate?access_token=ACCESS_TOKEN"         // 删除模板
+	GET_SUBSCRIBE_CATEGORY      = "https://api.weixin.qq.com/wxaapi/newtmpl/getcategory"                                   // 获取公众号类目
+	GET_PUB_TEMPLATE_KEYWORDS   = "https://api.weixin.qq.com/wxaapi/newtmpl/getpubtemplatekeywords"                        // 获取模板中的关键词
+	GET_PUB_TEMPLATE_TITLES     = "https://api.weixin.qq.com/wxaapi/newtmpl/getpubtemplatetitles"                          // 获取类目下的公共模板
+	GET_SUBSCRIBE_TEMPLATE      = "https://api.weixin.qq.com/wxaapi/newtmpl/gettemplate"                                   // 获取私有模板列表
+	SEND_SUBSCRIBE_MESSAGE      = "https://api.weixin.qq.com/cgi-bin/message/subscribe/bizsend?access_token=ACCESS_TOKEN"  // 发送订阅通知
+	SEND_ONCE_SUBSCRIBE_MESSAGE = "https://api.weixin.qq.com/cgi-bin/message/template/subscribe?access_token=ACCESS_TOKEN" // 发送一次性订阅消息
+	ONCE_SUBSCRIBE_AUTH_URL     = "https://mp.weixin.qq.com/mp/subscribemsg"                                               // 一次性订阅消息授权页
+)
+
+type SubscribeCategory struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type PubTemplateKeyword struct {
+	Kid     int64  `json:"kid"`
+	Name    string `json:"name"`
+	Example string `json:"example"`
+	Rule    string `json:"rule"`
+}
+
+type PubTemplateTitle struct {
+	Tid        int64  `json:"tid"`
+	Title      string `json:"title"`
+	Type       int    `json:"type"`
+	CategoryId string `json:"categoryId"`
+}
+
+type PubTemplateTitleList struct {
+	Count int64              `json:"count"`
+	Data  []PubTemplateTitle `json:"data"`
+}
+
+type SubscribeTemplate struct {
+	PriTmplId string `json:"priTmplId"`
+	Title     string `json:"title"`
+	Content   string `json:"content"`
+	Example   string `json:"example"`
+	Type      int    `json:"type"`
+}
+
+type MiniProgram struct {
+	AppId    string `json:"appid"`
+	PagePath string `json:"pagepath"`
+}
+
+type SubscribeValue struct {
+	Value string `json:"value"`
+}
+
+// SubscribeMessage 订阅通知
+type SubscribeMessage struct {
+	ToUser      string                    `json:"touser"`
+	TemplateId  string                    `json:"template_id"`
+	Page        string                    `json:"page,omitempty"`
+	MiniProgram *MiniProgram              `json:"miniprogram,omitempty"`
+	Data        map[string]SubscribeValue `json:"data"`
+}
+
+type OnceSubscribeValue struct {
+	Value string `json:"value"`
+	Color string `json:"color,omitempty"`
+}
+
+// OnceSubscribeMessage 一次性订阅消息，data中只有content一项
+type OnceSubscribeMessage struct {
+	ToUser      string                        `json:"touser"`
+	TemplateId  string                        `json:"template_id"`
+	Url         string                        `json:"url,omitempty"`
+	MiniProgram *MiniProgram                  `json:"miniprogram,omitempty"`
+	Scene       string                        `json:"scene"`
+	Title       string                        `json:"title"`
+	Data        map[string]OnceSubscribeValue `json:"data"`
+}
+
+// SubscribeMsgEvent 订阅通知相关事件推送中的列表，
+// 对应 SubscribeMsgPopupEvent, SubscribeMsgChangeEvent, SubscribeMsgSentEvent 节点
+type SubscribeMsgEvent struct {
+	List []SubscribeMsgEventItem `xml:"List" json:"list"`
+}
+
+type SubscribeMsgEventItem struct {
+	TemplateId            string `xml:"TemplateId" json:"template_id"`
+	SubscribeStatusString string `xml:"SubscribeStatusString" json:"subscribe_status_string,omitempty"`
+	PopupScene            string `xml:"PopupScene" json:"popup_scene,omitempty"`
+	MsgID                 string `xml:"MsgID" json:"msg_id,omitempty"`
+	ErrorCode             string `xml:"ErrorCode" json:"error_code,omitempty"`
+	ErrorStatus           string `xml:"ErrorStatus" json:"error_status,omitempty"`
+}
+
+// AddSubscribeTemplate
+//
+// 参数：
+// tid			模板标题 id，可通过getPubTemplateTitleList接口获取
+// kidList		开发者自行组合好的模板关键词列表，最多支持5个，最少2个关键词组合
+// sceneDesc	服务场景描述，15个字以内
+//
+// 返回：
+// 成功返回 { "errcode": 0, "errmsg": "ok", "priTmplId": "9Aw5ZV1j9xdWTFEkqCpZ7mIBbSC34khK55OtzUPl0rU" }
+// 失败返回 { "errcode":200014,"errmsg":"template tid not exist"}
+func AddSubscribeTemplate(accessToken string, tid string, kidList []int64, sceneDesc string) (string, error) {
+	resData, err := MakePostReq(TokenUrl(ADD_SUBSCRIBE_TEMPLATE, accessToken), map[string]interface{}{
+		"tid":       tid,
+		"kidList":   kidList,
+		"sceneDesc": sceneDesc,
+	}, "application/json")
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		PriTmplId string `json:"priTmplId"`
+	}
+	err = ParseResult(resData, &result)
+	return result.PriTmplId, err
+}
+
+// DelSubscribeTemplate
+//
+// 参数：
+// priTmplId	要删除的模板id
+//
+// 返回：
+// 成功返回 { "errcode": 0, "errmsg": "ok" }
+// 失败返回 { "errcode":20001,"errmsg":"system error"}
+func DelSubscribeTemplate(accessToken string, priTmplId string) error {
+	resData, err := MakePostReq(TokenUrl(DEL_SUBSCRIBE_TEMPLATE, accessToken), map[string]interface{}{
+		"priTmplId": priTmplId,
+	}, "application/json")
+	if err != nil {
+		return err
+	}
+
+	return ParseResult(resData, nil)
+}
+
+// GetSubscribeCategory
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok", "data":[ { "id":616, "name":"公交" } ] }
+// 失败返回 { "errcode":40001,"errmsg":"invalid credential"}
+func GetSubscribeCategory(accessToken string) ([]SubscribeCategory, error) {
+	resData, err := MakeGetReq(GET_SUBSCRIBE_CATEGORY, map[string]string{
+		"access_token": accessToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Data []SubscribeCategory `json:"data"`
+	}
+	err = ParseResult(resData, &result)
+	return result.Data, err
+}
+
+// GetPubTemplateKeywords
+//
+// 参数：
+// tid	模板标题 id
+//
+// 返回：
+// 成功返回 { "count":1, "data":[ { "kid":1, "name":"物品名称", "example":"名称", "rule":"thing" } ] }
+// 失败返回 { "errcode":40001,"errmsg":"invalid credential"}
+func GetPubTemplateKeywords(accessToken string, tid string) ([]PubTemplateKeyword, error) {
+	resData, err := MakeGetReq(GET_PUB_TEMPLATE_KEYWORDS, map[string]string{
+		"access_token": accessToken,
+		"tid":          tid,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Data []PubTemplateKeyword `json:"data"`
+	}
+	err = ParseResult(resData, &result)
+	return result.Data, err
+}
+
+// GetPubTemplateTitles
+//
+// 参数：
+// ids		类目 id，多个用逗号隔开
+// start	用于分页，表示从 start 开始，从 0 开始计数
+// limit	用于分页，表示拉取 limit 条记录，最大为 30
+//
+// 返回：
+// 成功返回 { "count":55, "data":[ { "tid":99, "title":"付款成功通知", "type":2, "categoryId":"616" } ] }
+// 失败返回 { "errcode":40001,"errmsg":"invalid credential"}
+func GetPubTemplateTitles(accessToken string, ids string, start int, limit int) (PubTemplateTitleList, error) {
+	var list PubTemplateTitleList
+
+	resData, err := MakeGetReq(GET_PUB_TEMPLATE_TITLES, map[string]string{
+		"access_token": accessToken,
+		"ids":          ids,
+		"start":        strconv.Itoa(start),
+		"limit":        strconv.Itoa(limit),
+	})
+	if err != nil {
+		return list, err
+	}
+
+	err = ParseResult(resData, &list)
+	return list, err
+}
+
+// GetSubscribeTemplate
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok", "data":[ { "priTmplId":"9Aw5ZV1j9xdWTFEkqCpZ7mIBbSC34khK55OtzUPl0rU", "title":"报名结果通知", "content":"会议时间:{{date2.DATA}}\n会议地点:{{thing1.DATA}}\n", "example":"会议时间:2016年8月8日\n会议地点:TIT会议室\n", "type":2 } ] }
+// 失败返回 { "errcode":40001,"errmsg":"invalid credential"}
+func GetSubscribeTemplate(accessToken string) ([]SubscribeTemplate, error) {
+	resData, err := MakeGetReq(GET_SUBSCRIBE_TEMPLATE, map[string]string{
+		"access_token": accessToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Data []SubscribeTemplate `json:"data"`
+	}
+	err = ParseResult(resData, &result)
+	return result.Data, err
+}
+
+// SendSubscribeMessage
+//
+//	参数：{
+//		  "touser":"OPENID",
+//		  "template_id":"TEMPLATEID",
+//		  "page":"mp.weixin.qq.com",
+//		  "miniprogram":{
+//				"appid":"APPID",
+//				"pagepath":"index?foo=bar"
+//		  },
+//		  "data":{
+//				"name1":{ "value":"广州腾讯科技有限公司" },
+//				"thing8":{ "value":"广州腾讯科技有限公司" }
+//		  }
+//	}
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+// 失败返回 { "errcode":43101,"errmsg":"user refuse to accept the msg"}
+func SendSubscribeMessage(accessToken string, msg SubscribeMessage) error {
+	resData, err := MakePostReq(TokenUrl(SEND_SUBSCRIBE_MESSAGE, accessToken), msg, "application/json")
+	if err != nil {
+		return err
+	}
+
+	return ParseResult(resData, nil)
+}
+
+// OnceSubscribeAuthUrl 生成一次性订阅消息授权页地址，用户同意或取消后会跳转到
+// redirect_url?openid=OPENID&template_id=TEMPLATE_ID&action=ACTION&scene=SCENE&reserved=RESERVED
+//
+// 参数：
+// appid		公众号的唯一标识
+// scene		重定向后会带上scene参数，开发者可以填0-10000的整型值，用来标识订阅场景值
+// template_id	订阅消息模板ID
+// redirect_url	授权后重定向的回调地址
+// reserved		用于保持请求和回调的状态，授权请后原样带回给第三方
+func OnceSubscribeAuthUrl(appId string, scene int, templateId string, redirectUrl string, reserved string) string {
+	return ONCE_SUBSCRIBE_AUTH_URL + "?action=get_confirm" +
+		"&appid=" + appId +
+		"&scene=" + strconv.Itoa(scene) +
+		"&template_id=" + url.QueryEscape(templateId) +
+		"&redirect_url=" + url.QueryEscape(redirectUrl) +
+		"&reserved=" + url.QueryEscape(reserved) +
+		"#wechat_redirect"
+}
+
+// SendOnceSubscribeMessage
+//
+//	参数：{
+//		  "touser":"OPENID",
+//		  "template_id":"TEMPLATE_ID",
+//		  "url":"URL",
+//		  "scene":"SCENE",
+//		  "title":"TITLE",
+//		  "data":{
+//				"content":{ "value":"VALUE", "color":"COLOR" }
+//		  }
+//	}
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+// 失败返回 { "errcode":43101,"errmsg":"user refuse to accept the msg"}
+func SendOnceSubscribeMessage(accessToken string, msg OnceSubscribeMessage) error {
+	resData, err := MakePostReq(TokenUrl(SEND_ONCE_SUBSCRIBE_MESSAGE, accessToken), msg, "application/json")
+	if err != nil {
+		return err
+	}
+
+	return ParseResult(resData, nil)
+}
@@ -0,0 +1,211 @@
+package wechat
+
+import (
+	"errors"
+	"strconv"
+)
+
+// 用户标签管理
+//
+// 文档：https://developers.weixin.qq.com/doc/offiaccount/User_Management/User_Tag_Management.html
+
+const (
+	TAGS_CREATE          = "https://api.weixin.qq.com/cgi-bin/tags/create?access_token=ACCESS_TOKEN"                 // 创建标签
+	TAGS_GET             = "https://api.weixin.qq.com/cgi-bin/tags/get"                                              // 获取已创建的标签
+	TAGS_UPDATE          = "https://api.weixin.qq.com/cgi-bin/tags/update?access_token=ACCESS_TOKEN"                 // 编辑标签
+	TAGS_DELETE          = "https://api.weixin.qq.com/cgi-bin/tags/delete?access_token=ACCESS_TOKEN"                 // 删除标签
+	TAGS_BATCH_TAGGING   = "https://api.weixin.qq.com/cgi-bin/tags/members/batchtagging?access_token=ACCESS_TOKEN"   // 批量为用户打标签
+	TAGS_BATCH_UNTAGGING = "https://api.weixin.qq.com/cgi-bin/tags/members/batchuntagging?access_token=ACCESS_TOKEN" // 批量为用户取消标签
+	TAGS_GET_ID_LIST     = "https://api.weixin.qq.com/cgi-bin/tags/getidlist?access_token=ACCESS_TOKEN"              // 获取用户身上的标签列表
+	USER_TAG_GET         = "https://api.weixin.qq.com/cgi-bin/user/tag/get?access_token=ACCESS_TOKEN"                // 获取标签下粉丝列表
+
+	MAX_TAGGING_BATCH = 50 // 批量打标签与取消标签每次最多50个
+)
+
+var ErrTooManyOpenIds = errors.New("at most " + strconv.Itoa(MAX_TAGGING_BATCH) + " openids are allowed for each tagging")
+
+// Tag 用户标签，count 为此标签下粉丝数
+type Tag struct {
+	Id    int64  `json:"id"`
+	Name  string `json:"name"`
+	Count int64  `json:"count,omitempty"`
+}
+
+// CreateTag
+//
+//	参数：{
+//		  "tag":{ "name":"广东" }
+//	}
+//
+// 返回：
+// 成功返回 { "tag":{ "id":134, "name":"广东" } }
+// 失败返回 { "errcode":45157,"errmsg":"invalid tag name"}
+func CreateTag(accessToken string, name string) (Tag, error) {
+	var result struct {
+		Tag Tag `json:"tag"`
+	}
+	resData, err := MakePostReq(TokenUrl(TAGS_CREATE, accessToken), map[string]Tag{
+		"tag": {Name: name},
+	}, "application/json")
+	if err != nil {
+		return result.Tag, err
+	}
+
+	err = ParseResult(resData, &result)
+	return result.Tag, err
+}
+
+// GetTags
+//
+// 返回：
+// 成功返回 { "tags":[ { "id":1, "name":"每天一罐可乐星人", "count":0 }, { "id":2, "name":"星标组", "count":0 } ] }
+func GetTags(accessToken string) ([]Tag, error) {
+	var result struct {
+		Tags []Tag `json:"tags"`
+	}
+	resData, err := MakeGetReq(TAGS_GET, map[string]string{
+		"access_token": accessToken,
+	})
+	if err != nil {
+		return result.Tags, err
+	}
+
+	err = ParseResult(resData, &result)
+	return result.Tags, err
+}
+
+// UpdateTag
+//
+//	参数：{
+//		  "tag":{ "id":134, "name":"广东人" }
+//	}
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func UpdateTag(accessToken string, tagId int64, name string) error {
+	resData, err := MakePostReq(TokenUrl(TAGS_UPDATE, accessToken), map[string]Tag{
+		"tag": {Id: tagId, Name: name},
+	}, "application/json")
+	if err != nil {
+		return err
+	}
+	return ParseResult(resData, nil)
+}
+
+// DeleteTag 删除标签，粉丝数超过10w的标签需先取消部分粉丝的标签
+//
+//	参数：{
+//		  "tag":{ "id":134 }
+//	}
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+// 失败返回 { "errcode":45058,"errmsg":"can't modify sys tag"}
+func DeleteTag(accessToken string, tagId int64) error {
+	resData, err := MakePostReq(TokenUrl(TAGS_DELETE, accessToken), map[string]map[string]int64{
+		"tag": {"id": tagId},
+	}, "application/json")
+	if err != nil {
+		return err
+	}
+	return ParseResult(resData, nil)
+}
+
+// BatchTagging 批量为用户打标签，每次最多50个
+//
+//	参数：{
+//		  "openid_list":[ "ocYxcuAEy30bX0NXmGn4ypqx3tI0", "ocYxcuBt0mRugKZ7tGAHPnUaOW7Y" ],
+//		  "tagid":134
+//	}
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+// 失败返回 { "errcode":45059,"errmsg":"tag exceeds limit"}
+func BatchTagging(accessToken string, tagId int64, openIds []string) error {
+	return tagging(TAGS_BATCH_TAGGING, accessToken, tagId, openIds)
+}
+
+// BatchUntagging 批量为用户取消标签，每次最多50个
+//
+//	参数：{
+//		  "openid_list":[ "ocYxcuAEy30bX0NXmGn4ypqx3tI0", "ocYxcuBt0mRugKZ7tGAHPnUaOW7Y" ],
+//		  "tagid":134
+//	}
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func BatchUntagging(accessToken string, tagId int64, openIds []string) error {
+	return tagging(TAGS_BATCH_UNTAGGING, accessToken, tagId, openIds)
+}
+
+func tagging(api string, accessToken string, tagId int64, openIds []string) error {
+	if len(openIds) > MAX_TAGGING_BATCH {
+		return ErrTooManyOpenIds
+	}
+
+	resData, err := MakePostReq(TokenUrl(api, accessToken), map[string]interface{}{
+		"openid_list": openIds,
+		"tagid":       tagId,
+	}, "application/json")
+	if err != nil {
+		return err
+	}
+	return ParseResult(resData, nil)
+}
+
+// GetUserTagIdList 获取用户身上的标签列表
+//
+//	参数：{
+//		  "openid":"ocYxcuBt0mRugKZ7tGAHPnUaOW7Y"
+//	}
+//
+// 返回：
+// 成功返回 { "tagid_list":[ 134, 2 ] }
+func GetUserTagIdList(accessToken string, openId string) ([]int64, error) {
+	var result struct {
+		TagIdList []int64 `json:"tagid_list"`
+	}
+	resData, err := MakePostReq(TokenUrl(TAGS_GET_ID_LIST, accessToken), map[string]string{
+		"openid": openId,
+	}, "application/json")
+	if err != nil {
+		return result.TagIdList, err
+	}
+
+	err = ParseResult(resData, &result)
+	return result.TagIdList, err
+}
+
+// GetTagUsers 获取标签下粉丝列表，每次最多10000个
+//
+//	参数：{
+//		  "tagid":134,
+//		  "next_openid":""
+//	}
+//
+// 返回：
+// 成功返回 { "count":2, "data":{ "openid":[ "ocYxcuAEy30bX0NXmGn4ypqx3tI0", "ocYxcuBt0mRugKZ7tGAHPnUaOW7Y" ] }, "next_openid":"ocYxcuBt0mRugKZ7tGAHPnUaOW7Y" }
+func GetTagUsers(accessToken string, tagId int64, nextOpenId string) (OpenIdList, error) {
+	var list OpenIdList
+	resData, err := MakePostReq(TokenUrl(USER_TAG_GET, accessToken), map[string]interface{}{
+		"tagid":       tagId,
+		"next_openid": nextOpenId,
+	}, "application/json")
+	if err != nil {
+		return list, err
+	}
+
+	err = ParseResult(resData, &list)
+	return list, err
+}
+
+// NewTagUserIterator 遍历标签下的粉丝，nextOpenId 不为空时从该openid之后开始
+func NewTagUserIterator(token func() string, tagId int64, nextOpenId string) *UserIterator {
+	return &UserIterator{
+		token: token,
+		fetch: func(accessToken string, nextOpenId string) (OpenIdList, error) {
+			return GetTagUsers(accessToken, tagId, nextOpenId)
+		},
+		nextOpenId: nextOpenId,
+	}
+}
@@ -0,0 +1,338 @@
+package wechat
+
+// 用户管理与黑名单
+//
+// 文档：https://developers.weixin.qq.com/doc/offiaccount/User_Management/Get_users_basic_information_UnionID.html
+//      https://developers.weixin.qq.com/doc/offiaccount/User_Management/Getting_a_User_List.html
+//      https://developers.weixin.qq.com/doc/offiaccount/User_Management/Manage_blacklist.html
+
+const (
+	USER_INFO          = "https://api.weixin.qq.com/cgi-bin/user/info"                                               // 获取用户基本信息
+	USER_INFO_BATCHGET = "https://api.weixin.qq.com/cgi-bin/user/info/batchget?access_token=ACCESS_TOKEN"            // 批量获取用户基本信息
+	USER_GET           = "https://api.weixin.qq.com/cgi-bin/user/get"                                                // 获取关注者列表
+	USER_UPDATE_REMARK = "https://api.weixin.qq.com/cgi-bin/user/info/updateremark?access_token=ACCESS_TOKEN"        // 设置用户备注名
+	BLACKLIST_GET      = "https://api.weixin.qq.com/cgi-bin/tags/members/getblacklist?access_token=ACCESS_TOKEN"     // 获取黑名单列表
+	BLACKLIST_BATCH    = "https://api.weixin.qq.com/cgi-bin/tags/members/batchblacklist?access_token=ACCESS_TOKEN"   // 拉黑用户
+	BLACKLIST_UNBATCH  = "https://api.weixin.qq.com/cgi-bin/tags/members/batchunblacklist?access_token=ACCESS_TOKEN" // 取消拉黑用户
+
+	MAX_USER_BATCHGET   = 100 // 批量获取用户信息每次最多100个
+	MAX_BLACKLIST_BATCH = 20  // 拉黑与取消拉黑每次最多20个
+)
+
+// User 用户基本信息，subscribe 为0时只有 openid 与 unionid
+type User struct {
+	Subscribe      int     `json:"subscribe"`
+	OpenId         string  `json:"openid"`
+	Nickname       string  `json:"nickname,omitempty"`
+	Sex            int     `json:"sex,omitempty"`
+	Language       string  `json:"language,omitempty"`
+	City           string  `json:"city,omitempty"`
+	Province       string  `json:"province,omitempty"`
+	Country        string  `json:"country,omitempty"`
+	HeadImgUrl     string  `json:"headimgurl,omitempty"`
+	SubscribeTime  int64   `json:"subscribe_time,omitempty"`
+	UnionId        string  `json:"unionid,omitempty"`
+	Remark         string  `json:"remark"`
+	GroupId        int64   `json:"groupid"`
+	TagIdList      []int64 `json:"tagid_list"`
+	SubscribeScene string  `json:"subscribe_scene,omitempty"` // 关注的渠道来源，如 ADD_SCENE_QR_CODE
+	QrScene        int64   `json:"qr_scene,omitempty"`
+	QrSceneStr     string  `json:"qr_scene_str,omitempty"`
+}
+
+// OpenIdList 关注者列表与黑名单列表，每次最多返回10000个
+type OpenIdList struct {
+	Total int64 `json:"total"`
+	Count int64 `json:"count"`
+	Data  struct {
+		OpenId []string `json:"openid"`
+	} `json:"data"`
+	NextOpenId string `json:"next_openid"`
+}
+
+// GetUserInfo
+//
+// 参数：
+// openid	用户的标识
+// lang		返回国家地区语言版本，zh_CN 简体，zh_TW 繁体，en 英语
+//
+// 返回：
+//
+//	成功返回 {
+//		  "subscribe":1, "openid":"o6_bmjrPTlm6_2sgVt7hMZOPfL2M", "nickname":"Band", "sex":1, "language":"zh_CN",
+//		  "city":"广州", "province":"广东", "country":"中国", "headimgurl":"http://thirdwx.qlogo.cn/mmopen/.../0",
+//		  "subscribe_time":1382694957, "unionid":"o6_bmasdasdsad6_2sgVt7hMZOPfL", "remark":"", "groupid":0,
+//		  "tagid_list":[128,2], "subscribe_scene":"ADD_SCENE_QR_CODE", "qr_scene":98765, "qr_scene_str":""
+//	}
+//
+// 失败返回 { "errcode":40013,"errmsg":"invalid appid"}
+func GetUserInfo(accessToken string, openId string, lang string) (User, error) {
+	var user User
+	if lang == "" {
+		lang = "zh_CN"
+	}
+	resData, err := MakeGetReq(USER_INFO, map[string]string{
+		"access_token": accessToken,
+		"openid":       openId,
+		"lang":         lang,
+	})
+	if err != nil {
+		return user, err
+	}
+
+	err = ParseResult(resData, &user)
+	return user, err
+}
+
+// BatchGetUserInfo 批量获取用户基本信息，超过100个时分批请求，按 openIds 的顺序返回
+//
+//	参数：{
+//		  "user_list":[ { "openid":"otvxTs4dckWG7imySrJd6jSi0CWE", "lang":"zh_CN" } ]
+//	}
+//
+// 返回：
+// 成功返回 { "user_info_list":[ { "subscribe":1, "openid":"otvxTs4dckWG7imySrJd6jSi0CWE", ... } ] }
+func BatchGetUserInfo(accessToken string, openIds []string, lang string) ([]User, error) {
+	type userItem struct {
+		OpenId string `json:"openid"`
+		Lang   string `json:"lang"`
+	}
+	if lang == "" {
+		lang = "zh_CN"
+	}
+
+	users := make([]User, 0, len(openIds))
+	for start := 0; start < len(openIds); start += MAX_USER_BATCHGET {
+		end := start + MAX_USER_BATCHGET
+		if end > len(openIds) {
+			end = len(openIds)
+		}
+
+		userList := make([]userItem, 0, end-start)
+		for _, openId := range openIds[start:end] {
+			userList = append(userList, userItem{OpenId: openId, Lang: lang})
+		}
+
+		resData, err := MakePostReq(TokenUrl(USER_INFO_BATCHGET, accessToken), map[string][]userItem{
+			"user_list": userList,
+		}, "application/json")
+		if err != nil {
+			return users, err
+		}
+
+		var result struct {
+			UserInfoList []User `json:"user_info_list"`
+		}
+		if err := ParseResult(resData, &result); err != nil {
+			return users, err
+		}
+		users = append(users, result.UserInfoList...)
+	}
+	return users, nil
+}
+
+// GetUserList 获取关注者列表
+//
+// 参数：
+// next_openid	第一个拉取的OPENID，不填默认从头开始拉取
+//
+// 返回：
+// 成功返回 { "total":23000, "count":10000, "data":{ "openid":[ "OPENID1", "OPENID2" ] }, "next_openid":"OPENID10000" }
+func GetUserList(accessToken string, nextOpenId string) (OpenIdList, error) {
+	var list OpenIdList
+	resData, err := MakeGetReq(USER_GET, map[string]string{
+		"access_token": accessToken,
+		"next_openid":  nextOpenId,
+	})
+	if err != nil {
+		return list, err
+	}
+
+	err = ParseResult(resData, &list)
+	return list, err
+}
+
+// UpdateUserRemark
+//
+//	参数：{
+//		  "openid":"oDF3iY9ffA-hqb2vVvbr7qxf6A0Q",
+//		  "remark":"pangzi"
+//	}
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func UpdateUserRemark(accessToken string, openId string, remark string) error {
+	resData, err := MakePostReq(TokenUrl(USER_UPDATE_REMARK, accessToken), map[string]string{
+		"openid": openId,
+		"remark": remark,
+	}, "application/json")
+	if err != nil {
+		return err
+	}
+	return ParseResult(resData, nil)
+}
+
+// GetBlacklist 获取黑名单列表
+//
+//	参数：{
+//		  "begin_openid":"OPENID1"
+//	}
+//
+// 返回：
+// 成功返回 { "total":23000, "count":10000, "data":{ "openid":[ "OPENID1", "OPENID2" ] }, "next_openid":"OPENID10000" }
+func GetBlacklist(accessToken string, beginOpenId string) (OpenIdList, error) {
+	var list OpenIdList
+	resData, err := MakePostReq(TokenUrl(BLACKLIST_GET, accessToken), map[string]string{
+		"begin_openid": beginOpenId,
+	}, "application/json")
+	if err != nil {
+		return list, err
+	}
+
+	err = ParseResult(resData, &list)
+	return list, err
+}
+
+// BatchBlacklist 拉黑用户，超过20个时分批请求
+//
+//	参数：{
+//		  "openid_list":[ "OPENID1", "OPENID2" ]
+//	}
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+// 失败返回 { "errcode":49003,"errmsg":"not most blacklist"}
+func BatchBlacklist(accessToken string, openIds []string) error {
+	return batchOpenIds(BLACKLIST_BATCH, accessToken, openIds)
+}
+
+// BatchUnblacklist 取消拉黑用户，超过20个时分批请求
+//
+//	参数：{
+//		  "openid_list":[ "OPENID1", "OPENID2" ]
+//	}
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func BatchUnblacklist(accessToken string, openIds []string) error {
+	return batchOpenIds(BLACKLIST_UNBATCH, accessToken, openIds)
+}
+
+func batchOpenIds(api string, accessToken string, openIds []string) error {
+	for start := 0; start < len(openIds); start += MAX_BLACKLIST_BATCH {
+		end := start + MAX_BLACKLIST_BATCH
+		if end > len(openIds) {
+			end = len(openIds)
+		}
+
+		resData, err := MakePostReq(TokenUrl(api, accessToken), map[string][]string{
+			"openid_list": openIds[start:end],
+		}, "application/json")
+		if err != nil {
+			return err
+		}
+		if err := ParseResult(resData, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UserIterator 逐个遍历关注者、黑名单或标签下粉丝的openid，按 next_openid 自动翻页，
+// 每页请求时调用 token 获取 access_token，遍历大量用户时不会因 access_token 过期中断
+//
+// iterator := wechat.NewUserIterator(GetToken, "")
+//
+//	for iterator.Next() {
+//		openId := iterator.OpenId()
+//	}
+//
+//	if err := iterator.Err(); err != nil {
+//		// 从 iterator.NextOpenId() 处继续
+//	}
+type UserIterator struct {
+	token func() string
+	fetch func(accessToken string, nextOpenId string) (OpenIdList, error)
+
+	openIds    []string
+	index      int
+	total      int64
+	nextOpenId string
+	done       bool
+	err        error
+}
+
+// NewUserIterator 遍历关注者，nextOpenId 不为空时从该openid之后开始
+func NewUserIterator(token func() string, nextOpenId string) *UserIterator {
+	return &UserIterator{token: token, fetch: GetUserList, nextOpenId: nextOpenId}
+}
+
+// NewBlacklistIterator 遍历黑名单，beginOpenId 不为空时从该openid之后开始
+func NewBlacklistIterator(token func() string, beginOpenId string) *UserIterator {
+	return &UserIterator{token: token, fetch: GetBlacklist, nextOpenId: beginOpenId}
+}
+
+// Next 移动到下一个openid，遍历结束或出错时返回false
+func (it *UserIterator) Next() bool {
+	if it.index+1 < len(it.openIds) {
+		it.index++
+		return true
+	}
+
+	for !it.done && it.err == nil {
+		list, err := it.fetch(it.token(), it.nextOpenId)
+		if err != nil {
+			it.err = err
+			break
+		}
+		it.total = list.Total
+		it.openIds = list.Data.OpenId
+		it.index = 0
+
+		// 拉取完毕后再次请求时 count 为0且 next_openid 为空
+		if len(it.openIds) == 0 || list.NextOpenId == "" {
+			it.done = true
+		} else {
+			it.nextOpenId = list.NextOpenId
+		}
+		if len(it.openIds) > 0 {
+			return true
+		}
+	}
+
+	it.openIds = nil
+	return false
+}
+
+// OpenId 当前的openid
+func (it *UserIterator) OpenId() string {
+	if it.index < len(it.openIds) {
+		return it.openIds[it.index]
+	}
+	return ""
+}
+
+// Page 当前页剩余的openid，用于批量获取用户信息，之后的 Next 从下一页开始
+func (it *UserIterator) Page() []string {
+	if it.index >= len(it.openIds) {
+		return nil
+	}
+	page := it.openIds[it.index:]
+	it.index = len(it.openIds) - 1
+	return page
+}
+
+// Total 关注者或黑名单的总数，第一次调用 Next 后有效，标签下粉丝列表没有总数
+func (it *UserIterator) Total() int64 {
+	return it.total
+}
+
+// NextOpenId 下一页的起始openid，出错后可用于重新创建迭代器继续遍历
+func (it *UserIterator) NextOpenId() string {
+	return it.nextOpenId
+}
+
+// Err 遍历中发生的错误
+func (it *UserIterator) Err() error {
+	return it.err
+}
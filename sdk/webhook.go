@@ -0,0 +1,109 @@
+package wechat
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// 推送消息转发
+//
+// go-wechat 将解析后的推送消息以json POST到业务服务，请求头中带有投递id、时间戳与签名，
+// 签名为 HMAC-SHA256(secret, timestamp + "." + body) 的十六进制字符串，
+// 业务服务可以在响应中返回与客服消息相同格式的json作为被动回复
+
+const (
+	WEBHOOK_HEADER_DELIVERY  = "X-Wechat-Delivery"  // 投递id，重试时保持不变，可用于排重
+	WEBHOOK_HEADER_TIMESTAMP = "X-Wechat-Timestamp" // 投递时间戳
+	WEBHOOK_HEADER_SIGNATURE = "X-Wechat-Signature" // 签名，格式为 sha256=HEX
+)
+
+var (
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+	ErrInvalidWebhookReply     = errors.New("invalid webhook reply")
+)
+
+// WebhookPayload 转发的消息体
+type WebhookPayload struct {
+	DeliveryId string      `json:"delivery_id"`
+	AccountId  int         `json:"account_id"`
+	AppId      string      `json:"app_id"`
+	Message    *MixMessage `json:"message"`
+}
+
+// WebhookSignature 计算转发消息的签名
+func WebhookSignature(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook 校验转发消息的签名与时间戳，tolerance 为允许的时间误差(秒)，为0时不校验时间戳
+func VerifyWebhook(secret string, timestamp string, signature string, body []byte, now int64, tolerance int64) error {
+	if !hmac.Equal([]byte(WebhookSignature(secret, timestamp, body)), []byte(signature)) {
+		return ErrInvalidWebhookSignature
+	}
+	if tolerance > 0 {
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || ts < now-tolerance || ts > now+tolerance {
+			return ErrInvalidWebhookSignature
+		}
+	}
+	return nil
+}
+
+// ParseWebhookReply 解析业务服务的响应作为被动回复
+//
+// 响应为空或 success 时返回nil，其余与客服消息的格式相同，如
+// { "msgtype":"text", "text":{ "content":"Hello World" } }
+// 另支持 { "msgtype":"transfer_customer_service", "customservice":{ "kf_account":"test1@test" } }
+func ParseWebhookReply(data []byte) (Reply, error) {
+	body := strings.TrimSpace(string(data))
+	if body == "" || body == "success" {
+		return nil, nil
+	}
+
+	var msg CustomMessage
+	if err := json.Unmarshal([]byte(body), &msg); err != nil {
+		return nil, err
+	}
+
+	switch msg.MsgType {
+	case REPLY_TYPE_TEXT:
+		if msg.Text != nil {
+			return &TextReply{msg.Text.Content}, nil
+		}
+	case REPLY_TYPE_IMAGE:
+		if msg.Image != nil {
+			return &ImageReply{msg.Image.MediaId}, nil
+		}
+	case REPLY_TYPE_VOICE:
+		if msg.Voice != nil {
+			return &VoiceReply{msg.Voice.MediaId}, nil
+		}
+	case REPLY_TYPE_VIDEO:
+		if msg.Video != nil {
+			return &VideoReply{msg.Video.MediaId, msg.Video.Title, msg.Video.Description}, nil
+		}
+	case REPLY_TYPE_MUSIC:
+		if msg.Music != nil {
+			return &MusicReply{msg.Music.Title, msg.Music.Description, msg.Music.MusicUrl, msg.Music.HQMusicUrl, msg.Music.ThumbMediaId}, nil
+		}
+	case REPLY_TYPE_NEWS:
+		if msg.News != nil {
+			return &NewsReply{msg.News.Articles}, nil
+		}
+	case REPLY_TYPE_TRANSFER_CUSTOMER_SERVICE:
+		reply := &TransferCustomerServiceReply{}
+		if msg.CustomService != nil {
+			reply.KfAccount = msg.CustomService.KfAccount
+		}
+		return reply, nil
+	}
+
+	return nil, ErrInvalidWebhookReply
+}
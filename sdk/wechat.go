@@ -10,6 +10,8 @@ import (
 	"github.com/json-iterator/go"
 	"time"
 	"github.com/xlstudio/wxbizdatacrypt"
+	"strings"
+	"strconv"
 )
 
 // 内部api
@@ -391,6 +393,36 @@ func GetToken() string {
 	return token
 }
 
+// TokenUrl 将接口地址中的ACCESS_TOKEN占位符替换为真实的access_token
+func TokenUrl(api string, accessToken string) string {
+	return strings.Replace(api, "ACCESS_TOKEN", accessToken, 1)
+}
+
+// CommonError 微信接口返回的通用错误
+type CommonError struct {
+	ErrCode int64  `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+func (e *CommonError) Error() string {
+	return "wechat error " + strconv.FormatInt(e.ErrCode, 10) + ": " + e.ErrMsg
+}
+
+// ParseResult 解析微信接口返回的json，errcode不为0时返回*CommonError
+func ParseResult(data []byte, v interface{}) error {
+	var commonError CommonError
+	if err := json.Unmarshal(data, &commonError); err != nil {
+		return err
+	}
+	if commonError.ErrCode != 0 {
+		return &commonError
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
 func MakeGetReq(url string, data map[string]string) ([]byte, error) {
 
 	var count = 0
@@ -438,18 +470,18 @@ func MakeGetReq(url string, data map[string]string) ([]byte, error) {
 	return body, nil
 }
 
-func MakePostReq(url string, postData map[string]interface{}, contentType string) ([]byte, error) {
+func MakePostReq(url string, postData interface{}, contentType string) ([]byte, error) {
 	jsonData, jsonErr := json.Marshal(postData)
 	if jsonErr != nil {
 		return []byte{}, jsonErr
 	}
 
-	res, _ := http.Post(url, contentType, bytes.NewBuffer(jsonData))
+	res, err := http.Post(url, contentType, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return []byte{}, err
+	}
 
-	var (
-		reader io.ReadCloser
-		err    error
-	)
+	var reader io.ReadCloser
 	if res.Header.Get("Content-Encoding") == "gzip" {
 		reader, err = gzip.NewReader(res.Body)
 		if err != nil {
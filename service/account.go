@@ -1,17 +1,23 @@
 package main
 
+import "strconv"
+
 // 从数据库初始化所有应用账号对象，存进内存中
 
 var Account = make(map[int]map[string]string)
 
 func InitAccount() {
 
-	account, _ := Query("select acid,app_id,app_secret from wx_official_account where state = 1")
+	account, _ := Query("select acid,app_id,app_secret,token,encoding_aes_key,encrypt_mode from wx_official_account where state = 1")
 
 	for i := 0; i < len(account); i++ {
 		Account[int(account[i]["acid"].(int64))] = map[string]string{
+			"accountId": strconv.FormatInt(account[i]["acid"].(int64), 10),
 			"appId": account[i]["app_id"].(string),
 			"appSecret": account[i]["app_secret"].(string),
+			"token": account[i]["token"].(string),
+			"encodingAESKey": account[i]["encoding_aes_key"].(string),
+			"encryptMode": strconv.FormatInt(account[i]["encrypt_mode"].(int64), 10),
 		}
 	}
 }
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chenhg5/go-wechat/sdk"
+)
+
+// 推送消息归档，ARCHIVE_ENABLED 为 true 时排重后的每条消息与事件写入 wx_message，保存明文xml与规范化的字段。
+//
+// wx_message 按月分区(p{YYYYMM})，每天检查并提前创建后两个月的分区，超过 ARCHIVE_RETENTION_DAYS 天的分区整体删除，
+// 未满一个分区的过期消息按批删除。图片、语音、视频消息的临时素材只保存3天，配置 ARCHIVE_MEDIA_DIR 时收到消息后立即下载到
+// ARCHIVE_MEDIA_DIR/{accountId}/{YYYYMM}/ 下，失败的下载在有效期内重试。下载由 ARCHIVE_MEDIA_WORKERS 个协程从队列中依次执行，
+// 队列满时消息保持 pending，由重试任务下载
+
+const (
+	ARCHIVE_MAINTAIN_LOCK      = "go-wechat:archive_maintain"
+	ARCHIVE_MAINTAIN_LOCK_TTL  = time.Hour
+	ARCHIVE_MEDIA_LOCK         = "go-wechat:archive_media"
+	ARCHIVE_MEDIA_LOCK_TTL     = 10 * time.Minute
+	ARCHIVE_MEDIA_RETRY        = 5 * time.Minute // 下载失败的重试检查间隔
+	ARCHIVE_MEDIA_MAX_ATTEMPTS = 5               // 每个媒体文件最多下载次数
+	ARCHIVE_MEDIA_EXPIRE_DAYS  = 3               // 临时素材的有效天数
+	ARCHIVE_PARTITION_AHEAD    = 2               // 提前创建的月分区数
+	ARCHIVE_PURGE_BATCH        = 1000
+	ARCHIVE_MEDIA_QUEUE_SIZE   = 1000
+	ARCHIVE_VIDEO_TIMEOUT      = 5 * time.Minute // 从 video_url 下载视频的超时时间
+
+	ARCHIVE_MEDIA_PENDING = "pending"
+	ARCHIVE_MEDIA_SUCCESS = "success"
+	ARCHIVE_MEDIA_FAILED  = "failed"
+)
+
+// archiveMediaJob 等待下载的媒体文件
+type archiveMediaJob struct {
+	accountId int
+	id        int64
+	mediaId   string
+	ext       string
+	createdAt time.Time
+}
+
+var archiveMediaQueue chan archiveMediaJob
+
+var archiveVideoClient = &http.Client{Timeout: ARCHIVE_VIDEO_TIMEOUT}
+
+// InitArchive 启动分区维护、过期清理与媒体文件下载的重试
+func InitArchive() {
+	if !GetEnvBool("ARCHIVE_ENABLED", false) {
+		return
+	}
+	go func() {
+		MaintainArchive()
+		for range time.Tick(24 * time.Hour) {
+			MaintainArchive()
+		}
+	}()
+	if GetEnvString("ARCHIVE_MEDIA_DIR", "") != "" {
+		archiveMediaQueue = make(chan archiveMediaJob, ARCHIVE_MEDIA_QUEUE_SIZE)
+		for i := 0; i < GetEnvInt("ARCHIVE_MEDIA_WORKERS", 4); i++ {
+			go func() {
+				for job := range archiveMediaQueue {
+					DownloadArchiveMedia(job.accountId, job.id, job.mediaId, job.ext, job.createdAt)
+				}
+			}()
+		}
+		go func() {
+			for range time.Tick(ARCHIVE_MEDIA_RETRY) {
+				RetryArchiveMedia()
+			}
+		}()
+	}
+}
+
+// Archive 将推送消息写入 wx_message，写入失败只记录错误，不影响后续处理
+func Archive() wechat.Middleware {
+	return func(next wechat.HandlerFunc) wechat.HandlerFunc {
+		return func(ctx *wechat.Context) (wechat.Reply, error) {
+			if err := ArchiveMessage(ctx); err != nil {
+				LogError(err)
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// ArchiveMessage 写入一条推送消息，媒体消息加入下载队列
+func ArchiveMessage(ctx *wechat.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("archive panic: %v", r)
+		}
+	}()
+
+	msg := ctx.Message
+	mediaId, mediaStatus := archiveMediaId(msg), ""
+	if mediaId != "" && GetEnvString("ARCHIVE_MEDIA_DIR", "") != "" {
+		mediaStatus = ARCHIVE_MEDIA_PENDING
+	}
+	createdAt := time.Now()
+
+	rs := Exec("insert into wx_message (acid, msg_id, openid, msg_type, event, event_key, content, media_id, media_status, raw, create_time, created_at) "+
+		"values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		ctx.AccountId, msg.MsgId, msg.FromUserName, msg.MsgType, msg.Event, msg.EventKey, ArchiveContent(msg),
+		mediaId, mediaStatus, string(ctx.Raw), msg.CreateTime, createdAt.Format("2006-01-02 15:04:05"))
+
+	if mediaStatus == ARCHIVE_MEDIA_PENDING {
+		id, _ := rs.LastInsertId()
+		select {
+		case archiveMediaQueue <- archiveMediaJob{ctx.AccountId, id, mediaId, archiveMediaExt(msg.MsgType, msg.Format), createdAt}:
+		default:
+			// 队列满或没有启动下载协程时保持 pending，由 RetryArchiveMedia 下载
+		}
+	}
+	return nil
+}
+
+// ArchiveContent 返回消息中用于搜索的文本，文本消息为内容，语音为识别结果，链接为标题、描述与地址，位置为地址，事件为 EventKey
+func ArchiveContent(msg *wechat.MixMessage) string {
+	switch msg.MsgType {
+	case wechat.MSG_TYPE_TEXT:
+		return msg.Content
+	case wechat.MSG_TYPE_VOICE:
+		return msg.Recognition
+	case wechat.MSG_TYPE_LINK:
+		return strings.Join([]string{msg.Title, msg.Description, msg.Url}, "\n")
+	case wechat.MSG_TYPE_LOCATION:
+		return msg.Label
+	case wechat.MSG_TYPE_IMAGE:
+		return msg.PicUrl
+	}
+	return msg.EventKey
+}
+
+func archiveMediaId(msg *wechat.MixMessage) string {
+	switch msg.MsgType {
+	case wechat.MSG_TYPE_IMAGE, wechat.MSG_TYPE_VOICE, wechat.MSG_TYPE_VIDEO, wechat.MSG_TYPE_SHORT_VIDEO:
+		return msg.MediaId
+	}
+	return ""
+}
+
+// archiveMediaExt 响应中没有文件名时使用的扩展名
+func archiveMediaExt(msgType string, format string) string {
+	switch msgType {
+	case wechat.MSG_TYPE_IMAGE:
+		return ".jpg"
+	case wechat.MSG_TYPE_VOICE:
+		if format != "" {
+			return "." + strings.ToLower(format)
+		}
+		return ".amr"
+	}
+	return ".mp4"
+}
+
+// DownloadArchiveMedia 下载消息的临时素材，结果记录在 media_status 与 media_path
+func DownloadArchiveMedia(accountId int, id int64, mediaId string, ext string, createdAt time.Time) {
+	defer func() {
+		if r := recover(); r != nil {
+			LogError(fmt.Errorf("archive media panic: %v", r))
+		}
+	}()
+
+	dir := filepath.Join(GetEnvString("ARCHIVE_MEDIA_DIR", ""), strconv.Itoa(accountId), createdAt.Format("200601"))
+	localPath, err := DownloadArchiveFile(accountId, dir, strconv.FormatInt(id, 10), mediaId, ext)
+	if err != nil {
+		LogError(err)
+		Exec("update wx_message set media_status = ?, media_attempts = media_attempts + 1 where id = ? and created_at = ?",
+			ARCHIVE_MEDIA_FAILED, id, createdAt.Format("2006-01-02 15:04:05"))
+		return
+	}
+	Exec("update wx_message set media_status = ?, media_path = ?, media_attempts = media_attempts + 1 where id = ? and created_at = ?",
+		ARCHIVE_MEDIA_SUCCESS, localPath, id, createdAt.Format("2006-01-02 15:04:05"))
+}
+
+// DownloadArchiveFile 使用账号自己的 access_token 通过 media/get 下载临时素材到 dir/{name}{ext}，
+// 临时素材只能由收到消息的账号下载，视频从 video_url 下载，先写入临时文件再重命名
+func DownloadArchiveFile(accountId int, dir string, name string, mediaId string, ext string) (string, error) {
+	token := GetAccountToken(accountId)
+	if token == "" {
+		return "", NoAccountTokenError(accountId)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	body, info, err := wechat.OpenMedia(token, mediaId)
+	if err != nil {
+		return "", err
+	}
+	if body == nil {
+		if info.VideoUrl == "" {
+			return "", errors.New("素材没有文件: " + mediaId)
+		}
+		res, err := archiveVideoClient.Get(info.VideoUrl)
+		if err != nil {
+			return "", err
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return "", errors.New("网络错误")
+		}
+		body = res.Body
+	}
+	defer body.Close()
+
+	if fileExt := path.Ext(info.FileName); fileExt != "" {
+		ext = fileExt
+	}
+	localPath := filepath.Join(dir, name+ext)
+
+	f, err := os.Create(localPath + ".tmp")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		os.Remove(localPath + ".tmp")
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(localPath + ".tmp")
+		return "", err
+	}
+	return localPath, os.Rename(localPath+".tmp", localPath)
+}
+
+// RetryArchiveMedia 重试有效期内下载失败的媒体文件，以及服务重启前没有完成的下载
+func RetryArchiveMedia() {
+	if !RedisClient.SetNX(ARCHIVE_MEDIA_LOCK, 1, ARCHIVE_MEDIA_LOCK_TTL) {
+		return
+	}
+	defer RedisClient.Del(ARCHIVE_MEDIA_LOCK)
+	defer func() {
+		if r := recover(); r != nil {
+			LogError(fmt.Errorf("archive media retry panic: %v", r))
+		}
+	}()
+
+	now := time.Now()
+	messages, _ := Query("select id, acid, msg_type, media_id, raw, created_at from wx_message "+
+		"where created_at > ? and created_at < ? and media_status in (?, ?) and media_attempts < ? order by created_at",
+		now.AddDate(0, 0, -ARCHIVE_MEDIA_EXPIRE_DAYS).Format("2006-01-02 15:04:05"), now.Add(-ARCHIVE_MEDIA_RETRY).Format("2006-01-02 15:04:05"),
+		ARCHIVE_MEDIA_PENDING, ARCHIVE_MEDIA_FAILED, ARCHIVE_MEDIA_MAX_ATTEMPTS)
+
+	for _, message := range messages {
+		createdAt, err := time.ParseInLocation("2006-01-02 15:04:05", message["created_at"].(string), time.Local)
+		if err != nil {
+			continue
+		}
+		var format string
+		if msg, err := wechat.ParseMessage([]byte(message["raw"].(string))); err == nil {
+			format = msg.Format
+		}
+		DownloadArchiveMedia(int(message["acid"].(int64)), message["id"].(int64), message["media_id"].(string),
+			archiveMediaExt(message["msg_type"].(string), format), createdAt)
+	}
+}
+
+// MaintainArchive 创建后续的月分区并清理过期消息，多个实例只有一个执行
+func MaintainArchive() {
+	if !RedisClient.SetNX(ARCHIVE_MAINTAIN_LOCK, 1, ARCHIVE_MAINTAIN_LOCK_TTL) {
+		return
+	}
+	defer RedisClient.Del(ARCHIVE_MAINTAIN_LOCK)
+	defer func() {
+		if r := recover(); r != nil {
+			LogError(fmt.Errorf("archive maintain panic: %v", r))
+		}
+	}()
+
+	if err := EnsureArchivePartitions(time.Now(), ARCHIVE_PARTITION_AHEAD); err != nil {
+		LogError(err)
+	}
+	if days := GetEnvInt("ARCHIVE_RETENTION_DAYS", 180); days > 0 {
+		PurgeArchive(time.Now().AddDate(0, 0, -days))
+	}
+}
+
+// archivePartitions 返回 wx_message 的月分区，expired 为1时分区内的消息都在 before 之前，表没有分区时返回空
+func archivePartitions(before string) []map[string]interface{} {
+	partitions, _ := Query("select partition_name as name, cast(partition_description as unsigned) <= to_days(?) as expired "+
+		"from information_schema.partitions where table_schema = database() and table_name = 'wx_message' and partition_name like 'p2%' "+
+		"order by partition_ordinal_position", before)
+	return partitions
+}
+
+// EnsureArchivePartitions 从 p_max 中拆分出本月与之后 ahead 个月的分区
+func EnsureArchivePartitions(now time.Time, ahead int) error {
+	existing := map[string]bool{}
+	for _, partition := range archivePartitions(now.Format("2006-01-02 15:04:05")) {
+		existing[partition["name"].(string)] = true
+	}
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+
+	for i := 0; i <= ahead; i++ {
+		start := month.AddDate(0, i, 0)
+		name := "p" + start.Format("200601")
+		if existing[name] {
+			continue
+		}
+		_, err := SqlDB.Exec("alter table wx_message reorganize partition p_max into (" +
+			"partition " + name + " values less than (to_days('" + start.AddDate(0, 1, 0).Format("2006-01-02") + "')), " +
+			"partition p_max values less than maxvalue)")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeArchive 删除所有账号 before 之前的消息与媒体文件，整个分区过期时直接删除分区，返回删除的分区数与按批删除的消息数，
+// 只由全局的过期清理调用
+func PurgeArchive(before time.Time) (int, int) {
+	cutoff := before.Format("2006-01-02 15:04:05")
+	droppedPartitions := 0
+	for _, partition := range archivePartitions(cutoff) {
+		if partition["expired"].(int64) != 1 {
+			continue
+		}
+		name := partition["name"].(string)
+		files, _ := Query("select media_path from wx_message partition (" + name + ") where media_path != ''")
+		for _, file := range files {
+			os.Remove(file["media_path"].(string))
+		}
+		if _, err := SqlDB.Exec("alter table wx_message drop partition " + name); err != nil {
+			LogError(err)
+			break
+		}
+		droppedPartitions++
+	}
+
+	return droppedPartitions, purgeArchiveRows("created_at < ?", cutoff)
+}
+
+// PurgeAccountArchive 按批删除一个账号 before 之前的消息与媒体文件，不删除分区，返回删除的消息数
+func PurgeAccountArchive(accountId int, before time.Time) int {
+	return purgeArchiveRows("acid = ? and created_at < ?", accountId, before.Format("2006-01-02 15:04:05"))
+}
+
+// purgeArchiveRows 按批删除满足 where 的消息与媒体文件
+func purgeArchiveRows(where string, args ...interface{}) int {
+	deletedRows := 0
+	for {
+		messages, _ := Query("select id, media_path from wx_message where "+where+" limit ?", append(args, ARCHIVE_PURGE_BATCH)...)
+		if len(messages) == 0 {
+			break
+		}
+		ids := make([]interface{}, 0, len(messages))
+		for _, message := range messages {
+			if mediaPath := message["media_path"].(string); mediaPath != "" {
+				os.Remove(mediaPath)
+			}
+			ids = append(ids, message["id"])
+		}
+		Exec("delete from wx_message where "+where+" and id in (?"+strings.Repeat(", ?", len(ids)-1)+")",
+			append(append([]interface{}{}, args...), ids...)...)
+		deletedRows += len(ids)
+	}
+	return deletedRows
+}
+
+// OpenArchiveMedia 打开账号的归档消息下载到本地的媒体文件
+func OpenArchiveMedia(accountId int, id string) (io.ReadCloser, wechat.MediaInfo, error) {
+	var info wechat.MediaInfo
+	messages, _ := Query("select media_path from wx_message where acid = ? and id = ? and media_status = ?",
+		accountId, id, ARCHIVE_MEDIA_SUCCESS)
+	if len(messages) == 0 {
+		return nil, info, errors.New("媒体文件不存在")
+	}
+	localPath := messages[0]["media_path"].(string)
+	f, err := os.Open(localPath)
+	if err != nil {
+		return nil, info, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, info, err
+	}
+	info.ContentType = mime.TypeByExtension(filepath.Ext(localPath))
+	if info.ContentType == "" {
+		info.ContentType = "application/octet-stream"
+	}
+	info.FileName, info.Size = filepath.Base(localPath), stat.Size()
+	return f, info, nil
+}
+
+// SearchMessages 按用户、时间、类型与关键词搜索归档消息，按时间倒序
+//
+// 参数：
+// openid		用户的 openid，可选
+// beginTime	开始时间，如 2018-01-01 或 2018-01-01 08:00:00，可选
+// endTime		结束时间(不含)，可选
+// msgType		消息类型，如 text、image、event，可选
+// event		事件类型，如 subscribe、CLICK，可选
+// keyword		在文本内容、语音识别结果、链接与 EventKey 中搜索，可选
+// withRaw		为1时返回明文xml
+// page			页码，默认为1
+// pageSize		每页数量，默认为20
+//
+// 返回：
+// 成功返回 [ { "id":1, "msg_id":MSG_ID, "openid":OPENID, "msg_type":"text", "event":"", "event_key":"", "content":"你好", "media_id":"",
+// "media_status":"", "media_path":"", "create_time":1600000000, "created_at":CREATED_AT } ]
+func SearchMessages(wcctx *WechatCtx) ([]byte, error) {
+	page, pageSize := wcctx.Pagination()
+	where := "acid = ?"
+	args := []interface{}{wcctx.AccountId()}
+	for key, column := range map[string]string{"openid": "openid", "msgType": "msg_type", "event": "event"} {
+		if value := wcctx.GetFormValue(key); value != "" {
+			where += " and " + column + " = ?"
+			args = append(args, value)
+		}
+	}
+	if beginTime := wcctx.GetFormValue("beginTime"); beginTime != "" {
+		where += " and created_at >= ?"
+		args = append(args, beginTime)
+	}
+	if endTime := wcctx.GetFormValue("endTime"); endTime != "" {
+		where += " and created_at < ?"
+		args = append(args, endTime)
+	}
+	if keyword := wcctx.GetFormValue("keyword"); keyword != "" {
+		keyword = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(keyword)
+		where += " and content like ?"
+		args = append(args, "%"+keyword+"%")
+	}
+
+	columns := "id, msg_id, openid, msg_type, event, event_key, content, media_id, media_status, media_path, create_time, created_at"
+	if wcctx.GetFormValue("withRaw") == "1" {
+		columns += ", raw"
+	}
+	messages, _ := Query("select "+columns+" from wx_message where "+where+" order by created_at desc, id desc limit ?, ?",
+		append(args, (page-1)*pageSize, pageSize)...)
+	return json.Marshal(messages)
+}
+
+// PurgeMessages 立即清理账号的过期消息，只按批删除该账号的消息，分区由全局的过期清理删除
+//
+// 参数：
+// days		保留天数，默认为 ARCHIVE_RETENTION_DAYS，不能小于 ARCHIVE_RETENTION_DAYS
+//
+// 返回：
+// 成功返回 { "rows":120 }
+func PurgeMessages(wcctx *WechatCtx) ([]byte, error) {
+	retention := GetEnvInt("ARCHIVE_RETENTION_DAYS", 180)
+	days, err := strconv.Atoi(wcctx.GetFormValue("days"))
+	if err != nil {
+		days = retention
+	}
+	if days <= 0 || days < retention {
+		return []byte{}, errors.New("错误的保留天数")
+	}
+	lock := ARCHIVE_MAINTAIN_LOCK + ":" + strconv.Itoa(wcctx.AccountId())
+	if !RedisClient.SetNX(lock, 1, ARCHIVE_MAINTAIN_LOCK_TTL) {
+		return []byte{}, errors.New("归档清理进行中")
+	}
+	defer RedisClient.Del(lock)
+
+	rows := PurgeAccountArchive(wcctx.AccountId(), time.Now().AddDate(0, 0, -days))
+	return json.Marshal(map[string]int{"rows": rows})
+}
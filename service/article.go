@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chenhg5/go-wechat/sdk"
+	"gopkg.in/yaml.v2"
+)
+
+// Markdown 图文，开头可以有 yaml front matter：
+//
+// ---
+// title: 标题
+// author: 作者
+// digest: 摘要
+// cover: ./cover.jpg
+// source_url: https://example.com/post
+// open_comment: true
+// ---
+//
+// 没有 title 时使用正文的第一个一级标题。正文中的图片通过 media/uploadimg 上传到微信服务器后替换地址，
+// 本地图片相对 MARKDOWN_IMAGE_DIR(命令行中为 Markdown 文件所在目录)。
+// 封面上传为永久图片素材，没有 cover 时使用正文的第一张图片
+
+// MarkdownArticle Markdown 图文的 front matter 与正文
+type MarkdownArticle struct {
+	Title           string `yaml:"title"`
+	Author          string `yaml:"author"`
+	Digest          string `yaml:"digest"`
+	Cover           string `yaml:"cover"`
+	SourceUrl       string `yaml:"source_url"`
+	OpenComment     bool   `yaml:"open_comment"`
+	FansOnlyComment bool   `yaml:"fans_only_comment"`
+	Body            string `yaml:"-"`
+}
+
+var titleRe = regexp.MustCompile(`^#\s+(.+?)(\s+#+)?$`)
+
+// ParseMarkdownArticle 解析 front matter，没有标题时取出正文的第一个一级标题
+func ParseMarkdownArticle(data string) (MarkdownArticle, error) {
+	var article MarkdownArticle
+	data = strings.Replace(data, "\r\n", "\n", -1)
+
+	if strings.HasPrefix(data, "---\n") {
+		end := strings.Index(data[4:], "\n---")
+		if end < 0 {
+			return article, errors.New("front matter 没有结束")
+		}
+		if err := yaml.Unmarshal([]byte(data[4:4+end]), &article); err != nil {
+			return article, errors.New("错误的 front matter: " + err.Error())
+		}
+		data = data[4+end+4:]
+		if i := strings.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		} else {
+			data = ""
+		}
+	}
+
+	if article.Title == "" {
+		lines := strings.Split(data, "\n")
+		for i, line := range lines {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if m := titleRe.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+				article.Title = m[1]
+				data = strings.Join(lines[i+1:], "\n")
+			}
+			break
+		}
+	}
+
+	article.Body = data
+	return article, nil
+}
+
+// MarkdownTheme 在默认主题上依次合并 MARKDOWN_THEME 配置的主题文件与 override，格式为 json 或 yaml
+func MarkdownTheme(override string) (wechat.Theme, error) {
+	theme := wechat.Theme{}
+	for tag, style := range wechat.DefaultTheme {
+		theme[tag] = style
+	}
+
+	var sources []string
+	if file := GetEnvString("MARKDOWN_THEME", ""); file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, string(data))
+	}
+	if override != "" {
+		sources = append(sources, override)
+	}
+
+	for _, source := range sources {
+		var styles map[string]string
+		if err := yaml.Unmarshal([]byte(source), &styles); err != nil {
+			return nil, errors.New("错误的主题: " + err.Error())
+		}
+		for tag, style := range styles {
+			theme[tag] = style
+		}
+	}
+	return theme, nil
+}
+
+// articleImages 上传图文中的图片，同一张图片只上传一次
+type articleImages struct {
+	token    string
+	baseDir  string
+	uploaded map[string]string
+	first    string
+}
+
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/bmp":  ".bmp",
+}
+
+const MAX_ARTICLE_IMAGE_BYTES = 10 << 20 // 远程图片最大 10MB，与永久图片素材相同
+
+// 内网、本机与链路本地地址，远程图片不能解析到这些地址
+var privateNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+		"172.16.0.0/12", "192.168.0.0/16", "::1/128", "fc00::/7", "fe80::/10"} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// denyPrivateAddress 在建立连接前检查解析后的地址，重定向与 DNS 重新解析后的地址同样会被检查
+func denyPrivateAddress(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsUnspecified() || ip.IsMulticast() {
+		return errors.New("不允许的图片地址: " + host)
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return errors.New("不允许的图片地址: " + host)
+		}
+	}
+	return nil
+}
+
+// articleHttpClient 下载图文中的远程图片，不使用代理，只能访问公网地址
+var articleHttpClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext:           (&net.Dialer{Timeout: 5 * time.Second, Control: denyPrivateAddress}).DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 5 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 3 {
+			return errors.New("重定向次数过多")
+		}
+		return nil
+	},
+}
+
+// open 打开远程或本地图片，远程图片只能在公网且不超过 MAX_ARTICLE_IMAGE_BYTES，本地图片不能在 baseDir 之外
+func (a *articleImages) open(src string) (wechat.MediaFile, io.Closer, error) {
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		res, err := articleHttpClient.Get(src)
+		if err != nil {
+			return wechat.MediaFile{}, nil, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return wechat.MediaFile{}, nil, errors.New("下载图片失败: " + src)
+		}
+		if res.ContentLength > MAX_ARTICLE_IMAGE_BYTES {
+			return wechat.MediaFile{}, nil, errors.New("图片过大: " + src)
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(res.Body, MAX_ARTICLE_IMAGE_BYTES+1))
+		if err != nil {
+			return wechat.MediaFile{}, nil, err
+		}
+		if len(data) > MAX_ARTICLE_IMAGE_BYTES {
+			return wechat.MediaFile{}, nil, errors.New("图片过大: " + src)
+		}
+
+		name := "image"
+		if u, err := url.Parse(src); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+			name = path.Base(u.Path)
+		}
+		if path.Ext(name) == "" {
+			name += imageExtensions[strings.Split(res.Header.Get("Content-Type"), ";")[0]]
+		}
+		return wechat.MediaFile{Name: name, Reader: bytes.NewReader(data), Size: int64(len(data))}, ioutil.NopCloser(nil), nil
+	}
+
+	if a.baseDir == "" {
+		return wechat.MediaFile{}, nil, errors.New("没有配置本地图片目录: " + src)
+	}
+	file := filepath.Join(a.baseDir, filepath.FromSlash(src))
+	if rel, err := filepath.Rel(a.baseDir, file); err != nil || strings.HasPrefix(rel, "..") {
+		return wechat.MediaFile{}, nil, errors.New("图片不在本地图片目录中: " + src)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return wechat.MediaFile{}, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return wechat.MediaFile{}, nil, err
+	}
+	return wechat.MediaFile{Name: filepath.Base(file), Reader: f, Size: info.Size()}, f, nil
+}
+
+// rehost 上传图片并返回微信服务器上的url，已经在微信服务器上的图片不再上传
+func (a *articleImages) rehost(src string) (string, error) {
+	if a.first == "" {
+		a.first = src
+	}
+	if u, err := url.Parse(src); err == nil && strings.HasSuffix(u.Host, ".qpic.cn") {
+		return src, nil
+	}
+	if uploaded, ok := a.uploaded[src]; ok {
+		return uploaded, nil
+	}
+
+	file, closer, err := a.open(src)
+	if err != nil {
+		return "", err
+	}
+	defer closer.Close()
+
+	uploaded, err := wechat.UploadArticleImage(a.token, file)
+	if err != nil {
+		return "", err
+	}
+	a.uploaded[src] = uploaded
+	return uploaded, nil
+}
+
+// cover 上传封面为永久图片素材，返回 media_id
+func (a *articleImages) cover(src string) (string, error) {
+	file, closer, err := a.open(src)
+	if err != nil {
+		return "", err
+	}
+	defer closer.Close()
+
+	result, err := wechat.AddMaterial(a.token, wechat.MEDIA_TYPE_IMAGE, file, nil)
+	return result.MediaId, err
+}
+
+// ConvertMarkdownArticle 转换为可以直接加入草稿的图文，图片与封面使用 accessToken 上传，
+// upload 为false时不上传图片与封面，用于预览
+func ConvertMarkdownArticle(accessToken string, article MarkdownArticle, theme wechat.Theme, baseDir string, upload bool) (wechat.Article, error) {
+	result := wechat.Article{
+		Title:            article.Title,
+		Author:           article.Author,
+		Digest:           article.Digest,
+		ContentSourceUrl: article.SourceUrl,
+	}
+	if article.OpenComment {
+		result.NeedOpenComment = 1
+	}
+	if article.FansOnlyComment {
+		result.OnlyFansCanComment = 1
+	}
+	if result.Title == "" {
+		return result, errors.New("没有标题")
+	}
+
+	images := &articleImages{token: accessToken, baseDir: baseDir, uploaded: map[string]string{}}
+	renderer := wechat.NewMarkdownRenderer(theme)
+	if upload {
+		renderer.Image = images.rehost
+	}
+
+	var err error
+	if result.Content, err = renderer.Render(article.Body); err != nil || !upload {
+		return result, err
+	}
+
+	cover := article.Cover
+	if cover == "" {
+		cover = images.first
+	}
+	if cover == "" {
+		return result, errors.New("没有封面图片")
+	}
+	result.ThumbMediaId, err = images.cover(cover)
+	return result, err
+}
+
+// markdownArticle 读取参数 markdown 与 theme 并转换
+func markdownArticle(wcctx *WechatCtx, upload bool) (wechat.Article, error) {
+	article, err := ParseMarkdownArticle(wcctx.GetFormValue("markdown"))
+	if err != nil {
+		return wechat.Article{}, err
+	}
+	theme, err := MarkdownTheme(wcctx.GetFormValue("theme"))
+	if err != nil {
+		return wechat.Article{}, err
+	}
+	return ConvertMarkdownArticle(wcctx.AccessToken(), article, theme, GetEnvString("MARKDOWN_IMAGE_DIR", ""), upload)
+}
+
+// PreviewMarkdown 预览 Markdown 转换后的图文，不上传图片
+//
+// 参数：
+// markdown		Markdown 正文，可以有 front matter
+// theme		json 或 yaml 格式的主题，覆盖默认主题中的样式，如 {"h2":"font-size: 20px; color: #07c160;"}
+//
+// 返回：
+// 成功返回 { "title":TITLE, "author":AUTHOR, "content":CONTENT, ... }
+func PreviewMarkdown(wcctx *WechatCtx) ([]byte, error) {
+	article, err := markdownArticle(wcctx, false)
+	if err != nil {
+		return []byte{}, err
+	}
+	return json.Marshal(article)
+}
+
+// ConvertMarkdown 转换 Markdown 为图文，上传图片与封面，返回的图文可以直接用于 AddDraft
+//
+// 参数：
+// markdown		Markdown 正文，可以有 front matter
+// theme		json 或 yaml 格式的主题
+//
+// 返回：
+// 成功返回 { "title":TITLE, "content":CONTENT, "thumb_media_id":THUMB_MEDIA_ID, ... }
+// 失败返回 { "errcode":40005,"errmsg":"invalid file type"}
+func ConvertMarkdown(wcctx *WechatCtx) ([]byte, error) {
+	return Result(markdownArticle(wcctx, true))
+}
+
+// CreateMarkdownDraft 转换 Markdown 为图文并新建草稿
+//
+// 参数：
+// markdown		Markdown 正文，可以有 front matter
+// theme		json 或 yaml 格式的主题
+//
+// 返回：
+// 成功返回 { "media_id":MEDIA_ID, "article":{ "title":TITLE, ... } }
+func CreateMarkdownDraft(wcctx *WechatCtx) ([]byte, error) {
+	article, err := markdownArticle(wcctx, true)
+	if err != nil {
+		return Result(nil, err)
+	}
+	mediaId, err := wechat.AddDraft(wcctx.AccessToken(), []wechat.Article{article})
+	return Result(map[string]interface{}{"media_id": mediaId, "article": article}, err)
+}
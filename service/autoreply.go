@@ -0,0 +1,412 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chenhg5/go-wechat/sdk"
+)
+
+// 关键词自动回复，规则按账号保存在 wx_autoreply_rule 中
+//
+// 文本消息按 exact(完全匹配)、contains(包含)、regex(正则)匹配关键词，事件按 subscribe(关注) 与 click(菜单 EventKey) 匹配，
+// 没有规则匹配的非事件消息使用 default 规则。规则按 priority 从大到小匹配，只使用第一条匹配的规则，
+// begin_at、end_at 限定有效期，day_start、day_end 限定每天的时段(HH:MM，可跨零点)。
+// replies 为客服消息格式的json数组，只被动回复一条，reply_mode 为 first 时回复第一条，为 random 时随机回复一条
+
+const (
+	AUTOREPLY_MATCH_EXACT     = "exact"
+	AUTOREPLY_MATCH_CONTAINS  = "contains"
+	AUTOREPLY_MATCH_REGEX     = "regex"
+	AUTOREPLY_MATCH_SUBSCRIBE = "subscribe"
+	AUTOREPLY_MATCH_CLICK     = "click"
+	AUTOREPLY_MATCH_DEFAULT   = "default"
+
+	AUTOREPLY_MODE_FIRST  = "first"
+	AUTOREPLY_MODE_RANDOM = "random"
+
+	AUTOREPLY_SOURCE_LOCAL  = "local"
+	AUTOREPLY_SOURCE_IMPORT = "import" // 从公众平台官网导入
+)
+
+// 编译后的正则，按表达式缓存
+var autoReplyRegexps sync.Map
+
+// AutoReply 处理函数与转发规则都没有回复时，按自动回复规则回复
+func AutoReply() wechat.Middleware {
+	return func(next wechat.HandlerFunc) wechat.HandlerFunc {
+		return func(ctx *wechat.Context) (wechat.Reply, error) {
+			reply, err := next(ctx)
+			if reply != nil || err != nil {
+				return reply, err
+			}
+
+			rule := MatchAutoReplyRule(ctx.AccountId, ctx.Message, time.Now())
+			if rule == nil {
+				return nil, nil
+			}
+			replies, err := ParseAutoReplies(rule["replies"].(string))
+			if err != nil || len(replies) == 0 {
+				LogError(errors.New("自动回复规则 " + strconv.FormatInt(rule["id"].(int64), 10) + " 的回复错误"))
+				return nil, nil
+			}
+
+			if rule["reply_mode"].(string) == AUTOREPLY_MODE_RANDOM {
+				return replies[rand.Intn(len(replies))], nil
+			}
+			return replies[0], nil
+		}
+	}
+}
+
+// MatchAutoReplyRule 返回账号下匹配消息的第一条自动回复规则，没有匹配时返回nil
+func MatchAutoReplyRule(accountId int, msg *wechat.MixMessage, now time.Time) map[string]interface{} {
+	rules, _ := Query("select id, match_type, keyword, day_start, day_end, reply_mode, replies from wx_autoreply_rule "+
+		"where acid = ? and state = 1 and (begin_at is null or begin_at <= ?) and (end_at is null or end_at > ?) "+
+		"order by priority desc, id", accountId, now.Format("2006-01-02 15:04:05"), now.Format("2006-01-02 15:04:05"))
+	return matchAutoReplyRules(rules, msg, now)
+}
+
+// matchAutoReplyRules 按顺序返回第一条匹配消息的规则，没有匹配时返回第一条 default 规则
+func matchAutoReplyRules(rules []map[string]interface{}, msg *wechat.MixMessage, now time.Time) map[string]interface{} {
+	var fallback map[string]interface{}
+	for _, rule := range rules {
+		if !InDayWindow(rule["day_start"].(string), rule["day_end"].(string), now) {
+			continue
+		}
+		keyword := rule["keyword"].(string)
+		switch rule["match_type"].(string) {
+		case AUTOREPLY_MATCH_EXACT:
+			if msg.MsgType == wechat.MSG_TYPE_TEXT && strings.EqualFold(strings.TrimSpace(msg.Content), keyword) {
+				return rule
+			}
+		case AUTOREPLY_MATCH_CONTAINS:
+			if msg.MsgType == wechat.MSG_TYPE_TEXT && strings.Contains(strings.ToLower(msg.Content), strings.ToLower(keyword)) {
+				return rule
+			}
+		case AUTOREPLY_MATCH_REGEX:
+			if msg.MsgType != wechat.MSG_TYPE_TEXT {
+				continue
+			}
+			re, err := autoReplyRegexp(keyword)
+			if err != nil {
+				LogError(err)
+				continue
+			}
+			if re.MatchString(msg.Content) {
+				return rule
+			}
+		case AUTOREPLY_MATCH_SUBSCRIBE:
+			if msg.MsgType == wechat.MSG_TYPE_EVENT && strings.EqualFold(msg.Event, wechat.EVENT_SUBSCRIBE) {
+				return rule
+			}
+		case AUTOREPLY_MATCH_CLICK:
+			if msg.MsgType == wechat.MSG_TYPE_EVENT && strings.EqualFold(msg.Event, wechat.EVENT_CLICK) && msg.EventKey == keyword {
+				return rule
+			}
+		case AUTOREPLY_MATCH_DEFAULT:
+			if msg.MsgType != wechat.MSG_TYPE_EVENT && fallback == nil {
+				fallback = rule
+			}
+		}
+	}
+	return fallback
+}
+
+// InDayWindow 判断时间是否在每天的时段内，start 大于 end 时跨零点，都为空时为全天
+func InDayWindow(start string, end string, now time.Time) bool {
+	if start == "" && end == "" {
+		return true
+	}
+	clock := now.Format("15:04")
+	if start == "" {
+		start = "00:00"
+	}
+	if end == "" {
+		end = "24:00"
+	}
+	if start <= end {
+		return clock >= start && clock < end
+	}
+	return clock >= start || clock < end
+}
+
+func autoReplyRegexp(expr string) (*regexp.Regexp, error) {
+	if re, ok := autoReplyRegexps.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	autoReplyRegexps.Store(expr, re)
+	return re, nil
+}
+
+// ParseAutoReplies 解析客服消息格式的回复数组，如 [ { "msgtype":"text", "text":{ "content":"Hello World" } } ]
+func ParseAutoReplies(data string) ([]wechat.Reply, error) {
+	var items []wechat.CustomMessage
+	if err := json.Unmarshal([]byte(data), &items); err != nil {
+		return nil, err
+	}
+	replies := make([]wechat.Reply, 0, len(items))
+	for _, item := range items {
+		itemData, _ := json.Marshal(item)
+		reply, err := wechat.ParseWebhookReply(itemData)
+		if err != nil {
+			return nil, err
+		}
+		if reply == nil {
+			return nil, errors.New("错误的回复")
+		}
+		replies = append(replies, reply)
+	}
+	return replies, nil
+}
+
+// autoReplyRuleValues 读取并校验规则参数
+func autoReplyRuleValues(wcctx *WechatCtx) ([]interface{}, error) {
+	matchType := wcctx.GetFormValue("matchType")
+	keyword := wcctx.GetFormValue("keyword")
+	switch matchType {
+	case AUTOREPLY_MATCH_EXACT, AUTOREPLY_MATCH_CONTAINS, AUTOREPLY_MATCH_CLICK:
+		if keyword == "" {
+			return nil, errors.New("关键词不能为空")
+		}
+	case AUTOREPLY_MATCH_REGEX:
+		if _, err := regexp.Compile(keyword); keyword == "" || err != nil {
+			return nil, errors.New("错误的正则表达式")
+		}
+	case AUTOREPLY_MATCH_SUBSCRIBE, AUTOREPLY_MATCH_DEFAULT:
+		keyword = ""
+	default:
+		return nil, errors.New("错误的匹配方式")
+	}
+
+	replyMode := wcctx.GetFormValue("replyMode")
+	if replyMode == "" {
+		replyMode = AUTOREPLY_MODE_FIRST
+	}
+	if replyMode != AUTOREPLY_MODE_FIRST && replyMode != AUTOREPLY_MODE_RANDOM {
+		return nil, errors.New("错误的回复方式")
+	}
+	replies := wcctx.GetFormValue("replies")
+	if parsed, err := ParseAutoReplies(replies); err != nil || len(parsed) == 0 {
+		return nil, errors.New("错误的回复")
+	}
+
+	priority, _ := strconv.Atoi(wcctx.GetFormValue("priority"))
+	var times []interface{}
+	for _, key := range []string{"beginAt", "endAt"} {
+		value := wcctx.GetFormValue(key)
+		if value == "" {
+			times = append(times, nil)
+			continue
+		}
+		if _, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local); err != nil {
+			return nil, errors.New("错误的有效期")
+		}
+		times = append(times, value)
+	}
+	for _, key := range []string{"dayStart", "dayEnd"} {
+		value := wcctx.GetFormValue(key)
+		if _, err := time.Parse("15:04", value); value != "" && err != nil {
+			return nil, errors.New("错误的时段")
+		}
+		times = append(times, value)
+	}
+	state := 1
+	if wcctx.GetFormValue("state") == "0" {
+		state = 0
+	}
+
+	return append([]interface{}{wcctx.GetFormValue("name"), matchType, keyword, priority}, append(times, replyMode, replies, state)...), nil
+}
+
+// AddAutoReplyRule 添加自动回复规则
+//
+// 参数：
+// name			规则名称
+// matchType	exact 完全匹配 contains 包含 regex 正则 subscribe 关注 click 菜单点击 default 没有匹配时的默认回复
+// keyword		关键词、正则表达式或菜单的 EventKey
+// priority		优先级，越大越先匹配，默认为0
+// beginAt		开始时间，如 2018-01-01 00:00:00，可选
+// endAt		结束时间，可选
+// dayStart		每天开始的时刻，如 09:00，可选
+// dayEnd		每天结束的时刻，如 18:00，小于 dayStart 时跨零点，可选
+// replyMode	first 回复第一条(默认) random 随机回复一条
+// replies		客服消息格式的回复数组，如 [ { "msgtype":"text", "text":{ "content":"Hello World" } } ]
+// state		1 启用(默认) 0 停用
+//
+// 返回：
+// 成功返回 { "id":1 }
+func AddAutoReplyRule(wcctx *WechatCtx) ([]byte, error) {
+	values, err := autoReplyRuleValues(wcctx)
+	if err != nil {
+		return []byte{}, err
+	}
+	rs := Exec("insert into wx_autoreply_rule (name, match_type, keyword, priority, begin_at, end_at, day_start, day_end, reply_mode, replies, state, acid, source) "+
+		"values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", append(values, wcctx.AccountId(), AUTOREPLY_SOURCE_LOCAL)...)
+	id, _ := rs.LastInsertId()
+	return json.Marshal(map[string]int64{"id": id})
+}
+
+// UpdateAutoReplyRule 修改自动回复规则，参数与 AddAutoReplyRule 相同
+//
+// 参数：
+// id	规则id
+//
+// 返回：
+// 成功返回 { "id":1 }
+func UpdateAutoReplyRule(wcctx *WechatCtx) ([]byte, error) {
+	id, err := strconv.ParseInt(wcctx.GetFormValue("id"), 10, 64)
+	if err != nil {
+		return []byte{}, errors.New("错误的规则id")
+	}
+	values, err := autoReplyRuleValues(wcctx)
+	if err != nil {
+		return []byte{}, err
+	}
+	rs := Exec("update wx_autoreply_rule set name = ?, match_type = ?, keyword = ?, priority = ?, begin_at = ?, end_at = ?, "+
+		"day_start = ?, day_end = ?, reply_mode = ?, replies = ?, state = ? where acid = ? and id = ?",
+		append(values, wcctx.AccountId(), id)...)
+	if affected, _ := rs.RowsAffected(); affected == 0 {
+		rules, _ := Query("select id from wx_autoreply_rule where acid = ? and id = ?", wcctx.AccountId(), id)
+		if len(rules) == 0 {
+			return []byte{}, errors.New("规则不存在")
+		}
+	}
+	return json.Marshal(map[string]int64{"id": id})
+}
+
+// DelAutoReplyRule
+//
+// 参数：
+// id	规则id
+//
+// 返回：
+// 成功返回 { "id":1 }
+func DelAutoReplyRule(wcctx *WechatCtx) ([]byte, error) {
+	id, err := strconv.ParseInt(wcctx.GetFormValue("id"), 10, 64)
+	if err != nil {
+		return []byte{}, errors.New("错误的规则id")
+	}
+	Exec("delete from wx_autoreply_rule where acid = ? and id = ?", wcctx.AccountId(), id)
+	return json.Marshal(map[string]int64{"id": id})
+}
+
+// GetAutoReplyRules 按匹配顺序分页获取自动回复规则
+//
+// 参数：
+// matchType	匹配方式，为空时返回全部
+// page			页码，默认为1
+// pageSize		每页数量，默认为20
+//
+// 返回：
+// 成功返回 [ { "id":1, "name":NAME, "match_type":"contains", "keyword":"你好", "priority":0, "reply_mode":"first", "replies":REPLIES, "source":"local", ... } ]
+func GetAutoReplyRules(wcctx *WechatCtx) ([]byte, error) {
+	page, pageSize := wcctx.Pagination()
+	where := "acid = ?"
+	args := []interface{}{wcctx.AccountId()}
+	if matchType := wcctx.GetFormValue("matchType"); matchType != "" {
+		where += " and match_type = ?"
+		args = append(args, matchType)
+	}
+	rules, _ := Query("select * from wx_autoreply_rule where "+where+" order by priority desc, id limit ?, ?",
+		append(args, (page-1)*pageSize, pageSize)...)
+	return json.Marshal(rules)
+}
+
+// TestAutoReply 返回一条消息会匹配的规则，不发送回复
+//
+// 参数：
+// content		文本消息内容
+// event		事件类型，如 subscribe、CLICK，不为空时按事件匹配
+// eventKey		事件KEY值
+//
+// 返回：
+// 成功返回 { "id":1, "match_type":"contains", "keyword":"你好", "reply_mode":"first", "replies":REPLIES, ... }，没有匹配时返回 null
+func TestAutoReply(wcctx *WechatCtx) ([]byte, error) {
+	msg := &wechat.MixMessage{}
+	msg.MsgType, msg.Content = wechat.MSG_TYPE_TEXT, wcctx.GetFormValue("content")
+	if event := wcctx.GetFormValue("event"); event != "" {
+		msg.MsgType, msg.Event, msg.EventKey = wechat.MSG_TYPE_EVENT, event, wcctx.GetFormValue("eventKey")
+	}
+	return json.Marshal(MatchAutoReplyRule(wcctx.AccountId(), msg, time.Now()))
+}
+
+// ImportAutoReplyRules 通过 get_current_autoreply_info 导入公众平台官网设置的自动回复，
+// 每个关键词导入为一条规则，重新导入时替换之前导入的规则，本地添加的规则不受影响
+//
+// 返回：
+// 成功返回 { "imported":3, "skipped":1 }，skipped 为无法转换的回复数(如官网的卡券、小程序卡片)
+// 失败返回 { "errcode":40013,"errmsg":"invalid appid"}
+func ImportAutoReplyRules(wcctx *WechatCtx) ([]byte, error) {
+	info, err := wechat.GetCurrentAutoReplyInfo(wcctx.AccessToken())
+	if err != nil {
+		return Result(nil, err)
+	}
+
+	skipped := 0
+	convert := func(contents []wechat.AutoReplyContent) string {
+		msgs := make([]wechat.CustomMessage, 0, len(contents))
+		for _, content := range contents {
+			msg, err := content.CustomMessage()
+			if err != nil {
+				skipped++
+				continue
+			}
+			msgs = append(msgs, msg)
+		}
+		if len(msgs) == 0 {
+			return ""
+		}
+		data, _ := json.Marshal(msgs)
+		return string(data)
+	}
+
+	type importRule struct {
+		name, matchType, keyword, replyMode, replies string
+	}
+	rules := make([]importRule, 0)
+	if info.IsAddFriendReplyOpen == 1 && info.AddFriendAutoreplyInfo != nil {
+		rules = append(rules, importRule{"关注回复", AUTOREPLY_MATCH_SUBSCRIBE, "", AUTOREPLY_MODE_FIRST,
+			convert([]wechat.AutoReplyContent{*info.AddFriendAutoreplyInfo})})
+	}
+	if info.IsAutoreplyOpen == 1 && info.MessageDefaultAutoreplyInfo != nil {
+		rules = append(rules, importRule{"收到消息回复", AUTOREPLY_MATCH_DEFAULT, "", AUTOREPLY_MODE_FIRST,
+			convert([]wechat.AutoReplyContent{*info.MessageDefaultAutoreplyInfo})})
+	}
+	for _, rule := range info.KeywordAutoreplyInfo.List {
+		replyMode := AUTOREPLY_MODE_FIRST
+		if rule.ReplyMode == wechat.AUTOREPLY_REPLY_RANDOM {
+			replyMode = AUTOREPLY_MODE_RANDOM
+		}
+		replies := convert(rule.ReplyListInfo)
+		for _, keyword := range rule.KeywordListInfo {
+			matchType := AUTOREPLY_MATCH_CONTAINS
+			if keyword.MatchMode == wechat.AUTOREPLY_MATCH_EQUAL {
+				matchType = AUTOREPLY_MATCH_EXACT
+			}
+			rules = append(rules, importRule{rule.RuleName, matchType, keyword.Content, replyMode, replies})
+		}
+	}
+
+	Exec("delete from wx_autoreply_rule where acid = ? and source = ?", wcctx.AccountId(), AUTOREPLY_SOURCE_IMPORT)
+	imported := 0
+	for _, rule := range rules {
+		if rule.replies == "" {
+			continue
+		}
+		Exec("insert into wx_autoreply_rule (acid, name, match_type, keyword, reply_mode, replies, source) values (?, ?, ?, ?, ?, ?, ?)",
+			wcctx.AccountId(), rule.name, rule.matchType, rule.keyword, rule.replyMode, rule.replies, AUTOREPLY_SOURCE_IMPORT)
+		imported++
+	}
+
+	return json.Marshal(map[string]int{"imported": imported, "skipped": skipped})
+}
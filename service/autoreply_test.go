@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chenhg5/go-wechat/sdk"
+)
+
+func TestInDayWindow(t *testing.T) {
+	at := func(clock string) time.Time {
+		now, _ := time.Parse("2006-01-02 15:04", "2020-01-01 "+clock)
+		return now
+	}
+
+	cases := []struct {
+		start, end, clock string
+		want              bool
+	}{
+		{"", "", "03:00", true},
+		{"09:00", "18:00", "09:00", true},
+		{"09:00", "18:00", "17:59", true},
+		{"09:00", "18:00", "18:00", false},
+		{"09:00", "18:00", "08:59", false},
+		{"09:00", "", "23:59", true},
+		{"", "09:00", "00:00", true},
+		{"", "09:00", "09:00", false},
+		// 跨零点
+		{"22:00", "06:00", "23:30", true},
+		{"22:00", "06:00", "05:59", true},
+		{"22:00", "06:00", "06:00", false},
+		{"22:00", "06:00", "12:00", false},
+	}
+	for _, c := range cases {
+		if got := InDayWindow(c.start, c.end, at(c.clock)); got != c.want {
+			t.Errorf("InDayWindow(%q, %q, %s) = %v, want %v", c.start, c.end, c.clock, got, c.want)
+		}
+	}
+}
+
+func TestMatchAutoReplyRules(t *testing.T) {
+	rule := func(id int64, matchType string, keyword string, dayStart string, dayEnd string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "match_type": matchType, "keyword": keyword, "day_start": dayStart, "day_end": dayEnd}
+	}
+	rules := []map[string]interface{}{
+		rule(1, AUTOREPLY_MATCH_EXACT, "Hello", "", ""),
+		rule(2, AUTOREPLY_MATCH_CONTAINS, "价格", "", ""),
+		rule(3, AUTOREPLY_MATCH_REGEX, `^\d{6}$`, "", ""),
+		rule(4, AUTOREPLY_MATCH_REGEX, `(`, "", ""),
+		rule(5, AUTOREPLY_MATCH_CONTAINS, "夜间", "22:00", "06:00"),
+		rule(6, AUTOREPLY_MATCH_DEFAULT, "", "22:00", "06:00"),
+		rule(7, AUTOREPLY_MATCH_DEFAULT, "", "", ""),
+		rule(8, AUTOREPLY_MATCH_SUBSCRIBE, "", "", ""),
+		rule(9, AUTOREPLY_MATCH_CLICK, "V1001_GOOD", "", ""),
+		rule(10, AUTOREPLY_MATCH_CONTAINS, "hello", "", ""),
+	}
+	text := func(content string) *wechat.MixMessage {
+		return &wechat.MixMessage{MsgType: wechat.MSG_TYPE_TEXT, Content: content}
+	}
+	event := func(name string, key string) *wechat.MixMessage {
+		return &wechat.MixMessage{MsgType: wechat.MSG_TYPE_EVENT, Event: name, EventKey: key}
+	}
+	day, _ := time.Parse("2006-01-02 15:04", "2020-01-01 12:00")
+	night, _ := time.Parse("2006-01-02 15:04", "2020-01-01 23:00")
+
+	cases := []struct {
+		name string
+		msg  *wechat.MixMessage
+		now  time.Time
+		want int64 // 0 为没有匹配
+	}{
+		{"exact ignores case and spaces", text(" hello "), day, 1},
+		{"exact before later contains", text("Hello"), day, 1},
+		{"contains", text("请问价格多少"), day, 2},
+		{"contains ignores case", text("say HELLO world"), day, 10},
+		{"regex", text("123456"), day, 3},
+		{"invalid regex is skipped", text("1234567"), day, 7},
+		{"day window", text("夜间客服"), night, 5},
+		{"outside day window", text("夜间客服"), day, 7},
+		{"first default in window", text("随便说说"), night, 6},
+		{"default for other messages", &wechat.MixMessage{MsgType: wechat.MSG_TYPE_IMAGE}, day, 7},
+		{"subscribe", event("subscribe", ""), day, 8},
+		{"click", event("CLICK", "V1001_GOOD"), day, 9},
+		{"click with other key", event("CLICK", "V1001_BAD"), day, 0},
+		{"no default for events", event("unsubscribe", ""), day, 0},
+	}
+	for _, c := range cases {
+		var got int64
+		if rule := matchAutoReplyRules(rules, c.msg, c.now); rule != nil {
+			got = rule["id"].(int64)
+		}
+		if got != c.want {
+			t.Errorf("%s: matched rule %d, want %d", c.name, got, c.want)
+		}
+	}
+}
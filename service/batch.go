@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/chenhg5/go-wechat/sdk"
+)
+
+// runBatches 并发执行 fn(0) 到 fn(n-1)，同时最多 concurrency 个，返回每个的错误，
+// fn 中的 panic 记录日志后作为该项的错误返回
+func runBatches(n int, concurrency int, fn func(i int) error) []error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	errs := make([]error, n)
+	var (
+		wg        sync.WaitGroup
+		semaphore = make(chan struct{}, concurrency)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int) {
+			defer func() {
+				if r := recover(); r != nil {
+					errs[i] = errors.New(fmt.Sprint(r))
+					LogError(fmt.Errorf("batch panic: %v", r))
+				}
+				<-semaphore
+				wg.Done()
+			}()
+
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+// batchErrCode 将批量请求中一项的错误转为 errcode 与 errmsg，微信返回的错误码原样保留，其他错误为-1
+func batchErrCode(err error) (int64, string) {
+	switch e := err.(type) {
+	case nil:
+		return 0, "ok"
+	case *wechat.CommonError:
+		return e.ErrCode, e.ErrMsg
+	default:
+		return -1, e.Error()
+	}
+}
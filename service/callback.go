@@ -0,0 +1,144 @@
+package main
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chenhg5/go-wechat/sdk"
+	"github.com/valyala/fasthttp"
+)
+
+// 消息推送回调，服务器地址配置为 /callback/{accountId}
+//
+// GET 请求为服务器配置校验，校验签名后原样返回 echostr
+// POST 请求为消息与事件推送，校验签名与时间戳后解析消息体，交给 GlobalRouter 处理，
+// 带 encrypt_type=aes 的请求先校验 msg_signature 并解密，安全模式的账号拒绝明文消息
+
+// CALLBACK_TIMESTAMP_TOLERANCE 推送时间戳与本机时间允许的最大误差，超过视为过期请求
+const CALLBACK_TIMESTAMP_TOLERANCE = 300
+
+// CALLBACK_MAX_BODY_SIZE 推送消息体的最大长度
+const CALLBACK_MAX_BODY_SIZE = 1 << 20
+
+func Callback(wcctx *WechatCtx) {
+
+	defer handle(wcctx)
+
+	accountId, err := strconv.Atoi(strings.TrimPrefix(string(wcctx.Ctx.Path()), "/callback/"))
+	if err != nil {
+		wcctx.Json(fasthttp.StatusNotFound, "错误的路径", "")
+		return
+	}
+
+	wcctx.Account = GetAccountInfo(accountId)
+	if wcctx.Account == nil {
+		wcctx.Json(fasthttp.StatusNotFound, "账号不存在", "")
+		return
+	}
+
+	args := wcctx.Ctx.QueryArgs()
+	timestamp := string(args.Peek("timestamp"))
+	nonce := string(args.Peek("nonce"))
+
+	if !wechat.CheckSignature(wcctx.Account["token"], timestamp, nonce, string(args.Peek("signature"))) {
+		wcctx.Json(fasthttp.StatusForbidden, "签名错误", "")
+		return
+	}
+
+	if wcctx.Ctx.IsGet() {
+		wcctx.Ctx.SetContentType("text/plain; charset=utf-8")
+		wcctx.Ctx.Write(args.Peek("echostr"))
+		return
+	}
+
+	if !wcctx.Ctx.IsPost() {
+		wcctx.Json(fasthttp.StatusMethodNotAllowed, "错误的请求方法", "")
+		return
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || ts < time.Now().Unix()-CALLBACK_TIMESTAMP_TOLERANCE || ts > time.Now().Unix()+CALLBACK_TIMESTAMP_TOLERANCE {
+		wcctx.Json(fasthttp.StatusForbidden, "过期的请求", "")
+		return
+	}
+
+	// 处理超时的消息会在请求结束后继续处理，不能引用 fasthttp 复用的缓冲区
+	body, err := ioutil.ReadAll(wcctx.BodyStream(CALLBACK_MAX_BODY_SIZE))
+	if err != nil {
+		wcctx.Json(fasthttp.StatusRequestEntityTooLarge, "错误的消息体", "")
+		return
+	}
+	encryptMode, _ := strconv.Atoi(wcctx.Account["encryptMode"])
+	encrypted := string(args.Peek("encrypt_type")) == "aes"
+
+	if encryptMode == wechat.ENCRYPT_MODE_SAFE && !encrypted {
+		wcctx.Json(fasthttp.StatusForbidden, "安全模式下只接收加密消息", "")
+		return
+	}
+
+	// 兼容模式下消息体同时包含明文与密文，收到加密消息时以密文为准
+	if encrypted {
+		crypt, err := NewMsgCrypt(wcctx.Account)
+		if err != nil {
+			wcctx.Json(fasthttp.StatusInternalServerError, "消息加解密密钥配置错误", "")
+			return
+		}
+		body, err = crypt.DecryptMsg(string(args.Peek("msg_signature")), timestamp, nonce, body)
+		if err == wechat.ErrInvalidMsgSignature {
+			wcctx.Json(fasthttp.StatusForbidden, "签名错误", "")
+			return
+		}
+		if err != nil {
+			wcctx.Json(fasthttp.StatusBadRequest, "错误的消息体", "")
+			return
+		}
+	}
+
+	msg, err := wechat.ParseMessage(body)
+	if err != nil {
+		wcctx.Json(fasthttp.StatusBadRequest, "错误的消息体", "")
+		return
+	}
+
+	ctx := &wechat.Context{AccountId: accountId, Message: msg, Raw: body}
+	reply, err := GlobalRouter.Dispatch(ctx)
+	if err != nil {
+		LogError(err)
+	}
+
+	if reply != nil {
+		replyXML, err := ReplyXML(ctx, reply, encrypted, nonce)
+		if err == nil {
+			wcctx.Ctx.SetContentType("text/xml; charset=utf-8")
+			wcctx.Ctx.Write(replyXML)
+			return
+		}
+		LogError(err)
+	}
+
+	// 不回复时返回 success，微信服务器不会对此作任何处理
+	wcctx.Ctx.SetContentType("text/plain; charset=utf-8")
+	wcctx.Ctx.WriteString("success")
+}
+
+// ReplyXML 生成被动回复的xml，收到的是加密消息时回复也需要加密
+func ReplyXML(ctx *wechat.Context, reply wechat.Reply, encrypted bool, nonce string) ([]byte, error) {
+	now := time.Now().Unix()
+	replyXML, err := ctx.Reply(reply, now)
+	if err != nil || !encrypted {
+		return replyXML, err
+	}
+
+	crypt, err := NewMsgCrypt(GetAccountInfo(ctx.AccountId))
+	if err != nil {
+		return nil, err
+	}
+	return crypt.EncryptMsg(replyXML, now, nonce)
+}
+
+// NewMsgCrypt 根据账号的令牌与消息加解密密钥创建加解密器
+func NewMsgCrypt(account map[string]string) (*wechat.MsgCrypt, error) {
+	return wechat.NewMsgCrypt(account["token"], account["encodingAESKey"], account["appId"])
+}
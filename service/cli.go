@@ -0,0 +1,268 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chenhg5/go-wechat/sdk"
+)
+
+// 命令行，不带参数时启动服务器
+//
+// go-wechat menu diff     -account 1 [-file menu.yaml]
+// go-wechat menu apply    -account 1 [-file menu.yaml] [-dry-run]
+// go-wechat menu rollback -account 1 [-version 12] [-dry-run]
+// go-wechat menu versions -account 1
+// go-wechat menu dump     -account 1
+// go-wechat article draft -account 1 -file post.md [-theme theme.yaml] [-dry-run]
+//
+// 没有指定 -file 时使用 wx_menu_definition 中保存的菜单定义，
+// article draft 将 Markdown 转换为图文并新建草稿，-dry-run 只输出转换后的html，不上传图片
+
+const CLI_USAGE = `usage:
+  go-wechat menu diff     -account 1 [-file menu.yaml]
+  go-wechat menu apply    -account 1 [-file menu.yaml] [-dry-run]
+  go-wechat menu rollback -account 1 [-version 12] [-dry-run]
+  go-wechat menu versions -account 1
+  go-wechat menu dump     -account 1
+  go-wechat article draft -account 1 -file post.md [-theme theme.yaml] [-dry-run]
+`
+
+// RunCommand 执行命令行，返回进程的退出码
+func RunCommand(args []string) int {
+	if len(args) < 2 {
+		fmt.Fprint(os.Stderr, CLI_USAGE)
+		return 2
+	}
+
+	switch args[0] {
+	case "menu":
+		return runMenuCommand(args)
+	case "article":
+		return runArticleCommand(args)
+	}
+	fmt.Fprint(os.Stderr, CLI_USAGE)
+	return 2
+}
+
+func runMenuCommand(args []string) int {
+	flags := flag.NewFlagSet("menu "+args[1], flag.ContinueOnError)
+	accountId := flags.Int("account", 0, "账号id")
+	file := flags.String("file", "", "json 或 yaml 格式的菜单定义文件")
+	dryRun := flags.Bool("dry-run", false, "只显示差异，不同步")
+	version := flags.Int64("version", 0, "回滚到的版本id，默认为上一个版本")
+	if err := flags.Parse(args[2:]); err != nil {
+		return 2
+	}
+	if GetAccountInfo(*accountId) == nil {
+		fmt.Fprintln(os.Stderr, "账号不存在:", *accountId)
+		return 2
+	}
+
+	var err error
+	switch args[1] {
+	case "diff":
+		err = menuDiffCommand(*accountId, *file)
+	case "apply":
+		err = menuApplyCommand(*accountId, *file, *dryRun)
+	case "rollback":
+		err = menuRollbackCommand(*accountId, *version, *dryRun)
+	case "versions":
+		menuVersionsCommand(*accountId)
+	case "dump":
+		err = menuDumpCommand(*accountId)
+	default:
+		fmt.Fprint(os.Stderr, CLI_USAGE)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func runArticleCommand(args []string) int {
+	flags := flag.NewFlagSet("article "+args[1], flag.ContinueOnError)
+	accountId := flags.Int("account", 0, "账号id")
+	file := flags.String("file", "", "Markdown 文件")
+	theme := flags.String("theme", "", "json 或 yaml 格式的主题文件")
+	dryRun := flags.Bool("dry-run", false, "只输出转换后的html，不上传图片与新建草稿")
+	if err := flags.Parse(args[2:]); err != nil {
+		return 2
+	}
+	if args[1] != "draft" || *file == "" {
+		fmt.Fprint(os.Stderr, CLI_USAGE)
+		return 2
+	}
+	if GetAccountInfo(*accountId) == nil {
+		fmt.Fprintln(os.Stderr, "账号不存在:", *accountId)
+		return 2
+	}
+
+	if err := articleDraftCommand(*accountId, *file, *theme, *dryRun); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func articleDraftCommand(accountId int, file string, themeFile string, dryRun bool) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	article, err := ParseMarkdownArticle(string(data))
+	if err != nil {
+		return err
+	}
+
+	var override []byte
+	if themeFile != "" {
+		if override, err = ioutil.ReadFile(themeFile); err != nil {
+			return err
+		}
+	}
+	theme, err := MarkdownTheme(string(override))
+	if err != nil {
+		return err
+	}
+
+	token := ""
+	if !dryRun {
+		if token = GetAccountToken(accountId); token == "" {
+			return NoAccountTokenError(accountId)
+		}
+	}
+
+	converted, err := ConvertMarkdownArticle(token, article, theme, filepath.Dir(file), !dryRun)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		fmt.Println(converted.Content)
+		return nil
+	}
+
+	mediaId, err := wechat.AddDraft(token, []wechat.Article{converted})
+	if err != nil {
+		return err
+	}
+	fmt.Println("已新建草稿", mediaId)
+	return nil
+}
+
+func loadMenuDefinition(accountId int, file string) (wechat.MenuInfo, error) {
+	if file == "" {
+		return GetStoredMenuDefinition(accountId)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return wechat.MenuInfo{}, err
+	}
+	return ParseMenuDefinition(data)
+}
+
+func printMenuDiff(diff []string) {
+	if len(diff) == 0 {
+		fmt.Println("菜单没有变化")
+		return
+	}
+	fmt.Println(strings.Join(diff, "\n"))
+}
+
+func menuDiffCommand(accountId int, file string) error {
+	desired, err := loadMenuDefinition(accountId, file)
+	if err != nil {
+		return err
+	}
+	_, diff, err := DiffMenuDefinition(accountId, desired)
+	if err != nil {
+		return err
+	}
+	printMenuDiff(diff)
+	return nil
+}
+
+func menuApplyCommand(accountId int, file string, dryRun bool) error {
+	desired, err := loadMenuDefinition(accountId, file)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		return menuDryRun(accountId, desired)
+	}
+
+	source := "cli"
+	if file != "" {
+		source = "cli:" + file
+	}
+	return menuApply(accountId, desired, source)
+}
+
+func menuRollbackCommand(accountId int, version int64, dryRun bool) error {
+	desired, version, err := GetMenuVersion(accountId, version)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		return menuDryRun(accountId, desired)
+	}
+	return menuApply(accountId, desired, fmt.Sprintf("rollback:%d", version))
+}
+
+func menuDryRun(accountId int, desired wechat.MenuInfo) error {
+	_, diff, err := DiffMenuDefinition(accountId, desired)
+	if err != nil {
+		return err
+	}
+	printMenuDiff(diff)
+	if len(diff) > 0 {
+		fmt.Println("dry run，未同步")
+	}
+	return nil
+}
+
+func menuApply(accountId int, desired wechat.MenuInfo, source string) error {
+	diff, version, err := ApplyMenuDefinition(accountId, desired, source)
+	printMenuDiff(diff)
+	if err != nil {
+		if version > 0 {
+			fmt.Println("同步中途失败，已记录为版本", version, "，可以通过 menu rollback 回滚")
+		}
+		return err
+	}
+	if version > 0 {
+		fmt.Println("已同步，版本", version)
+	}
+	return nil
+}
+
+func menuVersionsCommand(accountId int) {
+	versions, _ := Query("select id, source, status, created_at from wx_menu_version where acid = ? order by id desc limit 20", accountId)
+	for _, version := range versions {
+		fmt.Printf("%d\t%s\t%s\t%s\n", version["id"], version["created_at"], version["status"], version["source"])
+	}
+}
+
+func menuDumpCommand(accountId int) error {
+	token := GetAccountToken(accountId)
+	if token == "" {
+		return NoAccountTokenError(accountId)
+	}
+	current, err := GetCurrentMenu(token)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/chenhg5/go-wechat/sdk"
+)
+
+// 图文留言管理，ModerateComments 对同一篇文章的多条评论批量精选、取消精选、删除或回复
+
+// CommentModeration 批量处理中一条评论的结果
+type CommentModeration struct {
+	UserCommentId int64  `json:"user_comment_id"`
+	ErrCode       int64  `json:"errcode"`
+	ErrMsg        string `json:"errmsg"`
+}
+
+// CommentModerationResult 批量处理的结果，失败的评论可以单独重试
+type CommentModerationResult struct {
+	Total    int                 `json:"total"`
+	Success  int                 `json:"success"`
+	Failed   int                 `json:"failed"`
+	Comments []CommentModeration `json:"comments"`
+}
+
+// ModerateCommentList 对文章的多条评论执行 action，elect 精选，unelect 取消精选，delete 删除，reply 回复，
+// deletereply 删除回复，使用文章所属账号的 accessToken，同时最多 concurrency 个请求
+func ModerateCommentList(accessToken string, msgDataId int64, index int, userCommentIds []int64, action string, content string, concurrency int) (CommentModerationResult, error) {
+	var moderate func(userCommentId int64) error
+	switch action {
+	case "elect":
+		moderate = func(id int64) error { return wechat.MarkElectComment(accessToken, msgDataId, index, id) }
+	case "unelect":
+		moderate = func(id int64) error { return wechat.UnmarkElectComment(accessToken, msgDataId, index, id) }
+	case "delete":
+		moderate = func(id int64) error { return wechat.DeleteComment(accessToken, msgDataId, index, id) }
+	case "reply":
+		if content == "" {
+			return CommentModerationResult{}, errors.New("回复内容不能为空")
+		}
+		moderate = func(id int64) error { return wechat.ReplyComment(accessToken, msgDataId, index, id, content) }
+	case "deletereply":
+		moderate = func(id int64) error { return wechat.DeleteCommentReply(accessToken, msgDataId, index, id) }
+	default:
+		return CommentModerationResult{}, errors.New("错误的操作")
+	}
+
+	comments := make([]CommentModeration, len(userCommentIds))
+	errs := runBatches(len(comments), concurrency, func(i int) error {
+		return moderate(userCommentIds[i])
+	})
+	for i, err := range errs {
+		comments[i].UserCommentId = userCommentIds[i]
+		comments[i].ErrCode, comments[i].ErrMsg = batchErrCode(err)
+	}
+
+	result := CommentModerationResult{Total: len(comments), Comments: comments}
+	for _, comment := range comments {
+		if comment.ErrCode == 0 {
+			result.Success++
+		} else {
+			result.Failed++
+		}
+	}
+	return result, nil
+}
+
+// commentArticle 读取文章的 msgDataId 与 index
+func commentArticle(wcctx *WechatCtx) (int64, int, error) {
+	msgDataId, err := strconv.ParseInt(wcctx.GetFormValue("msgDataId"), 10, 64)
+	if err != nil {
+		return 0, 0, errors.New("错误的msgDataId")
+	}
+	index, _ := strconv.Atoi(wcctx.GetFormValue("index"))
+	return msgDataId, index, nil
+}
+
+// commentRequest 读取文章与 userCommentId 后调用留言接口
+func commentRequest(wcctx *WechatCtx, request func(msgDataId int64, index int, userCommentId int64) error) ([]byte, error) {
+	msgDataId, index, err := commentArticle(wcctx)
+	if err != nil {
+		return []byte{}, err
+	}
+	userCommentId, err := strconv.ParseInt(wcctx.GetFormValue("userCommentId"), 10, 64)
+	if err != nil {
+		return []byte{}, errors.New("错误的评论id")
+	}
+	return Result(wechat.CommonError{ErrMsg: "ok"}, request(msgDataId, index, userCommentId))
+}
+
+// OpenComment
+//
+// 参数：
+// msgDataId	群发或发布返回的 msg_data_id
+// index		多图文中的第几篇，第一篇为0
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+// 失败返回 { "errcode":88000,"errmsg":"without comment privilege"}
+func OpenComment(wcctx *WechatCtx) ([]byte, error) {
+	msgDataId, index, err := commentArticle(wcctx)
+	if err != nil {
+		return []byte{}, err
+	}
+	return Result(wechat.CommonError{ErrMsg: "ok"}, wechat.OpenComment(wcctx.AccessToken(), msgDataId, index))
+}
+
+// CloseComment
+//
+// 参数：
+// msgDataId	群发或发布返回的 msg_data_id
+// index		多图文中的第几篇，第一篇为0
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func CloseComment(wcctx *WechatCtx) ([]byte, error) {
+	msgDataId, index, err := commentArticle(wcctx)
+	if err != nil {
+		return []byte{}, err
+	}
+	return Result(wechat.CommonError{ErrMsg: "ok"}, wechat.CloseComment(wcctx.AccessToken(), msgDataId, index))
+}
+
+// GetComments
+//
+// 参数：
+// msgDataId	群发或发布返回的 msg_data_id
+// index		多图文中的第几篇，第一篇为0
+// begin		起始位置
+// count		获取数目，不超过50
+// type			0 普通评论和精选评论，1 普通评论，2 精选评论
+//
+// 返回：
+// 成功返回 { "total":TOTAL, "comment":[ { "user_comment_id":USER_COMMENT_ID, "openid":OPENID, "create_time":CREATE_TIME, "content":CONTENT, "comment_type":1, "reply":{ "content":CONTENT, "create_time":CREATE_TIME } } ] }
+func GetComments(wcctx *WechatCtx) ([]byte, error) {
+	msgDataId, index, err := commentArticle(wcctx)
+	if err != nil {
+		return []byte{}, err
+	}
+	begin, _ := strconv.Atoi(wcctx.GetFormValue("begin"))
+	count, _ := strconv.Atoi(wcctx.GetFormValue("count"))
+	commentType, _ := strconv.Atoi(wcctx.GetFormValue("type"))
+	return Result(wechat.GetComments(wcctx.AccessToken(), msgDataId, index, begin, count, commentType))
+}
+
+// MarkElectComment
+//
+// 参数：
+// msgDataId		群发或发布返回的 msg_data_id
+// index			多图文中的第几篇，第一篇为0
+// userCommentId	评论id
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func MarkElectComment(wcctx *WechatCtx) ([]byte, error) {
+	return commentRequest(wcctx, func(msgDataId int64, index int, userCommentId int64) error {
+		return wechat.MarkElectComment(wcctx.AccessToken(), msgDataId, index, userCommentId)
+	})
+}
+
+// UnmarkElectComment
+//
+// 参数与 MarkElectComment 相同
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func UnmarkElectComment(wcctx *WechatCtx) ([]byte, error) {
+	return commentRequest(wcctx, func(msgDataId int64, index int, userCommentId int64) error {
+		return wechat.UnmarkElectComment(wcctx.AccessToken(), msgDataId, index, userCommentId)
+	})
+}
+
+// DeleteComment
+//
+// 参数与 MarkElectComment 相同
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func DeleteComment(wcctx *WechatCtx) ([]byte, error) {
+	return commentRequest(wcctx, func(msgDataId int64, index int, userCommentId int64) error {
+		return wechat.DeleteComment(wcctx.AccessToken(), msgDataId, index, userCommentId)
+	})
+}
+
+// ReplyComment
+//
+// 参数：
+// msgDataId		群发或发布返回的 msg_data_id
+// index			多图文中的第几篇，第一篇为0
+// userCommentId	评论id
+// content			回复内容
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func ReplyComment(wcctx *WechatCtx) ([]byte, error) {
+	content := wcctx.GetFormValue("content")
+	if content == "" {
+		return []byte{}, errors.New("回复内容不能为空")
+	}
+	return commentRequest(wcctx, func(msgDataId int64, index int, userCommentId int64) error {
+		return wechat.ReplyComment(wcctx.AccessToken(), msgDataId, index, userCommentId, content)
+	})
+}
+
+// DeleteCommentReply
+//
+// 参数与 MarkElectComment 相同
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func DeleteCommentReply(wcctx *WechatCtx) ([]byte, error) {
+	return commentRequest(wcctx, func(msgDataId int64, index int, userCommentId int64) error {
+		return wechat.DeleteCommentReply(wcctx.AccessToken(), msgDataId, index, userCommentId)
+	})
+}
+
+// ModerateComments 批量处理一篇文章的评论
+//
+// 参数：
+// msgDataId		群发或发布返回的 msg_data_id
+// index			多图文中的第几篇，第一篇为0
+// action			elect 精选，unelect 取消精选，delete 删除，reply 回复，deletereply 删除回复
+// userCommentIds	评论id，多个用英文逗号隔开
+// content			action 为 reply 时的回复内容
+//
+// 返回：
+// 成功返回 { "total":3, "success":2, "failed":1, "comments":[ { "user_comment_id":1, "errcode":0, "errmsg":"ok" }, ... ] }
+func ModerateComments(wcctx *WechatCtx) ([]byte, error) {
+	msgDataId, index, err := commentArticle(wcctx)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	var userCommentIds []int64
+	for _, id := range strings.Split(wcctx.GetFormValue("userCommentIds"), ",") {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+		userCommentId, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return []byte{}, errors.New("错误的评论id")
+		}
+		userCommentIds = append(userCommentIds, userCommentId)
+	}
+	if len(userCommentIds) == 0 {
+		return []byte{}, errors.New("错误的评论id")
+	}
+
+	result, err := ModerateCommentList(wcctx.AccessToken(), msgDataId, index, userCommentIds, wcctx.GetFormValue("action"),
+		wcctx.GetFormValue("content"), GetEnvInt("COMMENT_CONCURRENCY", 4))
+	if err != nil {
+		return []byte{}, err
+	}
+	return json.Marshal(result)
+}
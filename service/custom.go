@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/chenhg5/go-wechat/sdk"
+)
+
+// SendCustomMessage
+//
+// 参数：
+// toUser		接收者openid
+// msgType		消息类型 text, image, voice, video, music, news
+// content		text为文本内容，image, voice, video为media_id，music与news为对应的json，
+//
+//	如 {"articles":[{"title":"", "description":"", "url":"", "picurl":""}]}
+//
+// kfAccount	以某个客服帐号来发消息
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+// 失败返回 { "errcode":45015,"errmsg":"response out of time limit or subscription is canceled"}
+func SendCustomMessage(wcctx *WechatCtx) ([]byte, error) {
+	msg := wechat.CustomMessage{
+		ToUser:  wcctx.GetFormValue("toUser"),
+		MsgType: wcctx.GetFormValue("msgType"),
+	}
+
+	content := wcctx.GetFormValue("content")
+	switch msg.MsgType {
+	case "text":
+		msg.Text = &wechat.CustomText{Content: content}
+	case "image":
+		msg.Image = &wechat.CustomMedia{MediaId: content}
+	case "voice":
+		msg.Voice = &wechat.CustomMedia{MediaId: content}
+	case "video":
+		msg.Video = &wechat.CustomVideo{MediaId: content}
+	case "music":
+		msg.Music = &wechat.CustomMusic{}
+		if err := json.Unmarshal([]byte(content), msg.Music); err != nil {
+			return []byte{}, err
+		}
+	case "news":
+		msg.News = &wechat.CustomNews{}
+		if err := json.Unmarshal([]byte(content), msg.News); err != nil {
+			return []byte{}, err
+		}
+	}
+
+	if kfAccount := wcctx.GetFormValue("kfAccount"); kfAccount != "" {
+		msg.CustomService = &wechat.CustomService{KfAccount: kfAccount}
+	}
+
+	return Result(wechat.CommonError{ErrMsg: "ok"}, wechat.SendCustomMessage(wcctx.AccessToken(), msg))
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/chenhg5/go-wechat/sdk"
+)
+
+// 草稿箱与发布，每次发布在 wx_publish_job 中记录一条任务，
+// 收到 PUBLISHJOBFINISH 事件或轮询发布状态时更新任务，每篇文章的结果记录在 wx_publish_article
+
+// articlesParam 读取json格式的图文列表
+func articlesParam(wcctx *WechatCtx) ([]wechat.Article, error) {
+	var articles []wechat.Article
+	if err := json.Unmarshal([]byte(wcctx.GetFormValue("articles")), &articles); err != nil {
+		return nil, errors.New("错误的图文")
+	}
+	return articles, nil
+}
+
+// AddDraft
+//
+// 参数：
+// articles		图文json，最多8篇，如 [{"title":"标题","content":"<p>正文</p>","thumb_media_id":"..."}]
+//
+// 返回：
+// 成功返回 { "media_id":MEDIA_ID }
+// 失败返回 { "errcode":40007,"errmsg":"invalid media_id"}
+func AddDraft(wcctx *WechatCtx) ([]byte, error) {
+	articles, err := articlesParam(wcctx)
+	if err != nil {
+		return []byte{}, err
+	}
+	mediaId, err := wechat.AddDraft(wcctx.AccessToken(), articles)
+	if err == wechat.ErrInvalidArticles {
+		return []byte{}, errors.New("一个草稿最多8篇图文")
+	}
+	return Result(map[string]string{"media_id": mediaId}, err)
+}
+
+// GetDraft
+//
+// 参数：
+// mediaId	草稿的media_id
+//
+// 返回：
+// 成功返回 { "news_item":[ { "title":TITLE, ..., "url":URL } ] }
+func GetDraft(wcctx *WechatCtx) ([]byte, error) {
+	articles, err := wechat.GetDraft(wcctx.AccessToken(), wcctx.GetFormValue("mediaId"))
+	return Result(map[string][]wechat.Article{"news_item": articles}, err)
+}
+
+// DeleteDraft
+//
+// 参数：
+// mediaId	草稿的media_id
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func DeleteDraft(wcctx *WechatCtx) ([]byte, error) {
+	return Result(wechat.CommonError{ErrMsg: "ok"}, wechat.DeleteDraft(wcctx.AccessToken(), wcctx.GetFormValue("mediaId")))
+}
+
+// UpdateDraft
+//
+// 参数：
+// mediaId	草稿的media_id
+// index	要更新的文章在图文中的位置，第一篇为0
+// article	图文json
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func UpdateDraft(wcctx *WechatCtx) ([]byte, error) {
+	index, err := strconv.Atoi(wcctx.GetFormValue("index"))
+	if err != nil || index < 0 {
+		return []byte{}, errors.New("错误的位置")
+	}
+	var article wechat.Article
+	if err := json.Unmarshal([]byte(wcctx.GetFormValue("article")), &article); err != nil {
+		return []byte{}, errors.New("错误的图文")
+	}
+	return Result(wechat.CommonError{ErrMsg: "ok"},
+		wechat.UpdateDraft(wcctx.AccessToken(), wcctx.GetFormValue("mediaId"), index, article))
+}
+
+// GetDraftCount
+//
+// 返回：
+// 成功返回 { "total_count":TOTAL_COUNT }
+func GetDraftCount(wcctx *WechatCtx) ([]byte, error) {
+	count, err := wechat.GetDraftCount(wcctx.AccessToken())
+	return Result(map[string]int64{"total_count": count}, err)
+}
+
+// BatchGetDraft
+//
+// 参数：
+// offset		从全部草稿的该偏移位置开始返回，0表示从第一个返回
+// count		返回草稿的数量，取值在1到20之间
+// noContent	为1时不返回 content 字段
+//
+// 返回：
+// 成功返回 { "total_count":TOTAL_COUNT, "item_count":ITEM_COUNT, "item":[ { "media_id":MEDIA_ID, "content":{ "news_item":[...] }, "update_time":UPDATE_TIME } ] }
+func BatchGetDraft(wcctx *WechatCtx) ([]byte, error) {
+	offset, _ := strconv.Atoi(wcctx.GetFormValue("offset"))
+	count, _ := strconv.Atoi(wcctx.GetFormValue("count"))
+	return Result(wechat.BatchGetDraft(wcctx.AccessToken(), offset, count, wcctx.GetFormValue("noContent") == "1"))
+}
+
+// SubmitPublish 发布草稿，发布结果通过 GetPublishJobs 查询
+//
+// 参数：
+// mediaId	草稿的media_id
+//
+// 返回：
+// 成功返回 { "publish_id":"100000001", "msg_data_id":2247483673 }
+// 失败返回 { "errcode":53503,"errmsg":"该草稿未通过发布检查"}
+func SubmitPublish(wcctx *WechatCtx) ([]byte, error) {
+	mediaId := wcctx.GetFormValue("mediaId")
+	result, err := wechat.SubmitPublish(wcctx.AccessToken(), mediaId)
+	if err == nil {
+		CreatePublishJob(wcctx.AccountId(), result, mediaId)
+	}
+	return Result(result, err)
+}
+
+// GetPublishStatus 从微信接口查询发布状态并更新发布任务
+//
+// 参数：
+// publishId	发布任务id
+//
+// 返回：
+// 成功返回 { "publish_id":"100000001", "publish_status":0, "article_id":ARTICLE_ID, "article_detail":{ "count":1, "item":[ { "idx":1, "article_url":ARTICLE_URL } ] }, "fail_idx":[] }
+func GetPublishStatus(wcctx *WechatCtx) ([]byte, error) {
+	status, err := wechat.GetPublishStatus(wcctx.AccessToken(), wcctx.GetFormValue("publishId"))
+	if err == nil {
+		UpdatePublishJob(wcctx.AccountId(), status)
+	}
+	return Result(status, err)
+}
+
+// DeletePublish
+//
+// 参数：
+// articleId	发布成功时返回的 article_id
+// index		要删除的文章在图文中的位置，第一篇为1，不填或为0时删除全部文章
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func DeletePublish(wcctx *WechatCtx) ([]byte, error) {
+	articleId := wcctx.GetFormValue("articleId")
+	index, _ := strconv.Atoi(wcctx.GetFormValue("index"))
+
+	err := wechat.DeletePublish(wcctx.AccessToken(), articleId, index)
+	if err == nil {
+		DeletePublishArticle(wcctx.AccountId(), articleId, index)
+	}
+	return Result(wechat.CommonError{ErrMsg: "ok"}, err)
+}
+
+// GetPublishedArticle
+//
+// 参数：
+// articleId	发布成功时返回的 article_id
+//
+// 返回：
+// 成功返回 { "news_item":[ { "title":TITLE, ..., "url":URL, "is_deleted":false } ] }
+func GetPublishedArticle(wcctx *WechatCtx) ([]byte, error) {
+	articles, err := wechat.GetPublishedArticle(wcctx.AccessToken(), wcctx.GetFormValue("articleId"))
+	return Result(map[string][]wechat.Article{"news_item": articles}, err)
+}
+
+// BatchGetPublished
+//
+// 参数：
+// offset		从全部发布的该偏移位置开始返回，0表示从第一个返回
+// count		返回的数量，取值在1到20之间
+// noContent	为1时不返回 content 字段
+//
+// 返回：
+// 成功返回 { "total_count":TOTAL_COUNT, "item_count":ITEM_COUNT, "item":[ { "article_id":ARTICLE_ID, "content":{ "news_item":[...] }, "update_time":UPDATE_TIME } ] }
+func BatchGetPublished(wcctx *WechatCtx) ([]byte, error) {
+	offset, _ := strconv.Atoi(wcctx.GetFormValue("offset"))
+	count, _ := strconv.Atoi(wcctx.GetFormValue("count"))
+	return Result(wechat.BatchGetPublished(wcctx.AccessToken(), offset, count, wcctx.GetFormValue("noContent") == "1"))
+}
+
+// GetPublishJobs 查询本地记录的发布任务与每篇文章的结果
+//
+// 参数：
+// publishId	发布任务id，为空时按时间倒序分页返回
+// page			页码
+// pageSize		每页数量
+//
+// 返回：
+// 成功返回 [ { "publish_id":"100000001", "media_id":MEDIA_ID, "publish_status":0, "article_id":ARTICLE_ID, ..., "articles":[ { "idx":1, "status":"success", "article_url":ARTICLE_URL } ] } ]
+func GetPublishJobs(wcctx *WechatCtx) ([]byte, error) {
+	var jobs []map[string]interface{}
+	if publishId := wcctx.GetFormValue("publishId"); publishId != "" {
+		jobs, _ = Query("select * from wx_publish_job where acid = ? and publish_id = ?", wcctx.AccountId(), publishId)
+	} else {
+		page, pageSize := wcctx.Pagination()
+		jobs, _ = Query("select * from wx_publish_job where acid = ? order by id desc limit ?, ?",
+			wcctx.AccountId(), (page-1)*pageSize, pageSize)
+	}
+
+	for _, job := range jobs {
+		job["articles"], _ = Query("select idx, status, article_url, updated_at from wx_publish_article where acid = ? and publish_id = ? order by idx",
+			wcctx.AccountId(), job["publish_id"])
+	}
+	return json.Marshal(jobs)
+}
+
+// CreatePublishJob 记录发布任务
+func CreatePublishJob(accountId int, result wechat.PublishResult, mediaId string) {
+	Exec("insert into wx_publish_job (acid, publish_id, media_id, msg_data_id, publish_status) values (?, ?, ?, ?, ?) "+
+		"on duplicate key update media_id = values(media_id), msg_data_id = values(msg_data_id)",
+		accountId, string(result.PublishId), mediaId, result.MsgDataId, wechat.PUBLISH_STATUS_PUBLISHING)
+}
+
+// UpdatePublishJob 根据 PUBLISHJOBFINISH 事件或轮询结果更新发布任务与每篇文章的状态，
+// 在公众平台发布的任务没有提交记录，同样写入
+func UpdatePublishJob(accountId int, status wechat.PublishStatus) {
+	publishId := string(status.PublishId)
+	Exec("insert into wx_publish_job (acid, publish_id, publish_status, article_id) values (?, ?, ?, ?) "+
+		"on duplicate key update publish_status = values(publish_status), article_id = values(article_id)",
+		accountId, publishId, status.PublishStatus, status.ArticleId)
+
+	for _, item := range status.ArticleDetail.Item {
+		Exec("insert into wx_publish_article (acid, publish_id, article_id, idx, status, article_url) values (?, ?, ?, ?, 'success', ?) "+
+			"on duplicate key update article_id = values(article_id), status = if(status = 'deleted', status, 'success'), article_url = values(article_url)",
+			accountId, publishId, status.ArticleId, item.Idx, item.ArticleUrl)
+	}
+	for _, idx := range status.FailIdx {
+		Exec("insert into wx_publish_article (acid, publish_id, article_id, idx, status) values (?, ?, ?, ?, 'failed') "+
+			"on duplicate key update status = 'failed'",
+			accountId, publishId, status.ArticleId, idx)
+	}
+
+	switch status.PublishStatus {
+	case wechat.PUBLISH_STATUS_DELETED:
+		Exec("update wx_publish_article set status = 'deleted' where acid = ? and publish_id = ?", accountId, publishId)
+	case wechat.PUBLISH_STATUS_BANNED:
+		Exec("update wx_publish_article set status = 'banned' where acid = ? and publish_id = ?", accountId, publishId)
+	}
+}
+
+// DeletePublishArticle 标记已删除的文章，index 为0时标记全部文章
+func DeletePublishArticle(accountId int, articleId string, index int) {
+	if index == 0 {
+		Exec("update wx_publish_job set publish_status = ? where acid = ? and article_id = ?",
+			wechat.PUBLISH_STATUS_DELETED, accountId, articleId)
+		Exec("update wx_publish_article set status = 'deleted' where acid = ? and article_id = ?", accountId, articleId)
+		return
+	}
+	Exec("update wx_publish_article set status = 'deleted' where acid = ? and article_id = ? and idx = ?", accountId, articleId, index)
+}
@@ -0,0 +1,24 @@
+package main
+
+// 可选配置项，未在 config.go 中配置时使用默认值
+
+func GetEnvInt(key string, defaultValue int) int {
+	if value, ok := EnvConfig[key].(int); ok {
+		return value
+	}
+	return defaultValue
+}
+
+func GetEnvString(key string, defaultValue string) string {
+	if value, ok := EnvConfig[key].(string); ok && value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func GetEnvBool(key string, defaultValue bool) bool {
+	if value, ok := EnvConfig[key].(bool); ok {
+		return value
+	}
+	return defaultValue
+}
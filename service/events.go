@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chenhg5/go-wechat/sdk"
+	"github.com/valyala/fasthttp"
+)
+
+// 实时事件推送，/events/stream 以 SSE 或 WebSocket 向运营后台等客户端推送本实例收到的推送消息
+//
+// 参数(query)：
+// clientId		客户端id，对应配置 CLIENT_ID，也可以使用 Basic 认证
+// clientSecret	客户端密钥，对应配置 CLIENT_SECRET
+// accountId	只推送该账号的消息，为空时推送所有账号
+// event		只推送这些事件或消息类型，多个用英文逗号隔开，如 subscribe,SCAN,text，为空时推送全部
+//
+// 每个客户端有固定长度的缓冲，推送时不会阻塞回调处理，缓冲满时丢弃消息，
+// 连续丢弃 EVENT_STREAM_MAX_DROPS 条后断开该客户端
+
+const (
+	EVENT_STREAM_HEARTBEAT = 15 * time.Second // 心跳间隔，用于发现已断开的客户端
+)
+
+var GlobalEventHub = &EventHub{subscribers: map[*EventSubscriber]struct{}{}}
+
+// EventHub 管理所有实时事件的订阅者
+type EventHub struct {
+	mu          sync.RWMutex
+	subscribers map[*EventSubscriber]struct{}
+}
+
+// EventSubscriber 一个实时事件客户端
+type EventSubscriber struct {
+	accountId int
+	events    map[string]bool
+	ch        chan []byte
+	done      chan struct{}
+	drops     int64 // 连续丢弃的消息数
+	maxDrops  int64
+	once      sync.Once
+}
+
+// Subscribe 添加订阅者，超过 EVENT_STREAM_MAX_CLIENTS 时返回nil
+func (hub *EventHub) Subscribe(accountId int, events []string) *EventSubscriber {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	if len(hub.subscribers) >= GetEnvInt("EVENT_STREAM_MAX_CLIENTS", 100) {
+		return nil
+	}
+
+	sub := &EventSubscriber{
+		accountId: accountId,
+		events:    map[string]bool{},
+		ch:        make(chan []byte, GetEnvInt("EVENT_STREAM_BUFFER", 64)),
+		done:      make(chan struct{}),
+		maxDrops:  int64(GetEnvInt("EVENT_STREAM_MAX_DROPS", 100)),
+	}
+	for _, event := range events {
+		if event = strings.TrimSpace(event); event != "" {
+			sub.events[strings.ToLower(event)] = true
+		}
+	}
+	hub.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe 移除订阅者
+func (hub *EventHub) Unsubscribe(sub *EventSubscriber) {
+	hub.mu.Lock()
+	delete(hub.subscribers, sub)
+	hub.mu.Unlock()
+	sub.close()
+}
+
+// Len 当前订阅者数量
+func (hub *EventHub) Len() int {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	return len(hub.subscribers)
+}
+
+// Publish 向匹配的订阅者推送消息，不会阻塞
+func (hub *EventHub) Publish(accountId int, msg *wechat.MixMessage) {
+	if hub.Len() == 0 {
+		return
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"account_id": accountId, "message": msg})
+	if err != nil {
+		LogError(err)
+		return
+	}
+
+	var slow []*EventSubscriber
+
+	hub.mu.RLock()
+	for sub := range hub.subscribers {
+		if !sub.match(accountId, msg) {
+			continue
+		}
+		select {
+		case sub.ch <- data:
+			atomic.StoreInt64(&sub.drops, 0)
+		default:
+			if atomic.AddInt64(&sub.drops, 1) >= sub.maxDrops {
+				slow = append(slow, sub)
+			}
+		}
+	}
+	hub.mu.RUnlock()
+
+	for _, sub := range slow {
+		hub.Unsubscribe(sub)
+	}
+}
+
+func (sub *EventSubscriber) match(accountId int, msg *wechat.MixMessage) bool {
+	if sub.accountId != 0 && sub.accountId != accountId {
+		return false
+	}
+	if len(sub.events) == 0 {
+		return true
+	}
+	if msg.MsgType == wechat.MSG_TYPE_EVENT {
+		return sub.events[strings.ToLower(msg.Event)]
+	}
+	return sub.events[strings.ToLower(msg.MsgType)]
+}
+
+func (sub *EventSubscriber) close() {
+	sub.once.Do(func() { close(sub.done) })
+}
+
+// Broadcast 将推送消息推送给实时事件的客户端
+func Broadcast(hub *EventHub) wechat.Middleware {
+	return func(next wechat.HandlerFunc) wechat.HandlerFunc {
+		return func(ctx *wechat.Context) (wechat.Reply, error) {
+			hub.Publish(ctx.AccountId, ctx.Message)
+			return next(ctx)
+		}
+	}
+}
+
+func EventStream(wcctx *WechatCtx) {
+
+	defer handle(wcctx)
+
+	if !wcctx.Authorized() {
+		wcctx.Ctx.Response.Header.Set("WWW-Authenticate", `Basic realm="go-wechat"`)
+		wcctx.Json(fasthttp.StatusUnauthorized, "错误的客户端凭证", "")
+		return
+	}
+
+	args := wcctx.Ctx.QueryArgs()
+	accountId := 0
+	if id := string(args.Peek("accountId")); id != "" {
+		var err error
+		if accountId, err = strconv.Atoi(id); err != nil {
+			wcctx.Json(fasthttp.StatusBadRequest, "错误的参数", "")
+			return
+		}
+	}
+
+	var events []string
+	if event := string(args.Peek("event")); event != "" {
+		events = strings.Split(event, ",")
+	}
+
+	sub := GlobalEventHub.Subscribe(accountId, events)
+	if sub == nil {
+		wcctx.Json(fasthttp.StatusServiceUnavailable, "客户端数量已达上限", "")
+		return
+	}
+
+	if IsWebSocketUpgrade(wcctx.Ctx) {
+		UpgradeWebSocket(wcctx.Ctx, func(ws *WebSocketConn) {
+			defer GlobalEventHub.Unsubscribe(sub)
+			ws.Serve(sub.ch, sub.done, EVENT_STREAM_HEARTBEAT)
+		})
+		return
+	}
+
+	wcctx.Ctx.SetContentType("text/event-stream")
+	wcctx.Ctx.Response.Header.Set("Cache-Control", "no-cache")
+	wcctx.Ctx.Response.Header.Set("X-Accel-Buffering", "no")
+	wcctx.Ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer GlobalEventHub.Unsubscribe(sub)
+		ServeSSE(w, sub.ch, sub.done, EVENT_STREAM_HEARTBEAT)
+	})
+}
+
+// ServeSSE 以 SSE 格式写出消息，写失败(客户端断开)或 done 关闭时返回
+func ServeSSE(w *bufio.Writer, ch <-chan []byte, done <-chan struct{}, heartbeat time.Duration) {
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	w.WriteString("retry: 3000\n\n")
+	if w.Flush() != nil {
+		return
+	}
+
+	for {
+		select {
+		case data := <-ch:
+			w.WriteString("data: ")
+			w.Write(data)
+			w.WriteString("\n\n")
+		case <-ticker.C:
+			w.WriteString(": ping\n\n")
+		case <-done:
+			return
+		}
+		if w.Flush() != nil {
+			return
+		}
+	}
+}
@@ -55,6 +55,154 @@ var GlobalFuncMap = map[string]EndPoint{
 	"SendWxappTemplateMessage":      SendWxappTemplateMessage,
 	"PayUnifiedOrder":               PayUnifiedOrder,
 	"DecodeWxappData":               DecodeWxappData,
+
+	// 群发消息
+	"SendMassAll":  SendMassAll,
+	"SendMass":     SendMass,
+	"PreviewMass":  PreviewMass,
+	"GetMass":      GetMass,
+	"DeleteMass":   DeleteMass,
+	"GetMassSpeed": GetMassSpeed,
+	"SetMassSpeed": SetMassSpeed,
+	"GetMassJob":   GetMassJob,
+
+	// 订阅通知与一次性订阅消息
+	"AddSubscribeTemplate":     AddSubscribeTemplate,
+	"DelSubscribeTemplate":     DelSubscribeTemplate,
+	"GetSubscribeCategory":     GetSubscribeCategory,
+	"GetPubTemplateKeywords":   GetPubTemplateKeywords,
+	"GetPubTemplateTitles":     GetPubTemplateTitles,
+	"GetSubscribeTemplate":     GetSubscribeTemplate,
+	"SendSubscribeMessage":     SendSubscribeMessage,
+	"GetOnceSubscribeAuthUrl":  GetOnceSubscribeAuthUrl,
+	"ConfirmOnceSubscribe":     ConfirmOnceSubscribe,
+	"SendOnceSubscribeMessage": SendOnceSubscribeMessage,
+	"GetSubscribeStatus":       GetSubscribeStatus,
+
+	// 客服消息
+	"SendCustomMessage": SendCustomMessage,
+
+	// 推送消息转发
+	"AddWebhookRule":       AddWebhookRule,
+	"DelWebhookRule":       DelWebhookRule,
+	"GetWebhookRules":      GetWebhookRules,
+	"GetWebhookDeliveries": GetWebhookDeliveries,
+	"RedeliverWebhook":     RedeliverWebhook,
+
+	// 推送消息流
+	"CreateStreamGroup": CreateStreamGroup,
+
+	// 自定义菜单
+	"CreateMenu":             CreateMenu,
+	"GetMenu":                GetMenu,
+	"DeleteMenu":             DeleteMenu,
+	"GetCurrentSelfMenuInfo": GetCurrentSelfMenuInfo,
+	"AddConditionalMenu":     AddConditionalMenu,
+	"DelConditionalMenu":     DelConditionalMenu,
+	"TryMatchMenu":           TryMatchMenu,
+
+	// 菜单即代码
+	"SaveMenuDefinition": SaveMenuDefinition,
+	"GetMenuDefinition":  GetMenuDefinition,
+	"DiffMenu":           DiffMenu,
+	"ApplyMenu":          ApplyMenu,
+	"RollbackMenu":       RollbackMenu,
+	"GetMenuVersions":    GetMenuVersions,
+
+	// 用户管理
+	"GetUserInfo":      GetUserInfo,
+	"BatchGetUserInfo": BatchGetUserInfo,
+	"GetUserList":      GetUserList,
+	"UpdateUserRemark": UpdateUserRemark,
+	"GetBlacklist":     GetBlacklist,
+	"BatchBlacklist":   BatchBlacklist,
+	"BatchUnblacklist": BatchUnblacklist,
+
+	// 用户标签
+	"CreateTag":        CreateTag,
+	"GetTags":          GetTags,
+	"UpdateTag":        UpdateTag,
+	"DeleteTag":        DeleteTag,
+	"BatchTagging":     BatchTagging,
+	"BatchUntagging":   BatchUntagging,
+	"BulkTaggingUsers": BulkTaggingUsers,
+	"GetUserTagIdList": GetUserTagIdList,
+	"GetTagUsers":      GetTagUsers,
+
+	// 关注者本地镜像
+	"SyncUsers":         SyncUsers,
+	"GetUserSyncStatus": GetUserSyncStatus,
+	"QueryUsers":        QueryUsers,
+
+	// 跨账号身份
+	"ResolveIdentity": ResolveIdentity,
+
+	// 素材管理
+	"UploadMedia":        UploadMedia,
+	"UploadArticleImage": UploadArticleImage,
+	"AddMaterial":        AddMaterial,
+	"GetMaterial":        GetMaterial,
+	"DelMaterial":        DelMaterial,
+	"GetMaterialCount":   GetMaterialCount,
+	"BatchGetMaterial":   BatchGetMaterial,
+
+	// 素材库本地镜像
+	"SyncMaterials":         SyncMaterials,
+	"GetMaterialSyncStatus": GetMaterialSyncStatus,
+	"ListMaterials":         ListMaterials,
+	"SearchMaterials":       SearchMaterials,
+
+	// 草稿箱与发布
+	"AddDraft":            AddDraft,
+	"GetDraft":            GetDraft,
+	"DeleteDraft":         DeleteDraft,
+	"UpdateDraft":         UpdateDraft,
+	"GetDraftCount":       GetDraftCount,
+	"BatchGetDraft":       BatchGetDraft,
+	"SubmitPublish":       SubmitPublish,
+	"GetPublishStatus":    GetPublishStatus,
+	"DeletePublish":       DeletePublish,
+	"GetPublishedArticle": GetPublishedArticle,
+	"BatchGetPublished":   BatchGetPublished,
+	"GetPublishJobs":      GetPublishJobs,
+
+	// Markdown 图文
+	"PreviewMarkdown":     PreviewMarkdown,
+	"ConvertMarkdown":     ConvertMarkdown,
+	"CreateMarkdownDraft": CreateMarkdownDraft,
+
+	// 图文留言管理
+	"OpenComment":        OpenComment,
+	"CloseComment":       CloseComment,
+	"GetComments":        GetComments,
+	"MarkElectComment":   MarkElectComment,
+	"UnmarkElectComment": UnmarkElectComment,
+	"DeleteComment":      DeleteComment,
+	"ReplyComment":       ReplyComment,
+	"DeleteCommentReply": DeleteCommentReply,
+	"ModerateComments":   ModerateComments,
+
+	// 带参数二维码
+	"CreateQrcodeCampaign":   CreateQrcodeCampaign,
+	"GetQrcodeCampaigns":     GetQrcodeCampaigns,
+	"CreateQrcode":           CreateQrcode,
+	"GetQrcodes":             GetQrcodes,
+	"GetQrcodeCampaignStats": GetQrcodeCampaignStats,
+	"ShortUrl":               ShortUrl,
+	"ShortenGen":             ShortenGen,
+	"ShortenFetch":           ShortenFetch,
+
+	// 自动回复
+	"AddAutoReplyRule":     AddAutoReplyRule,
+	"UpdateAutoReplyRule":  UpdateAutoReplyRule,
+	"DelAutoReplyRule":     DelAutoReplyRule,
+	"GetAutoReplyRules":    GetAutoReplyRules,
+	"TestAutoReply":        TestAutoReply,
+	"ImportAutoReplyRules": ImportAutoReplyRules,
+
+	// 消息归档
+	"SearchMessages": SearchMessages,
+	"PurgeMessages":  PurgeMessages,
 }
 
 func handle(wcctx *WechatCtx) {
@@ -113,3 +261,17 @@ func handle(wcctx *WechatCtx) {
 
 	WechatCtxPool.Put(wcctx)
 }
+
+// LogError 记录不需要返回给调用方的错误
+func LogError(err error) {
+	if EnvConfig["DEBUG"].(bool) {
+		log.Println("[GoWechat]", ansi.Color(" ERROR ", "white:red"), err)
+	}
+
+	if EnvConfig["LOG_IN_FILE"].(bool) {
+		ErrorLogger.log("\n")
+		ErrorLogger.log("[" + time.Now().Format("2006-01-02 15:04:05") + "] app.ERROR: ")
+		ErrorLogger.log(err.Error())
+		ErrorLogger.log("\n")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 跨账号身份，同一开放平台下的公众号与小程序中同一用户的 openid 不同而 unionid 相同，
+// 小程序登录、网页授权与 user/info 返回 unionid 时记录到 wx_identity，
+// 用于把任意账号的 openid 解析为 unionid 与其他账号中的 openid
+
+// RecordIdentity 记录账号下 openid 与 unionid 的对应关系，unionid 为空时忽略
+func RecordIdentity(accountId int, openId string, unionId string, source string) {
+	if openId == "" || unionId == "" {
+		return
+	}
+	Exec("insert into wx_identity (acid, openid, unionid, source) values (?, ?, ?, ?) "+
+		"on duplicate key update unionid = values(unionid), source = values(source)",
+		accountId, openId, unionId, source)
+}
+
+// RecordIdentityFromResult 从微信接口返回的 json 中记录 openid 与 unionid，
+// 用于小程序登录与网页授权等直接返回微信响应的接口，记录失败不影响接口返回
+func RecordIdentityFromResult(accountId int, resData []byte, source string) {
+	defer func() {
+		if r := recover(); r != nil {
+			LogError(fmt.Errorf("record identity panic: %v", r))
+		}
+	}()
+
+	var result struct {
+		OpenId  string `json:"openid"`
+		UnionId string `json:"unionid"`
+	}
+	if err := json.Unmarshal(resData, &result); err != nil {
+		return
+	}
+	RecordIdentity(accountId, result.OpenId, result.UnionId, source)
+}
+
+// ResolveIdentity
+//
+// 参数：
+// openId	当前账号下的openid，与unionId二选一
+// unionId	unionid
+//
+// 返回：
+//
+//	成功返回 {
+//		  "unionid":"o6_bmasdasdsad6_2sgVt7hMZOPfL",
+//		  "identities":[
+//		    { "acid":1, "app_id":"wx...", "openid":"o6_bmjrPTlm6_2sgVt7hMZOPfL2M", "source":"user", "subscribe":1 },
+//		    { "acid":5, "app_id":"wx...", "openid":"oZ7xc5Qv0x4yH6nYqJ1dQeZ2aB3c", "source":"wxapp", "subscribe":null }
+//		  ]
+//	}
+//
+// subscribe 为关注者本地镜像中的关注状态，小程序或镜像中没有的用户为 null
+func ResolveIdentity(wcctx *WechatCtx) ([]byte, error) {
+	unionId := wcctx.GetFormValue("unionId")
+	if openId := wcctx.GetFormValue("openId"); unionId == "" && openId != "" {
+		identities, _ := Query("select unionid from wx_identity where acid = ? and openid = ?", wcctx.AccountId(), openId)
+		if len(identities) == 0 {
+			return []byte{}, errors.New("没有该openid的unionid")
+		}
+		unionId = identities[0]["unionid"].(string)
+	}
+	if unionId == "" {
+		return []byte{}, errors.New("错误的openid")
+	}
+
+	identities, _ := Query("select i.acid, a.app_id, i.openid, i.source, u.subscribe from wx_identity i "+
+		"left join wx_official_account a on a.acid = i.acid "+
+		"left join wx_user u on u.acid = i.acid and u.openid = i.openid "+
+		"where i.unionid = ? order by i.acid", unionId)
+
+	return json.Marshal(map[string]interface{}{"unionid": unionId, "identities": identities})
+}
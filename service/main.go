@@ -1,6 +1,7 @@
 package main
 
 import (
+	"os"
 	"runtime"
 )
 
@@ -21,6 +22,26 @@ func main() {
 	// 初始化账号集
 	InitAccount()
 
+	// 带参数时作为命令行执行，如 go-wechat menu apply -account 1 -file menu.yaml
+	if len(os.Args) > 1 {
+		os.Exit(RunCommand(os.Args[1:]))
+	}
+
+	// 初始化推送消息路由
+	InitRouter()
+
+	// 启动推送消息转发的重试
+	InitWebhook()
+
+	// 定时全量同步关注者
+	InitUserSync()
+
+	// 定时同步永久素材
+	InitMaterialSync()
+
+	// 消息归档的分区维护、过期清理与媒体文件下载
+	InitArchive()
+
 	// 初始化服务器
 	InitServer(EnvConfig["SERVER_PORT"].(string))
 
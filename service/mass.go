@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/chenhg5/go-wechat/sdk"
+)
+
+// 群发消息，每次群发都会在 wx_mass_job 中记录一条任务，
+// 收到 MASSSENDJOBFINISH 事件推送后更新任务状态与发送数量
+
+// SendMassAll
+//
+// 参数：
+// msgType				消息类型 text, mpnews, voice, image, mpvideo, wxcard
+// content				text为文本内容，wxcard为card_id，其余为media_id
+// isToAll				为1时发送给全部用户
+// tagId				群发到的标签id，isToAll为1时忽略
+// sendIgnoreReprint	为1时图文被判定为转载也继续群发
+// clientMsgId			开发者侧群发msgid，用于避免重复推送
+//
+// 返回：
+// 成功返回 { "msg_id":34182, "msg_data_id": 206227730 }
+// 失败返回 { "errcode":40007,"errmsg":"invalid media_id"}
+func SendMassAll(wcctx *WechatCtx) ([]byte, error) {
+
+	filter := wechat.MassFilter{IsToAll: wcctx.GetFormValue("isToAll") == "1"}
+	target := "all"
+	if !filter.IsToAll {
+		tagId, err := strconv.ParseInt(wcctx.GetFormValue("tagId"), 10, 64)
+		if err != nil {
+			return []byte{}, errors.New("错误的标签id")
+		}
+		filter.TagId = tagId
+		target = "tag"
+	}
+
+	msg := massMessage(wcctx)
+	result, err := wechat.SendMassAll(wcctx.AccessToken(), filter, msg)
+	if err == nil {
+		CreateMassJob(wcctx.AccountId(), result, msg.MsgType, target, filter.TagId)
+	}
+
+	return Result(result, err)
+}
+
+// SendMass
+//
+// 参数：
+// toUser				接收者openid，多个用英文逗号隔开，最少2个，最多10000个
+// msgType				消息类型 text, mpnews, voice, image, mpvideo, wxcard
+// content				text为文本内容，wxcard为card_id，其余为media_id
+// sendIgnoreReprint	为1时图文被判定为转载也继续群发
+// clientMsgId			开发者侧群发msgid，用于避免重复推送
+//
+// 返回：
+// 成功返回 { "msg_id":34182, "msg_data_id": 206227730 }
+// 失败返回 { "errcode":40007,"errmsg":"invalid media_id"}
+func SendMass(wcctx *WechatCtx) ([]byte, error) {
+
+	toUser := strings.Split(wcctx.GetFormValue("toUser"), ",")
+	if len(toUser) < 2 {
+		return []byte{}, errors.New("至少需要两个接收者")
+	}
+
+	msg := massMessage(wcctx)
+	result, err := wechat.SendMass(wcctx.AccessToken(), toUser, msg)
+	if err == nil {
+		CreateMassJob(wcctx.AccountId(), result, msg.MsgType, "openid", 0)
+	}
+
+	return Result(result, err)
+}
+
+// PreviewMass
+//
+// 参数：
+// toUser	接收者openid，与toWxName二选一
+// toWxName	接收者微信号
+// msgType	消息类型
+// content	text为文本内容，wxcard为card_id，其余为media_id
+//
+// 返回：
+// 成功返回 { "msg_id":34182 }
+// 失败返回 { "errcode":40007,"errmsg":"invalid media_id"}
+func PreviewMass(wcctx *WechatCtx) ([]byte, error) {
+	return Result(wechat.PreviewMass(wcctx.AccessToken(),
+		wcctx.GetFormValue("toUser"),
+		wcctx.GetFormValue("toWxName"),
+		massMessage(wcctx)))
+}
+
+// GetMass
+//
+// 参数：
+// msgId	群发消息后返回的消息id
+//
+// 返回：
+// 成功返回 { "msg_id":201053012, "msg_status":"SEND_SUCCESS" }
+// 失败返回 { "errcode":40001,"errmsg":"invalid credential"}
+func GetMass(wcctx *WechatCtx) ([]byte, error) {
+	msgId, err := strconv.ParseInt(wcctx.GetFormValue("msgId"), 10, 64)
+	if err != nil {
+		return []byte{}, errors.New("错误的消息id")
+	}
+	return Result(wechat.GetMass(wcctx.AccessToken(), msgId))
+}
+
+// DeleteMass
+//
+// 参数：
+// msgId		群发消息后返回的消息id
+// articleIdx	要删除的文章在图文消息中的位置，不填或填0会删除全部文章
+//
+// 返回：
+// 成功返回 { "msg_id":201053012, "status":"DELETED" }
+// 失败返回 { "errcode":40001,"errmsg":"invalid credential"}
+func DeleteMass(wcctx *WechatCtx) ([]byte, error) {
+	msgId, err := strconv.ParseInt(wcctx.GetFormValue("msgId"), 10, 64)
+	if err != nil {
+		return []byte{}, errors.New("错误的消息id")
+	}
+	articleIdx, _ := strconv.Atoi(wcctx.GetFormValue("articleIdx"))
+
+	err = wechat.DeleteMass(wcctx.AccessToken(), msgId, articleIdx)
+	if err == nil && articleIdx == 0 {
+		Exec("update wx_mass_job set status = 'DELETED' where acid = ? and msg_id = ?", wcctx.AccountId(), msgId)
+	}
+
+	return Result(map[string]interface{}{"msg_id": msgId, "status": "DELETED"}, err)
+}
+
+// GetMassSpeed
+//
+// 返回：
+// 成功返回 { "speed":3, "realspeed":15 }
+// 失败返回 { "errcode":40001,"errmsg":"invalid credential"}
+func GetMassSpeed(wcctx *WechatCtx) ([]byte, error) {
+	return Result(wechat.GetMassSpeed(wcctx.AccessToken()))
+}
+
+// SetMassSpeed
+//
+// 参数：
+// speed	群发速度的级别，0到4
+//
+// 返回：
+// 成功返回 { "speed":1 }
+// 失败返回 { "errcode":45083,"errmsg":"invalid speed"}
+func SetMassSpeed(wcctx *WechatCtx) ([]byte, error) {
+	speed, err := strconv.Atoi(wcctx.GetFormValue("speed"))
+	if err != nil || speed < 0 || speed > 4 {
+		return []byte{}, errors.New("错误的群发速度")
+	}
+	return Result(map[string]int{"speed": speed}, wechat.SetMassSpeed(wcctx.AccessToken(), speed))
+}
+
+// GetMassJob
+//
+// 参数：
+// msgId	群发消息后返回的消息id，为空时返回最近的任务
+// page		页码，从1开始
+// pageSize	每页数量，默认20
+//
+// 返回：
+// 成功返回 [{ "msg_id":34182, "status":"send success", "total_count":100, "filter_count":80, "sent_count":75, "error_count":5, ... }]
+func GetMassJob(wcctx *WechatCtx) ([]byte, error) {
+	if msgId := wcctx.GetFormValue("msgId"); msgId != "" {
+		jobs, _ := Query("select * from wx_mass_job where acid = ? and msg_id = ?", wcctx.AccountId(), msgId)
+		return json.Marshal(jobs)
+	}
+
+	page, pageSize := wcctx.Pagination()
+	jobs, _ := Query("select * from wx_mass_job where acid = ? order by id desc limit ?, ?",
+		wcctx.AccountId(), (page-1)*pageSize, pageSize)
+	return json.Marshal(jobs)
+}
+
+// CreateMassJob 记录群发任务
+func CreateMassJob(accountId int, result wechat.MassResult, msgType string, target string, tagId int64) {
+	Exec("insert into wx_mass_job (acid, msg_id, msg_data_id, msg_type, target, tag_id, status) values (?, ?, ?, ?, ?, ?, 'SENDING')",
+		accountId, result.MsgId, result.MsgDataId, msgType, target, tagId)
+}
+
+// FinishMassJob 根据 MASSSENDJOBFINISH 事件更新群发任务的状态与数量
+func FinishMassJob(accountId int, msgId int64, status string, totalCount, filterCount, sentCount, errorCount int64) {
+	Exec("update wx_mass_job set status = ?, total_count = ?, filter_count = ?, sent_count = ?, error_count = ? where acid = ? and msg_id = ?",
+		status, totalCount, filterCount, sentCount, errorCount, accountId, msgId)
+}
+
+func massMessage(wcctx *WechatCtx) wechat.MassMessage {
+	msg := wechat.NewMassMessage(wcctx.GetFormValue("msgType"), wcctx.GetFormValue("content"))
+	if wcctx.GetFormValue("sendIgnoreReprint") == "1" {
+		msg.SendIgnoreReprint = 1
+	}
+	msg.ClientMsgId = wcctx.GetFormValue("clientMsgId")
+	return msg
+}
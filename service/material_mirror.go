@@ -0,0 +1,290 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chenhg5/go-wechat/sdk"
+)
+
+// 永久素材本地镜像，wx_material 保存素材库的元数据用于搜索，
+// 配置 MATERIAL_DIR 时同时把图片、语音与视频文件下载到 MATERIAL_DIR/{accountId}/ 下。
+// 同步按类型遍历 batchget_material，新增的素材计入 added，本次没有同步到的素材标记为已删除
+
+const (
+	MATERIAL_SYNC_LOCK_PREFIX = "go-wechat:material_sync:"
+	MATERIAL_SYNC_LOCK_TTL    = 10 * time.Minute
+	MATERIAL_BATCH_COUNT      = 20 // batchget_material 每次最多20个
+)
+
+var ErrMaterialSyncRunning = errors.New("素材同步进行中")
+
+var materialTypes = []string{wechat.MEDIA_TYPE_IMAGE, wechat.MEDIA_TYPE_VIDEO, wechat.MEDIA_TYPE_VOICE, wechat.MEDIA_TYPE_NEWS}
+
+func InitMaterialSync() {
+	hours := GetEnvInt("MATERIAL_SYNC_INTERVAL", 24)
+	if hours <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(time.Duration(hours) * time.Hour) {
+			for accountId := range Account {
+				if err := SyncMaterialMirror(accountId); err != nil && err != ErrMaterialSyncRunning {
+					LogError(err)
+				}
+			}
+		}
+	}()
+}
+
+// SyncMaterialMirror 全量同步账号的永久素材，进度记录在 wx_material_sync
+func SyncMaterialMirror(accountId int) (err error) {
+	lockKey := MATERIAL_SYNC_LOCK_PREFIX + strconv.Itoa(accountId)
+	if !RedisClient.SetNX(lockKey, 1, MATERIAL_SYNC_LOCK_TTL) {
+		return ErrMaterialSyncRunning
+	}
+	defer RedisClient.Del(lockKey)
+
+	now, _ := Query("select now() as now")
+	startedAt := now[0]["now"].(string)
+	Exec("insert into wx_material_sync (acid, status, total, added, deleted, error, started_at) values (?, 'running', 0, 0, 0, '', ?) "+
+		"on duplicate key update status = 'running', total = 0, added = 0, deleted = 0, error = '', started_at = values(started_at)",
+		accountId, startedAt)
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("material sync panic: %v", r)
+		}
+		if err != nil {
+			Exec("update wx_material_sync set status = 'failed', error = ? where acid = ?", truncateError(err), accountId)
+		} else {
+			Exec("update wx_material_sync set status = 'success' where acid = ?", accountId)
+		}
+	}()
+
+	// 只有用该账号自己的 access_token 取得的完整列表才能用于下面的删除标记
+	if GetAccountToken(accountId) == "" {
+		return NoAccountTokenError(accountId)
+	}
+
+	total, added := 0, 0
+	for _, mediaType := range materialTypes {
+		for offset := 0; ; offset += MATERIAL_BATCH_COUNT {
+			list, err := wechat.BatchGetMaterial(GetAccountToken(accountId), mediaType, offset, MATERIAL_BATCH_COUNT)
+			if err != nil {
+				return err
+			}
+			for _, item := range list.Item {
+				if SaveMaterial(accountId, mediaType, item) {
+					added++
+				}
+			}
+
+			total += len(list.Item)
+			Exec("update wx_material_sync set total = ?, added = ? where acid = ?", total, added, accountId)
+			RedisClient.RedisCon.Expire(lockKey, MATERIAL_SYNC_LOCK_TTL)
+
+			if len(list.Item) == 0 || int64(offset+len(list.Item)) >= list.TotalCount {
+				break
+			}
+		}
+	}
+
+	// 本次没有同步到的素材已在公众平台删除
+	deleted, _ := Query("select id, local_path from wx_material where acid = ? and deleted = 0 and synced_at < ?", accountId, startedAt)
+	for _, material := range deleted {
+		Exec("update wx_material set deleted = 1 where id = ?", material["id"])
+		if localPath := material["local_path"].(string); localPath != "" {
+			os.Remove(localPath)
+		}
+	}
+	Exec("update wx_material_sync set deleted = ? where acid = ?", len(deleted), accountId)
+
+	return nil
+}
+
+// SaveMaterial 写入素材元数据，配置 MATERIAL_DIR 时下载新增或更新的素材文件，返回是否为新增素材
+func SaveMaterial(accountId int, mediaType string, item wechat.MaterialItem) bool {
+	var (
+		titles  []string
+		digests []string
+		content string
+	)
+	if item.Content != nil {
+		for _, news := range item.Content.NewsItem {
+			titles = append(titles, news.Title)
+			digests = append(digests, news.Digest)
+		}
+		data, _ := json.Marshal(item.Content.NewsItem)
+		content = string(data)
+	}
+
+	materials, _ := Query("select update_time, local_path from wx_material where acid = ? and media_id = ?", accountId, item.MediaId)
+	Exec("insert into wx_material (acid, media_id, type, name, title, digest, url, content, update_time, deleted, synced_at) "+
+		"values (?, ?, ?, ?, ?, ?, ?, ?, ?, 0, now()) on duplicate key update name = values(name), title = values(title), "+
+		"digest = values(digest), url = values(url), content = values(content), update_time = values(update_time), deleted = 0, synced_at = now()",
+		accountId, item.MediaId, mediaType, item.Name, strings.Join(titles, "\n"), strings.Join(digests, "\n"),
+		item.Url, content, item.UpdateTime)
+
+	dir := GetEnvString("MATERIAL_DIR", "")
+	if dir != "" && mediaType != wechat.MEDIA_TYPE_NEWS &&
+		(len(materials) == 0 || materials[0]["update_time"].(int64) != item.UpdateTime || materials[0]["local_path"].(string) == "") {
+		localPath, err := DownloadMaterialFile(accountId, filepath.Join(dir, strconv.Itoa(accountId)), mediaType, item)
+		if err != nil {
+			LogError(err)
+		} else {
+			Exec("update wx_material set local_path = ? where acid = ? and media_id = ?", localPath, accountId, item.MediaId)
+		}
+	}
+
+	return len(materials) == 0
+}
+
+// DownloadMaterialFile 下载素材文件到 dir 下，视频素材从 down_url 下载，先写入临时文件再重命名
+func DownloadMaterialFile(accountId int, dir string, mediaType string, item wechat.MaterialItem) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	body, info, err := wechat.OpenMaterial(GetAccountToken(accountId), item.MediaId)
+	if err != nil {
+		return "", err
+	}
+	if body == nil {
+		if info.DownUrl == "" {
+			return "", errors.New("素材没有文件: " + item.MediaId)
+		}
+		res, err := http.Get(info.DownUrl)
+		if err != nil {
+			return "", err
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return "", errors.New("网络错误")
+		}
+		body = res.Body
+	}
+	defer body.Close()
+
+	ext := path.Ext(info.FileName)
+	if ext == "" {
+		ext = path.Ext(item.Name)
+	}
+	if ext == "" && mediaType == wechat.MEDIA_TYPE_VIDEO {
+		ext = ".mp4"
+	}
+	localPath := filepath.Join(dir, item.MediaId+ext)
+
+	f, err := os.Create(localPath + ".tmp")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		os.Remove(localPath + ".tmp")
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(localPath + ".tmp")
+		return "", err
+	}
+	return localPath, os.Rename(localPath+".tmp", localPath)
+}
+
+// SyncMaterials 开始同步永久素材，同步在后台进行，通过 GetMaterialSyncStatus 查询进度
+//
+// 返回：
+// 成功返回 { "status":"running" }
+func SyncMaterials(wcctx *WechatCtx) ([]byte, error) {
+	accountId := wcctx.AccountId()
+	if lock, _ := RedisClient.Get(MATERIAL_SYNC_LOCK_PREFIX + strconv.Itoa(accountId)); lock != "" {
+		return []byte{}, ErrMaterialSyncRunning
+	}
+
+	go func() {
+		if err := SyncMaterialMirror(accountId); err != nil {
+			LogError(err)
+		}
+	}()
+	return json.Marshal(map[string]string{"status": "running"})
+}
+
+// GetMaterialSyncStatus
+//
+// 返回：
+// 成功返回 { "acid":1, "status":"success", "total":320, "added":3, "deleted":1, "error":"", "started_at":"2018-06-12 15:06:50", "updated_at":"2018-06-12 15:07:20" }
+func GetMaterialSyncStatus(wcctx *WechatCtx) ([]byte, error) {
+	status, _ := Query("select * from wx_material_sync where acid = ?", wcctx.AccountId())
+	if len(status) == 0 {
+		return json.Marshal(map[string]string{"status": "never"})
+	}
+	return json.Marshal(status[0])
+}
+
+// ListMaterials
+//
+// 参数：
+// type		素材类型，image、video、voice、news，为空时不限
+// deleted	为1时只返回已删除的素材
+// page		页码
+// pageSize	每页数量
+//
+// 返回：
+// 成功返回 { "total":320, "materials":[ { "media_id":"...", "type":"image", "name":"a.jpg", "url":"...", "local_path":"...", "update_time":1528787210, ... } ] }
+func ListMaterials(wcctx *WechatCtx) ([]byte, error) {
+	return queryMaterials(wcctx, "")
+}
+
+// SearchMaterials 按名称、图文标题与摘要搜索素材
+//
+// 参数：
+// keyword	关键词
+// type		素材类型，为空时不限
+// page		页码
+// pageSize	每页数量
+//
+// 返回：
+// 成功返回 { "total":2, "materials":[...] }
+func SearchMaterials(wcctx *WechatCtx) ([]byte, error) {
+	keyword := strings.TrimSpace(wcctx.GetFormValue("keyword"))
+	if keyword == "" {
+		return []byte{}, errors.New("错误的关键词")
+	}
+	return queryMaterials(wcctx, keyword)
+}
+
+func queryMaterials(wcctx *WechatCtx, keyword string) ([]byte, error) {
+	where := []string{"acid = ?", "deleted = ?"}
+	deleted := 0
+	if wcctx.GetFormValue("deleted") == "1" {
+		deleted = 1
+	}
+	args := []interface{}{wcctx.AccountId(), deleted}
+
+	if mediaType := wcctx.GetFormValue("type"); mediaType != "" {
+		where = append(where, "type = ?")
+		args = append(args, mediaType)
+	}
+	if keyword != "" {
+		like := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(keyword) + "%"
+		where = append(where, "(name like ? or title like ? or digest like ?)")
+		args = append(args, like, like, like)
+	}
+
+	condition := strings.Join(where, " and ")
+	total, _ := Query("select count(*) as total from wx_material where "+condition, args...)
+
+	page, pageSize := wcctx.Pagination()
+	materials, _ := Query("select media_id, type, name, title, digest, url, local_path, update_time, deleted, synced_at "+
+		"from wx_material where "+condition+" order by update_time desc limit ?, ?", append(args, (page-1)*pageSize, pageSize)...)
+
+	return json.Marshal(map[string]interface{}{"total": total[0]["total"], "materials": materials})
+}
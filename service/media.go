@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"strconv"
+
+	"github.com/chenhg5/go-wechat/sdk"
+	"github.com/valyala/fasthttp"
+)
+
+// 临时素材与永久素材，上传的文件通过 multipart 表单最后的 media 字段传入，
+// 下载通过 GET /media 流式返回文件内容，不经过 /call 的json包装
+
+// mediaFile 读取表单中 media 字段的文件，文件直接从请求体边读边上传，需要放在表单的最后
+func mediaFile(wcctx *WechatCtx, upload func(file wechat.MediaFile) ([]byte, error)) ([]byte, error) {
+	part, err := wcctx.FormFile("media")
+	if err != nil {
+		return []byte{}, errors.New("错误的文件")
+	}
+	return upload(wechat.MediaFile{Name: part.FileName(), Reader: part})
+}
+
+// UploadMedia
+//
+// 参数：
+// type		媒体文件类型，image、voice、video、thumb
+// media	文件
+//
+// 返回：
+// 成功返回 { "type":"image", "media_id":"MEDIA_ID", "created_at":123456789 }
+// 失败返回 { "errcode":40004,"errmsg":"invalid media type"}
+func UploadMedia(wcctx *WechatCtx) ([]byte, error) {
+	return mediaFile(wcctx, func(file wechat.MediaFile) ([]byte, error) {
+		return Result(wechat.UploadMedia(wcctx.AccessToken(), wcctx.GetFormValue("type"), file))
+	})
+}
+
+// UploadArticleImage 上传图文消息内的图片，jpg或png，1M以下
+//
+// 参数：
+// media	文件
+//
+// 返回：
+// 成功返回 { "url":"http://mmbiz.qpic.cn/mmbiz/..." }
+func UploadArticleImage(wcctx *WechatCtx) ([]byte, error) {
+	return mediaFile(wcctx, func(file wechat.MediaFile) ([]byte, error) {
+		url, err := wechat.UploadArticleImage(wcctx.AccessToken(), file)
+		return Result(map[string]string{"url": url}, err)
+	})
+}
+
+// AddMaterial
+//
+// 参数：
+// type			媒体文件类型，image、voice、video、thumb
+// media		文件
+// title		视频素材的标题
+// introduction	视频素材的描述
+//
+// 返回：
+// 成功返回 { "media_id":MEDIA_ID, "url":URL }
+func AddMaterial(wcctx *WechatCtx) ([]byte, error) {
+	var description *wechat.VideoDescription
+	if wcctx.GetFormValue("type") == wechat.MEDIA_TYPE_VIDEO {
+		if wcctx.GetFormValue("title") == "" {
+			return []byte{}, errors.New("视频素材需要标题")
+		}
+		description = &wechat.VideoDescription{
+			Title:        wcctx.GetFormValue("title"),
+			Introduction: wcctx.GetFormValue("introduction"),
+		}
+	}
+
+	return mediaFile(wcctx, func(file wechat.MediaFile) ([]byte, error) {
+		return Result(wechat.AddMaterial(wcctx.AccessToken(), wcctx.GetFormValue("type"), file, description))
+	})
+}
+
+// GetMaterial 获取图文与视频永久素材的信息，其他类型的文件通过 GET /media?source=material 下载
+//
+// 参数：
+// mediaId	素材id
+//
+// 返回：
+// 成功返回 { "news_item":[...] } 或 { "title":TITLE, "description":DESCRIPTION, "down_url":DOWN_URL }
+func GetMaterial(wcctx *WechatCtx) ([]byte, error) {
+	body, info, err := wechat.OpenMaterial(wcctx.AccessToken(), wcctx.GetFormValue("mediaId"))
+	if body != nil {
+		body.Close()
+		return []byte{}, errors.New("请通过 /media 下载文件素材")
+	}
+	return Result(info, err)
+}
+
+// DelMaterial
+//
+// 参数：
+// mediaId	素材id
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func DelMaterial(wcctx *WechatCtx) ([]byte, error) {
+	return Result(wechat.CommonError{ErrMsg: "ok"}, wechat.DelMaterial(wcctx.AccessToken(), wcctx.GetFormValue("mediaId")))
+}
+
+// GetMaterialCount
+//
+// 返回：
+// 成功返回 { "voice_count":COUNT, "video_count":COUNT, "image_count":COUNT, "news_count":COUNT }
+func GetMaterialCount(wcctx *WechatCtx) ([]byte, error) {
+	return Result(wechat.GetMaterialCount(wcctx.AccessToken()))
+}
+
+// BatchGetMaterial
+//
+// 参数：
+// type		素材类型，image、video、voice、news
+// offset	从全部素材的该偏移位置开始返回，0表示从第一个素材返回
+// count	返回素材的数量，取值在1到20之间
+//
+// 返回：
+// 成功返回 { "total_count":TOTAL_COUNT, "item_count":ITEM_COUNT, "item":[...] }
+func BatchGetMaterial(wcctx *WechatCtx) ([]byte, error) {
+	offset, _ := strconv.Atoi(wcctx.GetFormValue("offset"))
+	count, _ := strconv.Atoi(wcctx.GetFormValue("count"))
+	return Result(wechat.BatchGetMaterial(wcctx.AccessToken(), wcctx.GetFormValue("type"), offset, count))
+}
+
+// MediaDownload 下载素材，GET /media?accountId=1&mediaId=MEDIA_ID&source=temp，需要客户端凭证
+//
+// source 为 temp 临时素材(默认)，jssdk 高清语音，material 永久素材，qrcode 带参数二维码(mediaId 为 ticket)，
+// archive 归档消息下载到本地的媒体文件(mediaId 为消息id)。除 qrcode 外都只能读取 accountId 账号的素材。
+// 文件直接作为响应体返回，临时视频素材与永久图文、视频素材返回json
+func MediaDownload(wcctx *WechatCtx) {
+
+	defer handle(wcctx)
+
+	if !wcctx.Authorized() {
+		wcctx.Ctx.Response.Header.Set("WWW-Authenticate", `Basic realm="go-wechat"`)
+		wcctx.Json(fasthttp.StatusUnauthorized, "错误的客户端凭证", "")
+		return
+	}
+
+	args := wcctx.Ctx.QueryArgs()
+	mediaId := string(args.Peek("mediaId"))
+	if mediaId == "" {
+		wcctx.Json(fasthttp.StatusBadRequest, "错误的参数", "")
+		return
+	}
+	// 除带参数二维码外都按 accountId 读取该账号的素材
+	source := string(args.Peek("source"))
+	accountId, _ := strconv.Atoi(string(args.Peek("accountId")))
+	if wcctx.Account = GetAccountInfo(accountId); wcctx.Account == nil && source != "qrcode" {
+		wcctx.Json(fasthttp.StatusBadRequest, "错误的账号", "")
+		return
+	}
+
+	var (
+		body  io.ReadCloser
+		info  interface{}
+		media wechat.MediaInfo
+		err   error
+	)
+	switch source {
+	case "", "temp":
+		body, media, err = wechat.OpenMedia(wcctx.AccessToken(), mediaId)
+		info = media
+	case "jssdk":
+		body, media, err = wechat.OpenJssdkMedia(wcctx.AccessToken(), mediaId)
+		info = media
+	case "material":
+		var material wechat.MaterialInfo
+		body, material, err = wechat.OpenMaterial(wcctx.AccessToken(), mediaId)
+		media, info = material.MediaInfo, material
+	case "qrcode":
+		body, media, err = wechat.OpenQrcode(mediaId)
+		info = media
+	case "archive":
+		body, media, err = OpenArchiveMedia(wcctx.AccountId(), mediaId)
+		if err != nil {
+			wcctx.Json(fasthttp.StatusNotFound, err.Error(), "")
+			return
+		}
+	default:
+		wcctx.Json(fasthttp.StatusBadRequest, "错误的参数", "")
+		return
+	}
+
+	if err != nil {
+		data, _ := Result(nil, err)
+		wcctx.Json(fasthttp.StatusBadGateway, "微信接口错误", string(data))
+		return
+	}
+
+	if body == nil {
+		data, _ := json.Marshal(info)
+		wcctx.Json(fasthttp.StatusOK, "ok", string(data))
+		return
+	}
+
+	wcctx.Ctx.SetContentType(media.ContentType)
+	if media.FileName != "" {
+		wcctx.Ctx.Response.Header.Set("Content-Disposition",
+			mime.FormatMediaType("attachment", map[string]string{"filename": media.FileName}))
+	}
+	// fasthttp 发送完成后关闭 body
+	wcctx.Ctx.SetBodyStream(body, int(media.Size))
+}
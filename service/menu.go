@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/chenhg5/go-wechat/sdk"
+)
+
+// 自定义菜单与个性化菜单，上传前在本地校验按钮数量、标题长度与各类型的必填字段，
+// 校验失败返回 { "path":"button[0].name", "reason":"name exceeds 16 bytes" }
+
+// CreateMenu
+//
+// 参数：
+// menu		菜单json，如 {"button":[{"type":"click","name":"今日歌曲","key":"V1001_TODAY_MUSIC"}]}
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+// 失败返回 { "errcode":40018,"errmsg":"invalid button name size"}
+func CreateMenu(wcctx *WechatCtx) ([]byte, error) {
+	var menu wechat.Menu
+	if err := json.Unmarshal([]byte(wcctx.GetFormValue("menu")), &menu); err != nil {
+		return []byte{}, errors.New("错误的菜单")
+	}
+	return Result(wechat.CommonError{ErrMsg: "ok"}, wechat.CreateMenu(wcctx.AccessToken(), menu))
+}
+
+// GetMenu
+//
+// 返回：
+// 成功返回 { "menu":{ "button":[...], "menuid":"208396938" }, "conditionalmenu":[ { "button":[...], "matchrule":{...}, "menuid":"208396993" } ] }
+// 失败返回 { "errcode":46003,"errmsg":"menu no exist"}
+func GetMenu(wcctx *WechatCtx) ([]byte, error) {
+	return Result(wechat.GetMenu(wcctx.AccessToken()))
+}
+
+// DeleteMenu 删除菜单，同时删除所有个性化菜单
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func DeleteMenu(wcctx *WechatCtx) ([]byte, error) {
+	return Result(wechat.CommonError{ErrMsg: "ok"}, wechat.DeleteMenu(wcctx.AccessToken()))
+}
+
+// GetCurrentSelfMenuInfo
+//
+// 返回：
+// 成功返回 { "is_menu_open":1, "selfmenu_info":{ "button":[...] } }
+func GetCurrentSelfMenuInfo(wcctx *WechatCtx) ([]byte, error) {
+	return Result(wechat.GetCurrentSelfMenuInfo(wcctx.AccessToken()))
+}
+
+// AddConditionalMenu
+//
+// 参数：
+// menu		菜单json，需包含 matchrule，如 {"button":[...],"matchrule":{"tag_id":"2"}}
+//
+// 返回：
+// 成功返回 { "menuid":"208379533" }
+// 失败返回 { "errcode":65303,"errmsg":"there is no selfmenu, please create selfmenu first"}
+func AddConditionalMenu(wcctx *WechatCtx) ([]byte, error) {
+	var menu wechat.Menu
+	if err := json.Unmarshal([]byte(wcctx.GetFormValue("menu")), &menu); err != nil {
+		return []byte{}, errors.New("错误的菜单")
+	}
+
+	menuId, err := wechat.AddConditionalMenu(wcctx.AccessToken(), menu)
+	return Result(map[string]wechat.MenuId{"menuid": menuId}, err)
+}
+
+// DelConditionalMenu
+//
+// 参数：
+// menuId	个性化菜单id
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+// 失败返回 { "errcode":65301,"errmsg":"no such menu"}
+func DelConditionalMenu(wcctx *WechatCtx) ([]byte, error) {
+	return Result(wechat.CommonError{ErrMsg: "ok"},
+		wechat.DelConditionalMenu(wcctx.AccessToken(), wechat.MenuId(wcctx.GetFormValue("menuId"))))
+}
+
+// TryMatchMenu
+//
+// 参数：
+// userId	粉丝的OpenID或微信号
+//
+// 返回：
+// 成功返回 { "button":[ { "type":"view", "name":"tx", "url":"http://www.qq.com/" } ] }
+// 失败返回 { "errcode":65304,"errmsg":"match rule empty"}
+func TryMatchMenu(wcctx *WechatCtx) ([]byte, error) {
+	return Result(wechat.TryMatchMenu(wcctx.AccessToken(), wcctx.GetFormValue("userId")))
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/chenhg5/go-wechat/sdk"
+	"gopkg.in/yaml.v2"
+)
+
+// 菜单即代码，菜单定义为 json 或 yaml，格式与 menu/get 的返回相同：
+//
+// menu:
+//   button:
+//     - { type: click, name: 今日歌曲, key: V1001_TODAY_MUSIC }
+// conditionalmenu:
+//   - button: [ ... ]
+//     matchrule: { tag_id: "2" }
+//
+// 定义可以放在代码仓库中通过命令行同步，也可以通过 SaveMenuDefinition 保存在 wx_menu_definition 中，
+// 每次同步都在 wx_menu_version 中记录一个版本，用于回滚。同步前当前菜单与最近的版本不同时(首次同步或在官网修改过)，
+// 先把当前菜单记录为 snapshot 版本；同步中途失败时记录 failed 版本，保存失败后实际的菜单
+
+// ParseMenuDefinition 解析 json 或 yaml 格式的菜单定义，顶层直接为 button 时视为只有默认菜单
+func ParseMenuDefinition(data []byte) (wechat.MenuInfo, error) {
+	var (
+		info wechat.MenuInfo
+		raw  interface{}
+	)
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return info, err
+	}
+
+	definition, ok := normalizeYaml(raw).(map[string]interface{})
+	if !ok {
+		return info, errors.New("错误的菜单定义")
+	}
+	if _, ok := definition["menu"]; !ok {
+		definition = map[string]interface{}{"menu": definition}
+	}
+
+	normalized, err := json.Marshal(definition)
+	if err != nil {
+		return info, err
+	}
+	err = json.Unmarshal(normalized, &info)
+	return info, err
+}
+
+// normalizeYaml 将 yaml 解析出的 map[interface{}]interface{} 转为可序列化为 json 的结构，
+// 菜单中的字段都是字符串，数字与布尔值也转为字符串，如 tag_id: 2
+func normalizeYaml(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			m[fmt.Sprint(k)] = normalizeYaml(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range value {
+			value[i] = normalizeYaml(item)
+		}
+		return value
+	case string, nil:
+		return value
+	}
+	return fmt.Sprint(v)
+}
+
+// ValidateMenuDefinition 校验默认菜单与所有个性化菜单
+func ValidateMenuDefinition(info wechat.MenuInfo) error {
+	if len(info.Menu.Button) > 0 {
+		if err := info.Menu.Validate(); err != nil {
+			menuError := err.(*wechat.MenuError)
+			return &wechat.MenuError{Path: "menu." + menuError.Path, Reason: menuError.Reason}
+		}
+	} else if len(info.ConditionalMenu) > 0 {
+		return &wechat.MenuError{Path: "menu", Reason: "conditional menu requires default menu"}
+	}
+
+	// 对比与回滚按匹配规则对应个性化菜单，规则不能重复
+	rules := map[wechat.MatchRule]int{}
+	for i, menu := range info.ConditionalMenu {
+		if menu.MatchRule == nil {
+			return &wechat.MenuError{Path: "conditionalmenu[" + strconv.Itoa(i) + "].matchrule", Reason: "matchrule is required for conditional menu"}
+		}
+		if j, ok := rules[*menu.MatchRule]; ok {
+			return &wechat.MenuError{Path: "conditionalmenu[" + strconv.Itoa(i) + "].matchrule", Reason: "matchrule duplicates conditionalmenu[" + strconv.Itoa(j) + "]"}
+		}
+		rules[*menu.MatchRule] = i
+		if err := menu.Validate(); err != nil {
+			menuError := err.(*wechat.MenuError)
+			return &wechat.MenuError{Path: "conditionalmenu[" + strconv.Itoa(i) + "]." + menuError.Path, Reason: menuError.Reason}
+		}
+	}
+	return nil
+}
+
+// GetCurrentMenu 查询当前菜单，没有菜单时返回空菜单
+func GetCurrentMenu(accessToken string) (wechat.MenuInfo, error) {
+	info, err := wechat.GetMenu(accessToken)
+	if commonError, ok := err.(*wechat.CommonError); ok && commonError.ErrCode == 46003 {
+		return wechat.MenuInfo{}, nil
+	}
+	return info, err
+}
+
+// DiffMenuDefinition 对比账号的当前菜单与菜单定义，返回当前菜单与差异，
+// 菜单使用账号自己的 access_token 查询，版本记录也按账号保存，不能退回使用全局的 access_token
+func DiffMenuDefinition(accountId int, desired wechat.MenuInfo) (wechat.MenuInfo, []string, error) {
+	if err := ValidateMenuDefinition(desired); err != nil {
+		return wechat.MenuInfo{}, nil, err
+	}
+	token := GetAccountToken(accountId)
+	if token == "" {
+		return wechat.MenuInfo{}, nil, NoAccountTokenError(accountId)
+	}
+	current, err := GetCurrentMenu(token)
+	if err != nil {
+		return current, nil, err
+	}
+	return current, wechat.DiffMenu(current, desired), nil
+}
+
+// ApplyMenuDefinition 将菜单定义同步到公众号并记录版本，没有差异时不做任何操作，
+// 个性化菜单先全部删除再按定义重新创建，默认菜单为空时删除所有菜单。
+// 微信没有事务接口，中途失败时菜单只同步了一部分，记录为 failed 版本并返回该版本id，可以回滚到上一个版本
+func ApplyMenuDefinition(accountId int, desired wechat.MenuInfo, source string) ([]string, int64, error) {
+	current, diff, err := DiffMenuDefinition(accountId, desired)
+	if err != nil || len(diff) == 0 {
+		return diff, 0, err
+	}
+
+	SnapshotMenu(accountId, current)
+
+	token := GetAccountToken(accountId)
+	if err := pushMenuDefinition(token, current, desired); err != nil {
+		// 记录失败后实际的菜单，查询失败时记录同步前的菜单
+		actual, getErr := GetCurrentMenu(token)
+		if getErr != nil {
+			actual = current
+		}
+		versionId := recordMenuVersion(accountId, actual, diff, source, err)
+		return diff, versionId, err
+	}
+
+	return diff, recordMenuVersion(accountId, desired, diff, source, nil), nil
+}
+
+// pushMenuDefinition 按定义创建默认菜单与个性化菜单，desired 中的 MenuId 更新为新建的个性化菜单id
+func pushMenuDefinition(accessToken string, current wechat.MenuInfo, desired wechat.MenuInfo) error {
+	if len(desired.Menu.Button) == 0 {
+		return wechat.DeleteMenu(accessToken)
+	}
+
+	if err := wechat.CreateMenu(accessToken, desired.Menu); err != nil {
+		return err
+	}
+	for _, menu := range current.ConditionalMenu {
+		if err := wechat.DelConditionalMenu(accessToken, menu.MenuId); err != nil {
+			return err
+		}
+	}
+	for i, menu := range desired.ConditionalMenu {
+		menuId, err := wechat.AddConditionalMenu(accessToken, menu)
+		if err != nil {
+			return err
+		}
+		desired.ConditionalMenu[i].MenuId = menuId
+	}
+	return nil
+}
+
+// SnapshotMenu 当前菜单与最近成功的版本不同时，把当前菜单记录为 snapshot 版本，保证同步前的菜单可以回滚
+func SnapshotMenu(accountId int, current wechat.MenuInfo) {
+	versions, _ := Query("select menu from wx_menu_version where acid = ? and status = 'success' order by id desc limit 1", accountId)
+	if len(versions) > 0 {
+		var last wechat.MenuInfo
+		if err := json.Unmarshal([]byte(versions[0]["menu"].(string)), &last); err == nil && len(wechat.DiffMenu(last, current)) == 0 {
+			return
+		}
+	}
+	recordMenuVersion(accountId, current, nil, "snapshot", nil)
+}
+
+// recordMenuVersion 记录一个菜单版本，err 不为nil时为中途失败的版本
+func recordMenuVersion(accountId int, info wechat.MenuInfo, diff []string, source string, err error) int64 {
+	status, errMsg := "success", ""
+	if err != nil {
+		status, errMsg = "failed", truncateError(err)
+	}
+	menu, _ := json.Marshal(info)
+	rs := Exec("insert into wx_menu_version (acid, menu, diff, source, status, error) values (?, ?, ?, ?, ?, ?)",
+		accountId, string(menu), strings.Join(diff, "\n"), source, status, errMsg)
+	versionId, _ := rs.LastInsertId()
+	return versionId
+}
+
+// GetMenuVersion 读取已同步的菜单版本，versionId 为0时返回最近一次同步之前的成功版本，
+// 即最近一次同步(包括中途失败的同步)前的菜单
+func GetMenuVersion(accountId int, versionId int64) (wechat.MenuInfo, int64, error) {
+	var (
+		info     wechat.MenuInfo
+		versions []map[string]interface{}
+	)
+	if versionId == 0 {
+		versions, _ = Query("select id, menu from wx_menu_version where acid = ? and status = 'success' "+
+			"and id < (select max(id) from wx_menu_version where acid = ?) order by id desc limit 1", accountId, accountId)
+	} else {
+		versions, _ = Query("select id, menu from wx_menu_version where acid = ? and id = ? and status = 'success'", accountId, versionId)
+	}
+	if len(versions) == 0 {
+		return info, 0, errors.New("菜单版本不存在")
+	}
+
+	err := json.Unmarshal([]byte(versions[0]["menu"].(string)), &info)
+	return info, versions[0]["id"].(int64), err
+}
+
+// GetStoredMenuDefinition 读取保存在 wx_menu_definition 中的菜单定义
+func GetStoredMenuDefinition(accountId int) (wechat.MenuInfo, error) {
+	definitions, _ := Query("select definition from wx_menu_definition where acid = ?", accountId)
+	if len(definitions) == 0 {
+		return wechat.MenuInfo{}, errors.New("菜单定义不存在")
+	}
+	return ParseMenuDefinition([]byte(definitions[0]["definition"].(string)))
+}
+
+// menuDefinition 读取参数 definition 中的菜单定义，为空时使用保存的定义
+func menuDefinition(wcctx *WechatCtx) (wechat.MenuInfo, error) {
+	if definition := wcctx.GetFormValue("definition"); definition != "" {
+		return ParseMenuDefinition([]byte(definition))
+	}
+	return GetStoredMenuDefinition(wcctx.AccountId())
+}
+
+// SaveMenuDefinition
+//
+// 参数：
+// definition	json 或 yaml 格式的菜单定义
+//
+// 返回：
+// 成功返回 { "menu":{ "button":[...] }, "conditionalmenu":[...] }
+// 失败返回 { "path":"menu.button[0].name", "reason":"name exceeds 16 bytes" }
+func SaveMenuDefinition(wcctx *WechatCtx) ([]byte, error) {
+	definition := wcctx.GetFormValue("definition")
+	info, err := ParseMenuDefinition([]byte(definition))
+	if err != nil {
+		return []byte{}, errors.New("错误的菜单定义")
+	}
+	if err := ValidateMenuDefinition(info); err != nil {
+		return Result(nil, err)
+	}
+
+	Exec("insert into wx_menu_definition (acid, definition) values (?, ?) on duplicate key update definition = values(definition)",
+		wcctx.AccountId(), definition)
+	return json.Marshal(info)
+}
+
+// GetMenuDefinition
+//
+// 返回：
+// 成功返回 { "menu":{ "button":[...] }, "conditionalmenu":[...] }
+func GetMenuDefinition(wcctx *WechatCtx) ([]byte, error) {
+	return Result(GetStoredMenuDefinition(wcctx.AccountId()))
+}
+
+// DiffMenu
+//
+// 参数：
+// definition	json 或 yaml 格式的菜单定义，为空时使用保存的定义
+//
+// 返回：
+// 成功返回 { "diff":[ "~ menu.button[0].name: \"今日歌曲\" -> \"每日歌曲\"" ] }
+func DiffMenu(wcctx *WechatCtx) ([]byte, error) {
+	desired, err := menuDefinition(wcctx)
+	if err != nil {
+		return []byte{}, err
+	}
+	_, diff, err := DiffMenuDefinition(wcctx.AccountId(), desired)
+	return Result(map[string][]string{"diff": diff}, err)
+}
+
+// ApplyMenu
+//
+// 参数：
+// definition	json 或 yaml 格式的菜单定义，为空时使用保存的定义
+// dryRun		为1时只返回差异，不同步
+//
+// 返回：
+// 成功返回 { "diff":[...], "version":12 }，没有差异时 version 为0
+func ApplyMenu(wcctx *WechatCtx) ([]byte, error) {
+	desired, err := menuDefinition(wcctx)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	if wcctx.GetFormValue("dryRun") == "1" {
+		_, diff, err := DiffMenuDefinition(wcctx.AccountId(), desired)
+		return Result(map[string]interface{}{"diff": diff, "version": 0}, err)
+	}
+
+	diff, versionId, err := ApplyMenuDefinition(wcctx.AccountId(), desired, "api")
+	return Result(map[string]interface{}{"diff": diff, "version": versionId}, err)
+}
+
+// RollbackMenu
+//
+// 参数：
+// version	回滚到的版本id，为空时回滚到上一个版本
+// dryRun	为1时只返回差异，不同步
+//
+// 返回：
+// 成功返回 { "diff":[...], "version":13 }
+func RollbackMenu(wcctx *WechatCtx) ([]byte, error) {
+	versionId, _ := strconv.ParseInt(wcctx.GetFormValue("version"), 10, 64)
+	desired, versionId, err := GetMenuVersion(wcctx.AccountId(), versionId)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	if wcctx.GetFormValue("dryRun") == "1" {
+		_, diff, err := DiffMenuDefinition(wcctx.AccountId(), desired)
+		return Result(map[string]interface{}{"diff": diff, "version": 0}, err)
+	}
+
+	diff, newVersionId, err := ApplyMenuDefinition(wcctx.AccountId(), desired, "rollback:"+strconv.FormatInt(versionId, 10))
+	return Result(map[string]interface{}{"diff": diff, "version": newVersionId}, err)
+}
+
+// GetMenuVersions
+//
+// 参数：
+// page		页码
+// pageSize	每页数量
+//
+// 返回：
+// 成功返回 [ { "id":12, "diff":"...", "source":"cli:menu.yaml", "status":"success", "error":"", "created_at":"2018-06-12 15:06:50" } ]
+func GetMenuVersions(wcctx *WechatCtx) ([]byte, error) {
+	page, pageSize := wcctx.Pagination()
+	versions, _ := Query("select id, diff, source, status, error, created_at from wx_menu_version where acid = ? order by id desc limit ?, ?",
+		wcctx.AccountId(), (page-1)*pageSize, pageSize)
+	return json.Marshal(versions)
+}
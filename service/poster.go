@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chenhg5/go-wechat/sdk"
+	"github.com/valyala/fasthttp"
+)
+
+// 本地二维码与海报，GET /qrcode 将任意内容编码为二维码图片，GET /poster 按布局合成海报，
+// 与 /media 一样直接返回图片，需要客户端凭证
+
+const (
+	MAX_QRCODE_SIZE         = 2048
+	MAX_POSTER_IMAGE_BYTES  = 5 << 20 // 远程图片最大 5MB
+	MAX_POSTER_IMAGE_PIXELS = 4096    // 远程图片最大宽高
+)
+
+// posterHttpClient 下载二维码与头像，重定向的地址同样要在 POSTER_IMAGE_HOSTS 中
+var posterHttpClient = &http.Client{
+	Timeout: 5 * time.Second,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 3 {
+			return errors.New("重定向次数过多")
+		}
+		return checkImageHost(req.URL)
+	},
+}
+
+var posterNameRe = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+
+var (
+	posters     = map[string]*wechat.Poster{}
+	postersLock sync.Mutex
+	posterFont  wechat.TextRenderer
+	fontOnce    sync.Once
+)
+
+// LoadPosterTemplate 读取 POSTER_DIR 下的 {name}.json 布局，读取后缓存
+func LoadPosterTemplate(name string) (*wechat.Poster, error) {
+	dir := GetEnvString("POSTER_DIR", "")
+	if dir == "" {
+		return nil, errors.New("没有配置海报目录")
+	}
+	if !posterNameRe.MatchString(name) {
+		return nil, errors.New("错误的海报名称")
+	}
+
+	postersLock.Lock()
+	defer postersLock.Unlock()
+	if poster, ok := posters[name]; ok {
+		return poster, nil
+	}
+
+	poster, err := wechat.LoadPoster(filepath.Join(dir, name+".json"))
+	if err != nil {
+		return nil, err
+	}
+	poster.Text = PosterFont()
+	posters[name] = poster
+	return poster, nil
+}
+
+// PosterFont 读取 POSTER_FONT 配置的 BDF 字体，没有配置时返回 nil，海报不绘制昵称
+func PosterFont() wechat.TextRenderer {
+	fontOnce.Do(func() {
+		file := GetEnvString("POSTER_FONT", "")
+		if file == "" {
+			return
+		}
+		font, err := wechat.LoadBDFFont(file)
+		if err != nil {
+			LogError(err)
+			return
+		}
+		posterFont = font
+	})
+	return posterFont
+}
+
+// qrOptions 读取 level、size、margin、foreground 与 background
+func qrOptions(args *fasthttp.Args) (wechat.QrOptions, error) {
+	options := wechat.DefaultQrOptions
+	var err error
+	if options.Level, err = wechat.ParseQrLevel(string(args.Peek("level"))); err != nil {
+		return options, errors.New("错误的纠错等级")
+	}
+	if size := string(args.Peek("size")); size != "" {
+		if options.Size, err = strconv.Atoi(size); err != nil || options.Size <= 0 || options.Size > MAX_QRCODE_SIZE {
+			return options, errors.New("错误的尺寸")
+		}
+	}
+	if margin := string(args.Peek("margin")); margin != "" {
+		if options.Margin, err = strconv.Atoi(margin); err != nil {
+			return options, errors.New("错误的空白")
+		}
+		if options.Margin == 0 {
+			options.Margin = -1
+		}
+	}
+	for name, c := range map[string]*color.Color{"foreground": &options.Foreground, "background": &options.Background} {
+		if value := string(args.Peek(name)); value != "" {
+			rgba, err := wechat.ParseColor(value)
+			if err != nil {
+				return options, errors.New("错误的颜色")
+			}
+			*c = rgba
+		}
+	}
+	return options, nil
+}
+
+// checkImageHost 只允许下载 POSTER_IMAGE_HOSTS 中的域名，默认为微信头像与公众号图片的域名，
+// 防止通过 codeUrl 与 avatar 访问内网地址
+func checkImageHost(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("错误的图片地址")
+	}
+	hosts := GetEnvString("POSTER_IMAGE_HOSTS", "thirdwx.qlogo.cn,wx.qlogo.cn,mmbiz.qpic.cn")
+	for _, host := range strings.Split(hosts, ",") {
+		if strings.TrimSpace(host) == u.Hostname() {
+			return nil
+		}
+	}
+	return errors.New("不允许的图片域名: " + u.Hostname())
+}
+
+// fetchImage 下载并解码远程图片，限制域名、大小与宽高，宽高在解码前通过图片头检查
+func fetchImage(rawUrl string) (image.Image, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, errors.New("错误的图片地址")
+	}
+	if err := checkImageHost(u); err != nil {
+		return nil, err
+	}
+
+	res, err := posterHttpClient.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New("下载图片失败: " + rawUrl)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, MAX_POSTER_IMAGE_BYTES+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MAX_POSTER_IMAGE_BYTES {
+		return nil, errors.New("图片过大: " + rawUrl)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width > MAX_POSTER_IMAGE_PIXELS || config.Height > MAX_POSTER_IMAGE_PIXELS {
+		return nil, errors.New("图片尺寸过大: " + rawUrl)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// QrcodeImage 生成二维码图片，GET /qrcode?content=CONTENT&format=png
+//
+// 参数：
+// content		二维码内容，如支付的 code_url、短链接、网页授权链接
+// format		png(默认)或 svg
+// level		纠错等级 L、M(默认)、Q、H
+// size			图片宽度(像素)，默认256，最大2048
+// margin		四周空白的模块数，默认4
+// foreground	深色模块颜色，如 #000000
+// background	背景颜色，如 #ffffff，#ffffff00 为透明
+func QrcodeImage(wcctx *WechatCtx) {
+
+	defer handle(wcctx)
+
+	if !wcctx.Authorized() {
+		wcctx.Ctx.Response.Header.Set("WWW-Authenticate", `Basic realm="go-wechat"`)
+		wcctx.Json(fasthttp.StatusUnauthorized, "错误的客户端凭证", "")
+		return
+	}
+
+	args := wcctx.Ctx.QueryArgs()
+	content := string(args.Peek("content"))
+	if content == "" {
+		wcctx.Json(fasthttp.StatusBadRequest, "错误的参数", "")
+		return
+	}
+	options, err := qrOptions(args)
+	if err != nil {
+		wcctx.Json(fasthttp.StatusBadRequest, err.Error(), "")
+		return
+	}
+
+	var data []byte
+	switch string(args.Peek("format")) {
+	case "", "png":
+		data, err = wechat.QrPNG(content, options)
+		wcctx.Ctx.SetContentType("image/png")
+	case "svg":
+		data, err = wechat.QrSVG(content, options)
+		wcctx.Ctx.SetContentType("image/svg+xml")
+	default:
+		wcctx.Json(fasthttp.StatusBadRequest, "错误的参数", "")
+		return
+	}
+	if err == wechat.ErrQrTooLong {
+		wcctx.Json(fasthttp.StatusBadRequest, "内容过长", "")
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	wcctx.Ctx.SetBody(data)
+}
+
+// PosterImage 合成海报，GET /poster?name=NAME&content=CONTENT&avatar=AVATAR&nickname=NICKNAME
+//
+// 参数：
+// name			海报布局，POSTER_DIR 下的 {name}.json
+// content		二维码内容，本地生成二维码，纠错等级等参数与 /qrcode 相同
+// ticket		带参数二维码的 ticket，没有 content 时通过 showqrcode 获取二维码
+// codeUrl		小程序码等图片的地址，没有 content 与 ticket 时使用
+// accountId	与 openid 一起从关注者本地镜像读取头像与昵称
+// openid		用户的 openid
+// avatar		头像地址，覆盖本地镜像中的头像
+// nickname		昵称，覆盖本地镜像中的昵称
+// format		png(默认)或 jpeg
+func PosterImage(wcctx *WechatCtx) {
+
+	defer handle(wcctx)
+
+	if !wcctx.Authorized() {
+		wcctx.Ctx.Response.Header.Set("WWW-Authenticate", `Basic realm="go-wechat"`)
+		wcctx.Json(fasthttp.StatusUnauthorized, "错误的客户端凭证", "")
+		return
+	}
+
+	args := wcctx.Ctx.QueryArgs()
+	poster, err := LoadPosterTemplate(string(args.Peek("name")))
+	if err != nil {
+		wcctx.Json(fasthttp.StatusBadRequest, err.Error(), "")
+		return
+	}
+
+	var code image.Image
+	switch {
+	case len(args.Peek("content")) > 0:
+		options, err := qrOptions(args)
+		if err != nil {
+			wcctx.Json(fasthttp.StatusBadRequest, err.Error(), "")
+			return
+		}
+		if code, err = wechat.QrImage(string(args.Peek("content")), options); err != nil {
+			wcctx.Json(fasthttp.StatusBadRequest, "内容过长", "")
+			return
+		}
+	case len(args.Peek("ticket")) > 0:
+		body, _, err := wechat.OpenQrcode(string(args.Peek("ticket")))
+		if err == nil {
+			code, _, err = image.Decode(body)
+			body.Close()
+		}
+		if err != nil {
+			data, _ := Result(nil, err)
+			wcctx.Json(fasthttp.StatusBadGateway, "微信接口错误", string(data))
+			return
+		}
+	case len(args.Peek("codeUrl")) > 0:
+		if code, err = fetchImage(string(args.Peek("codeUrl"))); err != nil {
+			wcctx.Json(fasthttp.StatusBadGateway, err.Error(), "")
+			return
+		}
+	}
+
+	avatarUrl, nickname := "", ""
+	if openId := string(args.Peek("openid")); openId != "" {
+		accountId, _ := strconv.Atoi(string(args.Peek("accountId")))
+		users, _ := Query("select headimgurl, nickname from wx_user where acid = ? and openid = ?", accountId, openId)
+		if len(users) > 0 {
+			avatarUrl, nickname = users[0]["headimgurl"].(string), users[0]["nickname"].(string)
+		}
+	}
+	if value := string(args.Peek("avatar")); value != "" {
+		avatarUrl = value
+	}
+	if value := string(args.Peek("nickname")); value != "" {
+		nickname = value
+	}
+
+	var avatar image.Image
+	if avatarUrl != "" {
+		if avatar, err = fetchImage(avatarUrl); err != nil {
+			// 头像下载失败时不绘制头像
+			LogError(err)
+		}
+	}
+
+	img, err := poster.Compose(code, avatar, nickname)
+	if err != nil {
+		panic(err)
+	}
+
+	var buf bytes.Buffer
+	switch string(args.Peek("format")) {
+	case "", "png":
+		err = png.Encode(&buf, img)
+		wcctx.Ctx.SetContentType("image/png")
+	case "jpg", "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+		wcctx.Ctx.SetContentType("image/jpeg")
+	default:
+		wcctx.Json(fasthttp.StatusBadRequest, "错误的参数", "")
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	wcctx.Ctx.SetBody(buf.Bytes())
+}
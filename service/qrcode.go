@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/chenhg5/go-wechat/sdk"
+)
+
+// 带参数二维码与推广活动，每个二维码的场景值属于一个活动(wx_qrcode_campaign)，
+// 扫码事件按场景值归属到活动记录在 wx_qrcode_scan，SCAN 记为扫码，qrscene_ 开头的 subscribe 记为扫码关注
+
+// RecordQrcodeScan 记录一次扫码，场景值不是本服务生成的二维码时活动为0
+func RecordQrcodeScan(accountId int, scene string, openId string, event string) {
+	if scene == "" {
+		return
+	}
+	var campaignId int64
+	qrcodes, _ := Query("select campaign_id from wx_qrcode where acid = ? and scene = ? order by id desc limit 1", accountId, scene)
+	if len(qrcodes) > 0 {
+		campaignId = qrcodes[0]["campaign_id"].(int64)
+	}
+	Exec("insert into wx_qrcode_scan (acid, campaign_id, scene, openid, event) values (?, ?, ?, ?, ?)",
+		accountId, campaignId, scene, openId, event)
+}
+
+// OnQrcodeSubscribe 未关注用户扫码后关注
+func OnQrcodeSubscribe(ctx *wechat.Context) (wechat.Reply, error) {
+	event := ctx.Typed().(*wechat.SubscribeEvent)
+	RecordQrcodeScan(ctx.AccountId, wechat.QrcodeSceneFromEventKey(event.EventKey), ctx.Message.FromUserName, "subscribe")
+	return nil, nil
+}
+
+// OnQrcodeScan 已关注用户扫码
+func OnQrcodeScan(ctx *wechat.Context) (wechat.Reply, error) {
+	event := ctx.Typed().(*wechat.ScanEvent)
+	RecordQrcodeScan(ctx.AccountId, event.EventKey, ctx.Message.FromUserName, "scan")
+	return nil, nil
+}
+
+// CreateQrcodeCampaign 新建推广活动
+//
+// 参数：
+// name			活动名称
+// description	活动说明
+//
+// 返回：
+// 成功返回 { "id":ID }
+func CreateQrcodeCampaign(wcctx *WechatCtx) ([]byte, error) {
+	name := wcctx.GetFormValue("name")
+	if name == "" {
+		return []byte{}, errors.New("活动名称不能为空")
+	}
+	result := Exec("insert into wx_qrcode_campaign (acid, name, description) values (?, ?, ?)",
+		wcctx.AccountId(), name, wcctx.GetFormValue("description"))
+	id, _ := result.LastInsertId()
+	return json.Marshal(map[string]int64{"id": id})
+}
+
+// GetQrcodeCampaigns 分页获取推广活动
+//
+// 参数：
+// page			页码，默认为1
+// pageSize		每页数量，默认为20
+//
+// 返回：
+// 成功返回 [ { "id":1, "name":NAME, "description":DESCRIPTION, "qrcodes":2, "created_at":CREATED_AT, ... } ]
+func GetQrcodeCampaigns(wcctx *WechatCtx) ([]byte, error) {
+	page, pageSize := wcctx.Pagination()
+	campaigns, _ := Query("select c.*, (select count(*) from wx_qrcode q where q.acid = c.acid and q.campaign_id = c.id) as qrcodes "+
+		"from wx_qrcode_campaign c where c.acid = ? order by c.id desc limit ?, ?",
+		wcctx.AccountId(), (page-1)*pageSize, pageSize)
+	return json.Marshal(campaigns)
+}
+
+// CreateQrcode 为推广活动生成带参数二维码，纯数字的场景值使用整型参数
+//
+// 参数：
+// campaignId		活动id，为0时不属于任何活动
+// scene			场景值，整型为1到100000(永久)或32位非0整数(临时)，字符串长度为1到64
+// permanent		为1时生成永久二维码
+// expireSeconds	临时二维码有效时间，最长2592000秒，默认30秒
+//
+// 返回：
+// 成功返回 { "ticket":TICKET, "expire_seconds":60, "url":URL, "image_url":IMAGE_URL }
+// 失败返回 { "errcode":40013,"errmsg":"invalid appid"}
+func CreateQrcode(wcctx *WechatCtx) ([]byte, error) {
+	campaignId, _ := strconv.Atoi(wcctx.GetFormValue("campaignId"))
+	if campaignId > 0 {
+		campaigns, _ := Query("select id from wx_qrcode_campaign where acid = ? and id = ?", wcctx.AccountId(), campaignId)
+		if len(campaigns) == 0 {
+			return []byte{}, errors.New("活动不存在")
+		}
+	}
+
+	sceneValue := wcctx.GetFormValue("scene")
+	var scene wechat.QrcodeScene
+	if id, err := strconv.ParseInt(sceneValue, 10, 32); err == nil {
+		scene.SceneId = id
+		sceneValue = strconv.FormatInt(id, 10)
+	} else {
+		scene.SceneStr = sceneValue
+	}
+	permanent := wcctx.GetFormValue("permanent") == "1"
+	expireSeconds, _ := strconv.ParseInt(wcctx.GetFormValue("expireSeconds"), 10, 64)
+
+	qrcode, err := wechat.CreateQrcode(wcctx.AccessToken(), scene, permanent, expireSeconds)
+	if err == wechat.ErrInvalidScene {
+		return []byte{}, errors.New("错误的场景值")
+	}
+	if err != nil {
+		return Result(nil, err)
+	}
+
+	var expireAt interface{}
+	if !permanent {
+		expireAt = time.Now().Add(time.Duration(qrcode.ExpireSeconds) * time.Second).Format("2006-01-02 15:04:05")
+	}
+	Exec("insert into wx_qrcode (acid, campaign_id, scene, action, ticket, url, expire_at) values (?, ?, ?, ?, ?, ?, ?)",
+		wcctx.AccountId(), campaignId, sceneValue, wechat.QrcodeAction(scene, permanent), qrcode.Ticket, qrcode.Url, expireAt)
+
+	return json.Marshal(map[string]interface{}{
+		"ticket":         qrcode.Ticket,
+		"expire_seconds": qrcode.ExpireSeconds,
+		"url":            qrcode.Url,
+		"image_url":      wechat.QrcodeImageUrl(qrcode.Ticket),
+	})
+}
+
+// GetQrcodes 分页获取活动的二维码
+//
+// 参数：
+// campaignId	活动id
+// page			页码，默认为1
+// pageSize		每页数量，默认为20
+//
+// 返回：
+// 成功返回 [ { "id":1, "campaign_id":1, "scene":SCENE, "action":"QR_STR_SCENE", "ticket":TICKET, "url":URL, "expire_at":EXPIRE_AT, ... } ]
+func GetQrcodes(wcctx *WechatCtx) ([]byte, error) {
+	page, pageSize := wcctx.Pagination()
+	qrcodes, _ := Query("select * from wx_qrcode where acid = ? and campaign_id = ? order by id desc limit ?, ?",
+		wcctx.AccountId(), wcctx.GetFormValue("campaignId"), (page-1)*pageSize, pageSize)
+	return json.Marshal(qrcodes)
+}
+
+// GetQrcodeCampaignStats 活动的扫码与关注转化统计，conversion 为扫码关注人数除以扫码人数，
+// retained 为扫码关注后仍在关注的人数(依赖关注者本地镜像)
+//
+// 参数：
+// campaignId	活动id，为空时统计所有活动
+// beginDate	开始日期，如 2018-01-01，可选
+// endDate		结束日期(含)，可选
+//
+// 返回：
+// 成功返回 [ { "campaign_id":1, "name":NAME, "scans":120, "scanners":80, "subscribes":40, "retained":35, "conversion":0.5 } ]
+func GetQrcodeCampaignStats(wcctx *WechatCtx) ([]byte, error) {
+	where := "s.acid = ?"
+	args := []interface{}{wcctx.AccountId()}
+	if campaignId := wcctx.GetFormValue("campaignId"); campaignId != "" {
+		where += " and s.campaign_id = ?"
+		args = append(args, campaignId)
+	}
+	if beginDate := wcctx.GetFormValue("beginDate"); beginDate != "" {
+		where += " and s.created_at >= ?"
+		args = append(args, beginDate)
+	}
+	if endDate := wcctx.GetFormValue("endDate"); endDate != "" {
+		where += " and s.created_at < date_add(?, interval 1 day)"
+		args = append(args, endDate)
+	}
+
+	stats, _ := Query("select s.campaign_id, ifnull(c.name, '') as name, count(*) as scans, count(distinct s.openid) as scanners, "+
+		"count(distinct if(s.event = 'subscribe', s.openid, null)) as subscribes, "+
+		"count(distinct if(s.event = 'subscribe' and u.subscribe = 1, s.openid, null)) as retained "+
+		"from wx_qrcode_scan s left join wx_qrcode_campaign c on c.id = s.campaign_id "+
+		"left join wx_user u on u.acid = s.acid and u.openid = s.openid "+
+		"where "+where+" group by s.campaign_id, c.name order by s.campaign_id", args...)
+
+	for _, stat := range stats {
+		conversion := 0.0
+		if scanners := stat["scanners"].(int64); scanners > 0 {
+			conversion = float64(stat["subscribes"].(int64)) / float64(scanners)
+		}
+		stat["conversion"] = conversion
+	}
+	return json.Marshal(stats)
+}
+
+// ShortUrl 长链接转短链接
+//
+// 参数：
+// longUrl	需要转换的长链接，支持http://、https://、weixin://wxpay 格式的url
+//
+// 返回：
+// 成功返回 { "short_url":SHORT_URL }
+func ShortUrl(wcctx *WechatCtx) ([]byte, error) {
+	shortUrl, err := wechat.ShortUrl(wcctx.AccessToken(), wcctx.GetFormValue("longUrl"))
+	return Result(map[string]string{"short_url": shortUrl}, err)
+}
+
+// ShortenGen 将长信息转换为短key
+//
+// 参数：
+// longData			需要转换的长信息，不超过4KB
+// expireSeconds	过期秒数，最长30天，默认30天
+//
+// 返回：
+// 成功返回 { "short_key":SHORT_KEY }
+func ShortenGen(wcctx *WechatCtx) ([]byte, error) {
+	expireSeconds, _ := strconv.ParseInt(wcctx.GetFormValue("expireSeconds"), 10, 64)
+	shortKey, err := wechat.ShortenGen(wcctx.AccessToken(), wcctx.GetFormValue("longData"), expireSeconds)
+	return Result(map[string]string{"short_key": shortKey}, err)
+}
+
+// ShortenFetch 获取短key对应的长信息
+//
+// 参数：
+// shortKey	短key
+//
+// 返回：
+// 成功返回 { "long_data":LONG_DATA, "create_time":CREATE_TIME, "expire_seconds":EXPIRE_SECONDS }
+func ShortenFetch(wcctx *WechatCtx) ([]byte, error) {
+	return Result(wechat.ShortenFetch(wcctx.AccessToken(), wcctx.GetFormValue("shortKey")))
+}
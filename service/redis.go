@@ -50,3 +50,18 @@ func (Client *ClientType) Del(key string) *redis.Client {
 	}
 	return (*Client).RedisCon
 }
+
+func (Client *ClientType) SetNX(key string, value interface{}, expiration time.Duration) bool {
+	ok, err := (*Client).RedisCon.SetNX(key, value, expiration).Result()
+	if err != nil {
+		panic(err)
+	}
+	return ok
+}
+
+// RedisDedupStore 基于redis的推送消息排重存储，多个实例共享
+type RedisDedupStore struct{}
+
+func (store RedisDedupStore) Add(key string, ttl time.Duration) (bool, error) {
+	return RedisClient.RedisCon.SetNX("go-wechat:dedup:"+key, 1, ttl).Result()
+}
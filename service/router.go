@@ -0,0 +1,119 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/chenhg5/go-wechat/sdk"
+)
+
+// 推送消息的路由，与 GlobalFuncMap 分发 /call 的方法类似，
+// 按 MsgType、Event 与 EventKey 前缀把推送分发到各个处理函数
+
+var GlobalRouter = wechat.NewRouter()
+
+func InitRouter() {
+
+	// 微信服务器五秒内收不到响应会重试三次，排重记录保留一分钟覆盖所有重试
+	GlobalRouter.Use(wechat.Dedup(RedisDedupStore{}, time.Minute))
+
+	// 排重之后的中间件 panic 时仍正常回复，避免微信重试被排重丢弃
+	GlobalRouter.Use(wechat.Recovery())
+
+	// 排重后归档到 wx_message
+	if GetEnvBool("ARCHIVE_ENABLED", false) {
+		GlobalRouter.Use(Archive())
+	}
+
+	// 排重后写入消息流，供业务服务通过消费组拉取
+	if GetEnvBool("STREAM_ENABLED", false) {
+		GlobalRouter.Use(Stream(int64(GetEnvInt("STREAM_MAX_LEN", 10000))))
+	}
+
+	// 推送给 /events/stream 的实时事件客户端
+	GlobalRouter.Use(Broadcast(GlobalEventHub))
+
+	// 超过 CALLBACK_HANDLER_TIMEOUT 毫秒的处理先回复 success，处理完成后通过客服消息下发回复
+	GlobalRouter.Use(wechat.Timeout(time.Duration(GetEnvInt("CALLBACK_HANDLER_TIMEOUT", 4000))*time.Millisecond, SendLateReply))
+
+	// Timeout 在单独的 goroutine 中执行后续处理，需要在其中再次恢复 panic
+	GlobalRouter.Use(wechat.Recovery())
+
+	if EnvConfig["DEBUG"].(bool) {
+		GlobalRouter.Use(wechat.Logging(log.New(os.Stdout, "[GoWechat] ", log.LstdFlags)))
+	}
+
+	// 处理函数与转发规则都没有回复时按 wx_autoreply_rule 自动回复
+	GlobalRouter.Use(AutoReply())
+
+	// 按 wx_webhook_rule 转发到业务服务
+	GlobalRouter.Use(Webhook())
+
+	// 关注者本地镜像
+	GlobalRouter.HandleEvent(wechat.EVENT_SUBSCRIBE, OnUserSubscribe)
+	GlobalRouter.HandleEvent(wechat.EVENT_UNSUBSCRIBE, OnUserUnsubscribe)
+	GlobalRouter.HandleEvent(wechat.EVENT_SCAN, OnUserScan)
+
+	// 群发
+	GlobalRouter.HandleEvent(wechat.EVENT_MASS_SEND_JOB_FINISH, OnMassSendJobFinish)
+
+	// 订阅通知
+	GlobalRouter.HandleEvent(wechat.EVENT_SUBSCRIBE_MSG_POPUP_EVENT, OnSubscribeMsgPopupEvent)
+	GlobalRouter.HandleEvent(wechat.EVENT_SUBSCRIBE_MSG_CHANGE_EVENT, OnSubscribeMsgChangeEvent)
+
+	// 发布
+	GlobalRouter.HandleEvent(wechat.EVENT_PUBLISH_JOB_FINISH, OnPublishJobFinish)
+
+	// 带参数二维码
+	GlobalRouter.HandleEventKey(wechat.EVENT_SUBSCRIBE, wechat.QRCODE_SCENE_PREFIX, OnQrcodeSubscribe)
+	GlobalRouter.HandleEvent(wechat.EVENT_SCAN, OnQrcodeScan)
+}
+
+func OnMassSendJobFinish(ctx *wechat.Context) (wechat.Reply, error) {
+	event := ctx.Typed().(*wechat.MassSendJobFinishEvent)
+	FinishMassJob(ctx.AccountId, event.MsgID, event.Status, event.TotalCount, event.FilterCount, event.SentCount, event.ErrorCount)
+	return nil, nil
+}
+
+func OnSubscribeMsgPopupEvent(ctx *wechat.Context) (wechat.Reply, error) {
+	event := ctx.Typed().(*wechat.SubscribeMsgPopupEvent)
+	RecordSubscribeEvent(ctx.AccountId, event.FromUserName, event.List, "popup")
+	return nil, nil
+}
+
+func OnSubscribeMsgChangeEvent(ctx *wechat.Context) (wechat.Reply, error) {
+	event := ctx.Typed().(*wechat.SubscribeMsgChangeEvent)
+	RecordSubscribeEvent(ctx.AccountId, event.FromUserName, event.List, "change")
+	return nil, nil
+}
+
+func OnPublishJobFinish(ctx *wechat.Context) (wechat.Reply, error) {
+	event := ctx.Typed().(*wechat.PublishJobFinishEvent)
+	UpdatePublishJob(ctx.AccountId, event.PublishEventInfo)
+	return nil, nil
+}
+
+// SendLateReply 将超时处理函数的回复通过收到消息的账号的客服消息下发
+func SendLateReply(ctx *wechat.Context, reply wechat.Reply, err error) {
+	if err != nil {
+		LogError(err)
+	}
+	if reply == nil {
+		return
+	}
+
+	msg, err := wechat.CustomMessageFromReply(ctx.Message.FromUserName, reply)
+	if err != nil {
+		LogError(err)
+		return
+	}
+	token := GetAccountToken(ctx.AccountId)
+	if token == "" {
+		LogError(NoAccountTokenError(ctx.AccountId))
+		return
+	}
+	if err := wechat.SendCustomMessage(token, msg); err != nil {
+		LogError(err)
+	}
+}
@@ -1,6 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
 	"net"
 	"time"
 	"sync/atomic"
@@ -12,6 +19,7 @@ import (
 	"log"
 	"sync"
 	"strconv"
+	"strings"
 )
 
 type GracefulListener struct {
@@ -117,21 +125,133 @@ func (c *gracefulConn) Close() error {
 type WechatCtx struct {
 	Ctx     *fasthttp.RequestCtx
 	Account map[string]string
+
+	form     map[string][]string // 已读取的表单字段
+	formFile *multipart.Part     // 表单中的文件，边读边上传
 }
 
-func (wcctx *WechatCtx) GetFormValue(key string) string {
-	mf, err := (*wcctx).Ctx.MultipartForm()
-	if err == nil && mf.Value != nil {
-		vv := mf.Value[key]
-		if len(vv) > 0 {
-			return vv[0]
-		} else {
-			return ""
+// 请求体以流的方式读取，整个请求体最多 MAX_UPLOAD_SIZE，其中文件之外的表单字段读入内存，最多 MAX_FORM_SIZE
+const MAX_FORM_SIZE = 4 << 20
+
+var ErrRequestTooLarge = errors.New("请求体过大")
+
+// BodyStream 返回请求体的流，读取超过 limit 时返回 ErrRequestTooLarge
+func (wcctx *WechatCtx) BodyStream(limit int64) io.Reader {
+	var body io.Reader = wcctx.Ctx.RequestBodyStream()
+	if body == nil {
+		body = bytes.NewReader(wcctx.Ctx.PostBody())
+	}
+	return &bodyLimitReader{reader: body, remaining: limit}
+}
+
+type bodyLimitReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (r *bodyLimitReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n, ErrRequestTooLarge
+	}
+	return n, err
+}
+
+// readForm 按顺序读取 multipart 表单的字段，读到文件时停止，文件留给 FormFile 边读边上传而不整个读入内存，
+// 因此文件需要放在表单的最后，文件之后的字段不会读取
+func (wcctx *WechatCtx) readForm() {
+	if wcctx.form != nil {
+		return
+	}
+	wcctx.form = map[string][]string{}
+
+	boundary := string(wcctx.Ctx.Request.Header.MultipartFormBoundary())
+	if boundary == "" {
+		return
+	}
+	reader := multipart.NewReader(wcctx.BodyStream(int64(GetEnvInt("MAX_UPLOAD_SIZE", 20<<20))), boundary)
+
+	size := 0
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return
+		}
+		if part.FileName() != "" {
+			wcctx.formFile = part
+			return
+		}
+		value, err := ioutil.ReadAll(io.LimitReader(part, int64(MAX_FORM_SIZE-size+1)))
+		if size += len(value); err != nil || size > MAX_FORM_SIZE {
+			return
 		}
+		wcctx.form[part.FormName()] = append(wcctx.form[part.FormName()], string(value))
+	}
+}
+
+func (wcctx *WechatCtx) GetFormValue(key string) string {
+	wcctx.readForm()
+	if vv := wcctx.form[key]; len(vv) > 0 {
+		return vv[0]
 	}
 	return ""
 }
 
+// FormFile 返回表单中 key 字段的文件，文件内容直接从请求体读取，只能读取一次
+func (wcctx *WechatCtx) FormFile(key string) (*multipart.Part, error) {
+	wcctx.readForm()
+	if wcctx.formFile == nil || wcctx.formFile.FormName() != key {
+		return nil, fasthttp.ErrMissingFile
+	}
+	return wcctx.formFile, nil
+}
+
+func (wcctx *WechatCtx) AccountId() int {
+	accountId, _ := strconv.Atoi(wcctx.Account["accountId"])
+	return accountId
+}
+
+// AccessToken 返回调用账号自己的 access_token，接口写入的数据按账号保存，调用微信接口也必须使用同一个账号
+func (wcctx *WechatCtx) AccessToken() string {
+	return GetAccountToken(wcctx.AccountId())
+}
+
+// Pagination 读取分页参数 page 与 pageSize
+func (wcctx *WechatCtx) Pagination() (int, int) {
+	page, _ := strconv.Atoi(wcctx.GetFormValue("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(wcctx.GetFormValue("pageSize"))
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	return page, pageSize
+}
+
+// Authorized 校验客户端凭证，支持 Basic 认证或 query 中的 clientId 与 clientSecret，
+// 未配置 CLIENT_ID 与 CLIENT_SECRET 时拒绝所有请求
+func (wcctx *WechatCtx) Authorized() bool {
+	clientId, clientSecret := GetEnvString("CLIENT_ID", ""), GetEnvString("CLIENT_SECRET", "")
+	if clientId == "" || clientSecret == "" {
+		return false
+	}
+
+	id := string(wcctx.Ctx.QueryArgs().Peek("clientId"))
+	secret := string(wcctx.Ctx.QueryArgs().Peek("clientSecret"))
+	if auth := string(wcctx.Ctx.Request.Header.Peek("Authorization")); strings.HasPrefix(auth, "Basic ") {
+		if decoded, err := base64.StdEncoding.DecodeString(auth[len("Basic "):]); err == nil {
+			if i := strings.IndexByte(string(decoded), ':'); i >= 0 {
+				id, secret = string(decoded[:i]), string(decoded[i+1:])
+			}
+		}
+	}
+
+	return subtle.ConstantTimeCompare([]byte(id), []byte(clientId)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(secret), []byte(clientSecret)) == 1
+}
+
 func (wcctx *WechatCtx) Json(statusCode int, msg string, data string) {
 	(*wcctx).Ctx.SetStatusCode(statusCode)
 	(*wcctx).Ctx.SetContentType("application/json")
@@ -154,8 +274,15 @@ func InitServer(port string) {
 	duration := 30 * time.Second
 	graceful := newGracefulListener(ln, duration)
 
+	// 上传的文件不整个读入内存，请求体超过预读的部分通过 RequestBodyStream 边读边处理
+	server := &fasthttp.Server{
+		MaxRequestBodySize:           GetEnvInt("MAX_UPLOAD_SIZE", 20<<20),
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+	}
+
 	go func() {
-		fasthttp.Serve(graceful, func(ctx *fasthttp.RequestCtx) {
+		server.Handler = func(ctx *fasthttp.RequestCtx) {
 			path := string(ctx.Path())
 
 			var (
@@ -166,21 +293,35 @@ func InitServer(port string) {
 			if wcctx, ok = WechatCtxPool.Get().(*WechatCtx); ok {
 				wcctx.Ctx = ctx
 				wcctx.Account = map[string]string{}
+				wcctx.form, wcctx.formFile = nil, nil
 			} else {
 				wcctx = &WechatCtx{
-					ctx,
-					map[string]string{},
+					Ctx:     ctx,
+					Account: map[string]string{},
 				}
 			}
 
-			switch path {
-			case "/call":
+			switch {
+			case path == "/call":
 				CallMethod(wcctx)
+			case strings.HasPrefix(path, "/callback/"):
+				Callback(wcctx)
+			case path == "/events/stream":
+				EventStream(wcctx)
+			case path == "/media":
+				MediaDownload(wcctx)
+			case path == "/qrcode":
+				QrcodeImage(wcctx)
+			case path == "/poster":
+				PosterImage(wcctx)
 			default:
 				defer handle(wcctx)
 				wcctx.Json(fasthttp.StatusNotFound, "错误的路径", "")
 			}
-		})
+		}
+		if err := server.Serve(graceful); err != nil {
+			log.Fatalf("error in server: %s", err)
+		}
 	}()
 
 	osSignals := make(chan os.Signal)
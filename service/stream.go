@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/chenhg5/go-wechat/sdk"
+	"github.com/go-redis/redis"
+)
+
+// 推送消息流，排重后的每条推送消息写入账号对应的 Redis Stream(go-wechat:stream:{accountId})，
+// 业务服务通过消费组拉取，go 项目可以使用 wechat.StreamConsumer
+//
+// 需要 redis 5.0 以上版本，STREAM_ENABLED 为 true 时启用，STREAM_MAX_LEN 为每个消息流保留的大约条数
+
+// Stream 将推送消息写入消息流，写入失败只记录错误，不影响后续处理
+func Stream(maxLen int64) wechat.Middleware {
+	return func(next wechat.HandlerFunc) wechat.HandlerFunc {
+		return func(ctx *wechat.Context) (wechat.Reply, error) {
+			if err := PublishStream(ctx.AccountId, ctx.Message, maxLen); err != nil {
+				LogError(err)
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// PublishStream 将一条推送消息写入账号的消息流
+func PublishStream(accountId int, msg *wechat.MixMessage, maxLen int64) error {
+	values, err := wechat.StreamValues(accountId, msg)
+	if err != nil {
+		return err
+	}
+	return RedisClient.RedisCon.XAdd(&redis.XAddArgs{
+		Stream:       wechat.StreamKey(accountId),
+		MaxLenApprox: maxLen,
+		Values:       values,
+	}).Err()
+}
+
+// CreateStreamGroup
+//
+// 参数：
+// group	消费组名称
+// start	$ 只消费之后的消息，0 从头消费，默认为 $
+//
+// 返回：
+// 成功返回 { "stream":"go-wechat:stream:1", "group":"GROUP" }
+func CreateStreamGroup(wcctx *WechatCtx) ([]byte, error) {
+	group := wcctx.GetFormValue("group")
+	if group == "" {
+		return []byte{}, errors.New("错误的消费组名称")
+	}
+	start := wcctx.GetFormValue("start")
+	if start == "" {
+		start = "$"
+	}
+
+	stream := wechat.StreamKey(wcctx.AccountId())
+	err := RedisClient.RedisCon.XGroupCreateMkStream(stream, group, start).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return []byte{}, err
+	}
+
+	return json.Marshal(map[string]string{"stream": stream, "group": group})
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/chenhg5/go-wechat/sdk"
+)
+
+// 订阅通知与一次性订阅消息，用户对每个模板的授权状态记录在 wx_subscribe_status 中，
+// 由 subscribe_msg_popup_event, subscribe_msg_change_event 事件与一次性订阅授权回跳更新
+
+// AddSubscribeTemplate
+//
+// 参数：
+// tid			模板标题 id
+// kidList		模板关键词id，多个用英文逗号隔开
+// sceneDesc	服务场景描述
+//
+// 返回：
+// 成功返回 { "priTmplId": "9Aw5ZV1j9xdWTFEkqCpZ7mIBbSC34khK55OtzUPl0rU" }
+// 失败返回 { "errcode":200014,"errmsg":"template tid not exist"}
+func AddSubscribeTemplate(wcctx *WechatCtx) ([]byte, error) {
+	var kidList []int64
+	for _, kid := range strings.Split(wcctx.GetFormValue("kidList"), ",") {
+		id, err := strconv.ParseInt(kid, 10, 64)
+		if err != nil {
+			return []byte{}, errors.New("错误的关键词id")
+		}
+		kidList = append(kidList, id)
+	}
+
+	priTmplId, err := wechat.AddSubscribeTemplate(wcctx.AccessToken(), wcctx.GetFormValue("tid"), kidList, wcctx.GetFormValue("sceneDesc"))
+	return Result(map[string]string{"priTmplId": priTmplId}, err)
+}
+
+// DelSubscribeTemplate
+//
+// 参数：
+// priTmplId	要删除的模板id
+//
+// 返回：
+// 成功返回 { "priTmplId": "9Aw5ZV1j9xdWTFEkqCpZ7mIBbSC34khK55OtzUPl0rU" }
+// 失败返回 { "errcode":20001,"errmsg":"system error"}
+func DelSubscribeTemplate(wcctx *WechatCtx) ([]byte, error) {
+	priTmplId := wcctx.GetFormValue("priTmplId")
+	return Result(map[string]string{"priTmplId": priTmplId}, wechat.DelSubscribeTemplate(wcctx.AccessToken(), priTmplId))
+}
+
+// GetSubscribeCategory
+//
+// 返回：
+// 成功返回 [ { "id":616, "name":"公交" } ]
+// 失败返回 { "errcode":40001,"errmsg":"invalid credential"}
+func GetSubscribeCategory(wcctx *WechatCtx) ([]byte, error) {
+	return Result(wechat.GetSubscribeCategory(wcctx.AccessToken()))
+}
+
+// GetPubTemplateKeywords
+//
+// 参数：
+// tid	模板标题 id
+//
+// 返回：
+// 成功返回 [ { "kid":1, "name":"物品名称", "example":"名称", "rule":"thing" } ]
+// 失败返回 { "errcode":40001,"errmsg":"invalid credential"}
+func GetPubTemplateKeywords(wcctx *WechatCtx) ([]byte, error) {
+	return Result(wechat.GetPubTemplateKeywords(wcctx.AccessToken(), wcctx.GetFormValue("tid")))
+}
+
+// GetPubTemplateTitles
+//
+// 参数：
+// ids		类目 id，多个用逗号隔开
+// start	从 0 开始计数
+// limit	最大为 30
+//
+// 返回：
+// 成功返回 { "count":55, "data":[ { "tid":99, "title":"付款成功通知", "type":2, "categoryId":"616" } ] }
+// 失败返回 { "errcode":40001,"errmsg":"invalid credential"}
+func GetPubTemplateTitles(wcctx *WechatCtx) ([]byte, error) {
+	start, _ := strconv.Atoi(wcctx.GetFormValue("start"))
+	limit, _ := strconv.Atoi(wcctx.GetFormValue("limit"))
+	if limit < 1 || limit > 30 {
+		limit = 30
+	}
+	return Result(wechat.GetPubTemplateTitles(wcctx.AccessToken(), wcctx.GetFormValue("ids"), start, limit))
+}
+
+// GetSubscribeTemplate
+//
+// 返回：
+// 成功返回 [ { "priTmplId":"9Aw5ZV1j9xdWTFEkqCpZ7mIBbSC34khK55OtzUPl0rU", "title":"报名结果通知", "content":"...", "example":"...", "type":2 } ]
+// 失败返回 { "errcode":40001,"errmsg":"invalid credential"}
+func GetSubscribeTemplate(wcctx *WechatCtx) ([]byte, error) {
+	return Result(wechat.GetSubscribeTemplate(wcctx.AccessToken()))
+}
+
+// SendSubscribeMessage
+//
+// 参数：
+// toUser				接收者openid
+// templateId			订阅通知模板id
+// page					跳转网页地址
+// miniprogramAppId		跳转小程序appid
+// miniprogramPagePath	跳转小程序页面
+// data					模板内容，json格式，如 {"thing1":"广州腾讯科技有限公司"}
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+// 失败返回 { "errcode":43101,"errmsg":"user refuse to accept the msg"}
+func SendSubscribeMessage(wcctx *WechatCtx) ([]byte, error) {
+	var values map[string]string
+	if err := json.Unmarshal([]byte(wcctx.GetFormValue("data")), &values); err != nil {
+		return []byte{}, errors.New("错误的模板内容")
+	}
+
+	msg := wechat.SubscribeMessage{
+		ToUser:     wcctx.GetFormValue("toUser"),
+		TemplateId: wcctx.GetFormValue("templateId"),
+		Page:       wcctx.GetFormValue("page"),
+		Data:       map[string]wechat.SubscribeValue{},
+	}
+	if appId := wcctx.GetFormValue("miniprogramAppId"); appId != "" {
+		msg.MiniProgram = &wechat.MiniProgram{AppId: appId, PagePath: wcctx.GetFormValue("miniprogramPagePath")}
+	}
+	for k, v := range values {
+		msg.Data[k] = wechat.SubscribeValue{Value: v}
+	}
+
+	err := wechat.SendSubscribeMessage(wcctx.AccessToken(), msg)
+	if commonError, ok := err.(*wechat.CommonError); ok && commonError.ErrCode == 43101 {
+		RecordSubscribeStatus(wcctx.AccountId(), msg.ToUser, msg.TemplateId, "reject", "", "bizsend")
+	}
+
+	return Result(wechat.CommonError{ErrMsg: "ok"}, err)
+}
+
+// GetOnceSubscribeAuthUrl
+//
+// 参数：
+// scene		订阅场景值，0-10000
+// templateId	一次性订阅消息模板id
+// redirectUrl	授权后重定向的回调地址，回调时请调用 ConfirmOnceSubscribe 记录授权结果
+// reserved		用于保持请求和回调的状态
+//
+// 返回：
+// 成功返回 { "url": "https://mp.weixin.qq.com/mp/subscribemsg?action=get_confirm&..." }
+func GetOnceSubscribeAuthUrl(wcctx *WechatCtx) ([]byte, error) {
+	scene, err := strconv.Atoi(wcctx.GetFormValue("scene"))
+	if err != nil || scene < 0 || scene > 10000 {
+		return []byte{}, errors.New("错误的场景值")
+	}
+
+	return json.Marshal(map[string]string{
+		"url": wechat.OnceSubscribeAuthUrl(wcctx.Account["appId"], scene,
+			wcctx.GetFormValue("templateId"),
+			wcctx.GetFormValue("redirectUrl"),
+			wcctx.GetFormValue("reserved")),
+	})
+}
+
+// ConfirmOnceSubscribe 记录一次性订阅授权页回跳带回的结果
+//
+// 参数：
+// openid		用户唯一标识
+// templateId	订阅消息模板ID
+// action		用户点击动作，confirm 代表用户确认授权，cancel 代表用户取消授权
+// scene		订阅场景值
+//
+// 返回：
+// 成功返回 { "openid":"OPENID", "template_id":"TEMPLATE_ID", "status":"accept" }
+func ConfirmOnceSubscribe(wcctx *WechatCtx) ([]byte, error) {
+	status := "reject"
+	if wcctx.GetFormValue("action") == "confirm" {
+		status = "accept"
+	}
+
+	openId := wcctx.GetFormValue("openid")
+	templateId := wcctx.GetFormValue("templateId")
+	RecordSubscribeStatus(wcctx.AccountId(), openId, templateId, status, wcctx.GetFormValue("scene"), "once")
+
+	return json.Marshal(map[string]string{"openid": openId, "template_id": templateId, "status": status})
+}
+
+// SendOnceSubscribeMessage
+//
+// 参数：
+// toUser				接收者openid
+// templateId			一次性订阅消息模板id
+// scene				订阅场景值
+// title				消息标题，15字以内
+// content				消息正文，200字以内
+// color				消息正文颜色
+// url					点击消息跳转的链接
+// miniprogramAppId		跳转小程序appid
+// miniprogramPagePath	跳转小程序页面
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+// 失败返回 { "errcode":43101,"errmsg":"user refuse to accept the msg"}
+func SendOnceSubscribeMessage(wcctx *WechatCtx) ([]byte, error) {
+	msg := wechat.OnceSubscribeMessage{
+		ToUser:     wcctx.GetFormValue("toUser"),
+		TemplateId: wcctx.GetFormValue("templateId"),
+		Url:        wcctx.GetFormValue("url"),
+		Scene:      wcctx.GetFormValue("scene"),
+		Title:      wcctx.GetFormValue("title"),
+		Data: map[string]wechat.OnceSubscribeValue{
+			"content": {Value: wcctx.GetFormValue("content"), Color: wcctx.GetFormValue("color")},
+		},
+	}
+	if appId := wcctx.GetFormValue("miniprogramAppId"); appId != "" {
+		msg.MiniProgram = &wechat.MiniProgram{AppId: appId, PagePath: wcctx.GetFormValue("miniprogramPagePath")}
+	}
+
+	err := wechat.SendOnceSubscribeMessage(wcctx.AccessToken(), msg)
+	if err == nil {
+		// 一次授权只能下发一条消息
+		RecordSubscribeStatus(wcctx.AccountId(), msg.ToUser, msg.TemplateId, "used", msg.Scene, "once")
+	}
+
+	return Result(wechat.CommonError{ErrMsg: "ok"}, err)
+}
+
+// GetSubscribeStatus
+//
+// 参数：
+// openid		用户唯一标识
+// templateId	模板id，为空时返回该用户所有模板的授权状态
+//
+// 返回：
+// 成功返回 [ { "openid":"OPENID", "template_id":"TEMPLATE_ID", "status":"accept", "scene":"2", "source":"popup", ... } ]
+func GetSubscribeStatus(wcctx *WechatCtx) ([]byte, error) {
+	openId := wcctx.GetFormValue("openid")
+	if templateId := wcctx.GetFormValue("templateId"); templateId != "" {
+		status, _ := Query("select * from wx_subscribe_status where acid = ? and openid = ? and template_id = ?",
+			wcctx.AccountId(), openId, templateId)
+		return json.Marshal(status)
+	}
+
+	status, _ := Query("select * from wx_subscribe_status where acid = ? and openid = ?", wcctx.AccountId(), openId)
+	return json.Marshal(status)
+}
+
+// RecordSubscribeStatus 记录用户对模板的授权状态
+//
+// status 为 accept, reject 或 used(一次性订阅已下发)
+// source 为 popup, change, once 或 bizsend
+func RecordSubscribeStatus(accountId int, openId string, templateId string, status string, scene string, source string) {
+	Exec("insert into wx_subscribe_status (acid, openid, template_id, status, scene, source) values (?, ?, ?, ?, ?, ?) "+
+		"on duplicate key update status = values(status), scene = values(scene), source = values(source)",
+		accountId, openId, templateId, status, scene, source)
+}
+
+// RecordSubscribeEvent 根据 subscribe_msg_popup_event 与 subscribe_msg_change_event 事件更新授权状态
+func RecordSubscribeEvent(accountId int, openId string, list []wechat.SubscribeMsgEventItem, source string) {
+	for _, item := range list {
+		RecordSubscribeStatus(accountId, openId, item.TemplateId, item.SubscribeStatusString, item.PopupScene, source)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/chenhg5/go-wechat/sdk"
+)
+
+// 用户标签管理
+
+// TaggingBatch 批量打标签中一批的结果
+type TaggingBatch struct {
+	Batch   int      `json:"batch"`
+	OpenIds []string `json:"openids"`
+	ErrCode int64    `json:"errcode"`
+	ErrMsg  string   `json:"errmsg"`
+}
+
+// BulkTaggingResult 批量打标签的结果，部分批次失败时只需重试失败批次中的openid
+type BulkTaggingResult struct {
+	Total   int            `json:"total"`
+	Success int            `json:"success"`
+	Failed  int            `json:"failed"`
+	Batches []TaggingBatch `json:"batches"`
+}
+
+// BulkTagging 使用标签所属账号的 accessToken 将任意数量的openid按每批50个打标签或取消标签，同时最多 concurrency 批请求
+func BulkTagging(accessToken string, tagId int64, openIds []string, untag bool, concurrency int) BulkTaggingResult {
+	tagging := wechat.BatchTagging
+	if untag {
+		tagging = wechat.BatchUntagging
+	}
+
+	var batches []TaggingBatch
+	for start := 0; start < len(openIds); start += wechat.MAX_TAGGING_BATCH {
+		end := start + wechat.MAX_TAGGING_BATCH
+		if end > len(openIds) {
+			end = len(openIds)
+		}
+		batches = append(batches, TaggingBatch{Batch: len(batches), OpenIds: openIds[start:end]})
+	}
+
+	errs := runBatches(len(batches), concurrency, func(i int) error {
+		return tagging(accessToken, tagId, batches[i].OpenIds)
+	})
+	for i, err := range errs {
+		batches[i].ErrCode, batches[i].ErrMsg = batchErrCode(err)
+	}
+
+	result := BulkTaggingResult{Total: len(openIds), Batches: batches}
+	for _, batch := range batches {
+		if batch.ErrCode == 0 {
+			result.Success += len(batch.OpenIds)
+		} else {
+			result.Failed += len(batch.OpenIds)
+		}
+	}
+	return result
+}
+
+func tagId(wcctx *WechatCtx) (int64, error) {
+	id, err := strconv.ParseInt(wcctx.GetFormValue("tagId"), 10, 64)
+	if err != nil {
+		return 0, errors.New("错误的标签id")
+	}
+	return id, nil
+}
+
+// CreateTag
+//
+// 参数：
+// name		标签名，30个字符以内
+//
+// 返回：
+// 成功返回 { "tag":{ "id":134, "name":"广东" } }
+// 失败返回 { "errcode":45157,"errmsg":"invalid tag name"}
+func CreateTag(wcctx *WechatCtx) ([]byte, error) {
+	tag, err := wechat.CreateTag(wcctx.AccessToken(), wcctx.GetFormValue("name"))
+	return Result(map[string]wechat.Tag{"tag": tag}, err)
+}
+
+// GetTags
+//
+// 返回：
+// 成功返回 { "tags":[ { "id":1, "name":"每天一罐可乐星人", "count":0 } ] }
+func GetTags(wcctx *WechatCtx) ([]byte, error) {
+	tags, err := wechat.GetTags(wcctx.AccessToken())
+	return Result(map[string][]wechat.Tag{"tags": tags}, err)
+}
+
+// UpdateTag
+//
+// 参数：
+// tagId	标签id
+// name		标签名
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func UpdateTag(wcctx *WechatCtx) ([]byte, error) {
+	id, err := tagId(wcctx)
+	if err != nil {
+		return []byte{}, err
+	}
+	return Result(wechat.CommonError{ErrMsg: "ok"}, wechat.UpdateTag(wcctx.AccessToken(), id, wcctx.GetFormValue("name")))
+}
+
+// DeleteTag
+//
+// 参数：
+// tagId	标签id
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+// 失败返回 { "errcode":45058,"errmsg":"can't modify sys tag"}
+func DeleteTag(wcctx *WechatCtx) ([]byte, error) {
+	id, err := tagId(wcctx)
+	if err != nil {
+		return []byte{}, err
+	}
+	return Result(wechat.CommonError{ErrMsg: "ok"}, wechat.DeleteTag(wcctx.AccessToken(), id))
+}
+
+// BatchTagging
+//
+// 参数：
+// tagId	标签id
+// openIds	用户openid，多个用英文逗号隔开，最多50个，更多时使用 BulkTaggingUsers
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func BatchTagging(wcctx *WechatCtx) ([]byte, error) {
+	id, err := tagId(wcctx)
+	if err != nil {
+		return []byte{}, err
+	}
+	openIds, err := openIdList(wcctx, "openIds")
+	if err != nil {
+		return []byte{}, err
+	}
+	return Result(wechat.CommonError{ErrMsg: "ok"}, wechat.BatchTagging(wcctx.AccessToken(), id, openIds))
+}
+
+// BatchUntagging
+//
+// 参数：
+// tagId	标签id
+// openIds	用户openid，多个用英文逗号隔开，最多50个
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func BatchUntagging(wcctx *WechatCtx) ([]byte, error) {
+	id, err := tagId(wcctx)
+	if err != nil {
+		return []byte{}, err
+	}
+	openIds, err := openIdList(wcctx, "openIds")
+	if err != nil {
+		return []byte{}, err
+	}
+	return Result(wechat.CommonError{ErrMsg: "ok"}, wechat.BatchUntagging(wcctx.AccessToken(), id, openIds))
+}
+
+// BulkTaggingUsers
+//
+// 参数：
+// tagId		标签id
+// openIds		用户openid，多个用英文逗号隔开，数量不限，按每批50个请求
+// untag		为1时取消标签
+// concurrency	同时请求的批数，默认为 TAG_BULK_CONCURRENCY
+//
+// 返回：
+//
+//	成功返回 {
+//		  "total":120, "success":70, "failed":50,
+//		  "batches":[ { "batch":0, "openids":[...], "errcode":0, "errmsg":"ok" }, { "batch":1, "openids":[...], "errcode":45059, "errmsg":"tag exceeds limit" } ]
+//	}
+func BulkTaggingUsers(wcctx *WechatCtx) ([]byte, error) {
+	id, err := tagId(wcctx)
+	if err != nil {
+		return []byte{}, err
+	}
+	openIds, err := openIdList(wcctx, "openIds")
+	if err != nil {
+		return []byte{}, err
+	}
+
+	concurrency, _ := strconv.Atoi(wcctx.GetFormValue("concurrency"))
+	if concurrency <= 0 {
+		concurrency = GetEnvInt("TAG_BULK_CONCURRENCY", 4)
+	}
+
+	return json.Marshal(BulkTagging(wcctx.AccessToken(), id, openIds, wcctx.GetFormValue("untag") == "1", concurrency))
+}
+
+// GetUserTagIdList
+//
+// 参数：
+// openId	用户openid
+//
+// 返回：
+// 成功返回 { "tagid_list":[ 134, 2 ] }
+func GetUserTagIdList(wcctx *WechatCtx) ([]byte, error) {
+	tagIds, err := wechat.GetUserTagIdList(wcctx.AccessToken(), wcctx.GetFormValue("openId"))
+	return Result(map[string][]int64{"tagid_list": tagIds}, err)
+}
+
+// GetTagUsers
+//
+// 参数：
+// tagId		标签id
+// nextOpenId	第一个拉取的openid，为空时从头开始拉取
+//
+// 返回：
+// 成功返回 { "count":2, "data":{ "openid":[ "ocYxcuAEy30bX0NXmGn4ypqx3tI0", "ocYxcuBt0mRugKZ7tGAHPnUaOW7Y" ] }, "next_openid":"ocYxcuBt0mRugKZ7tGAHPnUaOW7Y" }
+func GetTagUsers(wcctx *WechatCtx) ([]byte, error) {
+	id, err := tagId(wcctx)
+	if err != nil {
+		return []byte{}, err
+	}
+	return Result(wechat.GetTagUsers(wcctx.AccessToken(), id, wcctx.GetFormValue("nextOpenId")))
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/chenhg5/go-wechat/sdk"
+)
+
+// 用户管理与黑名单，批量接口超过单次上限时由sdk分批请求
+
+// openIdList 读取参数中英文逗号隔开的openid
+func openIdList(wcctx *WechatCtx, key string) ([]string, error) {
+	var openIds []string
+	for _, openId := range strings.Split(wcctx.GetFormValue(key), ",") {
+		if openId = strings.TrimSpace(openId); openId != "" {
+			openIds = append(openIds, openId)
+		}
+	}
+	if len(openIds) == 0 {
+		return nil, errors.New("错误的openid")
+	}
+	return openIds, nil
+}
+
+// GetUserInfo
+//
+// 参数：
+// openId	用户的标识
+// lang		返回国家地区语言版本，zh_CN 简体，zh_TW 繁体，en 英语，默认 zh_CN
+//
+// 返回：
+// 成功返回 { "subscribe":1, "openid":"o6_bmjrPTlm6_2sgVt7hMZOPfL2M", "nickname":"Band", "unionid":"...", "subscribe_scene":"ADD_SCENE_QR_CODE", ... }
+// 失败返回 { "errcode":40003,"errmsg":"invalid openid"}
+func GetUserInfo(wcctx *WechatCtx) ([]byte, error) {
+	user, err := wechat.GetUserInfo(wcctx.AccessToken(), wcctx.GetFormValue("openId"), wcctx.GetFormValue("lang"))
+	if err == nil {
+		RecordIdentity(wcctx.AccountId(), user.OpenId, user.UnionId, "user")
+	}
+	return Result(user, err)
+}
+
+// BatchGetUserInfo
+//
+// 参数：
+// openIds	用户的标识，多个用英文逗号隔开，超过100个时分批获取
+// lang		返回国家地区语言版本，默认 zh_CN
+//
+// 返回：
+// 成功返回 { "user_info_list":[ { "subscribe":1, "openid":"otvxTs4dckWG7imySrJd6jSi0CWE", ... } ] }
+func BatchGetUserInfo(wcctx *WechatCtx) ([]byte, error) {
+	openIds, err := openIdList(wcctx, "openIds")
+	if err != nil {
+		return []byte{}, err
+	}
+
+	users, err := wechat.BatchGetUserInfo(wcctx.AccessToken(), openIds, wcctx.GetFormValue("lang"))
+	for _, user := range users {
+		RecordIdentity(wcctx.AccountId(), user.OpenId, user.UnionId, "user")
+	}
+	return Result(map[string][]wechat.User{"user_info_list": users}, err)
+}
+
+// GetUserList
+//
+// 参数：
+// nextOpenId	第一个拉取的openid，为空时从头开始拉取
+//
+// 返回：
+// 成功返回 { "total":23000, "count":10000, "data":{ "openid":[ "OPENID1", "OPENID2" ] }, "next_openid":"OPENID10000" }
+func GetUserList(wcctx *WechatCtx) ([]byte, error) {
+	return Result(wechat.GetUserList(wcctx.AccessToken(), wcctx.GetFormValue("nextOpenId")))
+}
+
+// UpdateUserRemark
+//
+// 参数：
+// openId	用户的标识
+// remark	备注名，长度必须小于30字符
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func UpdateUserRemark(wcctx *WechatCtx) ([]byte, error) {
+	return Result(wechat.CommonError{ErrMsg: "ok"},
+		wechat.UpdateUserRemark(wcctx.AccessToken(), wcctx.GetFormValue("openId"), wcctx.GetFormValue("remark")))
+}
+
+// GetBlacklist
+//
+// 参数：
+// beginOpenId	第一个拉取的openid，为空时从头开始拉取
+//
+// 返回：
+// 成功返回 { "total":23000, "count":10000, "data":{ "openid":[ "OPENID1", "OPENID2" ] }, "next_openid":"OPENID10000" }
+func GetBlacklist(wcctx *WechatCtx) ([]byte, error) {
+	return Result(wechat.GetBlacklist(wcctx.AccessToken(), wcctx.GetFormValue("beginOpenId")))
+}
+
+// BatchBlacklist
+//
+// 参数：
+// openIds	需要拉黑的openid，多个用英文逗号隔开
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+// 失败返回 { "errcode":49003,"errmsg":"not most blacklist"}
+func BatchBlacklist(wcctx *WechatCtx) ([]byte, error) {
+	openIds, err := openIdList(wcctx, "openIds")
+	if err != nil {
+		return []byte{}, err
+	}
+	return Result(wechat.CommonError{ErrMsg: "ok"}, wechat.BatchBlacklist(wcctx.AccessToken(), openIds))
+}
+
+// BatchUnblacklist
+//
+// 参数：
+// openIds	需要取消拉黑的openid，多个用英文逗号隔开
+//
+// 返回：
+// 成功返回 { "errcode":0, "errmsg":"ok" }
+func BatchUnblacklist(wcctx *WechatCtx) ([]byte, error) {
+	openIds, err := openIdList(wcctx, "openIds")
+	if err != nil {
+		return []byte{}, err
+	}
+	return Result(wechat.CommonError{ErrMsg: "ok"}, wechat.BatchUnblacklist(wcctx.AccessToken(), openIds))
+}
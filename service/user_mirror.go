@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chenhg5/go-wechat/sdk"
+)
+
+// 关注者本地镜像，wx_user 保存每个账号的关注者用于微信接口无法完成的筛选：
+//
+// 1. 全量同步：通过 user/get 遍历关注者，每页用 batchget 获取信息后写入，
+//    同步结束后本次没有同步到的关注者视为已取消关注
+// 2. 增量更新：subscribe、unsubscribe 与 SCAN 事件实时更新
+// 3. 定时同步：每 USER_SYNC_INTERVAL 小时对所有账号全量同步一次，修复遗漏的事件
+//
+// 每个账号使用 GetAccountToken 获取自己的 access_token
+
+const (
+	USER_SYNC_LOCK_PREFIX = "go-wechat:user_sync:"
+	USER_SYNC_LOCK_TTL    = 10 * time.Minute // 每同步一页续期一次，进程退出后锁自动过期
+)
+
+var ErrUserSyncRunning = errors.New("用户同步进行中")
+
+func InitUserSync() {
+	hours := GetEnvInt("USER_SYNC_INTERVAL", 24)
+	if hours <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(time.Duration(hours) * time.Hour) {
+			for accountId := range Account {
+				if err := SyncUserMirror(accountId); err != nil && err != ErrUserSyncRunning {
+					LogError(err)
+				}
+			}
+		}
+	}()
+}
+
+// SyncUserMirror 全量同步账号的关注者，同一账号同时只有一个同步，进度记录在 wx_user_sync
+func SyncUserMirror(accountId int) (err error) {
+	lockKey := USER_SYNC_LOCK_PREFIX + strconv.Itoa(accountId)
+	if !RedisClient.SetNX(lockKey, 1, USER_SYNC_LOCK_TTL) {
+		return ErrUserSyncRunning
+	}
+	defer RedisClient.Del(lockKey)
+
+	// 使用数据库时间，避免与应用服务器的时钟不一致
+	now, _ := Query("select now() as now")
+	startedAt := now[0]["now"].(string)
+	Exec("insert into wx_user_sync (acid, status, total, synced, error, started_at) values (?, 'running', 0, 0, '', ?) "+
+		"on duplicate key update status = 'running', total = 0, synced = 0, error = '', started_at = values(started_at)",
+		accountId, startedAt)
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("user sync panic: %v", r)
+		}
+		if err != nil {
+			Exec("update wx_user_sync set status = 'failed', error = ? where acid = ?", truncateError(err), accountId)
+		} else {
+			Exec("update wx_user_sync set status = 'success' where acid = ?", accountId)
+		}
+	}()
+
+	// 遍历与 batchget 都使用该账号自己的 access_token，否则会把其他账号的关注者写入本账号
+	token := func() string { return GetAccountToken(accountId) }
+	if token() == "" {
+		return NoAccountTokenError(accountId)
+	}
+
+	synced := 0
+	iterator := wechat.NewUserIterator(token, "")
+	for iterator.Next() {
+		users, err := wechat.BatchGetUserInfo(token(), iterator.Page(), "zh_CN")
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			SaveUser(accountId, user)
+		}
+
+		synced += len(users)
+		Exec("update wx_user_sync set total = ?, synced = ? where acid = ?", iterator.Total(), synced, accountId)
+		RedisClient.RedisCon.Expire(lockKey, USER_SYNC_LOCK_TTL)
+	}
+	if err := iterator.Err(); err != nil {
+		return err
+	}
+
+	// 本次没有同步到的关注者已取消关注
+	Exec("update wx_user set subscribe = 0 where acid = ? and subscribe = 1 and synced_at < ?", accountId, startedAt)
+	return nil
+}
+
+// SaveUser 写入关注者信息与标签，未关注的用户只有 openid 与 unionid，只更新关注状态
+func SaveUser(accountId int, user wechat.User) {
+	RecordIdentity(accountId, user.OpenId, user.UnionId, "user")
+
+	if user.Subscribe == 0 {
+		Exec("insert into wx_user (acid, openid, unionid, subscribe, synced_at) values (?, ?, ?, 0, now()) "+
+			"on duplicate key update unionid = values(unionid), subscribe = 0, synced_at = now()",
+			accountId, user.OpenId, user.UnionId)
+		return
+	}
+
+	Exec("insert into wx_user (acid, openid, unionid, subscribe, nickname, sex, language, city, province, country, headimgurl, "+
+		"subscribe_time, remark, subscribe_scene, qr_scene, qr_scene_str, synced_at) values (?, ?, ?, 1, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, now()) "+
+		"on duplicate key update unionid = values(unionid), subscribe = 1, nickname = values(nickname), sex = values(sex), "+
+		"language = values(language), city = values(city), province = values(province), country = values(country), "+
+		"headimgurl = values(headimgurl), subscribe_time = values(subscribe_time), remark = values(remark), "+
+		"subscribe_scene = values(subscribe_scene), qr_scene = values(qr_scene), qr_scene_str = values(qr_scene_str), synced_at = now()",
+		accountId, user.OpenId, user.UnionId, user.Nickname, user.Sex, user.Language, user.City, user.Province, user.Country,
+		user.HeadImgUrl, user.SubscribeTime, user.Remark, user.SubscribeScene, user.QrScene, user.QrSceneStr)
+
+	Exec("delete from wx_user_tag where acid = ? and openid = ?", accountId, user.OpenId)
+	for _, id := range user.TagIdList {
+		Exec("insert into wx_user_tag (acid, openid, tag_id) values (?, ?, ?)", accountId, user.OpenId, id)
+	}
+}
+
+// RefreshUser 从微信接口获取单个用户信息并写入
+func RefreshUser(accountId int, openId string) {
+	defer func() {
+		if r := recover(); r != nil {
+			LogError(fmt.Errorf("refresh user panic: %v", r))
+		}
+	}()
+
+	user, err := wechat.GetUserInfo(GetAccountToken(accountId), openId, "zh_CN")
+	if err != nil {
+		LogError(err)
+		return
+	}
+	SaveUser(accountId, user)
+}
+
+func OnUserSubscribe(ctx *wechat.Context) (wechat.Reply, error) {
+	go RefreshUser(ctx.AccountId, ctx.Message.FromUserName)
+	return nil, nil
+}
+
+func OnUserUnsubscribe(ctx *wechat.Context) (wechat.Reply, error) {
+	Exec("insert into wx_user (acid, openid, subscribe, unsubscribe_time, synced_at) values (?, ?, 0, ?, now()) "+
+		"on duplicate key update subscribe = 0, unsubscribe_time = values(unsubscribe_time), synced_at = now()",
+		ctx.AccountId, ctx.Message.FromUserName, ctx.Message.CreateTime)
+	return nil, nil
+}
+
+// OnUserScan 已关注用户扫码，镜像中没有该用户或未关注时补上
+func OnUserScan(ctx *wechat.Context) (wechat.Reply, error) {
+	users, _ := Query("select subscribe from wx_user where acid = ? and openid = ?", ctx.AccountId, ctx.Message.FromUserName)
+	if len(users) == 0 || users[0]["subscribe"].(int64) != 1 {
+		go RefreshUser(ctx.AccountId, ctx.Message.FromUserName)
+	}
+	return nil, nil
+}
+
+// SyncUsers 开始全量同步关注者，同步在后台进行，通过 GetUserSyncStatus 查询进度
+//
+// 返回：
+// 成功返回 { "status":"running" }
+func SyncUsers(wcctx *WechatCtx) ([]byte, error) {
+	accountId := wcctx.AccountId()
+	if lock, _ := RedisClient.Get(USER_SYNC_LOCK_PREFIX + strconv.Itoa(accountId)); lock != "" {
+		return []byte{}, ErrUserSyncRunning
+	}
+
+	go func() {
+		if err := SyncUserMirror(accountId); err != nil {
+			LogError(err)
+		}
+	}()
+	return json.Marshal(map[string]string{"status": "running"})
+}
+
+// GetUserSyncStatus
+//
+// 返回：
+// 成功返回 { "acid":1, "status":"success", "total":23000, "synced":23000, "error":"", "started_at":"2018-06-12 15:06:50", "updated_at":"2018-06-12 15:16:50" }
+func GetUserSyncStatus(wcctx *WechatCtx) ([]byte, error) {
+	status, _ := Query("select * from wx_user_sync where acid = ?", wcctx.AccountId())
+	if len(status) == 0 {
+		return json.Marshal(map[string]string{"status": "never"})
+	}
+	return json.Marshal(status[0])
+}
+
+// QueryUsers 按条件筛选本地镜像中的关注者
+//
+// 参数：
+// tagId			标签id
+// subscribeFrom	关注时间不早于，unix时间戳
+// subscribeTo		关注时间不晚于，unix时间戳
+// subscribeScene	关注的渠道来源，如 ADD_SCENE_QR_CODE
+// qrScene			二维码场景值，数字或字符串
+// unionId			unionid
+// subscribe		关注状态，默认为1，为all时不限
+// page				页码
+// pageSize			每页数量
+//
+// 返回：
+// 成功返回 { "total":120, "users":[ { "openid":"...", "unionid":"...", "nickname":"Band", "subscribe_time":1382694957, "subscribe_scene":"ADD_SCENE_QR_CODE", ... } ] }
+func QueryUsers(wcctx *WechatCtx) ([]byte, error) {
+	where := []string{"u.acid = ?"}
+	args := []interface{}{wcctx.AccountId()}
+
+	switch wcctx.GetFormValue("subscribe") {
+	case "all":
+	case "0":
+		where = append(where, "u.subscribe = 0")
+	default:
+		where = append(where, "u.subscribe = 1")
+	}
+
+	if wcctx.GetFormValue("tagId") != "" {
+		id, err := tagId(wcctx)
+		if err != nil {
+			return []byte{}, err
+		}
+		where = append(where, "exists (select 1 from wx_user_tag t where t.acid = u.acid and t.openid = u.openid and t.tag_id = ?)")
+		args = append(args, id)
+	}
+	if from := wcctx.GetFormValue("subscribeFrom"); from != "" {
+		where = append(where, "u.subscribe_time >= ?")
+		args = append(args, from)
+	}
+	if to := wcctx.GetFormValue("subscribeTo"); to != "" {
+		where = append(where, "u.subscribe_time <= ?")
+		args = append(args, to)
+	}
+	if scene := wcctx.GetFormValue("subscribeScene"); scene != "" {
+		where = append(where, "u.subscribe_scene = ?")
+		args = append(args, scene)
+	}
+	if qrScene := wcctx.GetFormValue("qrScene"); qrScene != "" {
+		if id, err := strconv.ParseInt(qrScene, 10, 64); err == nil {
+			where = append(where, "u.qr_scene = ?")
+			args = append(args, id)
+		} else {
+			where = append(where, "u.qr_scene_str = ?")
+			args = append(args, qrScene)
+		}
+	}
+	if unionId := wcctx.GetFormValue("unionId"); unionId != "" {
+		where = append(where, "u.unionid = ?")
+		args = append(args, unionId)
+	}
+
+	condition := strings.Join(where, " and ")
+	total, _ := Query("select count(*) as total from wx_user u where "+condition, args...)
+
+	page, pageSize := wcctx.Pagination()
+	users, _ := Query("select u.openid, u.unionid, u.subscribe, u.nickname, u.sex, u.language, u.city, u.province, u.country, "+
+		"u.headimgurl, u.subscribe_time, u.unsubscribe_time, u.remark, u.subscribe_scene, u.qr_scene, u.qr_scene_str, u.synced_at "+
+		"from wx_user u where "+condition+" order by u.id desc limit ?, ?", append(args, (page-1)*pageSize, pageSize)...)
+
+	return json.Marshal(map[string]interface{}{"total": total[0]["total"], "users": users})
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chenhg5/go-wechat/sdk"
+)
+
+// 推送消息转发，按 wx_webhook_rule 中各账号的规则把推送消息以json转发到业务服务
+//
+// 规则按 MsgType、Event 与 EventKey 前缀匹配，为空的条件匹配所有消息，
+// reply 为1的规则同步转发并以业务服务的响应作为被动回复，其余规则异步转发，
+// 转发失败的消息记录在 wx_webhook_delivery 中，按指数退避重试。
+// 同时进行的异步转发最多 WEBHOOK_CONCURRENCY 个，已满时直接加入重试队列；同步转发共用回调的处理时限 CALLBACK_HANDLER_TIMEOUT，
+// 超过时限的规则不再等待，加入重试队列
+
+const (
+	WEBHOOK_MAX_RESPONSE_SIZE = 1 << 20 // 业务服务响应的最大长度
+	WEBHOOK_RETRY_LEASE       = 60      // 重试时占用投递记录的秒数，避免多个实例重复投递
+	WEBHOOK_RETRY_BATCH       = 100     // 每次重试的最大投递数
+)
+
+var webhookClient = &http.Client{}
+
+var webhookSemaphore = make(chan struct{}, GetEnvInt("WEBHOOK_CONCURRENCY", 64))
+
+var errWebhookDeferred = errors.New("转发超过回调的处理时限或并发数，加入重试队列")
+
+// InitWebhook 启动转发失败消息的重试
+func InitWebhook() {
+	interval := time.Duration(GetEnvInt("WEBHOOK_RETRY_INTERVAL", 5)) * time.Second
+	go func() {
+		for range time.Tick(interval) {
+			RetryWebhookDeliveries()
+		}
+	}()
+}
+
+// Webhook 将匹配规则的推送消息转发到业务服务，处理函数没有回复时使用业务服务的回复
+func Webhook() wechat.Middleware {
+	return func(next wechat.HandlerFunc) wechat.HandlerFunc {
+		return func(ctx *wechat.Context) (wechat.Reply, error) {
+			deadline := time.Now().Add(time.Duration(GetEnvInt("CALLBACK_HANDLER_TIMEOUT", 4000)) * time.Millisecond)
+			reply, err := next(ctx)
+
+			for _, rule := range MatchWebhookRules(ctx.AccountId, ctx.Message) {
+				if rule["reply"].(int64) != 1 {
+					select {
+					case webhookSemaphore <- struct{}{}:
+						go func(rule map[string]interface{}) {
+							defer func() { <-webhookSemaphore }()
+							ForwardWebhook(ctx, rule, rule["timeout"].(int64))
+						}(rule)
+					default:
+						ForwardWebhook(ctx, rule, 0)
+					}
+					continue
+				}
+
+				timeout := int64(time.Until(deadline) / time.Millisecond)
+				if ruleTimeout := rule["timeout"].(int64); ruleTimeout < timeout {
+					timeout = ruleTimeout
+				}
+				if res := ForwardWebhook(ctx, rule, timeout); res != nil && reply == nil {
+					reply = res
+				}
+			}
+
+			return reply, err
+		}
+	}
+}
+
+// MatchWebhookRules 返回账号下匹配消息的转发规则
+func MatchWebhookRules(accountId int, msg *wechat.MixMessage) []map[string]interface{} {
+	rules, _ := Query("select id, msg_type, event, event_key_prefix, url, secret, reply, timeout from wx_webhook_rule "+
+		"where acid = ? and state = 1 order by id", accountId)
+
+	matched := make([]map[string]interface{}, 0)
+	for _, rule := range rules {
+		if msgType := rule["msg_type"].(string); msgType != "" && msgType != msg.MsgType {
+			continue
+		}
+		if event := rule["event"].(string); event != "" && !strings.EqualFold(event, msg.Event) {
+			continue
+		}
+		if !strings.HasPrefix(msg.EventKey, rule["event_key_prefix"].(string)) {
+			continue
+		}
+		matched = append(matched, rule)
+	}
+	return matched
+}
+
+// ForwardWebhook 转发一条推送消息，timeout 为毫秒，失败时加入重试队列，返回业务服务的被动回复，
+// timeout 不大于0时不投递，直接加入重试队列
+func ForwardWebhook(ctx *wechat.Context, rule map[string]interface{}, timeout int64) (reply wechat.Reply) {
+	defer func() {
+		if r := recover(); r != nil {
+			LogError(fmt.Errorf("webhook panic: %v", r))
+			reply = nil
+		}
+	}()
+
+	deliveryId := NewDeliveryId()
+	payload, err := json.Marshal(wechat.WebhookPayload{
+		DeliveryId: deliveryId,
+		AccountId:  ctx.AccountId,
+		AppId:      GetAccountInfo(ctx.AccountId)["appId"],
+		Message:    ctx.Message,
+	})
+	if err != nil {
+		LogError(err)
+		return nil
+	}
+
+	if timeout <= 0 {
+		Exec("insert into wx_webhook_delivery (delivery_id, acid, rule_id, payload, attempts, last_error, next_retry_at) "+
+			"values (?, ?, ?, ?, 0, ?, now())",
+			deliveryId, ctx.AccountId, rule["id"], string(payload), errWebhookDeferred.Error())
+		return nil
+	}
+
+	resData, err := PostWebhook(rule["url"].(string), rule["secret"].(string), deliveryId, payload, timeout)
+	if err != nil {
+		LogError(err)
+		Exec("insert into wx_webhook_delivery (delivery_id, acid, rule_id, payload, attempts, last_error, next_retry_at) "+
+			"values (?, ?, ?, ?, 1, ?, date_add(now(), interval ? second))",
+			deliveryId, ctx.AccountId, rule["id"], string(payload), truncateError(err), webhookBackoff(1))
+		return nil
+	}
+
+	if rule["reply"].(int64) != 1 {
+		return nil
+	}
+	reply, err = wechat.ParseWebhookReply(resData)
+	if err != nil {
+		LogError(err)
+	}
+	return reply
+}
+
+// PostWebhook 以签名的json请求投递消息，timeout 为毫秒，业务服务返回非2xx状态码时视为失败
+func PostWebhook(url string, secret string, deliveryId string, payload []byte, timeout int64) ([]byte, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(wechat.WEBHOOK_HEADER_DELIVERY, deliveryId)
+	req.Header.Set(wechat.WEBHOOK_HEADER_TIMESTAMP, timestamp)
+	req.Header.Set(wechat.WEBHOOK_HEADER_SIGNATURE, wechat.WebhookSignature(secret, timestamp, payload))
+
+	client := *webhookClient
+	client.Timeout = time.Duration(timeout) * time.Millisecond
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	resData, err := ioutil.ReadAll(io.LimitReader(resp.Body, WEBHOOK_MAX_RESPONSE_SIZE))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errors.New("webhook " + url + " responded " + resp.Status)
+	}
+	return resData, nil
+}
+
+// RetryWebhookDeliveries 重新投递到期的失败消息，规则被删除或停用的消息不再投递
+func RetryWebhookDeliveries() {
+	defer func() {
+		if r := recover(); r != nil {
+			LogError(fmt.Errorf("webhook retry panic: %v", r))
+		}
+	}()
+
+	deliveries, _ := Query("select d.id, d.delivery_id, d.payload, d.attempts, d.next_retry_at, r.url, r.secret, r.timeout, r.state "+
+		"from wx_webhook_delivery d left join wx_webhook_rule r on r.id = d.rule_id "+
+		"where d.status = 'pending' and d.next_retry_at <= now() order by d.next_retry_at limit ?", WEBHOOK_RETRY_BATCH)
+
+	for _, delivery := range deliveries {
+		claimed := Exec("update wx_webhook_delivery set next_retry_at = date_add(now(), interval ? second) "+
+			"where id = ? and status = 'pending' and next_retry_at = ?",
+			WEBHOOK_RETRY_LEASE, delivery["id"], delivery["next_retry_at"])
+		if n, _ := claimed.RowsAffected(); n != 1 {
+			continue
+		}
+
+		if state, _ := delivery["state"].(int64); state != 1 {
+			Exec("update wx_webhook_delivery set status = 'failed', last_error = ? where id = ?", "规则已删除或停用", delivery["id"])
+			continue
+		}
+
+		attempts := delivery["attempts"].(int64) + 1
+		_, err := PostWebhook(delivery["url"].(string), delivery["secret"].(string), delivery["delivery_id"].(string),
+			[]byte(delivery["payload"].(string)), delivery["timeout"].(int64))
+
+		switch {
+		case err == nil:
+			Exec("update wx_webhook_delivery set status = 'success', attempts = ?, last_error = '' where id = ?",
+				attempts, delivery["id"])
+		case attempts >= int64(GetEnvInt("WEBHOOK_MAX_ATTEMPTS", 8)):
+			Exec("update wx_webhook_delivery set status = 'failed', attempts = ?, last_error = ? where id = ?",
+				attempts, truncateError(err), delivery["id"])
+		default:
+			Exec("update wx_webhook_delivery set attempts = ?, last_error = ?, next_retry_at = date_add(now(), interval ? second) where id = ?",
+				attempts, truncateError(err), webhookBackoff(attempts), delivery["id"])
+		}
+	}
+}
+
+// webhookBackoff 第 attempts 次失败后的重试间隔(秒)，从 WEBHOOK_RETRY_BASE 开始翻倍，最长一小时
+func webhookBackoff(attempts int64) int64 {
+	backoff := int64(GetEnvInt("WEBHOOK_RETRY_BASE", 10))
+	for i := int64(1); i < attempts && backoff < 3600; i++ {
+		backoff *= 2
+	}
+	if backoff > 3600 {
+		backoff = 3600
+	}
+	return backoff
+}
+
+// NewDeliveryId 生成随机的投递id
+func NewDeliveryId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func truncateError(err error) string {
+	msg := err.Error()
+	if len(msg) > 512 {
+		msg = msg[:512]
+	}
+	return msg
+}
+
+// AddWebhookRule
+//
+// 参数：
+// msgType			匹配的消息类型，为空时匹配所有类型
+// event			匹配的事件类型，为空时匹配所有事件
+// eventKeyPrefix	匹配的事件KEY值前缀
+// url				业务服务地址
+// secret			签名密钥，为空时自动生成
+// reply			为1时同步转发，并以业务服务的响应作为被动回复
+// timeout			转发超时时间(毫秒)，默认3000
+//
+// 返回：
+// 成功返回 { "id":1, "secret":"SECRET" }
+func AddWebhookRule(wcctx *WechatCtx) ([]byte, error) {
+	url := wcctx.GetFormValue("url")
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return []byte{}, errors.New("错误的转发地址")
+	}
+
+	secret := wcctx.GetFormValue("secret")
+	if secret == "" {
+		secret = NewDeliveryId()
+	}
+	reply := 0
+	if wcctx.GetFormValue("reply") == "1" {
+		reply = 1
+	}
+	timeout, err := strconv.Atoi(wcctx.GetFormValue("timeout"))
+	if err != nil || timeout <= 0 {
+		timeout = 3000
+	}
+
+	rs := Exec("insert into wx_webhook_rule (acid, msg_type, event, event_key_prefix, url, secret, reply, timeout) values (?, ?, ?, ?, ?, ?, ?, ?)",
+		wcctx.AccountId(), wcctx.GetFormValue("msgType"), wcctx.GetFormValue("event"), wcctx.GetFormValue("eventKeyPrefix"),
+		url, secret, reply, timeout)
+	id, _ := rs.LastInsertId()
+
+	return json.Marshal(map[string]interface{}{"id": id, "secret": secret})
+}
+
+// DelWebhookRule
+//
+// 参数：
+// id	规则id
+//
+// 返回：
+// 成功返回 { "id":1 }
+func DelWebhookRule(wcctx *WechatCtx) ([]byte, error) {
+	id, err := strconv.ParseInt(wcctx.GetFormValue("id"), 10, 64)
+	if err != nil {
+		return []byte{}, errors.New("错误的规则id")
+	}
+	Exec("delete from wx_webhook_rule where acid = ? and id = ?", wcctx.AccountId(), id)
+	return json.Marshal(map[string]int64{"id": id})
+}
+
+// GetWebhookRules
+//
+// 返回：
+// 成功返回 [ { "id":1, "msg_type":"event", "event":"CLICK", "event_key_prefix":"order_", "url":"https://...", "reply":0, "timeout":3000, "state":1 } ]
+func GetWebhookRules(wcctx *WechatCtx) ([]byte, error) {
+	rules, _ := Query("select id, msg_type, event, event_key_prefix, url, reply, timeout, state, created_at from wx_webhook_rule where acid = ? order by id",
+		wcctx.AccountId())
+	return json.Marshal(rules)
+}
+
+// GetWebhookDeliveries
+//
+// 参数：
+// status	pending 等待重试 success 重试成功 failed 放弃重试，为空时返回全部
+// page		页码
+// pageSize	每页数量
+//
+// 返回：
+// 成功返回 [ { "delivery_id":"...", "rule_id":1, "attempts":3, "status":"pending", "last_error":"...", "next_retry_at":"...", ... } ]
+func GetWebhookDeliveries(wcctx *WechatCtx) ([]byte, error) {
+	page, pageSize := wcctx.Pagination()
+	if status := wcctx.GetFormValue("status"); status != "" {
+		deliveries, _ := Query("select * from wx_webhook_delivery where acid = ? and status = ? order by id desc limit ?, ?",
+			wcctx.AccountId(), status, (page-1)*pageSize, pageSize)
+		return json.Marshal(deliveries)
+	}
+
+	deliveries, _ := Query("select * from wx_webhook_delivery where acid = ? order by id desc limit ?, ?",
+		wcctx.AccountId(), (page-1)*pageSize, pageSize)
+	return json.Marshal(deliveries)
+}
+
+// RedeliverWebhook 将放弃重试的消息重新加入重试队列
+//
+// 参数：
+// deliveryId	投递id
+//
+// 返回：
+// 成功返回 { "delivery_id":"..." }
+func RedeliverWebhook(wcctx *WechatCtx) ([]byte, error) {
+	deliveryId := wcctx.GetFormValue("deliveryId")
+	rs := Exec("update wx_webhook_delivery set status = 'pending', attempts = 0, next_retry_at = now() where acid = ? and delivery_id = ? and status = 'failed'",
+		wcctx.AccountId(), deliveryId)
+	if n, _ := rs.RowsAffected(); n != 1 {
+		return []byte{}, errors.New("错误的投递id")
+	}
+	return json.Marshal(map[string]string{"delivery_id": deliveryId})
+}
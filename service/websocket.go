@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// 只用于服务端推送的最小 WebSocket 实现(RFC 6455)，
+// 服务端只发送文本帧，客户端发来的数据帧被忽略，支持 ping/pong 与关闭握手
+
+const (
+	WEBSOCKET_GUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	WEBSOCKET_OP_TEXT  = 0x1
+	WEBSOCKET_OP_CLOSE = 0x8
+	WEBSOCKET_OP_PING  = 0x9
+	WEBSOCKET_OP_PONG  = 0xA
+
+	WEBSOCKET_MAX_CONTROL_SIZE = 125
+	WEBSOCKET_WRITE_TIMEOUT    = 10 * time.Second
+)
+
+type WebSocketConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	control chan []byte // 由读循环交给写循环发送的控制帧
+	closed  chan struct{}
+}
+
+// IsWebSocketUpgrade 是否为 WebSocket 握手请求
+func IsWebSocketUpgrade(ctx *fasthttp.RequestCtx) bool {
+	return ctx.IsGet() &&
+		strings.EqualFold(string(ctx.Request.Header.Peek("Upgrade")), "websocket") &&
+		len(ctx.Request.Header.Peek("Sec-WebSocket-Key")) > 0
+}
+
+// UpgradeWebSocket 回复握手并接管连接，handler 返回后连接被关闭
+func UpgradeWebSocket(ctx *fasthttp.RequestCtx, handler func(ws *WebSocketConn)) {
+	key := string(ctx.Request.Header.Peek("Sec-WebSocket-Key"))
+	sum := sha1.Sum([]byte(key + WEBSOCKET_GUID))
+
+	ctx.SetStatusCode(fasthttp.StatusSwitchingProtocols)
+	ctx.Response.Header.Set("Upgrade", "websocket")
+	ctx.Response.Header.Set("Connection", "Upgrade")
+	ctx.Response.Header.Set("Sec-WebSocket-Accept", base64.StdEncoding.EncodeToString(sum[:]))
+
+	ctx.Hijack(func(c net.Conn) {
+		handler(&WebSocketConn{
+			conn:    c,
+			reader:  bufio.NewReader(c),
+			control: make(chan []byte, 1),
+			closed:  make(chan struct{}),
+		})
+	})
+}
+
+// Serve 将 ch 中的消息以文本帧发送，客户端断开或 done 关闭时返回
+func (ws *WebSocketConn) Serve(ch <-chan []byte, done <-chan struct{}, heartbeat time.Duration) {
+	go ws.readLoop()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		select {
+		case data := <-ch:
+			err = ws.writeFrame(WEBSOCKET_OP_TEXT, data)
+		case frame := <-ws.control:
+			err = ws.writeFrame(frame[0], frame[1:])
+		case <-ticker.C:
+			err = ws.writeFrame(WEBSOCKET_OP_PING, nil)
+		case <-ws.closed:
+			ws.writeFrame(WEBSOCKET_OP_CLOSE, nil)
+			return
+		case <-done:
+			ws.writeFrame(WEBSOCKET_OP_CLOSE, nil)
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readLoop 读取客户端的帧，回复 ping，收到关闭帧或读失败时关闭 closed
+func (ws *WebSocketConn) readLoop() {
+	defer close(ws.closed)
+
+	for {
+		opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return
+		}
+
+		switch opcode {
+		case WEBSOCKET_OP_CLOSE:
+			return
+		case WEBSOCKET_OP_PING:
+			select {
+			case ws.control <- append([]byte{WEBSOCKET_OP_PONG}, payload...):
+			default:
+			}
+		}
+	}
+}
+
+func (ws *WebSocketConn) readFrame() (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.reader, header[:]); err != nil {
+		return 0, nil, err
+	}
+
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	// 推送连接不需要客户端的数据，过长的数据帧直接丢弃
+	if length > WEBSOCKET_MAX_CONTROL_SIZE {
+		_, err := io.CopyN(ioutil.Discard, ws.reader, int64(length))
+		return opcode, nil, err
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return opcode, payload, nil
+}
+
+func (ws *WebSocketConn) writeFrame(opcode byte, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|opcode)
+
+	switch length := len(payload); {
+	case length <= WEBSOCKET_MAX_CONTROL_SIZE:
+		frame = append(frame, byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, 126, byte(length>>8), byte(length))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(length))
+		frame = append(frame, 127)
+		frame = append(frame, ext[:]...)
+	}
+	frame = append(frame, payload...)
+
+	ws.conn.SetWriteDeadline(time.Now().Add(WEBSOCKET_WRITE_TIMEOUT))
+	_, err := ws.conn.Write(frame)
+	return err
+}
@@ -9,7 +9,10 @@ import (
 	"compress/gzip"
 	"github.com/json-iterator/go"
 	"time"
+	"strconv"
+	"sync"
 	"github.com/xlstudio/wxbizdatacrypt"
+	"github.com/chenhg5/go-wechat/sdk"
 )
 
 // 内部api
@@ -69,6 +72,9 @@ const (
 // 失败返回 {"errcode":40013,"errmsg":"invalid appid"}
 func GetNewAccessToken(wcctx *WechatCtx) ([]byte, error) {
 
+	accountTokenLock.Lock()
+	defer accountTokenLock.Unlock()
+
 	resData, err := MakeGetReq(GET_ACCESS_TOKEN_API, map[string]string{
 		"grant_type": "client_credential",
 		"appid":      wcctx.Account["appId"],
@@ -80,8 +86,13 @@ func GetNewAccessToken(wcctx *WechatCtx) ([]byte, error) {
 
 	var dataMap map[string]interface{}
 	json.Unmarshal(resData, &dataMap)
-	if dataMap["errcode"] == "" {
-		RedisClient.Set("go-wechat:access_token", dataMap["access_token"].(string), time.Minute*110)
+	// 新的 access_token 会使之前获取的失效，账号自己的缓存与全局缓存同时更新，全局缓存记录为该账号所有
+	if token, ok := dataMap["access_token"].(string); ok {
+		RedisClient.Set(GLOBAL_TOKEN_KEY, token, time.Minute*110)
+		if wcctx.Account["accountId"] != "" {
+			RedisClient.Set(GLOBAL_TOKEN_OWNER_KEY, wcctx.Account["accountId"], 0)
+			RedisClient.Set(ACCOUNT_TOKEN_PREFIX+wcctx.Account["accountId"], token, time.Minute*110)
+		}
 	}
 
 	return resData, nil
@@ -109,6 +120,7 @@ func GetWebOauthAccessToken(wcctx *WechatCtx) ([]byte, error) {
 	if err != nil {
 		return []byte{}, err
 	}
+	RecordIdentityFromResult(wcctx.AccountId(), resData, "oauth")
 	return resData, nil
 }
 
@@ -164,6 +176,7 @@ func GetWebOauthUserinfo(wcctx *WechatCtx) ([]byte, error) {
 	if err != nil {
 		return []byte{}, err
 	}
+	RecordIdentityFromResult(wcctx.AccountId(), resData, "oauth")
 	return resData, nil
 }
 
@@ -251,6 +264,7 @@ func WxappOauth(wcctx *WechatCtx) ([]byte, error) {
 		return []byte{}, err
 	}
 
+	RecordIdentityFromResult(wcctx.AccountId(), resData, "wxapp")
 	return resData, nil
 }
 
@@ -392,11 +406,87 @@ func PayUnifiedOrder(wcctx *WechatCtx) ([]byte, error) {
 // sdk内部Api
 // ---------------------------
 
+// GetToken 返回全局的 access_token，全局缓存属于某个账号时与 GetAccountToken 使用同一个缓存，过期后一起刷新
 func GetToken() string {
-	token, _ := RedisClient.Get("go-wechat:access_token")
+	if owner, _ := RedisClient.Get(GLOBAL_TOKEN_OWNER_KEY); owner != "" {
+		if accountId, err := strconv.Atoi(owner); err == nil {
+			return GetAccountToken(accountId)
+		}
+	}
+	token, _ := RedisClient.Get(GLOBAL_TOKEN_KEY)
 	return token
 }
 
+const (
+	GLOBAL_TOKEN_KEY       = "go-wechat:access_token"
+	GLOBAL_TOKEN_OWNER_KEY = "go-wechat:access_token_owner" // 全局 access_token 所属的账号id
+	ACCOUNT_TOKEN_PREFIX   = "go-wechat:access_token:"
+)
+
+var accountTokenLock sync.Mutex
+
+// GetAccountToken 返回账号自己的 access_token，缓存在 go-wechat:access_token:{accountId}，
+// 过期后使用账号的 appId 与 appSecret 重新获取，账号不存在或获取失败时返回空字符串。
+// 每个账号只从这里获取 access_token，重新获取会使之前的失效，全局缓存属于该账号时一起更新
+func GetAccountToken(accountId int) string {
+	key := ACCOUNT_TOKEN_PREFIX + strconv.Itoa(accountId)
+	if token, _ := RedisClient.Get(key); token != "" {
+		return token
+	}
+
+	accountTokenLock.Lock()
+	defer accountTokenLock.Unlock()
+	if token, _ := RedisClient.Get(key); token != "" {
+		return token
+	}
+
+	account, ok := Account[accountId]
+	if !ok {
+		LogError(errors.New("账号不存在: " + strconv.Itoa(accountId)))
+		return ""
+	}
+	resData, err := MakeGetReq(GET_ACCESS_TOKEN_API, map[string]string{
+		"grant_type": "client_credential",
+		"appid":      account["appId"],
+		"secret":     account["appSecret"],
+	})
+	if err != nil {
+		LogError(err)
+		return ""
+	}
+	var result struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := wechat.ParseResult(resData, &result); err != nil {
+		LogError(err)
+		return ""
+	}
+	RedisClient.Set(key, result.AccessToken, time.Minute*110)
+	if owner, _ := RedisClient.Get(GLOBAL_TOKEN_OWNER_KEY); owner == strconv.Itoa(accountId) {
+		RedisClient.Set(GLOBAL_TOKEN_KEY, result.AccessToken, time.Minute*110)
+	}
+	return result.AccessToken
+}
+
+// NoAccountTokenError 账号没有可用的 access_token 时返回的错误，本地镜像的同步不能退回使用全局的 access_token
+func NoAccountTokenError(accountId int) error {
+	return errors.New("账号 " + strconv.Itoa(accountId) + " 没有可用的 access_token")
+}
+
+// Result 序列化sdk接口的返回值，微信返回的错误码与菜单校验错误原样透传给调用方
+func Result(v interface{}, err error) ([]byte, error) {
+	if commonError, ok := err.(*wechat.CommonError); ok {
+		return json.Marshal(commonError)
+	}
+	if menuError, ok := err.(*wechat.MenuError); ok {
+		return json.Marshal(menuError)
+	}
+	if err != nil {
+		return []byte{}, err
+	}
+	return json.Marshal(v)
+}
+
 func MakeGetReq(url string, data map[string]string) ([]byte, error) {
 
 	var count = 0
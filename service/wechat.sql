@@ -0,0 +1,334 @@
+-- go-wechat 数据表
+
+CREATE TABLE IF NOT EXISTS `wx_official_account` (
+  `acid` int(11) NOT NULL AUTO_INCREMENT,
+  `app_id` varchar(64) NOT NULL DEFAULT '',
+  `app_secret` varchar(64) NOT NULL DEFAULT '',
+  `token` varchar(32) NOT NULL DEFAULT '' COMMENT '服务器配置中的令牌(Token)',
+  `encoding_aes_key` varchar(43) NOT NULL DEFAULT '' COMMENT '服务器配置中的消息加解密密钥(EncodingAESKey)',
+  `encrypt_mode` tinyint(4) NOT NULL DEFAULT '0' COMMENT '消息加解密方式 0 明文模式 1 兼容模式 2 安全模式',
+  `state` tinyint(4) NOT NULL DEFAULT '1' COMMENT '1 启用 0 停用',
+  PRIMARY KEY (`acid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='公众号/小程序账号';
+
+-- 旧版本升级
+-- ALTER TABLE `wx_official_account` ADD COLUMN `token` varchar(32) NOT NULL DEFAULT '' COMMENT '服务器配置中的令牌(Token)' AFTER `app_secret`;
+-- ALTER TABLE `wx_official_account` ADD COLUMN `encoding_aes_key` varchar(43) NOT NULL DEFAULT '' AFTER `token`, ADD COLUMN `encrypt_mode` tinyint(4) NOT NULL DEFAULT '0' AFTER `encoding_aes_key`;
+
+-- 群发任务
+CREATE TABLE IF NOT EXISTS `wx_mass_job` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `acid` int(11) NOT NULL,
+  `msg_id` bigint(20) NOT NULL,
+  `msg_data_id` bigint(20) NOT NULL DEFAULT '0',
+  `msg_type` varchar(16) NOT NULL DEFAULT '',
+  `target` varchar(16) NOT NULL DEFAULT '' COMMENT 'all 全部用户 tag 标签 openid 用户列表',
+  `tag_id` int(11) NOT NULL DEFAULT '0',
+  `status` varchar(64) NOT NULL DEFAULT 'SENDING' COMMENT 'SENDING 或 MASSSENDJOBFINISH 事件中的 Status',
+  `total_count` int(11) NOT NULL DEFAULT '0',
+  `filter_count` int(11) NOT NULL DEFAULT '0',
+  `sent_count` int(11) NOT NULL DEFAULT '0',
+  `error_count` int(11) NOT NULL DEFAULT '0',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `acid_msg_id` (`acid`,`msg_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='群发任务';
+
+-- 订阅通知授权状态
+CREATE TABLE IF NOT EXISTS `wx_subscribe_status` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `acid` int(11) NOT NULL,
+  `openid` varchar(64) NOT NULL,
+  `template_id` varchar(128) NOT NULL,
+  `status` varchar(16) NOT NULL DEFAULT '' COMMENT 'accept 接受 reject 拒绝 used 一次性订阅已下发',
+  `scene` varchar(16) NOT NULL DEFAULT '' COMMENT '弹窗场景或一次性订阅场景值',
+  `source` varchar(16) NOT NULL DEFAULT '' COMMENT 'popup change once bizsend',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `acid_openid_template` (`acid`,`openid`,`template_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='订阅通知授权状态';
+
+-- 推送消息转发规则
+CREATE TABLE IF NOT EXISTS `wx_webhook_rule` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `acid` int(11) NOT NULL,
+  `msg_type` varchar(32) NOT NULL DEFAULT '' COMMENT '匹配的消息类型，为空时匹配所有类型',
+  `event` varchar(64) NOT NULL DEFAULT '' COMMENT '匹配的事件类型，为空时匹配所有事件',
+  `event_key_prefix` varchar(128) NOT NULL DEFAULT '' COMMENT '匹配的事件KEY值前缀',
+  `url` varchar(512) NOT NULL,
+  `secret` varchar(64) NOT NULL DEFAULT '' COMMENT '签名密钥',
+  `reply` tinyint(4) NOT NULL DEFAULT '0' COMMENT '1 同步转发并以响应作为被动回复 0 异步转发',
+  `timeout` int(11) NOT NULL DEFAULT '3000' COMMENT '转发超时时间(毫秒)',
+  `state` tinyint(4) NOT NULL DEFAULT '1' COMMENT '1 启用 0 停用',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `acid` (`acid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='推送消息转发规则';
+
+-- 推送消息转发重试队列
+CREATE TABLE IF NOT EXISTS `wx_webhook_delivery` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `delivery_id` varchar(32) NOT NULL,
+  `acid` int(11) NOT NULL,
+  `rule_id` int(11) NOT NULL,
+  `payload` mediumtext NOT NULL,
+  `attempts` int(11) NOT NULL DEFAULT '0' COMMENT '已投递次数',
+  `status` varchar(16) NOT NULL DEFAULT 'pending' COMMENT 'pending 等待重试 success 重试成功 failed 放弃重试',
+  `last_error` varchar(512) NOT NULL DEFAULT '',
+  `next_retry_at` datetime NOT NULL,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `delivery_id` (`delivery_id`),
+  KEY `status_next_retry_at` (`status`,`next_retry_at`),
+  KEY `acid` (`acid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='推送消息转发重试队列';
+
+-- 菜单定义
+CREATE TABLE IF NOT EXISTS `wx_menu_definition` (
+  `acid` int(11) NOT NULL,
+  `definition` mediumtext NOT NULL COMMENT 'json 或 yaml 格式的菜单定义',
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`acid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='菜单定义';
+
+-- 菜单同步版本
+CREATE TABLE IF NOT EXISTS `wx_menu_version` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `acid` int(11) NOT NULL,
+  `menu` mediumtext NOT NULL COMMENT '同步后的菜单，failed 版本为失败后实际的菜单',
+  `diff` text NOT NULL COMMENT '同步的差异',
+  `source` varchar(128) NOT NULL DEFAULT '' COMMENT 'api、cli:文件名、rollback:版本id 或 snapshot(同步前的菜单)',
+  `status` varchar(16) NOT NULL DEFAULT 'success' COMMENT 'success 成功 failed 中途失败',
+  `error` varchar(512) NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `acid` (`acid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='菜单同步版本';
+
+-- 关注者本地镜像
+CREATE TABLE IF NOT EXISTS `wx_user` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `acid` int(11) NOT NULL,
+  `openid` varchar(64) NOT NULL,
+  `unionid` varchar(64) NOT NULL DEFAULT '',
+  `subscribe` tinyint(4) NOT NULL DEFAULT '1' COMMENT '1 已关注 0 未关注',
+  `nickname` varchar(128) NOT NULL DEFAULT '',
+  `sex` tinyint(4) NOT NULL DEFAULT '0',
+  `language` varchar(16) NOT NULL DEFAULT '',
+  `city` varchar(64) NOT NULL DEFAULT '',
+  `province` varchar(64) NOT NULL DEFAULT '',
+  `country` varchar(64) NOT NULL DEFAULT '',
+  `headimgurl` varchar(512) NOT NULL DEFAULT '',
+  `subscribe_time` int(11) NOT NULL DEFAULT '0' COMMENT '关注时间戳',
+  `unsubscribe_time` int(11) NOT NULL DEFAULT '0' COMMENT '取消关注时间戳',
+  `remark` varchar(64) NOT NULL DEFAULT '',
+  `subscribe_scene` varchar(64) NOT NULL DEFAULT '' COMMENT '关注的渠道来源',
+  `qr_scene` int(11) NOT NULL DEFAULT '0' COMMENT '二维码扫码场景',
+  `qr_scene_str` varchar(64) NOT NULL DEFAULT '' COMMENT '二维码扫码场景描述',
+  `synced_at` datetime NOT NULL COMMENT '最后一次同步时间',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `acid_openid` (`acid`,`openid`),
+  KEY `acid_unionid` (`acid`,`unionid`),
+  KEY `acid_subscribe_time` (`acid`,`subscribe_time`),
+  KEY `acid_subscribe_scene` (`acid`,`subscribe_scene`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='关注者本地镜像';
+
+-- 关注者标签
+CREATE TABLE IF NOT EXISTS `wx_user_tag` (
+  `acid` int(11) NOT NULL,
+  `openid` varchar(64) NOT NULL,
+  `tag_id` int(11) NOT NULL,
+  PRIMARY KEY (`acid`,`tag_id`,`openid`),
+  KEY `acid_openid` (`acid`,`openid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='关注者标签';
+
+-- 关注者同步进度
+CREATE TABLE IF NOT EXISTS `wx_user_sync` (
+  `acid` int(11) NOT NULL,
+  `status` varchar(16) NOT NULL DEFAULT 'running' COMMENT 'running 同步中 success 成功 failed 失败',
+  `total` int(11) NOT NULL DEFAULT '0' COMMENT '关注者总数',
+  `synced` int(11) NOT NULL DEFAULT '0' COMMENT '已同步数',
+  `error` varchar(512) NOT NULL DEFAULT '',
+  `started_at` datetime NOT NULL,
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`acid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='关注者同步进度';
+
+-- 跨账号身份
+CREATE TABLE IF NOT EXISTS `wx_identity` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `acid` int(11) NOT NULL,
+  `openid` varchar(64) NOT NULL,
+  `unionid` varchar(64) NOT NULL,
+  `source` varchar(16) NOT NULL DEFAULT '' COMMENT 'wxapp 小程序登录 oauth 网页授权 user 用户信息',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `acid_openid` (`acid`,`openid`),
+  KEY `unionid` (`unionid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='跨账号身份';
+
+-- 永久素材本地镜像
+CREATE TABLE IF NOT EXISTS `wx_material` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `acid` int(11) NOT NULL,
+  `media_id` varchar(128) NOT NULL,
+  `type` varchar(16) NOT NULL COMMENT 'image video voice news',
+  `name` varchar(255) NOT NULL DEFAULT '' COMMENT '文件名',
+  `title` varchar(1024) NOT NULL DEFAULT '' COMMENT '图文素材的标题，多篇换行隔开',
+  `digest` text COMMENT '图文素材的摘要，多篇换行隔开',
+  `url` varchar(512) NOT NULL DEFAULT '',
+  `content` mediumtext COMMENT '图文素材的 news_item json',
+  `update_time` int(11) NOT NULL DEFAULT '0' COMMENT '素材最后更新时间戳',
+  `local_path` varchar(512) NOT NULL DEFAULT '' COMMENT '下载到本地的文件路径',
+  `deleted` tinyint(4) NOT NULL DEFAULT '0' COMMENT '1 已在公众平台删除',
+  `synced_at` datetime NOT NULL COMMENT '最后一次同步时间',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `acid_media_id` (`acid`,`media_id`),
+  KEY `acid_type_update_time` (`acid`,`type`,`update_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='永久素材本地镜像';
+
+-- 永久素材同步进度
+CREATE TABLE IF NOT EXISTS `wx_material_sync` (
+  `acid` int(11) NOT NULL,
+  `status` varchar(16) NOT NULL DEFAULT 'running' COMMENT 'running 同步中 success 成功 failed 失败',
+  `total` int(11) NOT NULL DEFAULT '0' COMMENT '已同步数',
+  `added` int(11) NOT NULL DEFAULT '0' COMMENT '新增数',
+  `deleted` int(11) NOT NULL DEFAULT '0' COMMENT '删除数',
+  `error` varchar(512) NOT NULL DEFAULT '',
+  `started_at` datetime NOT NULL,
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`acid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='永久素材同步进度';
+
+-- 发布任务
+CREATE TABLE IF NOT EXISTS `wx_publish_job` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `acid` int(11) NOT NULL,
+  `publish_id` varchar(64) NOT NULL,
+  `media_id` varchar(128) NOT NULL DEFAULT '' COMMENT '发布的草稿，在公众平台发布的任务为空',
+  `msg_data_id` bigint(20) NOT NULL DEFAULT '0',
+  `publish_status` int(11) NOT NULL DEFAULT '1' COMMENT '0 成功 1 发布中 2 原创失败 3 常规失败 4 审核不通过 5 已删除 6 已封禁',
+  `article_id` varchar(128) NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `acid_publish_id` (`acid`,`publish_id`),
+  KEY `acid_article_id` (`acid`,`article_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='发布任务';
+
+-- 发布的文章
+CREATE TABLE IF NOT EXISTS `wx_publish_article` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `acid` int(11) NOT NULL,
+  `publish_id` varchar(64) NOT NULL,
+  `article_id` varchar(128) NOT NULL DEFAULT '',
+  `idx` int(11) NOT NULL COMMENT '文章在图文中的位置，从1开始',
+  `status` varchar(16) NOT NULL COMMENT 'success 成功 failed 失败 deleted 已删除 banned 已封禁',
+  `article_url` varchar(512) NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `acid_publish_id_idx` (`acid`,`publish_id`,`idx`),
+  KEY `acid_article_id` (`acid`,`article_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='发布的文章';
+
+-- 二维码推广活动
+CREATE TABLE IF NOT EXISTS `wx_qrcode_campaign` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `acid` int(11) NOT NULL,
+  `name` varchar(64) NOT NULL,
+  `description` varchar(512) NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `acid` (`acid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='二维码推广活动';
+
+-- 带参数二维码
+CREATE TABLE IF NOT EXISTS `wx_qrcode` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `acid` int(11) NOT NULL,
+  `campaign_id` int(11) NOT NULL DEFAULT '0',
+  `scene` varchar(64) NOT NULL COMMENT '整型或字符串场景值',
+  `action` varchar(32) NOT NULL COMMENT 'QR_SCENE QR_STR_SCENE QR_LIMIT_SCENE QR_LIMIT_STR_SCENE',
+  `ticket` varchar(255) NOT NULL,
+  `url` varchar(255) NOT NULL DEFAULT '',
+  `expire_at` datetime DEFAULT NULL COMMENT '永久二维码为空',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `acid_scene` (`acid`,`scene`),
+  KEY `acid_campaign_id` (`acid`,`campaign_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='带参数二维码';
+
+-- 二维码扫码记录
+CREATE TABLE IF NOT EXISTS `wx_qrcode_scan` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `acid` int(11) NOT NULL,
+  `campaign_id` int(11) NOT NULL DEFAULT '0' COMMENT '不是本服务生成的二维码为0',
+  `scene` varchar(64) NOT NULL,
+  `openid` varchar(64) NOT NULL,
+  `event` varchar(16) NOT NULL COMMENT 'scan 已关注扫码 subscribe 扫码关注',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `acid_campaign_id_created_at` (`acid`,`campaign_id`,`created_at`),
+  KEY `acid_scene` (`acid`,`scene`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='二维码扫码记录';
+
+-- 关键词自动回复规则
+CREATE TABLE IF NOT EXISTS `wx_autoreply_rule` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `acid` int(11) NOT NULL,
+  `name` varchar(64) NOT NULL DEFAULT '',
+  `match_type` varchar(16) NOT NULL COMMENT 'exact 完全匹配 contains 包含 regex 正则 subscribe 关注 click 菜单点击 default 默认回复',
+  `keyword` varchar(255) NOT NULL DEFAULT '' COMMENT '关键词、正则表达式或菜单的 EventKey',
+  `priority` int(11) NOT NULL DEFAULT '0' COMMENT '越大越先匹配',
+  `begin_at` datetime DEFAULT NULL COMMENT '开始时间，为空时不限',
+  `end_at` datetime DEFAULT NULL COMMENT '结束时间，为空时不限',
+  `day_start` varchar(5) NOT NULL DEFAULT '' COMMENT '每天开始的时刻 HH:MM',
+  `day_end` varchar(5) NOT NULL DEFAULT '' COMMENT '每天结束的时刻 HH:MM，小于 day_start 时跨零点',
+  `reply_mode` varchar(16) NOT NULL DEFAULT 'first' COMMENT 'first 回复第一条 random 随机回复一条',
+  `replies` text NOT NULL COMMENT '客服消息格式的回复数组',
+  `state` tinyint(4) NOT NULL DEFAULT '1' COMMENT '1 启用 0 停用',
+  `source` varchar(16) NOT NULL DEFAULT 'local' COMMENT 'local 本地添加 import 从官网导入',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `acid_priority` (`acid`,`priority`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='关键词自动回复规则';
+
+-- 推送消息归档，按月分区，p_max 由服务拆分出各月的分区
+CREATE TABLE IF NOT EXISTS `wx_message` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `acid` int(11) NOT NULL,
+  `msg_id` bigint(20) NOT NULL DEFAULT '0' COMMENT '普通消息的 MsgId，事件为0',
+  `openid` varchar(64) NOT NULL,
+  `msg_type` varchar(32) NOT NULL,
+  `event` varchar(64) NOT NULL DEFAULT '',
+  `event_key` varchar(255) NOT NULL DEFAULT '',
+  `content` text NOT NULL COMMENT '文本内容、语音识别结果、链接、位置或 EventKey，用于搜索',
+  `media_id` varchar(128) NOT NULL DEFAULT '',
+  `media_status` varchar(16) NOT NULL DEFAULT '' COMMENT 'pending 等待下载 success 已下载 failed 下载失败',
+  `media_path` varchar(255) NOT NULL DEFAULT '' COMMENT '媒体文件的本地路径',
+  `media_attempts` int(11) NOT NULL DEFAULT '0',
+  `raw` mediumtext NOT NULL COMMENT '明文xml',
+  `create_time` int(11) NOT NULL DEFAULT '0' COMMENT '消息的 CreateTime',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`,`created_at`),
+  KEY `acid_created_at` (`acid`,`created_at`),
+  KEY `acid_openid_created_at` (`acid`,`openid`,`created_at`),
+  KEY `acid_msg_type_created_at` (`acid`,`msg_type`,`created_at`),
+  KEY `media_status_created_at` (`media_status`,`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='推送消息归档'
+PARTITION BY RANGE (TO_DAYS(`created_at`)) (
+  PARTITION p_max VALUES LESS THAN MAXVALUE
+);